@@ -0,0 +1,64 @@
+package main
+
+import (
+	"strings"
+)
+
+// breadcrumbSeparator 面包屑分隔符
+const breadcrumbSeparator = " > "
+
+// FormatBreadcrumb 将根节点在前的标题列表格式化为面包屑
+func FormatBreadcrumb(titles []string) string {
+	return strings.Join(titles, breadcrumbSeparator)
+}
+
+// WithBreadcrumbs 为搜索结果批量附加面包屑（一次递归查询）
+func WithBreadcrumbs(repo *DocumentRepository, docID int64, nodes []*PageIndexNode) ([]*NodeHit, error) {
+	ids := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		ids = append(ids, node.NodeID)
+	}
+
+	breadcrumbs, err := repo.FindBreadcrumbs(docID, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	hits := make([]*NodeHit, 0, len(nodes))
+	for _, node := range nodes {
+		hits = append(hits, &NodeHit{
+			PageIndexNode: node,
+			Breadcrumb:    FormatBreadcrumb(breadcrumbs[node.NodeID]),
+		})
+	}
+	return hits, nil
+}
+
+// BreadcrumbsAcrossDocs 为跨文档的节点批量生成面包屑（每个文档一次递归查询），按节点主键返回
+func BreadcrumbsAcrossDocs(repo *DocumentRepository, nodes []*PageIndexNode) (map[int64]string, error) {
+	byDoc := make(map[int64][]string)
+	for _, node := range nodes {
+		if node.DocID == nil {
+			continue
+		}
+		byDoc[*node.DocID] = append(byDoc[*node.DocID], node.NodeID)
+	}
+
+	titles := make(map[int64]map[string][]string, len(byDoc))
+	for docID, ids := range byDoc {
+		breadcrumbs, err := repo.FindBreadcrumbs(docID, ids)
+		if err != nil {
+			return nil, err
+		}
+		titles[docID] = breadcrumbs
+	}
+
+	result := make(map[int64]string, len(nodes))
+	for _, node := range nodes {
+		if node.DocID == nil {
+			continue
+		}
+		result[node.ID] = FormatBreadcrumb(titles[*node.DocID][node.NodeID])
+	}
+	return result, nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+)
+
+const usage = `用法:
+  pageindex-app                                 启动 HTTP 服务
+  pageindex-app embed-backfill [选项]            为已有节点生成标题 + 摘要向量
+  pageindex-app summarize-backfill [选项]        为空摘要节点自底向上生成摘要
+
+embed-backfill 选项:
+  -doc    只处理该文档（默认全部文档）
+  -all    重新生成已有向量的节点（默认只处理没有向量的节点）
+  -batch  每批查询的节点数（默认 100）
+
+summarize-backfill 选项:
+  -doc          只处理该文档（默认全部文档）
+  -concurrency  并发调用 LLM 的上限（默认 4）
+  -job          恢复已有任务（忽略 -doc / -concurrency）
+`
+
+// runCommand 执行运维子命令，输出写入 out
+func runCommand(args []string, repo *DocumentRepository, out io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing command\n%s", usage)
+	}
+
+	switch args[0] {
+	case "embed-backfill":
+		return runEmbedBackfill(args[1:], repo, out)
+	case "summarize-backfill":
+		return runSummarizeBackfill(args[1:], repo, out)
+	case "help", "-h", "--help":
+		fmt.Fprint(out, usage)
+		return nil
+	default:
+		return fmt.Errorf("unknown command %q\n%s", args[0], usage)
+	}
+}
+
+func runEmbedBackfill(args []string, repo *DocumentRepository, out io.Writer) error {
+	fs := flag.NewFlagSet("embed-backfill", flag.ContinueOnError)
+	docID := fs.Int64("doc", 0, "only backfill this document")
+	all := fs.Bool("all", false, "re-embed nodes that already have an embedding")
+	batch := fs.Int("batch", defaultBackfillBatch, "nodes per batch")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	stats, err := NewSemanticSearcher(repo, embedderFromEnv()).Backfill(context.Background(), BackfillOptions{
+		DocID:     *docID,
+		All:       *all,
+		BatchSize: *batch,
+	}, out)
+	if err != nil {
+		return err
+	}
+	return printJSON(out, stats)
+}
+
+func runSummarizeBackfill(args []string, repo *DocumentRepository, out io.Writer) error {
+	fs := flag.NewFlagSet("summarize-backfill", flag.ContinueOnError)
+	docID := fs.Int64("doc", 0, "only summarize nodes of this document")
+	concurrency := fs.Int("concurrency", defaultSummaryConcurrency, "max concurrent LLM calls")
+	jobID := fs.Int64("job", 0, "resume an existing job")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	backfiller := NewSummaryBackfiller(repo, llmFromEnv())
+	var (
+		job *SummaryJob
+		err error
+	)
+	if *jobID > 0 {
+		job, err = repo.GetSummaryJob(*jobID)
+	} else {
+		req := SummaryJobRequest{Concurrency: *concurrency}
+		if *docID > 0 {
+			req.DocID = docID
+		}
+		job, err = backfiller.Create(req)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "running summary job %d\n", job.ID)
+	runErr := backfiller.Run(context.Background(), job)
+
+	if job, err = repo.GetSummaryJob(job.ID); err != nil {
+		return err
+	}
+	if err := printJSON(out, job); err != nil {
+		return err
+	}
+	return runErr
+}
+
+func printJSON(out io.Writer, v interface{}) error {
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
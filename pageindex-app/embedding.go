@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/fndome/xb"
+)
+
+const (
+	defaultSemanticLimit = 10
+	maxSemanticLimit     = 100
+	defaultBackfillBatch = 100
+
+	// nodeEmbeddingDimensions page_index_nodes.embedding 列的维度（schema.sql 中的 vector(1536)）
+	nodeEmbeddingDimensions = 1536
+)
+
+// Embedder 文本向量化接口
+type Embedder interface {
+	Embed(ctx context.Context, text string) ([]float32, error)
+}
+
+// OpenAIEmbedder OpenAI 兼容的 Embeddings 客户端
+type OpenAIEmbedder struct {
+	apiKey  string
+	baseURL string
+	model   string
+	client  *http.Client
+}
+
+func NewOpenAIEmbedder(apiKey, baseURL, model string) *OpenAIEmbedder {
+	if baseURL == "" {
+		baseURL = "https://api.openai.com/v1"
+	}
+	if model == "" {
+		model = "text-embedding-3-small"
+	}
+	return &OpenAIEmbedder{
+		apiKey:  apiKey,
+		baseURL: baseURL,
+		model:   model,
+		client:  &http.Client{},
+	}
+}
+
+// Embed 生成向量
+func (e *OpenAIEmbedder) Embed(ctx context.Context, text string) ([]float32, error) {
+	jsonData, err := json.Marshal(map[string]interface{}{
+		"model": e.model,
+		"input": text,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", e.baseURL+"/embeddings", strings.NewReader(string(jsonData)))
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+e.apiKey)
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("embedding api error (status %d): %s", resp.StatusCode, string(body))
+	}
+
+	var result struct {
+		Data []struct {
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("unmarshal response: %w", err)
+	}
+	if len(result.Data) == 0 {
+		return nil, fmt.Errorf("no embedding in response")
+	}
+
+	// 维度与列不一致时写库才会失败，这里提前给出明确的错误
+	if n := len(result.Data[0].Embedding); n != nodeEmbeddingDimensions {
+		return nil, fmt.Errorf("embedding model %s returned %d dimensions, page_index_nodes.embedding expects %d", e.model, n, nodeEmbeddingDimensions)
+	}
+	return result.Data[0].Embedding, nil
+}
+
+// NodeEmbeddingText 节点参与向量化的文本：标题 + 摘要
+func NodeEmbeddingText(node *PageIndexNode) string {
+	text := strings.TrimSpace(node.Title)
+	if summary := strings.TrimSpace(node.Summary); summary != "" {
+		text += "\n" + summary
+	}
+	return text
+}
+
+// SemanticSearcher 节点语义检索与向量回填
+//
+// 向量写入前做 L2 归一化：归一化后欧氏距离与余弦距离单调一致，
+// 可直接使用 xb VectorSearch 生成的 <-> 排序。
+type SemanticSearcher struct {
+	repo     *DocumentRepository
+	embedder Embedder
+}
+
+func NewSemanticSearcher(repo *DocumentRepository, embedder Embedder) *SemanticSearcher {
+	return &SemanticSearcher{
+		repo:     repo,
+		embedder: embedder,
+	}
+}
+
+// Search 语义检索节点
+func (s *SemanticSearcher) Search(ctx context.Context, req SemanticSearchRequest) ([]*SemanticHit, error) {
+	limit := req.Limit
+	if limit <= 0 {
+		limit = defaultSemanticLimit
+	}
+	if limit > maxSemanticLimit {
+		limit = maxSemanticLimit
+	}
+
+	vector, err := s.embed(ctx, req.Query)
+	if err != nil {
+		return nil, err
+	}
+
+	hits, err := s.repo.SemanticSearchNodes(vector, req.DocIDs, req.Level, req.Page, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.WithPath && len(hits) > 0 {
+		nodes := make([]*PageIndexNode, 0, len(hits))
+		for _, hit := range hits {
+			nodes = append(nodes, &hit.PageIndexNode)
+		}
+		breadcrumbs, err := BreadcrumbsAcrossDocs(s.repo, nodes)
+		if err != nil {
+			return nil, err
+		}
+		for _, hit := range hits {
+			hit.Breadcrumb = breadcrumbs[hit.ID]
+		}
+	}
+	return hits, nil
+}
+
+// BackfillOptions 向量回填选项
+type BackfillOptions struct {
+	DocID     int64 // 0 表示全部文档
+	All       bool  // 重新生成已有向量的节点
+	BatchSize int   // 每批查询的节点数
+}
+
+// BackfillStats 向量回填统计
+type BackfillStats struct {
+	Scanned  int `json:"scanned"`
+	Embedded int `json:"embedded"`
+	Skipped  int `json:"skipped"` // 标题和摘要都为空
+}
+
+// Backfill 为已有节点生成向量，progress 不为 nil 时每批输出一行进度
+func (s *SemanticSearcher) Backfill(ctx context.Context, opts BackfillOptions, progress io.Writer) (*BackfillStats, error) {
+	batchSize := opts.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultBackfillBatch
+	}
+
+	stats := &BackfillStats{}
+	var afterID int64
+	for {
+		nodes, err := s.repo.FindNodesForEmbedding(opts.DocID, afterID, opts.All, batchSize)
+		if err != nil {
+			return stats, err
+		}
+		if len(nodes) == 0 {
+			return stats, nil
+		}
+
+		for _, node := range nodes {
+			stats.Scanned++
+			text := NodeEmbeddingText(node)
+			if text == "" {
+				stats.Skipped++
+				continue
+			}
+
+			vector, err := s.embed(ctx, text)
+			if err != nil {
+				return stats, fmt.Errorf("embed node %d (doc %d, node_id %s): %w", node.ID, *node.DocID, node.NodeID, err)
+			}
+			if err := s.repo.UpdateNodeEmbedding(node.ID, vector); err != nil {
+				return stats, fmt.Errorf("update node %d embedding: %w", node.ID, err)
+			}
+			stats.Embedded++
+		}
+		afterID = nodes[len(nodes)-1].ID
+
+		if progress != nil {
+			fmt.Fprintf(progress, "scanned %d, embedded %d, skipped %d\n", stats.Scanned, stats.Embedded, stats.Skipped)
+		}
+	}
+}
+
+func (s *SemanticSearcher) embed(ctx context.Context, text string) (xb.Vector, error) {
+	vector, err := s.embedder.Embed(ctx, text)
+	if err != nil {
+		return nil, err
+	}
+	if len(vector) == 0 {
+		return nil, fmt.Errorf("embedder returned an empty vector")
+	}
+	return xb.Vector(vector).Normalize(), nil
+}
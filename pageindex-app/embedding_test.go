@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/fndome/xb"
+)
+
+// keywordEmbedder 按词表统计词频的假向量化（测试用）
+type keywordEmbedder struct {
+	vocab []string
+	calls int
+}
+
+func (e *keywordEmbedder) Embed(ctx context.Context, text string) ([]float32, error) {
+	e.calls++
+	vector := make([]float32, len(e.vocab)+1)
+	vector[len(e.vocab)] = 0.01 // 避免零向量
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool { return r == ' ' || r == '\n' || r == '.' }) {
+		for i, v := range e.vocab {
+			if word == v {
+				vector[i]++
+			}
+		}
+	}
+	return vector, nil
+}
+
+func TestNodeEmbeddingText(t *testing.T) {
+	if got := NodeEmbeddingText(&PageIndexNode{Title: " Chapter 1 "}); got != "Chapter 1" {
+		t.Errorf("Unexpected text without summary: %q", got)
+	}
+	if got := NodeEmbeddingText(&PageIndexNode{Title: "Chapter 1", Summary: "Revenue overview"}); got != "Chapter 1\nRevenue overview" {
+		t.Errorf("Unexpected text with summary: %q", got)
+	}
+}
+
+func TestSemanticBackfillAndSearch(t *testing.T) {
+	db := setupTestDB(t)
+	if db == nil {
+		return
+	}
+	defer db.Close()
+
+	repo := NewDocumentRepository(db)
+	importer := NewPageIndexImporter(repo)
+	var docIDs []int64
+	for _, name := range []string{"Report A", "Report B"} {
+		result, err := importer.Import(ImportRequest{DocumentName: name, TotalPages: xb.Int(50), Structure: sampleStructure()})
+		if err != nil {
+			t.Fatalf("Import failed: %v", err)
+		}
+		docIDs = append(docIDs, result.Document.ID)
+	}
+
+	embedder := &keywordEmbedder{vocab: []string{"annual", "report", "chapter", "section", "1", "2"}}
+	searcher := NewSemanticSearcher(repo, embedder)
+
+	stats, err := searcher.Backfill(context.Background(), BackfillOptions{DocID: docIDs[0], BatchSize: 2}, nil)
+	if err != nil {
+		t.Fatalf("Backfill failed: %v", err)
+	}
+	if stats.Embedded != 5 {
+		t.Errorf("Expected 5 nodes embedded for the first document, got %+v", stats)
+	}
+
+	// 再次回填只处理另一个文档的节点
+	stats, err = searcher.Backfill(context.Background(), BackfillOptions{}, nil)
+	if err != nil {
+		t.Fatalf("Backfill failed: %v", err)
+	}
+	if stats.Scanned != 5 {
+		t.Errorf("Expected only the 5 remaining nodes to be scanned, got %+v", stats)
+	}
+
+	hits, err := searcher.Search(context.Background(), SemanticSearchRequest{Query: "section 2", DocIDs: docIDs[:1], Limit: 3})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(hits) != 3 || hits[0].NodeID != "0003" {
+		t.Fatalf("Expected Section 1.2 first, got %+v", hits)
+	}
+	for _, hit := range hits {
+		if *hit.DocID != docIDs[0] {
+			t.Errorf("Expected hits from doc %d only, got doc %d", docIDs[0], *hit.DocID)
+		}
+	}
+
+	hits, err = searcher.Search(context.Background(), SemanticSearchRequest{Query: "chapter", Level: xb.Int(1), Page: xb.Int(25), WithPath: true})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(hits) != 2 {
+		t.Fatalf("Expected Chapter 2 from both documents, got %d hits", len(hits))
+	}
+	for _, hit := range hits {
+		if hit.NodeID != "0004" || hit.Breadcrumb != "Annual Report > Chapter 2" {
+			t.Errorf("Unexpected hit: node_id=%s breadcrumb=%q", hit.NodeID, hit.Breadcrumb)
+		}
+	}
+}
+
+func TestOpenAIEmbedderChecksDimensions(t *testing.T) {
+	dims := 3
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		vector := strings.TrimSuffix(strings.Repeat("0.1,", dims), ",")
+		fmt.Fprintf(w, `{"data": [{"embedding": [%s]}]}`, vector)
+	}))
+	defer server.Close()
+
+	embedder := NewOpenAIEmbedder("test", server.URL, "text-embedding-3-large")
+	if _, err := embedder.Embed(context.Background(), "Chapter 1"); err == nil || !strings.Contains(err.Error(), "returned 3 dimensions") {
+		t.Errorf("Expected dimension mismatch error, got %v", err)
+	}
+
+	dims = nodeEmbeddingDimensions
+	if vector, err := embedder.Embed(context.Background(), "Chapter 1"); err != nil || len(vector) != nodeEmbeddingDimensions {
+		t.Errorf("Expected %d dimensions, got %d (err %v)", nodeEmbeddingDimensions, len(vector), err)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultFullTextLimit = 20
+	maxFullTextLimit     = 100
+)
+
+// ErrInvalidDocIDs doc_ids 参数不合法
+var ErrInvalidDocIDs = errors.New("invalid doc_ids")
+
+// SearchFullText 跨文档全文检索，结果按文档分组（文档按最高得分排序，组内按得分排序）
+func SearchFullText(repo *DocumentRepository, req FullTextRequest) ([]*DocumentHits, int, error) {
+	docIDs, err := ParseDocIDList(req.DocIDs)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	limit := req.Limit
+	if limit <= 0 {
+		limit = defaultFullTextLimit
+	}
+	if limit > maxFullTextLimit {
+		limit = maxFullTextLimit
+	}
+
+	hits, err := repo.FullTextSearchNodes(req.Query, docIDs, req.PerDoc, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if req.WithPath && len(hits) > 0 {
+		nodes := make([]*PageIndexNode, 0, len(hits))
+		for _, hit := range hits {
+			nodes = append(nodes, &hit.PageIndexNode)
+		}
+		breadcrumbs, err := BreadcrumbsAcrossDocs(repo, nodes)
+		if err != nil {
+			return nil, 0, err
+		}
+		for _, hit := range hits {
+			hit.Breadcrumb = breadcrumbs[hit.ID]
+		}
+	}
+
+	return GroupHitsByDocument(hits), len(hits), nil
+}
+
+// GroupHitsByDocument 按文档分组，hits 需已按得分降序排列
+func GroupHitsByDocument(hits []*FullTextHit) []*DocumentHits {
+	groups := []*DocumentHits{}
+	byDoc := make(map[int64]*DocumentHits)
+	for _, hit := range hits {
+		docID := *hit.DocID
+		group, ok := byDoc[docID]
+		if !ok {
+			group = &DocumentHits{
+				DocID:        docID,
+				DocumentName: hit.DocumentName,
+				Rank:         hit.Rank,
+			}
+			byDoc[docID] = group
+			groups = append(groups, group)
+		}
+		group.Hits = append(group.Hits, hit)
+	}
+	return groups
+}
+
+// ParseDocIDList 解析逗号分隔的文档 ID 列表（空字符串返回 nil）
+func ParseDocIDList(raw string) ([]int64, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+
+	parts := strings.Split(raw, ",")
+	ids := make([]int64, 0, len(parts))
+	for _, part := range parts {
+		id, err := strconv.ParseInt(strings.TrimSpace(part), 10, 64)
+		if err != nil || id <= 0 {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidDocIDs, part)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
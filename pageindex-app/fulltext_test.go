@@ -0,0 +1,135 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/fndome/xb"
+	"github.com/gin-gonic/gin"
+)
+
+func TestParseDocIDList(t *testing.T) {
+	ids, err := ParseDocIDList(" 3, 1,2 ")
+	if err != nil || len(ids) != 3 || ids[0] != 3 || ids[2] != 2 {
+		t.Errorf("Unexpected ids %v, err %v", ids, err)
+	}
+
+	if ids, err := ParseDocIDList(""); err != nil || ids != nil {
+		t.Errorf("Expected nil for empty input, got %v, err %v", ids, err)
+	}
+
+	for _, raw := range []string{"1,abc", "0", "1,,2"} {
+		if _, err := ParseDocIDList(raw); !errors.Is(err, ErrInvalidDocIDs) {
+			t.Errorf("%q: expected ErrInvalidDocIDs, got %v", raw, err)
+		}
+	}
+}
+
+func TestHighlightHTML(t *testing.T) {
+	headline := "use " + highlightStart + "<script>" + highlightStop + " & " + highlightStart + "risk" + highlightStop
+	want := "use <mark>&lt;script&gt;</mark> &amp; <mark>risk</mark>"
+	if got := highlightHTML(headline); got != want {
+		t.Errorf("highlightHTML() = %q, want %q", got, want)
+	}
+}
+
+func TestSetFullTextConfig(t *testing.T) {
+	repo := NewDocumentRepository(nil)
+	if err := repo.SetFullTextConfig("chinese"); err != nil || !strings.Contains(nodeSearchVector(repo.fullTextConfig), "to_tsvector('chinese'") {
+		t.Errorf("Expected chinese config, got %q (err %v)", repo.fullTextConfig, err)
+	}
+	if err := repo.SetFullTextConfig("english'); DROP TABLE documents; --"); err == nil || repo.fullTextConfig != "chinese" {
+		t.Errorf("Expected invalid config to be rejected, got %q (err %v)", repo.fullTextConfig, err)
+	}
+}
+
+func TestGroupHitsByDocument(t *testing.T) {
+	hit := func(docID int64, nodeID string, rank float64) *FullTextHit {
+		return &FullTextHit{
+			PageIndexNode: PageIndexNode{DocID: &docID, NodeID: nodeID},
+			DocumentName:  "doc",
+			Rank:          rank,
+		}
+	}
+
+	groups := GroupHitsByDocument([]*FullTextHit{
+		hit(2, "0001", 0.9),
+		hit(1, "0003", 0.7),
+		hit(2, "0004", 0.5),
+	})
+
+	if len(groups) != 2 {
+		t.Fatalf("Expected 2 groups, got %d", len(groups))
+	}
+	if groups[0].DocID != 2 || groups[0].Rank != 0.9 || len(groups[0].Hits) != 2 {
+		t.Errorf("Unexpected first group: %+v", groups[0])
+	}
+	if groups[1].DocID != 1 || len(groups[1].Hits) != 1 {
+		t.Errorf("Unexpected second group: %+v", groups[1])
+	}
+}
+
+func TestSearchHandlersRejectMissingDocID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/search/title", SearchByTitleHandler(nil))
+	r.GET("/search/page", SearchByPageHandler(nil))
+	r.GET("/search/level", SearchByLevelHandler(nil))
+	r.GET("/search/fulltext", FullTextSearchHandler(nil))
+
+	for _, url := range []string{
+		"/search/title?keyword=risk",
+		"/search/title?doc_id=abc&keyword=risk",
+		"/search/page?doc_id=0&page=3",
+		"/search/level?doc_id=1",
+		"/search/fulltext",
+		"/search/fulltext?q=risk&doc_ids=1,x",
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, url, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", url, w.Code)
+		}
+	}
+}
+
+func TestFullTextSearchAcrossDocuments(t *testing.T) {
+	db := setupTestDB(t)
+	if db == nil {
+		return
+	}
+	defer db.Close()
+
+	repo := NewDocumentRepository(db)
+	importer := NewPageIndexImporter(repo)
+	for _, name := range []string{"Report A", "Report B"} {
+		structure := sampleStructure()
+		structure.Nodes[0].Nodes[1].Summary = "Liquidity risk and funding"
+		structure.Nodes[1].Title = "Liquidity Management"
+		if _, err := importer.Import(ImportRequest{DocumentName: name, TotalPages: xb.Int(50), Structure: structure}); err != nil {
+			t.Fatalf("Import failed: %v", err)
+		}
+	}
+
+	groups, total, err := SearchFullText(repo, FullTextRequest{Query: "liquidity", PerDoc: 1, WithPath: true})
+	if err != nil {
+		t.Fatalf("SearchFullText failed: %v", err)
+	}
+	if len(groups) != 2 || total != 2 {
+		t.Fatalf("Expected one hit per document, got %d groups / %d hits", len(groups), total)
+	}
+
+	top := groups[0].Hits[0]
+	if top.NodeID != "0004" {
+		t.Errorf("Expected title match to outrank summary match, got %s", top.NodeID)
+	}
+	if !strings.Contains(top.TitleHighlight, "<mark>Liquidity</mark>") {
+		t.Errorf("Expected highlighted title, got %q", top.TitleHighlight)
+	}
+	if top.Breadcrumb != "Annual Report > Liquidity Management" {
+		t.Errorf("Unexpected breadcrumb %q", top.Breadcrumb)
+	}
+}
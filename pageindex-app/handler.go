@@ -1,10 +1,14 @@
 package main
 
 import (
+	"database/sql"
+	"errors"
+	"io"
 	"net/http"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
 )
 
 // ImportHandler 导入 PageIndex JSON
@@ -16,20 +20,95 @@ func ImportHandler(importer *PageIndexImporter) gin.HandlerFunc {
 			return
 		}
 
-		if err := importer.Import(req); err != nil {
+		result, err := importer.Import(req)
+		if err != nil {
+			var verr *ValidationError
+			if errors.As(err, &verr) {
+				c.JSON(http.StatusUnprocessableEntity, gin.H{
+					"error":      "validation failed",
+					"validation": verr.Result,
+				})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Import successful",
+			"doc_id":  result.Document.ID,
+			"issues":  result.Issues,
+		})
+	}
+}
+
+// ImportDocumentHandler 从 Markdown / HTML 标题层级生成目录树并导入
+func ImportDocumentHandler(importer *HeadingImporter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req DocumentImportRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		result, err := importer.Import(c.Request.Context(), req)
+		if err != nil {
+			var verr *ValidationError
+			if errors.As(err, &verr) {
+				c.JSON(http.StatusUnprocessableEntity, gin.H{
+					"error":      "validation failed",
+					"validation": verr.Result,
+				})
+				return
+			}
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{"message": "Import successful"})
+		c.JSON(http.StatusOK, gin.H{
+			"message":     "Import successful",
+			"doc_id":      result.Document.ID,
+			"total_pages": result.Document.TotalPages,
+			"issues":      result.Issues,
+		})
+	}
+}
+
+// ValidateHandler 校验 PageIndex JSON（不导入）
+func ValidateHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req ImportRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		result := ValidateTree(req.Structure, req.TotalPages)
+		mode := req.Mode
+		if mode == "" {
+			mode = ValidationLenient
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"mode":       mode,
+			"importable": !result.Rejects(mode),
+			"validation": result,
+		})
 	}
 }
 
 // SearchByTitleHandler 按标题搜索
 func SearchByTitleHandler(repo *DocumentRepository) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		docID, _ := strconv.ParseInt(c.Query("doc_id"), 10, 64)
+		docID, ok := parseDocIDQuery(c)
+		if !ok {
+			return
+		}
 		keyword := c.Query("keyword")
+		if keyword == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "missing keyword"})
+			return
+		}
 
 		nodes, err := repo.FindNodesByTitle(docID, keyword)
 		if err != nil {
@@ -37,20 +116,308 @@ func SearchByTitleHandler(repo *DocumentRepository) gin.HandlerFunc {
 			return
 		}
 
+		respondNodes(c, repo, docID, nodes)
+	}
+}
+
+// SearchByPageHandler 按页码搜索
+func SearchByPageHandler(repo *DocumentRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		docID, ok := parseDocIDQuery(c)
+		if !ok {
+			return
+		}
+		page, err := strconv.Atoi(c.Query("page"))
+		if err != nil || page <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "missing or invalid page"})
+			return
+		}
+
+		nodes, err := repo.FindNodesByPage(docID, page)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		respondNodes(c, repo, docID, nodes)
+	}
+}
+
+// SearchByLevelHandler 按层级搜索
+func SearchByLevelHandler(repo *DocumentRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		docID, ok := parseDocIDQuery(c)
+		if !ok {
+			return
+		}
+		level, err := strconv.Atoi(c.Query("level"))
+		if err != nil || level < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "missing or invalid level"})
+			return
+		}
+
+		nodes, err := repo.FindNodesByLevel(docID, level)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		respondNodes(c, repo, docID, nodes)
+	}
+}
+
+// GetNodeWithChildrenHandler 获取节点及其子节点
+func GetNodeWithChildrenHandler(importer *PageIndexImporter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		docID, ok := parseDocIDQuery(c)
+		if !ok {
+			return
+		}
+		nodeID := c.Param("node_id")
+
+		resp, err := importer.BuildHierarchy(docID, nodeID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "node not found"})
+			return
+		}
+
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// GetDocumentTreeHandler 导出文档的完整树结构（可直接重新导入）
+func GetDocumentTreeHandler(importer *PageIndexImporter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		docID, ok := parseDocIDParam(c)
+		if !ok {
+			return
+		}
+
+		var req TreeRequest
+		if err := c.ShouldBindQuery(&req); err != nil || req.Depth < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid node_id, depth or with_content"})
+			return
+		}
+
+		tree, err := importer.ExportTree(docID, req)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) || errors.Is(err, ErrNodeNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, tree)
+	}
+}
+
+// GetDocumentTOCHandler 渲染文档目录（format: markdown | html | json）
+// 页码链接到 GET /api/documents/:id/pages/:n；node_id / depth 与树导出含义相同
+func GetDocumentTOCHandler(importer *PageIndexImporter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		docID, ok := parseDocIDParam(c)
+		if !ok {
+			return
+		}
+
+		var req TOCRequest
+		if err := c.ShouldBindQuery(&req); err != nil || req.Depth < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid node_id, depth or with_summary"})
+			return
+		}
+		format, err := ParseTOCFormat(req.Format)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		tree, err := importer.OutlineTree(docID, req.TreeRequest, req.WithSummary)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) || errors.Is(err, ErrNodeNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		toc := BuildTOC(docID, *tree, req.WithSummary)
+		switch format {
+		case TOCFormatJSON:
+			c.JSON(http.StatusOK, toc)
+		case TOCFormatHTML:
+			c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(RenderTOCHTML(toc)))
+		default:
+			c.Data(http.StatusOK, "text/markdown; charset=utf-8", []byte(RenderTOCMarkdown(toc)))
+		}
+	}
+}
+
+// QueryHandler 基于目录推理的检索问答
+func QueryHandler(searcher *TreeSearcher) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req QueryRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		resp, err := searcher.Query(c.Request.Context(), req)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) || errors.Is(err, ErrNodeNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "document not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// SemanticSearchHandler 按标题 + 摘要的向量语义检索节点
+func SemanticSearchHandler(searcher *SemanticSearcher) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req SemanticSearchRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		hits, err := searcher.Search(c.Request.Context(), req)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"results": hits,
+			"total":   len(hits),
+		})
+	}
+}
+
+// FullTextSearchHandler 跨文档全文检索（标题、摘要、正文），结果按文档分组并带高亮片段
+func FullTextSearchHandler(repo *DocumentRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req FullTextRequest
+		if err := c.ShouldBindQuery(&req); err != nil || req.PerDoc < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "missing q or invalid per_doc"})
+			return
+		}
+
+		groups, total, err := SearchFullText(repo, req)
+		if err != nil {
+			if errors.Is(err, ErrInvalidDocIDs) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"results": groups,
+			"total":   total,
+		})
+	}
+}
+
+// respondNodes 输出节点列表，with_path=true 时为每个节点附加面包屑
+func respondNodes(c *gin.Context, repo *DocumentRepository, docID int64, nodes []*PageIndexNode) {
+	withPath, _ := strconv.ParseBool(c.Query("with_path"))
+	if !withPath {
 		c.JSON(http.StatusOK, gin.H{
 			"results": nodes,
 			"total":   len(nodes),
 		})
+		return
 	}
+
+	hits, err := WithBreadcrumbs(repo, docID, nodes)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"results": hits,
+		"total":   len(hits),
+	})
 }
 
-// SearchByPageHandler 按页码搜索
-func SearchByPageHandler(repo *DocumentRepository) gin.HandlerFunc {
+// parseDocIDQuery 解析 doc_id 查询参数，缺失或非法时返回 400
+func parseDocIDQuery(c *gin.Context) (int64, bool) {
+	docID, err := strconv.ParseInt(c.Query("doc_id"), 10, 64)
+	if err != nil || docID <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "missing or invalid doc_id"})
+		return 0, false
+	}
+	return docID, true
+}
+
+// parseDocIDParam 解析路径参数 :id，非法时返回 400
+func parseDocIDParam(c *gin.Context) (int64, bool) {
+	docID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || docID <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid document id"})
+		return 0, false
+	}
+	return docID, true
+}
+
+// GetNodePathHandler 获取从根节点到该节点的路径（面包屑）
+func GetNodePathHandler(repo *DocumentRepository) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		docID, _ := strconv.ParseInt(c.Query("doc_id"), 10, 64)
-		page, _ := strconv.Atoi(c.Query("page"))
+		docID, ok := parseDocIDQuery(c)
+		if !ok {
+			return
+		}
 
-		nodes, err := repo.FindNodesByPage(docID, page)
+		path, err := repo.FindAncestors(docID, c.Param("node_id"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if len(path) == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "node not found"})
+			return
+		}
+
+		titles := make([]string, 0, len(path))
+		for _, node := range path {
+			titles = append(titles, node.Title)
+		}
+
+		c.JSON(http.StatusOK, NodePathResponse{
+			Path:       path,
+			Breadcrumb: FormatBreadcrumb(titles),
+		})
+	}
+}
+
+// GetNodeDescendantsHandler 获取节点的全部后代
+func GetNodeDescendantsHandler(repo *DocumentRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		docID, ok := parseDocIDQuery(c)
+		if !ok {
+			return
+		}
+
+		maxDepth := 0
+		if v := c.Query("max_depth"); v != "" {
+			d, err := strconv.Atoi(v)
+			if err != nil || d < 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid max_depth"})
+				return
+			}
+			maxDepth = d
+		}
+
+		nodes, err := repo.FindDescendants(docID, c.Param("node_id"), maxDepth)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
@@ -63,13 +430,15 @@ func SearchByPageHandler(repo *DocumentRepository) gin.HandlerFunc {
 	}
 }
 
-// SearchByLevelHandler 按层级搜索
-func SearchByLevelHandler(repo *DocumentRepository) gin.HandlerFunc {
+// GetNodeSiblingsHandler 获取节点的兄弟节点
+func GetNodeSiblingsHandler(repo *DocumentRepository) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		docID, _ := strconv.ParseInt(c.Query("doc_id"), 10, 64)
-		level, _ := strconv.Atoi(c.Query("level"))
+		docID, ok := parseDocIDQuery(c)
+		if !ok {
+			return
+		}
 
-		nodes, err := repo.FindNodesByLevel(docID, level)
+		nodes, err := repo.FindSiblings(docID, c.Param("node_id"))
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
@@ -82,15 +451,35 @@ func SearchByLevelHandler(repo *DocumentRepository) gin.HandlerFunc {
 	}
 }
 
-// GetNodeWithChildrenHandler 获取节点及其子节点
-func GetNodeWithChildrenHandler(importer *PageIndexImporter) gin.HandlerFunc {
+// UploadPagesHandler 上传文档页面原文并组装节点正文
+//
+// 支持三种格式：
+//   - application/json: ["第 1 页", "第 2 页"] 或 [{"page": 1, "text": "..."}]
+//   - text/plain: 以换页符 \f 分页的纯文本
+//   - multipart/form-data: file 字段上传的纯文本文件（同样以 \f 分页）
+func UploadPagesHandler(svc *PageService) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		docID, _ := strconv.ParseInt(c.Query("doc_id"), 10, 64)
-		nodeID := c.Param("node_id")
+		docID, ok := parseDocIDParam(c)
+		if !ok {
+			return
+		}
 
-		resp, err := importer.BuildHierarchy(docID, nodeID)
+		pages, err := readPages(c)
 		if err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "node not found"})
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		resp, err := svc.UploadPages(docID, pages)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				c.JSON(http.StatusNotFound, gin.H{"error": "document not found"})
+			case errors.Is(err, ErrInvalidPages):
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			default:
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			}
 			return
 		}
 
@@ -98,3 +487,349 @@ func GetNodeWithChildrenHandler(importer *PageIndexImporter) gin.HandlerFunc {
 	}
 }
 
+// readPages 按 Content-Type 读取上传的页面
+func readPages(c *gin.Context) ([]PageText, error) {
+	switch c.ContentType() {
+	case "application/json":
+		data, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			return nil, err
+		}
+		return ParsePagesJSON(data)
+
+	case "multipart/form-data":
+		header, err := c.FormFile("file")
+		if err != nil {
+			return nil, err
+		}
+		f, err := header.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		data, err := io.ReadAll(f)
+		if err != nil {
+			return nil, err
+		}
+		return ParsePagesText(string(data)), nil
+
+	default:
+		data, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			return nil, err
+		}
+		return ParsePagesText(string(data)), nil
+	}
+}
+
+// GetPageHandler 获取单页原文
+func GetPageHandler(repo *DocumentRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		docID, ok := parseDocIDParam(c)
+		if !ok {
+			return
+		}
+
+		page, err := strconv.Atoi(c.Param("n"))
+		if err != nil || page <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid page number"})
+			return
+		}
+
+		p, err := repo.FindPage(docID, page)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "page not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, p)
+	}
+}
+
+// ListDocumentsHandler 文档目录（keyword 按名称模糊匹配）
+func ListDocumentsHandler(repo *DocumentRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		docs, err := repo.ListDocuments(c.Query("keyword"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"results": docs,
+			"total":   len(docs),
+		})
+	}
+}
+
+// GetDocumentHandler 文档详情：计数、版本列表与当前版本的校验问题
+func GetDocumentHandler(repo *DocumentRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		docID, ok := parseDocIDParam(c)
+		if !ok {
+			return
+		}
+
+		info, err := repo.GetDocumentInfo(docID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "document not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		versions, err := repo.FindVersions(docID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		issues, err := repo.FindValidationIssues(docID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, &DocumentDetail{
+			DocumentInfo: info,
+			Versions:     versions,
+			Issues:       issues,
+		})
+	}
+}
+
+// DeleteDocumentHandler 删除文档及其节点、页面和全部版本
+func DeleteDocumentHandler(repo *DocumentRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		docID, ok := parseDocIDParam(c)
+		if !ok {
+			return
+		}
+
+		err := repo.WithTx(func(tx *sqlx.Tx) error {
+			return repo.DeleteDocumentTx(tx, docID)
+		})
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "document not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Document deleted",
+			"doc_id":  docID,
+		})
+	}
+}
+
+// ReimportHandler 用新的 PageIndex 结果替换文档的树（保存为新版本）
+func ReimportHandler(importer *PageIndexImporter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		docID, ok := parseDocIDParam(c)
+		if !ok {
+			return
+		}
+
+		var req ImportRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		result, err := importer.Reimport(docID, req)
+		if err != nil {
+			respondVersionError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Reimport successful",
+			"doc_id":  docID,
+			"version": result.Document.ActiveVersion,
+			"issues":  result.Issues,
+		})
+	}
+}
+
+// ListVersionsHandler 文档的版本列表
+func ListVersionsHandler(repo *DocumentRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		docID, ok := parseDocIDParam(c)
+		if !ok {
+			return
+		}
+
+		doc, err := repo.GetDocument(docID)
+		if err != nil {
+			respondVersionError(c, err)
+			return
+		}
+		versions, err := repo.FindVersions(docID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"active_version": doc.ActiveVersion,
+			"results":        versions,
+			"total":          len(versions),
+		})
+	}
+}
+
+// ActivateVersionHandler 将文档的当前树切换为指定版本
+func ActivateVersionHandler(importer *PageIndexImporter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		docID, ok := parseDocIDParam(c)
+		if !ok {
+			return
+		}
+		version, err := strconv.Atoi(c.Param("version"))
+		if err != nil || version <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid version"})
+			return
+		}
+
+		result, err := importer.ActivateVersion(docID, version)
+		if err != nil {
+			respondVersionError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Version activated",
+			"doc_id":  docID,
+			"version": result.Document.ActiveVersion,
+			"issues":  result.Issues,
+		})
+	}
+}
+
+// DiffVersionsHandler 比较两个版本（from 默认为 to 的上一版本，to 默认为当前版本）
+func DiffVersionsHandler(importer *PageIndexImporter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		docID, ok := parseDocIDParam(c)
+		if !ok {
+			return
+		}
+
+		var versions [2]int
+		for i, key := range []string{"from", "to"} {
+			if raw := c.Query(key); raw != "" {
+				v, err := strconv.Atoi(raw)
+				if err != nil || v <= 0 {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "invalid " + key + " version"})
+					return
+				}
+				versions[i] = v
+			}
+		}
+
+		diff, err := importer.DiffVersions(docID, versions[0], versions[1])
+		if err != nil {
+			respondVersionError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, diff)
+	}
+}
+
+// respondVersionError 输出版本相关操作的错误
+func respondVersionError(c *gin.Context, err error) {
+	var verr *ValidationError
+	switch {
+	case errors.As(err, &verr):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":      "validation failed",
+			"validation": verr.Result,
+		})
+	case errors.Is(err, ErrVersionNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, sql.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{"error": "document not found"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// CreateSummaryJobHandler 创建摘要回填任务并在后台运行
+func CreateSummaryJobHandler(backfiller *SummaryBackfiller) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req SummaryJobRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		job, err := backfiller.Start(req)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "document not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusAccepted, job)
+	}
+}
+
+// GetSummaryJobHandler 查询摘要回填任务进度
+func GetSummaryJobHandler(repo *DocumentRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		jobID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil || jobID <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid job id"})
+			return
+		}
+
+		job, err := repo.GetSummaryJob(jobID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "job not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, job)
+	}
+}
+
+// ResumeSummaryJobHandler 在后台重新运行摘要回填任务（只处理仍为空的摘要）
+func ResumeSummaryJobHandler(backfiller *SummaryBackfiller) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		jobID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil || jobID <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid job id"})
+			return
+		}
+
+		job, err := backfiller.Resume(jobID)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				c.JSON(http.StatusNotFound, gin.H{"error": "job not found"})
+			case errors.Is(err, ErrJobRunning):
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			default:
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			}
+			return
+		}
+
+		c.JSON(http.StatusAccepted, job)
+	}
+}
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// 虚拟页码方式
+const (
+	PageModeSection = "section" // 每个标题小节算一页，按出现顺序编号
+	PageModeLine    = "line"    // 使用源文件行号作为页码
+)
+
+// heading 文档中的一个标题小节（Level 0 表示第一个标题之前的前言）
+type heading struct {
+	Level int
+	Title string
+	Body  string
+	Line  int // 标题所在行（从 1 开始）
+}
+
+var (
+	atxHeadingRe    = regexp.MustCompile(`^ {0,3}(#{1,6})(?:[ \t]+(.*?))?(?:[ \t]+#+)?[ \t]*$`)
+	setextH1Re      = regexp.MustCompile(`^ {0,3}=+[ \t]*$`)
+	setextH2Re      = regexp.MustCompile(`^ {0,3}-+[ \t]*$`)
+	codeFenceRe     = regexp.MustCompile("^ {0,3}(```|~~~)")
+	htmlHeadingTags = map[string]int{"h1": 1, "h2": 2, "h3": 3, "h4": 4, "h5": 5, "h6": 6}
+	htmlBlockTags   = map[string]bool{
+		"p": true, "div": true, "br": true, "li": true, "tr": true, "pre": true,
+		"blockquote": true, "section": true, "article": true, "table": true, "ul": true, "ol": true,
+	}
+)
+
+// HeadingImporter 从 Markdown / HTML 的标题层级生成 PageIndex 树并导入
+type HeadingImporter struct {
+	importer *PageIndexImporter
+	llm      LLMService // 可选，用于生成摘要
+}
+
+func NewHeadingImporter(importer *PageIndexImporter, llm LLMService) *HeadingImporter {
+	return &HeadingImporter{
+		importer: importer,
+		llm:      llm,
+	}
+}
+
+// Import 解析文档、（可选）生成摘要并导入
+func (h *HeadingImporter) Import(ctx context.Context, req DocumentImportRequest) (*ImportResult, error) {
+	importReq, err := h.Convert(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return h.importer.Import(*importReq)
+}
+
+// Convert 将 Markdown / HTML 文档转换为导入请求（不写库）
+func (h *HeadingImporter) Convert(ctx context.Context, req DocumentImportRequest) (*ImportRequest, error) {
+	var (
+		headings []heading
+		err      error
+	)
+	switch req.Format {
+	case "markdown":
+		headings = ParseMarkdownHeadings(req.Content)
+	case "html":
+		headings, err = ParseHTMLHeadings(req.Content)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported format %q", req.Format)
+	}
+
+	totalLines := strings.Count(req.Content, "\n") + 1
+	root, totalPages := BuildHeadingTree(req.DocumentName, headings, req.PageMode, totalLines)
+
+	if req.Summarize {
+		if h.llm == nil {
+			return nil, fmt.Errorf("summarize requested but no LLM configured")
+		}
+		if err := h.summarize(ctx, &root); err != nil {
+			return nil, err
+		}
+	}
+
+	return &ImportRequest{
+		DocumentName: req.DocumentName,
+		TotalPages:   &totalPages,
+		Structure:    root,
+		Mode:         req.Mode,
+	}, nil
+}
+
+// ParseMarkdownHeadings 按 ATX（# 标题）与 Setext（=== / ---）标题切分 Markdown，代码块中的 # 不算标题
+func ParseMarkdownHeadings(src string) []heading {
+	lines := strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n")
+
+	headings := []heading{{Level: 0, Line: 1}}
+	var body []string
+	inFence := false
+	flush := func() {
+		headings[len(headings)-1].Body = strings.TrimSpace(strings.Join(body, "\n"))
+		body = body[:0]
+	}
+
+	for i, line := range lines {
+		if codeFenceRe.MatchString(line) {
+			inFence = !inFence
+			body = append(body, line)
+			continue
+		}
+		if inFence {
+			body = append(body, line)
+			continue
+		}
+
+		if m := atxHeadingRe.FindStringSubmatch(line); m != nil {
+			flush()
+			headings = append(headings, heading{Level: len(m[1]), Title: strings.TrimSpace(m[2]), Line: i + 1})
+			continue
+		}
+
+		// Setext：上一行是普通文本，本行是 === 或 ---
+		if n := len(body); n > 0 && strings.TrimSpace(body[n-1]) != "" &&
+			(n == 1 || strings.TrimSpace(body[n-2]) == "") {
+			level := 0
+			if setextH1Re.MatchString(line) {
+				level = 1
+			} else if setextH2Re.MatchString(line) {
+				level = 2
+			}
+			if level > 0 {
+				title := strings.TrimSpace(body[n-1])
+				body = body[:n-1]
+				flush()
+				headings = append(headings, heading{Level: level, Title: title, Line: i})
+				continue
+			}
+		}
+
+		body = append(body, line)
+	}
+	flush()
+
+	return headings
+}
+
+// ParseHTMLHeadings 按 <h1>–<h6> 切分 HTML，忽略 script / style
+func ParseHTMLHeadings(src string) ([]heading, error) {
+	z := html.NewTokenizer(strings.NewReader(src))
+
+	headings := []heading{{Level: 0, Line: 1}}
+	var (
+		body    strings.Builder
+		title   strings.Builder
+		inTitle int // 当前所在标题的级别
+		skip    int // script / style 嵌套深度
+		line    = 1
+		flush   = func() {
+			headings[len(headings)-1].Body = normalizeWhitespace(body.String())
+			body.Reset()
+		}
+	)
+
+	for {
+		tt := z.Next()
+		raw := z.Raw()
+
+		switch tt {
+		case html.ErrorToken:
+			if err := z.Err(); err != io.EOF {
+				return nil, fmt.Errorf("parse html: %w", err)
+			}
+			flush()
+			return headings, nil
+
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, _ := z.TagName()
+			tag := string(name)
+			switch {
+			case tag == "script" || tag == "style":
+				if tt == html.StartTagToken {
+					skip++
+				}
+			case htmlHeadingTags[tag] > 0 && skip == 0:
+				flush()
+				inTitle = htmlHeadingTags[tag]
+				title.Reset()
+				headings = append(headings, heading{Level: inTitle, Line: line})
+			case htmlBlockTags[tag]:
+				body.WriteString("\n")
+			}
+
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			tag := string(name)
+			switch {
+			case tag == "script" || tag == "style":
+				if skip > 0 {
+					skip--
+				}
+			case htmlHeadingTags[tag] > 0 && inTitle > 0:
+				headings[len(headings)-1].Title = normalizeWhitespace(title.String())
+				inTitle = 0
+			case htmlBlockTags[tag]:
+				body.WriteString("\n")
+			}
+
+		case html.TextToken:
+			if skip > 0 {
+				break
+			}
+			text := html.UnescapeString(string(raw))
+			if inTitle > 0 {
+				title.WriteString(text)
+			} else {
+				body.WriteString(text)
+			}
+		}
+
+		line += strings.Count(string(raw), "\n")
+	}
+}
+
+// BuildHeadingTree 由标题列表构建 PageIndex 树，返回树和总页数
+//
+// 根节点（0000）代表整篇文档，标题为文档名，content 为第一个标题之前的前言。
+// 跳级的标题（如 h1 后直接 h3）挂在最近的更高级标题下。
+func BuildHeadingTree(name string, headings []heading, pageMode string, totalLines int) (PageIndexJSON, int) {
+	if pageMode == "" {
+		pageMode = PageModeSection
+	}
+
+	// 每个小节的起始页
+	starts := make([]int, len(headings))
+	for i, h := range headings {
+		if pageMode == PageModeLine {
+			starts[i] = h.Line
+		} else {
+			starts[i] = i + 1
+		}
+	}
+	totalPages := len(headings)
+	if pageMode == PageModeLine {
+		totalPages = totalLines
+	}
+
+	nodes := make([]*PageIndexJSON, len(headings))
+	parents := make([]int, len(headings)) // 父节点在 headings 中的下标
+	stack := []int{0}
+
+	for i, h := range headings {
+		title := h.Title
+		if i == 0 {
+			title = name
+		} else if title == "" {
+			title = fmt.Sprintf("(untitled h%d)", h.Level)
+		}
+		nodes[i] = &PageIndexJSON{
+			Title:   title,
+			NodeID:  fmt.Sprintf("%04d", i),
+			Content: h.Body,
+		}
+		if i == 0 {
+			continue
+		}
+
+		for len(stack) > 1 && headings[stack[len(stack)-1]].Level >= h.Level {
+			stack = stack[:len(stack)-1]
+		}
+		parents[i] = stack[len(stack)-1]
+		stack = append(stack, i)
+	}
+
+	// 子树的结束页 = 下一个同级或更高级标题的起始页 - 1，根节点覆盖全文
+	for i := range nodes {
+		start, end := starts[i], totalPages
+		if i > 0 {
+			for j := i + 1; j < len(headings); j++ {
+				if headings[j].Level <= headings[i].Level {
+					end = starts[j] - 1
+					break
+				}
+			}
+		}
+		if end < start {
+			end = start
+		}
+		nodes[i].StartIndex = &start
+		nodes[i].EndIndex = &end
+	}
+
+	// 自底向上组装：PageIndexJSON 的子节点是值拷贝，需先构建完整子树
+	children := make(map[int][]int, len(headings))
+	for i := 1; i < len(headings); i++ {
+		children[parents[i]] = append(children[parents[i]], i)
+	}
+	var assemble func(i int) PageIndexJSON
+	assemble = func(i int) PageIndexJSON {
+		node := *nodes[i]
+		for _, c := range children[i] {
+			node.Nodes = append(node.Nodes, assemble(c))
+		}
+		return node
+	}
+
+	return assemble(0), totalPages
+}
+
+// summarize 自底向上生成摘要：叶子节点用正文，父节点用正文 + 子节点摘要
+func (h *HeadingImporter) summarize(ctx context.Context, node *PageIndexJSON) error {
+	for i := range node.Nodes {
+		if err := h.summarize(ctx, &node.Nodes[i]); err != nil {
+			return err
+		}
+	}
+	if node.Summary != "" {
+		return nil
+	}
+
+	childSummaries := make([]string, 0, len(node.Nodes))
+	for _, child := range node.Nodes {
+		childSummaries = append(childSummaries, fmt.Sprintf("- %s：%s", child.Title, child.Summary))
+	}
+
+	summary, err := h.llm.Generate(ctx, buildSummaryPrompt(node.Title, node.Content, childSummaries))
+	if err != nil {
+		return fmt.Errorf("summarize node %s failed: %w", node.NodeID, err)
+	}
+	node.Summary = strings.TrimSpace(summary)
+	return nil
+}
+
+// normalizeWhitespace 合并行内空白，保留段落换行
+func normalizeWhitespace(s string) string {
+	lines := strings.Split(s, "\n")
+	out := make([]string, 0, len(lines))
+	for _, line := range lines {
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			out = append(out, line)
+		}
+	}
+	return strings.Join(out, "\n")
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+const sampleMarkdown = `Preface text.
+
+# Introduction
+
+Intro body.
+
+## Background
+Background body.
+
+` + "```" + `
+# not a heading
+` + "```" + `
+
+### Deep Detail
+Detail body.
+
+Usage
+=====
+
+Usage body.
+
+#### Skipped Level
+Skipped body.
+`
+
+func TestParseMarkdownHeadings(t *testing.T) {
+	headings := ParseMarkdownHeadings(sampleMarkdown)
+
+	expected := []struct {
+		level int
+		title string
+	}{
+		{0, ""},
+		{1, "Introduction"},
+		{2, "Background"},
+		{3, "Deep Detail"},
+		{1, "Usage"},
+		{4, "Skipped Level"},
+	}
+	if len(headings) != len(expected) {
+		t.Fatalf("Expected %d headings, got %d: %+v", len(expected), len(headings), headings)
+	}
+	for i, want := range expected {
+		if headings[i].Level != want.level || headings[i].Title != want.title {
+			t.Errorf("heading %d: expected h%d %q, got h%d %q", i, want.level, want.title, headings[i].Level, headings[i].Title)
+		}
+	}
+
+	if headings[0].Body != "Preface text." {
+		t.Errorf("Unexpected preamble: %q", headings[0].Body)
+	}
+	if !strings.Contains(headings[2].Body, "# not a heading") {
+		t.Errorf("Fenced code should stay in section body: %q", headings[2].Body)
+	}
+	if headings[4].Line != 17 {
+		t.Errorf("Expected setext heading on line 17, got %d", headings[4].Line)
+	}
+}
+
+func TestBuildHeadingTreeSectionMode(t *testing.T) {
+	root, total := BuildHeadingTree("Guide", ParseMarkdownHeadings(sampleMarkdown), PageModeSection, 0)
+
+	if total != 6 {
+		t.Fatalf("Expected 6 virtual pages, got %d", total)
+	}
+	if root.Title != "Guide" || root.Content != "Preface text." {
+		t.Errorf("Unexpected root: %+v", root)
+	}
+	if len(root.Nodes) != 2 {
+		t.Fatalf("Expected 2 top-level sections, got %d", len(root.Nodes))
+	}
+
+	intro := root.Nodes[0]
+	if intro.NodeID != "0001" || *intro.StartIndex != 2 || *intro.EndIndex != 4 {
+		t.Errorf("Unexpected intro node: id=%s pages %d-%d", intro.NodeID, *intro.StartIndex, *intro.EndIndex)
+	}
+	if got := intro.Nodes[0].Nodes[0].Title; got != "Deep Detail" {
+		t.Errorf("Expected h3 nested under h2, got %q", got)
+	}
+
+	usage := root.Nodes[1]
+	if len(usage.Nodes) != 1 || usage.Nodes[0].Title != "Skipped Level" {
+		t.Errorf("Expected skipped-level heading nested under Usage, got %+v", usage.Nodes)
+	}
+
+	if result := ValidateTree(root, &total); !result.Valid || len(result.Warnings) != 0 {
+		t.Errorf("Generated tree should validate cleanly: %+v", result.Issues())
+	}
+}
+
+func TestBuildHeadingTreeLineMode(t *testing.T) {
+	totalLines := strings.Count(sampleMarkdown, "\n") + 1
+	root, total := BuildHeadingTree("Guide", ParseMarkdownHeadings(sampleMarkdown), PageModeLine, totalLines)
+
+	if total != totalLines {
+		t.Errorf("Expected total pages %d, got %d", totalLines, total)
+	}
+	intro := root.Nodes[0]
+	if *intro.StartIndex != 3 || *intro.EndIndex != 16 {
+		t.Errorf("Expected intro on lines 3-16, got %d-%d", *intro.StartIndex, *intro.EndIndex)
+	}
+	if result := ValidateTree(root, &total); !result.Valid {
+		t.Errorf("Generated tree should validate: %+v", result.Errors)
+	}
+}
+
+func TestParseHTMLHeadings(t *testing.T) {
+	src := `<html><head><title>Doc</title><style>h1 { color: red }</style></head>
+<body>
+<p>Lead paragraph.</p>
+<h1>Overview &amp; Scope</h1>
+<p>First   paragraph.</p><p>Second paragraph.</p>
+<h2><span>Details</span></h2>
+<script>document.write("<h1>fake</h1>")</script>
+<ul><li>one</li><li>two</li></ul>
+</body></html>`
+
+	headings, err := ParseHTMLHeadings(src)
+	if err != nil {
+		t.Fatalf("ParseHTMLHeadings failed: %v", err)
+	}
+	if len(headings) != 3 {
+		t.Fatalf("Expected preamble + 2 headings, got %d: %+v", len(headings), headings)
+	}
+	if headings[1].Title != "Overview & Scope" || headings[1].Level != 1 || headings[1].Line != 4 {
+		t.Errorf("Unexpected h1: %+v", headings[1])
+	}
+	if headings[1].Body != "First paragraph.\nSecond paragraph." {
+		t.Errorf("Unexpected h1 body: %q", headings[1].Body)
+	}
+	if headings[2].Title != "Details" || headings[2].Body != "one\ntwo" {
+		t.Errorf("Unexpected h2: %+v", headings[2])
+	}
+}
+
+func TestHeadingImporterSummarize(t *testing.T) {
+	llm := &scriptedLLM{responses: []string{"child summary", "root summary"}}
+	imp := NewHeadingImporter(nil, llm)
+
+	req, err := imp.Convert(context.Background(), DocumentImportRequest{
+		DocumentName: "Notes",
+		Format:       "markdown",
+		Content:      "# Only Section\nbody",
+		Summarize:    true,
+	})
+	if err != nil {
+		t.Fatalf("Convert failed: %v", err)
+	}
+	if req.Structure.Summary != "root summary" || req.Structure.Nodes[0].Summary != "child summary" {
+		t.Errorf("Expected bottom-up summaries, got root=%q child=%q",
+			req.Structure.Summary, req.Structure.Nodes[0].Summary)
+	}
+
+	if _, err := NewHeadingImporter(nil, nil).Convert(context.Background(), DocumentImportRequest{
+		DocumentName: "Notes", Format: "markdown", Content: "# A", Summarize: true,
+	}); err == nil {
+		t.Error("Expected error when summarizing without an LLM")
+	}
+}
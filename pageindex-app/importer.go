@@ -2,6 +2,8 @@ package main
 
 import (
 	"fmt"
+
+	"github.com/jmoiron/sqlx"
 )
 
 // PageIndexImporter PageIndex JSON 导入器
@@ -14,47 +16,84 @@ func NewPageIndexImporter(repo *DocumentRepository) *PageIndexImporter {
 }
 
 // Import 导入 PageIndex 生成的 JSON 结构
-func (imp *PageIndexImporter) Import(req ImportRequest) error {
-	// 1. 创建文档记录
+// 先校验树结构（见 ValidateTree），通过后文档、节点、校验问题与版本 1 的快照在同一个事务中写入，
+// 任何一步失败都会整体回滚
+func (imp *PageIndexImporter) Import(req ImportRequest) (*ImportResult, error) {
+	validation := ValidateTree(req.Structure, req.TotalPages)
+	if validation.Rejects(req.Mode) {
+		return nil, &ValidationError{Result: validation}
+	}
+	issues := validation.Issues()
+
 	doc := &Document{
 		Name:       req.DocumentName,
 		TotalPages: req.TotalPages,
 	}
 
-	if err := imp.repo.CreateDocument(doc); err != nil {
-		return fmt.Errorf("create document failed: %w", err)
-	}
-
-	// 2. 递归导入节点
-	return imp.importNode(doc.ID, req.Structure, "", 0)
-}
+	err := imp.repo.WithTx(func(tx *sqlx.Tx) error {
+		// 1. 创建文档记录（RETURNING id）
+		if err := imp.repo.CreateDocumentTx(tx, doc); err != nil {
+			return fmt.Errorf("create document failed: %w", err)
+		}
 
-// importNode 递归导入节点
-func (imp *PageIndexImporter) importNode(docID int64, jsonNode PageIndexJSON, parentID string, level int) error {
-	// 创建当前节点
-	node := &PageIndexNode{
-		DocID:     &docID,
-		NodeID:    jsonNode.NodeID,
-		ParentID:  parentID,
-		Title:     jsonNode.Title,
-		StartPage: jsonNode.StartIndex,
-		EndPage:   jsonNode.EndIndex,
-		Summary:   jsonNode.Summary,
-		Level:     &level,
-	}
+		// 2. 展平节点树并批量写入
+		nodes := flattenTree(doc.ID, req.Structure)
+		if err := imp.repo.CreateNodesTx(tx, nodes); err != nil {
+			return fmt.Errorf("create nodes failed: %w", err)
+		}
 
-	if err := imp.repo.CreateNode(node); err != nil {
-		return fmt.Errorf("create node %s failed: %w", jsonNode.NodeID, err)
-	}
+		// 3. 保存校验问题
+		if err := imp.repo.CreateValidationIssuesTx(tx, doc.ID, issues); err != nil {
+			return err
+		}
 
-	// 递归处理子节点
-	for _, childJSON := range jsonNode.Nodes {
-		if err := imp.importNode(docID, childJSON, jsonNode.NodeID, level+1); err != nil {
+		// 4. 保存树快照为版本 1
+		version, err := imp.createVersionTx(tx, doc.ID, req)
+		if err != nil {
 			return err
 		}
+		if err := imp.repo.ActivateVersionTx(tx, version); err != nil {
+			return fmt.Errorf("activate version failed: %w", err)
+		}
+		doc.ActiveVersion = version.Version
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
+	return &ImportResult{
+		Document: doc,
+		Issues:   issues,
+	}, nil
+}
+
+// flattenTree 将 PageIndex 树按先序遍历展平为节点列表
+func flattenTree(docID int64, root PageIndexJSON) []*PageIndexNode {
+	var nodes []*PageIndexNode
+	var walk func(jsonNode PageIndexJSON, parentID string, level int)
+	walk = func(jsonNode PageIndexJSON, parentID string, level int) {
+		lvl := level
+		nodes = append(nodes, &PageIndexNode{
+			DocID:     &docID,
+			NodeID:    jsonNode.NodeID,
+			ParentID:  parentID,
+			Title:     jsonNode.Title,
+			StartPage: jsonNode.StartIndex,
+			EndPage:   jsonNode.EndIndex,
+			Summary:   jsonNode.Summary,
+			Content:   jsonNode.Content,
+			Level:     &lvl,
+			// 区分叶子节点的 "nodes": [] 与没有 nodes 键，导出时按原样输出
+			EmptyNodes: jsonNode.Nodes != nil && len(jsonNode.Nodes) == 0,
+		})
+
+		for _, child := range jsonNode.Nodes {
+			walk(child, jsonNode.NodeID, level+1)
+		}
+	}
+	walk(root, "", 0)
+	return nodes
 }
 
 // BuildHierarchy 构建层级结构（用于响应）
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/fndome/xb"
+)
+
+func sampleStructure() PageIndexJSON {
+	return PageIndexJSON{
+		Title:      "Annual Report",
+		NodeID:     "0000",
+		StartIndex: xb.Int(1),
+		EndIndex:   xb.Int(50),
+		Nodes: []PageIndexJSON{
+			{
+				Title:      "Chapter 1",
+				NodeID:     "0001",
+				StartIndex: xb.Int(1),
+				EndIndex:   xb.Int(20),
+				Nodes: []PageIndexJSON{
+					{Title: "Section 1.1", NodeID: "0002", StartIndex: xb.Int(1), EndIndex: xb.Int(10)},
+					{Title: "Section 1.2", NodeID: "0003", StartIndex: xb.Int(11), EndIndex: xb.Int(20)},
+				},
+			},
+			{Title: "Chapter 2", NodeID: "0004", StartIndex: xb.Int(21), EndIndex: xb.Int(50)},
+		},
+	}
+}
+
+func TestFlattenTree(t *testing.T) {
+	nodes := flattenTree(7, sampleStructure())
+
+	if len(nodes) != 5 {
+		t.Fatalf("Expected 5 nodes, got %d", len(nodes))
+	}
+
+	expected := []struct {
+		nodeID   string
+		parentID string
+		level    int
+	}{
+		{"0000", "", 0},
+		{"0001", "0000", 1},
+		{"0002", "0001", 2},
+		{"0003", "0001", 2},
+		{"0004", "0000", 1},
+	}
+	for i, want := range expected {
+		got := nodes[i]
+		if got.NodeID != want.nodeID || got.ParentID != want.parentID || *got.Level != want.level {
+			t.Errorf("node %d: expected %+v, got node_id=%s parent_id=%s level=%d",
+				i, want, got.NodeID, got.ParentID, *got.Level)
+		}
+		if *got.DocID != 7 {
+			t.Errorf("node %d: expected doc_id 7, got %d", i, *got.DocID)
+		}
+	}
+}
+
+func TestBuildNodeBatchInsert(t *testing.T) {
+	nodes := flattenTree(1, sampleStructure())[:2]
+	sql, args := buildNodeBatchInsert(nodes)
+
+	if !strings.HasPrefix(sql, "INSERT INTO page_index_nodes") {
+		t.Errorf("Unexpected SQL: %s", sql)
+	}
+	if !strings.Contains(sql, "($12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22)") {
+		t.Errorf("Second row placeholders should start at $12: %s", sql)
+	}
+	if len(args) != 22 {
+		t.Errorf("Expected 22 args, got %d", len(args))
+	}
+}
+
+func TestImportTransactional(t *testing.T) {
+	db := setupTestDB(t)
+	if db == nil {
+		return
+	}
+	defer db.Close()
+
+	repo := NewDocumentRepository(db)
+	importer := NewPageIndexImporter(repo)
+
+	result, err := importer.Import(ImportRequest{
+		DocumentName: "Annual Report",
+		TotalPages:   xb.Int(50),
+		Structure:    sampleStructure(),
+	})
+	if err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	doc := result.Document
+	if doc.ID == 0 {
+		t.Fatal("Expected doc ID to be set via RETURNING id")
+	}
+
+	var count int
+	db.Get(&count, "SELECT COUNT(*) FROM page_index_nodes WHERE doc_id = $1", doc.ID)
+	if count != 5 {
+		t.Errorf("Expected 5 nodes, got %d", count)
+	}
+
+	// node_id 超过 VARCHAR(50)，插入失败后文档也应回滚
+	broken := sampleStructure()
+	broken.Nodes[1].NodeID = strings.Repeat("x", 60)
+	if _, err := importer.Import(ImportRequest{DocumentName: "Broken", Structure: broken}); err == nil {
+		t.Fatal("Expected import to fail")
+	}
+
+	db.Get(&count, "SELECT COUNT(*) FROM documents WHERE name = 'Broken'")
+	if count != 0 {
+		t.Errorf("Expected failed import to be rolled back, found %d documents", count)
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"log"
+	"os"
 
 	"github.com/gin-gonic/gin"
 	"github.com/jmoiron/sqlx"
@@ -18,7 +19,27 @@ func main() {
 
 	// 创建服务
 	repo := NewDocumentRepository(db)
+	if config := os.Getenv("FULLTEXT_CONFIG"); config != "" {
+		if err := repo.SetFullTextConfig(config); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// 运维子命令：embed-backfill / summarize-backfill
+	if len(os.Args) > 1 {
+		if err := runCommand(os.Args[1:], repo, os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	importer := NewPageIndexImporter(repo)
+	llm := llmFromEnv()
+	searcher := NewTreeSearcher(repo, llm)
+	semantic := NewSemanticSearcher(repo, embedderFromEnv())
+	summaries := NewSummaryBackfiller(repo, llm)
+	pages := NewPageService(repo)
+	headings := NewHeadingImporter(importer, llm)
 
 	// 创建 HTTP 服务
 	r := gin.Default()
@@ -28,27 +49,90 @@ func main() {
 	{
 		// 导入
 		api.POST("/import", ImportHandler(importer))
+		api.POST("/import/document", ImportDocumentHandler(headings))
+		api.POST("/validate", ValidateHandler())
 
 		// 搜索
 		api.GET("/search/title", SearchByTitleHandler(repo))
 		api.GET("/search/page", SearchByPageHandler(repo))
 		api.GET("/search/level", SearchByLevelHandler(repo))
+		api.POST("/search/semantic", SemanticSearchHandler(semantic))
+		api.GET("/search/fulltext", FullTextSearchHandler(repo))
+
+		// 推理检索（LLM 沿目录树逐层定位）
+		api.POST("/query", QueryHandler(searcher))
+
+		// 文档目录与版本
+		api.GET("/documents", ListDocumentsHandler(repo))
+		api.GET("/documents/:id", GetDocumentHandler(repo))
+		api.DELETE("/documents/:id", DeleteDocumentHandler(repo))
+		api.POST("/documents/:id/versions", ReimportHandler(importer))
+		api.GET("/documents/:id/versions", ListVersionsHandler(repo))
+		api.POST("/documents/:id/versions/:version/activate", ActivateVersionHandler(importer))
+		api.GET("/documents/:id/diff", DiffVersionsHandler(importer))
+
+		// 文档树导出
+		api.GET("/documents/:id/tree", GetDocumentTreeHandler(importer))
+		api.GET("/documents/:id/toc", GetDocumentTOCHandler(importer))
+
+		// 页面原文
+		api.POST("/documents/:id/pages", UploadPagesHandler(pages))
+		api.GET("/documents/:id/pages/:n", GetPageHandler(repo))
+
+		// 摘要回填任务
+		api.POST("/summary-jobs", CreateSummaryJobHandler(summaries))
+		api.GET("/summary-jobs/:id", GetSummaryJobHandler(repo))
+		api.POST("/summary-jobs/:id/resume", ResumeSummaryJobHandler(summaries))
 
 		// 节点详情
 		api.GET("/nodes/:node_id/children", GetNodeWithChildrenHandler(importer))
+		api.GET("/nodes/:node_id/path", GetNodePathHandler(repo))
+		api.GET("/nodes/:node_id/descendants", GetNodeDescendantsHandler(repo))
+		api.GET("/nodes/:node_id/siblings", GetNodeSiblingsHandler(repo))
 	}
 
 	// 启动服务
 	log.Println("PageIndex Server starting on :8080")
 	log.Println("Endpoints:")
-	log.Println("  POST /api/import - 导入 PageIndex JSON")
-	log.Println("  GET  /api/search/title?doc_id=1&keyword=xxx - 标题搜索")
+	log.Println("  POST /api/import - 导入 PageIndex JSON（mode: strict|lenient）")
+	log.Println("  POST /api/import/document - 从 Markdown / HTML 标题生成目录树并导入")
+	log.Println("  POST /api/validate - 校验 PageIndex JSON（不导入）")
+	log.Println("  GET  /api/search/title?doc_id=1&keyword=xxx - 标题搜索（&with_path=true 附带面包屑）")
 	log.Println("  GET  /api/search/page?doc_id=1&page=25 - 页码搜索")
 	log.Println("  GET  /api/search/level?doc_id=1&level=2 - 层级搜索")
+	log.Println("  GET  /api/search/fulltext?q=liquidity&doc_ids=1,2 - 跨文档全文检索（按文档分组，带高亮片段）")
+	log.Println("  POST /api/search/semantic - 语义检索（可跨文档，按 level / page 过滤）")
+	log.Println("  POST /api/query - 推理检索问答")
+	log.Println("  GET  /api/documents?keyword=report - 文档目录")
+	log.Println("  GET  /api/documents/:id - 文档详情（版本、校验问题）")
+	log.Println("  DELETE /api/documents/:id - 删除文档")
+	log.Println("  POST /api/documents/:id/versions - 重新导入（保存为新版本并切换）")
+	log.Println("  GET  /api/documents/:id/versions - 版本列表")
+	log.Println("  POST /api/documents/:id/versions/:version/activate - 切换当前版本")
+	log.Println("  GET  /api/documents/:id/diff?from=1&to=2 - 版本差异（新增 / 删除 / 改名节点）")
+	log.Println("  GET  /api/documents/:id/tree?node_id=0006&depth=2 - 导出树结构")
+	log.Println("  GET  /api/documents/:id/toc?format=markdown|html|json&with_summary=true&depth=2 - 渲染目录")
+	log.Println("  POST /api/documents/:id/pages - 上传页面原文（JSON 数组或 \\f 分页文本）")
+	log.Println("  GET  /api/documents/:id/pages/:n - 单页原文")
+	log.Println("  POST /api/summary-jobs - 后台为空摘要节点生成摘要（doc_id、concurrency 可选）")
+	log.Println("  GET  /api/summary-jobs/:id - 摘要任务进度")
+	log.Println("  POST /api/summary-jobs/:id/resume - 恢复中断或失败的摘要任务")
 	log.Println("  GET  /api/nodes/:node_id/children?doc_id=1 - 节点详情")
+	log.Println("  GET  /api/nodes/:node_id/path?doc_id=1 - 节点路径（面包屑）")
+	log.Println("  GET  /api/nodes/:node_id/descendants?doc_id=1&max_depth=2 - 全部后代")
+	log.Println("  GET  /api/nodes/:node_id/siblings?doc_id=1 - 兄弟节点")
 
 	if err := r.Run(":8080"); err != nil {
 		log.Fatal(err)
 	}
 }
 
+// llmFromEnv 从环境变量创建 LLM 客户端
+func llmFromEnv() LLMService {
+	return NewOpenAIClient(os.Getenv("OPENAI_API_KEY"), os.Getenv("OPENAI_BASE_URL"), os.Getenv("OPENAI_MODEL"))
+}
+
+// embedderFromEnv 从环境变量创建 Embedding 客户端
+func embedderFromEnv() Embedder {
+	return NewOpenAIEmbedder(os.Getenv("OPENAI_API_KEY"), os.Getenv("OPENAI_BASE_URL"), os.Getenv("OPENAI_EMBEDDING_MODEL"))
+}
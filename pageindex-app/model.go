@@ -1,40 +1,96 @@
 package main
 
 import (
+	"encoding/json"
 	"time"
+
+	"github.com/fndome/xb"
 )
 
 // Document 文档
 type Document struct {
-	ID         int64     `json:"id" db:"id"`
-	Name       string    `json:"name" db:"name"`
-	TotalPages *int      `json:"total_pages" db:"total_pages"`
-	CreatedAt  time.Time `json:"created_at" db:"created_at"`
+	ID            int64     `json:"id" db:"id"`
+	Name          string    `json:"name" db:"name"`
+	TotalPages    *int      `json:"total_pages" db:"total_pages"`
+	ActiveVersion *int      `json:"active_version" db:"active_version"` // 当前生效的树版本
+	CreatedAt     time.Time `json:"created_at" db:"created_at"`
 }
 
 func (*Document) TableName() string {
 	return "documents"
 }
 
+// DocumentVersion 文档树的一个导入版本（保存完整的 PageIndex JSON 快照）
+type DocumentVersion struct {
+	ID           int64     `json:"-" db:"id"`
+	DocID        *int64    `json:"doc_id" db:"doc_id"`
+	Version      *int      `json:"version" db:"version"`
+	DocumentName string    `json:"document_name" db:"document_name"`
+	TotalPages   *int      `json:"total_pages" db:"total_pages"`
+	NodeCount    *int      `json:"node_count" db:"node_count"`
+	Structure    []byte    `json:"-" db:"structure"` // PageIndexJSON（JSONB）
+	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+}
+
+func (*DocumentVersion) TableName() string {
+	return "document_versions"
+}
+
 // PageIndexNode PageIndex 节点（扁平化存储）
 type PageIndexNode struct {
-	ID        int64     `json:"id" db:"id"`
-	DocID     *int64    `json:"doc_id" db:"doc_id"`
-	NodeID    string    `json:"node_id" db:"node_id"`
-	ParentID  string    `json:"parent_id" db:"parent_id"`
-	Title     string    `json:"title" db:"title"`
-	StartPage *int      `json:"start_page" db:"start_page"`
-	EndPage   *int      `json:"end_page" db:"end_page"`
-	Summary   string    `json:"summary" db:"summary"`
-	Content   string    `json:"content" db:"content"`
-	Level     *int      `json:"level" db:"level"`
-	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	ID        int64  `json:"id" db:"id"`
+	DocID     *int64 `json:"doc_id" db:"doc_id"`
+	NodeID    string `json:"node_id" db:"node_id"`
+	ParentID  string `json:"parent_id" db:"parent_id"`
+	Title     string `json:"title" db:"title"`
+	StartPage *int   `json:"start_page" db:"start_page"`
+	EndPage   *int   `json:"end_page" db:"end_page"`
+	Summary   string `json:"summary" db:"summary"`
+	Content   string `json:"content" db:"content"`
+	Level     *int   `json:"level" db:"level"`
+	// EmptyNodes 导入 JSON 中该叶子节点带有 "nodes": []（导出时原样保留该键）
+	EmptyNodes bool      `json:"-" db:"empty_nodes"`
+	Embedding  xb.Vector `json:"-" db:"embedding"` // 标题 + 摘要的向量（已归一化）
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`
 }
 
 func (*PageIndexNode) TableName() string {
 	return "page_index_nodes"
 }
 
+// DocumentPage 文档页面原文
+type DocumentPage struct {
+	ID         int64     `json:"id" db:"id"`
+	DocID      *int64    `json:"doc_id" db:"doc_id"`
+	PageNumber *int      `json:"page" db:"page_number"`
+	Text       string    `json:"text" db:"text"`
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`
+}
+
+func (*DocumentPage) TableName() string {
+	return "document_pages"
+}
+
+// SummaryJob 摘要回填任务
+type SummaryJob struct {
+	ID          int64      `json:"id" db:"id"`
+	DocID       *int64     `json:"doc_id" db:"doc_id"` // 为空表示全部文档
+	Status      string     `json:"status" db:"status"` // pending | running | completed | failed
+	Concurrency int        `json:"concurrency" db:"concurrency"`
+	Total       int        `json:"total" db:"total"`     // 需要生成摘要的节点数（含已完成）
+	Done        int        `json:"done" db:"done"`       // 已生成
+	Failed      int        `json:"failed" db:"failed"`   // LLM 调用失败（重新运行时会重试）
+	Skipped     int        `json:"skipped" db:"skipped"` // 没有正文也没有子节点摘要
+	LastError   string     `json:"last_error" db:"last_error"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at" db:"updated_at"`
+	FinishedAt  *time.Time `json:"finished_at" db:"finished_at"`
+}
+
+func (*SummaryJob) TableName() string {
+	return "summary_jobs"
+}
+
 // PageIndexJSON PageIndex 生成的原始 JSON 结构
 type PageIndexJSON struct {
 	Title      string          `json:"title"`
@@ -42,14 +98,61 @@ type PageIndexJSON struct {
 	StartIndex *int            `json:"start_index"`
 	EndIndex   *int            `json:"end_index"`
 	Summary    string          `json:"summary"`
+	Content    string          `json:"content,omitempty"` // PageIndex 原始输出没有该字段，由标题导入等来源填充
 	Nodes      []PageIndexJSON `json:"nodes"`
 }
 
+// MarshalJSON 叶子节点的 nodes 键与输入保持一致：输入为 "nodes": [] 时（Nodes 非 nil）输出空数组，没有该键时（Nodes 为 nil）省略
+func (p PageIndexJSON) MarshalJSON() ([]byte, error) {
+	type plain PageIndexJSON
+	out := struct {
+		plain
+		Nodes *[]PageIndexJSON `json:"nodes,omitempty"`
+	}{plain: plain(p)}
+	if p.Nodes != nil {
+		out.Nodes = &p.Nodes
+	}
+	return json.Marshal(out)
+}
+
 // ImportRequest 导入请求
 type ImportRequest struct {
 	DocumentName string        `json:"document_name" binding:"required"`
 	TotalPages   *int          `json:"total_pages"`
 	Structure    PageIndexJSON `json:"structure" binding:"required"`
+	Mode         string        `json:"mode,omitempty" binding:"omitempty,oneof=strict lenient"` // 校验模式，默认 lenient
+}
+
+// DocumentImportRequest Markdown / HTML 文档导入请求（按标题层级生成 PageIndex 树）
+type DocumentImportRequest struct {
+	DocumentName string `json:"document_name" binding:"required"`
+	Format       string `json:"format" binding:"required,oneof=markdown html"`
+	Content      string `json:"content" binding:"required"`
+	PageMode     string `json:"page_mode" binding:"omitempty,oneof=section line"` // 虚拟页码方式，默认 section
+	Summarize    bool   `json:"summarize"`                                        // 使用 LLM 生成节点摘要
+	Mode         string `json:"mode,omitempty" binding:"omitempty,oneof=strict lenient"`
+}
+
+// ImportResult 导入结果
+type ImportResult struct {
+	Document *Document          `json:"document"`
+	Issues   []*ValidationIssue `json:"issues"` // 随文档保存的校验问题（lenient 模式）
+}
+
+// ValidationIssue 树结构校验问题
+type ValidationIssue struct {
+	Severity string `json:"severity" db:"severity"` // error | warning
+	Code     string `json:"code" db:"code"`
+	Path     string `json:"path" db:"path"` // 如 structure.nodes[0].nodes[1]
+	NodeID   string `json:"node_id" db:"node_id"`
+	Message  string `json:"message" db:"message"`
+}
+
+// ValidationResult 校验结果
+type ValidationResult struct {
+	Valid    bool               `json:"valid"`
+	Errors   []*ValidationIssue `json:"errors"`
+	Warnings []*ValidationIssue `json:"warnings"`
 }
 
 // SearchByTitleRequest 标题搜索请求
@@ -64,6 +167,172 @@ type SearchByPageRequest struct {
 	Page  *int   `json:"page" binding:"required"`
 }
 
+// TreeRequest 树导出请求
+type TreeRequest struct {
+	NodeID string `form:"node_id"` // 子树根节点，为空时导出整棵树
+	Depth  int    `form:"depth"`   // 根节点以下的层数，0 表示不限制
+	// WithContent 导出节点原文（默认不导出：原文可能很大，PageIndex 原始格式也没有该字段）
+	WithContent bool `form:"with_content"`
+}
+
+// TOCRequest 目录渲染请求
+type TOCRequest struct {
+	TreeRequest
+	Format      string `form:"format"`       // markdown（默认）| html | json
+	WithSummary bool   `form:"with_summary"` // 在标题下附带节点摘要
+}
+
+// TOCEntry 目录条目（format=json）
+type TOCEntry struct {
+	NodeID    string      `json:"node_id"`
+	Title     string      `json:"title"`
+	Depth     int         `json:"depth"`
+	StartPage *int        `json:"start_page"`
+	EndPage   *int        `json:"end_page"`
+	PageURL   string      `json:"page_url,omitempty"`
+	Summary   string      `json:"summary,omitempty"`
+	Children  []*TOCEntry `json:"children,omitempty"`
+}
+
+// QueryRequest 推理检索请求
+type QueryRequest struct {
+	DocID    *int64 `json:"doc_id" binding:"required"`
+	Question string `json:"question" binding:"required"`
+	MaxSteps *int   `json:"max_steps"` // 最多展开几轮，默认 4
+}
+
+// QueryResponse 推理检索响应
+type QueryResponse struct {
+	Answer    string        `json:"answer"`
+	Citations []*Citation   `json:"citations"`
+	Trace     []*SearchStep `json:"trace"`
+}
+
+// Citation 答案引用的节点
+type Citation struct {
+	NodeID    string `json:"node_id"`
+	Title     string `json:"title"`
+	StartPage *int   `json:"start_page"`
+	EndPage   *int   `json:"end_page"`
+}
+
+// SearchStep 树搜索的一步决策
+type SearchStep struct {
+	Step      int      `json:"step"`
+	Action    string   `json:"action"` // expand | select
+	NodeIDs   []string `json:"node_ids"`
+	Reasoning string   `json:"reasoning"`
+}
+
+// NodeHit 搜索结果节点（可附带面包屑路径）
+type NodeHit struct {
+	*PageIndexNode
+	Breadcrumb string `json:"breadcrumb,omitempty"` // 如 "Chapter 3 > 3.2 Risk > Liquidity"
+}
+
+// SemanticSearchRequest 语义检索请求
+type SemanticSearchRequest struct {
+	Query    string  `json:"query" binding:"required"`
+	DocIDs   []int64 `json:"doc_ids"`   // 为空时检索全部文档
+	Level    *int    `json:"level"`     // 只返回该层级的节点
+	Page     *int    `json:"page"`      // 只返回包含该页的节点
+	Limit    int     `json:"limit"`     // 默认 10，最多 100
+	WithPath bool    `json:"with_path"` // 附带面包屑
+}
+
+// SemanticHit 语义检索结果（distance 越小越相似）
+type SemanticHit struct {
+	PageIndexNode
+	Distance   float64 `json:"distance" db:"distance"`
+	Breadcrumb string  `json:"breadcrumb,omitempty" db:"-"`
+}
+
+// FullTextRequest 跨文档全文检索请求
+type FullTextRequest struct {
+	Query    string `form:"q" binding:"required"` // websearch 语法："exact phrase" -exclude a OR b
+	DocIDs   string `form:"doc_ids"`              // 逗号分隔，为空时检索全部文档
+	PerDoc   int    `form:"per_doc"`              // 每个文档最多返回的节点数，0 表示不限制
+	Limit    int    `form:"limit"`                // 默认 20，最多 100
+	WithPath bool   `form:"with_path"`
+}
+
+// FullTextHit 全文检索命中的节点
+type FullTextHit struct {
+	PageIndexNode
+	DocumentName   string  `json:"-" db:"document_name"`
+	Rank           float64 `json:"rank" db:"rank"`
+	TitleHighlight string  `json:"title_highlight" db:"title_highlight"` // 已转义的 HTML，命中词以 <mark> 标记
+	Snippet        string  `json:"snippet" db:"snippet"`                 // 摘要与正文中的高亮片段（同上）
+	Breadcrumb     string  `json:"breadcrumb,omitempty" db:"-"`
+}
+
+// DocumentHits 按文档分组的检索结果
+type DocumentHits struct {
+	DocID        int64          `json:"doc_id"`
+	DocumentName string         `json:"document_name"`
+	Rank         float64        `json:"rank"` // 文档内最高的节点得分
+	Hits         []*FullTextHit `json:"hits"`
+}
+
+// SummaryJobRequest 创建摘要回填任务的请求
+type SummaryJobRequest struct {
+	DocID       *int64 `json:"doc_id"`      // 为空时处理全部文档
+	Concurrency int    `json:"concurrency"` // 并发调用 LLM 的上限，默认 4
+}
+
+// DocumentInfo 文档目录项
+type DocumentInfo struct {
+	Document
+	NodeCount    int `json:"node_count" db:"node_count"`
+	PageCount    int `json:"page_count" db:"page_count"` // 已上传的页面原文数
+	VersionCount int `json:"version_count" db:"version_count"`
+}
+
+// DocumentDetail 文档详情
+type DocumentDetail struct {
+	*DocumentInfo
+	Versions []*DocumentVersion `json:"versions"`
+	Issues   []*ValidationIssue `json:"issues"` // 当前版本的校验问题
+}
+
+// TreeDiff 两个版本之间的节点差异（按 node_id 对齐）
+type TreeDiff struct {
+	DocID    int64         `json:"doc_id"`
+	From     int           `json:"from"`
+	To       int           `json:"to"`
+	Added    []*NodeChange `json:"added"`
+	Removed  []*NodeChange `json:"removed"`
+	Retitled []*NodeChange `json:"retitled"`
+}
+
+// NodeChange 单个节点的变化
+type NodeChange struct {
+	NodeID    string `json:"node_id"`
+	Title     string `json:"title"`
+	OldTitle  string `json:"old_title,omitempty"`
+	StartPage *int   `json:"start_page"`
+	EndPage   *int   `json:"end_page"`
+}
+
+// NodePathResponse 节点路径响应
+type NodePathResponse struct {
+	Path       []*PageIndexNode `json:"path"`
+	Breadcrumb string           `json:"breadcrumb"`
+}
+
+// PageText 上传的单页文本
+type PageText struct {
+	Page int    `json:"page"`
+	Text string `json:"text"`
+}
+
+// UploadPagesResponse 页面上传响应
+type UploadPagesResponse struct {
+	DocID          int64 `json:"doc_id"`
+	Pages          int   `json:"pages"`
+	NodesAssembled int   `json:"nodes_assembled"`
+}
+
 // NodeResponse 节点响应
 type NodeResponse struct {
 	Node     *PageIndexNode   `json:"node"`
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// pageSeparator 节点正文中页与页之间的分隔
+const pageSeparator = "\n\n"
+
+// ErrInvalidPages 上传的页面数据不合法
+var ErrInvalidPages = errors.New("invalid pages")
+
+// PageService 页面原文上传与节点正文组装
+type PageService struct {
+	repo *DocumentRepository
+}
+
+func NewPageService(repo *DocumentRepository) *PageService {
+	return &PageService{repo: repo}
+}
+
+// UploadPages 替换文档的页面原文，并按 start_page–end_page 重新组装每个节点的 content
+// 页面写入与节点更新在同一事务中完成
+func (s *PageService) UploadPages(docID int64, pages []PageText) (*UploadPagesResponse, error) {
+	doc, err := s.repo.GetDocument(docID)
+	if err != nil {
+		return nil, err
+	}
+	if err := validatePages(pages, doc.TotalPages); err != nil {
+		return nil, err
+	}
+
+	resp := &UploadPagesResponse{DocID: docID, Pages: len(pages)}
+	err = s.repo.WithTx(func(tx *sqlx.Tx) error {
+		if err := s.repo.ReplacePagesTx(tx, docID, pages); err != nil {
+			return err
+		}
+		n, err := s.assembleTx(tx, docID)
+		resp.NodesAssembled = n
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// assembleTx 用已存储的页面组装文档全部节点的 content，返回更新的节点数
+func (s *PageService) assembleTx(tx *sqlx.Tx, docID int64) (int, error) {
+	stored, err := s.repo.FindPagesTx(tx, docID)
+	if err != nil {
+		return 0, err
+	}
+	pages := make(map[int]string, len(stored))
+	for _, p := range stored {
+		pages[*p.PageNumber] = p.Text
+	}
+
+	nodes, err := s.repo.FindNodeRangesTx(tx, docID)
+	if err != nil {
+		return 0, err
+	}
+
+	updated := 0
+	for _, node := range nodes {
+		content := AssembleContent(node, pages)
+		if content == node.Content {
+			continue
+		}
+		if err := s.repo.UpdateNodeContentTx(tx, node.ID, content); err != nil {
+			return updated, fmt.Errorf("update node %s content failed: %w", node.NodeID, err)
+		}
+		updated++
+	}
+	return updated, nil
+}
+
+// AssembleContent 拼接节点页码范围内的页面文本（缺失的页跳过）
+func AssembleContent(node *PageIndexNode, pages map[int]string) string {
+	if node.StartPage == nil || node.EndPage == nil {
+		return ""
+	}
+
+	parts := make([]string, 0, *node.EndPage-*node.StartPage+1)
+	for page := *node.StartPage; page <= *node.EndPage; page++ {
+		if text, ok := pages[page]; ok && text != "" {
+			parts = append(parts, text)
+		}
+	}
+	return strings.Join(parts, pageSeparator)
+}
+
+// ParsePagesJSON 解析 JSON 数组形式的页面
+//
+// 支持两种元素：
+//
+//	["第 1 页文本", "第 2 页文本"]                      // 按顺序从第 1 页编号
+//	[{"page": 1, "text": "..."}, {"page": 3, "text": "..."}]
+func ParsePagesJSON(data []byte) ([]PageText, error) {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("%w: expected a JSON array: %v", ErrInvalidPages, err)
+	}
+
+	pages := make([]PageText, 0, len(raw))
+	for i, item := range raw {
+		var text string
+		if err := json.Unmarshal(item, &text); err == nil {
+			pages = append(pages, PageText{Page: i + 1, Text: text})
+			continue
+		}
+
+		var page PageText
+		if err := json.Unmarshal(item, &page); err != nil {
+			return nil, fmt.Errorf("%w: element %d must be a string or {page, text}", ErrInvalidPages, i)
+		}
+		pages = append(pages, page)
+	}
+	return pages, nil
+}
+
+// ParsePagesText 按换页符（\f）切分纯文本，末尾的空页忽略
+func ParsePagesText(text string) []PageText {
+	parts := strings.Split(text, "\f")
+	if len(parts) > 0 && strings.TrimSpace(parts[len(parts)-1]) == "" {
+		parts = parts[:len(parts)-1]
+	}
+
+	pages := make([]PageText, 0, len(parts))
+	for i, part := range parts {
+		pages = append(pages, PageText{Page: i + 1, Text: strings.TrimSpace(part)})
+	}
+	return pages
+}
+
+// validatePages 检查页码：必须为正、不重复、不超过文档总页数
+func validatePages(pages []PageText, totalPages *int) error {
+	if len(pages) == 0 {
+		return fmt.Errorf("%w: no pages", ErrInvalidPages)
+	}
+
+	seen := make(map[int]bool, len(pages))
+	for _, page := range pages {
+		if page.Page <= 0 {
+			return fmt.Errorf("%w: page number %d must be positive", ErrInvalidPages, page.Page)
+		}
+		if totalPages != nil && page.Page > *totalPages {
+			return fmt.Errorf("%w: page %d exceeds total pages %d", ErrInvalidPages, page.Page, *totalPages)
+		}
+		if seen[page.Page] {
+			return fmt.Errorf("%w: duplicate page %d", ErrInvalidPages, page.Page)
+		}
+		seen[page.Page] = true
+	}
+	return nil
+}
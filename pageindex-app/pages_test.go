@@ -0,0 +1,74 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/fndome/xb"
+)
+
+func TestParsePagesJSON(t *testing.T) {
+	pages, err := ParsePagesJSON([]byte(`["第一页", "第二页"]`))
+	if err != nil {
+		t.Fatalf("ParsePagesJSON failed: %v", err)
+	}
+	if len(pages) != 2 || pages[1].Page != 2 || pages[1].Text != "第二页" {
+		t.Errorf("Unexpected pages: %+v", pages)
+	}
+
+	pages, err = ParsePagesJSON([]byte(`[{"page": 3, "text": "p3"}, {"page": 5, "text": "p5"}]`))
+	if err != nil {
+		t.Fatalf("ParsePagesJSON failed: %v", err)
+	}
+	if len(pages) != 2 || pages[0].Page != 3 || pages[1].Text != "p5" {
+		t.Errorf("Unexpected pages: %+v", pages)
+	}
+
+	for _, input := range []string{`{"page": 1}`, `[1, 2]`} {
+		if _, err := ParsePagesJSON([]byte(input)); !errors.Is(err, ErrInvalidPages) {
+			t.Errorf("Expected ErrInvalidPages for %s, got %v", input, err)
+		}
+	}
+}
+
+func TestParsePagesText(t *testing.T) {
+	pages := ParsePagesText("page one\n\fpage two\n\f\n")
+	if len(pages) != 2 {
+		t.Fatalf("Expected 2 pages (trailing empty page dropped), got %d", len(pages))
+	}
+	if pages[0].Text != "page one" || pages[1].Page != 2 || pages[1].Text != "page two" {
+		t.Errorf("Unexpected pages: %+v", pages)
+	}
+}
+
+func TestAssembleContent(t *testing.T) {
+	pages := map[int]string{1: "p1", 2: "p2", 4: "p4"}
+
+	node := &PageIndexNode{StartPage: xb.Int(1), EndPage: xb.Int(4)}
+	if got := AssembleContent(node, pages); got != "p1\n\np2\n\np4" {
+		t.Errorf("Unexpected content: %q", got)
+	}
+
+	if got := AssembleContent(&PageIndexNode{}, pages); got != "" {
+		t.Errorf("Node without page range should have empty content, got %q", got)
+	}
+}
+
+func TestValidatePages(t *testing.T) {
+	valid := []PageText{{Page: 1}, {Page: 2}}
+	if err := validatePages(valid, xb.Int(2)); err != nil {
+		t.Errorf("Expected valid pages, got %v", err)
+	}
+
+	cases := map[string][]PageText{
+		"empty":     nil,
+		"zero":      {{Page: 0}},
+		"duplicate": {{Page: 1}, {Page: 1}},
+		"too large": {{Page: 3}},
+	}
+	for name, pages := range cases {
+		if err := validatePages(pages, xb.Int(2)); !errors.Is(err, ErrInvalidPages) {
+			t.Errorf("%s: expected ErrInvalidPages, got %v", name, err)
+		}
+	}
+}
@@ -1,21 +1,54 @@
 package main
 
 import (
+	"database/sql"
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+
 	"github.com/fndome/xb"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 )
 
+// insertBatchSize 批量插入时每条 INSERT 的行数
+// page_index_nodes 每行 11 个参数，500 行远低于 PostgreSQL 65535 个参数的上限
+const insertBatchSize = 500
+
 // DocumentRepository 文档仓库
 type DocumentRepository struct {
 	db *sqlx.DB
+	// fullTextConfig 全文检索的文本搜索配置，见 SetFullTextConfig
+	fullTextConfig string
 }
 
 func NewDocumentRepository(db *sqlx.DB) *DocumentRepository {
-	return &DocumentRepository{db: db}
+	return &DocumentRepository{db: db, fullTextConfig: defaultFullTextConfig}
+}
+
+// WithTx 在事务中执行 fn，fn 返回错误时回滚
+func (r *DocumentRepository) WithTx(fn func(tx *sqlx.Tx) error) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return fmt.Errorf("begin tx failed: %w", err)
+	}
+	defer tx.Rollback() // Commit 之后调用无副作用
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 // CreateDocument 创建文档
 func (r *DocumentRepository) CreateDocument(doc *Document) error {
+	return r.CreateDocumentTx(r.db, doc)
+}
+
+// CreateDocumentTx 创建文档（可在事务中调用）
+// lib/pq 不支持 LastInsertId，使用 RETURNING id 回填 doc.ID
+func (r *DocumentRepository) CreateDocumentTx(q sqlx.Queryer, doc *Document) error {
 	sql, args := xb.Of(&Document{}).
 		Insert(func(ib *xb.InsertBuilder) {
 			ib.Set("name", doc.Name).
@@ -24,14 +57,7 @@ func (r *DocumentRepository) CreateDocument(doc *Document) error {
 		Build().
 		SqlOfInsert()
 
-	result, err := r.db.Exec(sql, args...)
-	if err != nil {
-		return err
-	}
-
-	id, _ := result.LastInsertId()
-	doc.ID = id
-	return nil
+	return q.QueryRowx(r.db.Rebind(sql)+" RETURNING id", args...).Scan(&doc.ID)
 }
 
 // CreateNode 创建节点
@@ -51,10 +77,130 @@ func (r *DocumentRepository) CreateNode(node *PageIndexNode) error {
 		Build().
 		SqlOfInsert()
 
-	_, err := r.db.Exec(sql, args...)
+	_, err := r.db.Exec(r.db.Rebind(sql), args...)
 	return err
 }
 
+// CreateNodesTx 批量创建节点（多行 INSERT，可在事务中调用）
+func (r *DocumentRepository) CreateNodesTx(e sqlx.Execer, nodes []*PageIndexNode) error {
+	for start := 0; start < len(nodes); start += insertBatchSize {
+		end := start + insertBatchSize
+		if end > len(nodes) {
+			end = len(nodes)
+		}
+
+		sql, args := buildNodeBatchInsert(nodes[start:end])
+		if _, err := e.Exec(sql, args...); err != nil {
+			return fmt.Errorf("insert nodes [%d, %d) failed: %w", start, end, err)
+		}
+	}
+	return nil
+}
+
+// buildNodeBatchInsert 构建节点的多行 INSERT
+func buildNodeBatchInsert(nodes []*PageIndexNode) (string, []interface{}) {
+	rows := make([][]interface{}, 0, len(nodes))
+	for _, node := range nodes {
+		rows = append(rows, []interface{}{
+			node.DocID, node.NodeID, node.ParentID, node.Title,
+			node.StartPage, node.EndPage, node.Summary, node.Content, node.Level, node.EmptyNodes, node.Embedding,
+		})
+	}
+	return buildBatchInsert("page_index_nodes",
+		[]string{"doc_id", "node_id", "parent_id", "title", "start_page", "end_page", "summary", "content", "level", "empty_nodes", "embedding"},
+		rows)
+}
+
+// buildBatchInsert 构建多行 INSERT
+// xb 的 InsertBuilder 一次只生成一行，批量插入使用原生 SQL
+func buildBatchInsert(table string, cols []string, rows [][]interface{}) (string, []interface{}) {
+	var sb strings.Builder
+	sb.WriteString("INSERT INTO " + table + " (" + strings.Join(cols, ", ") + ") VALUES ")
+
+	args := make([]interface{}, 0, len(rows)*len(cols))
+	for i, row := range rows {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteString("(")
+		for j := range cols {
+			if j > 0 {
+				sb.WriteString(", ")
+			}
+			fmt.Fprintf(&sb, "$%d", i*len(cols)+j+1)
+		}
+		sb.WriteString(")")
+		args = append(args, row...)
+	}
+
+	return sb.String(), args
+}
+
+// GetDocument 根据 ID 查询文档
+func (r *DocumentRepository) GetDocument(docID int64) (*Document, error) {
+	sql, args, _ := xb.Of(&Document{}).
+		Eq("id", docID).
+		Build().
+		SqlOfSelect()
+
+	var doc Document
+	if err := r.db.Get(&doc, r.db.Rebind(sql), args...); err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// FindNodesByDoc 查询文档的全部节点（按插入顺序，即导入时的先序遍历顺序）
+func (r *DocumentRepository) FindNodesByDoc(docID int64) ([]*PageIndexNode, error) {
+	sql, args, _ := xb.Of(&PageIndexNode{}).
+		Eq("doc_id", docID).
+		Sort("id", xb.ASC).
+		Build().
+		SqlOfSelect()
+
+	var nodes []*PageIndexNode
+	err := r.db.Select(&nodes, r.db.Rebind(sql), args...)
+	return nodes, err
+}
+
+// treeNodeColumns 重建树结构所需的列（不含原文与向量）
+const treeNodeColumns = "id, node_id, parent_id, title, start_page, end_page, level, empty_nodes"
+
+// FindTreeNodes 只查询重建树结构所需的列（顺序同 FindNodesByDoc），withSummary / withContent 时附带摘要 / 原文
+func (r *DocumentRepository) FindTreeNodes(docID int64, withSummary, withContent bool) ([]*PageIndexNode, error) {
+	cols := treeNodeColumns
+	if withSummary {
+		cols += ", summary"
+	}
+	if withContent {
+		cols += ", content"
+	}
+
+	var nodes []*PageIndexNode
+	err := r.db.Select(&nodes, "SELECT "+cols+" FROM page_index_nodes WHERE doc_id = $1 ORDER BY id", docID)
+	return nodes, err
+}
+
+// FindNodeContents 按主键批量查询节点正文
+func (r *DocumentRepository) FindNodeContents(ids []int64) (map[int64]string, error) {
+	rows, err := r.db.Query("SELECT id, COALESCE(content, '') FROM page_index_nodes WHERE id = ANY($1)", pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	contents := make(map[int64]string, len(ids))
+	for rows.Next() {
+		var id int64
+		var content string
+		if err := rows.Scan(&id, &content); err != nil {
+			return nil, err
+		}
+		contents[id] = content
+	}
+	return contents, rows.Err()
+}
+
 // FindNodesByTitle 按标题搜索节点
 func (r *DocumentRepository) FindNodesByTitle(docID int64, keyword string) ([]*PageIndexNode, error) {
 	sql, args, _ := xb.Of(&PageIndexNode{}).
@@ -66,7 +212,7 @@ func (r *DocumentRepository) FindNodesByTitle(docID int64, keyword string) ([]*P
 		SqlOfSelect()
 
 	var nodes []*PageIndexNode
-	err := r.db.Select(&nodes, sql, args...)
+	err := r.db.Select(&nodes, r.db.Rebind(sql), args...)
 	return nodes, err
 }
 
@@ -81,7 +227,7 @@ func (r *DocumentRepository) FindNodesByPage(docID int64, page int) ([]*PageInde
 		SqlOfSelect()
 
 	var nodes []*PageIndexNode
-	err := r.db.Select(&nodes, sql, args...)
+	err := r.db.Select(&nodes, r.db.Rebind(sql), args...)
 	return nodes, err
 }
 
@@ -89,13 +235,13 @@ func (r *DocumentRepository) FindNodesByPage(docID int64, page int) ([]*PageInde
 func (r *DocumentRepository) FindNodesByLevel(docID int64, level int) ([]*PageIndexNode, error) {
 	sql, args, _ := xb.Of(&PageIndexNode{}).
 		Eq("doc_id", docID).
-		Eq("level", level).
+		Eq("level", &level). // 传指针：xb 会忽略值为 0 的 int，根节点层级为 0
 		Sort("node_id", xb.ASC).
 		Build().
 		SqlOfSelect()
 
 	var nodes []*PageIndexNode
-	err := r.db.Select(&nodes, sql, args...)
+	err := r.db.Select(&nodes, r.db.Rebind(sql), args...)
 	return nodes, err
 }
 
@@ -109,7 +255,7 @@ func (r *DocumentRepository) FindChildNodes(docID int64, parentNodeID string) ([
 		SqlOfSelect()
 
 	var nodes []*PageIndexNode
-	err := r.db.Select(&nodes, sql, args...)
+	err := r.db.Select(&nodes, r.db.Rebind(sql), args...)
 	return nodes, err
 }
 
@@ -122,7 +268,7 @@ func (r *DocumentRepository) FindNodeByID(docID int64, nodeID string) (*PageInde
 		SqlOfSelect()
 
 	var node PageIndexNode
-	err := r.db.Get(&node, sql, args...)
+	err := r.db.Get(&node, r.db.Rebind(sql), args...)
 	if err != nil {
 		return nil, err
 	}
@@ -140,6 +286,594 @@ func (r *DocumentRepository) FindPageRange(docID int64, startPage, endPage int)
 		SqlOfSelect()
 
 	var nodes []*PageIndexNode
-	err := r.db.Select(&nodes, sql, args...)
+	err := r.db.Select(&nodes, r.db.Rebind(sql), args...)
+	return nodes, err
+}
+
+// ==================== 层级查询（递归 CTE） ====================
+// xb 的 WithRecursive 不支持 UNION ALL 自连接，这里使用原生 SQL
+
+// nodeColumns page_index_nodes 的列（CTE 附加了 depth 列，不能直接 SELECT *）
+const nodeColumns = "id, doc_id, node_id, parent_id, title, start_page, end_page, summary, content, level, empty_nodes, created_at"
+
+// maxTreeDepth 递归深度上限，防止脏数据（parent_id 成环）导致死循环
+const maxTreeDepth = 64
+
+// FindAncestors 查询从根节点到该节点的路径（含节点本身，根节点在前）
+func (r *DocumentRepository) FindAncestors(docID int64, nodeID string) ([]*PageIndexNode, error) {
+	query := `
+		WITH RECURSIVE ancestors AS (
+			SELECT n.*, 0 AS depth
+			FROM page_index_nodes n
+			WHERE n.doc_id = $1 AND n.node_id = $2
+			UNION ALL
+			SELECT p.*, a.depth + 1
+			FROM page_index_nodes p
+			JOIN ancestors a ON p.doc_id = a.doc_id AND p.node_id = a.parent_id
+			WHERE a.depth < $3
+		)
+		SELECT ` + nodeColumns + ` FROM ancestors ORDER BY depth DESC`
+
+	var nodes []*PageIndexNode
+	err := r.db.Select(&nodes, query, docID, nodeID, maxTreeDepth)
+	return nodes, err
+}
+
+// FindDescendants 查询节点的全部后代（先序），maxDepth 为向下的层数，0 表示不限制
+func (r *DocumentRepository) FindDescendants(docID int64, nodeID string, maxDepth int) ([]*PageIndexNode, error) {
+	if maxDepth <= 0 || maxDepth > maxTreeDepth {
+		maxDepth = maxTreeDepth
+	}
+
+	query := `
+		WITH RECURSIVE descendants AS (
+			SELECT n.*, 1 AS depth
+			FROM page_index_nodes n
+			WHERE n.doc_id = $1 AND n.parent_id = $2
+			UNION ALL
+			SELECT c.*, d.depth + 1
+			FROM page_index_nodes c
+			JOIN descendants d ON c.doc_id = d.doc_id AND c.parent_id = d.node_id
+			WHERE d.depth < $3
+		)
+		SELECT ` + nodeColumns + ` FROM descendants ORDER BY id`
+
+	var nodes []*PageIndexNode
+	err := r.db.Select(&nodes, query, docID, nodeID, maxDepth)
+	return nodes, err
+}
+
+// FindSiblings 查询同一父节点下的其他节点
+func (r *DocumentRepository) FindSiblings(docID int64, nodeID string) ([]*PageIndexNode, error) {
+	query := `
+		SELECT s.*
+		FROM page_index_nodes s
+		JOIN page_index_nodes n ON s.doc_id = n.doc_id AND s.parent_id = n.parent_id
+		WHERE n.doc_id = $1 AND n.node_id = $2 AND s.node_id <> n.node_id
+		ORDER BY s.start_page, s.id`
+
+	var nodes []*PageIndexNode
+	err := r.db.Select(&nodes, query, docID, nodeID)
+	return nodes, err
+}
+
+// FindBreadcrumbs 批量查询节点的面包屑（根节点在前的标题列表），一次查询覆盖所有节点
+func (r *DocumentRepository) FindBreadcrumbs(docID int64, nodeIDs []string) (map[string][]string, error) {
+	breadcrumbs := make(map[string][]string, len(nodeIDs))
+	if len(nodeIDs) == 0 {
+		return breadcrumbs, nil
+	}
+
+	query := `
+		WITH RECURSIVE ancestors AS (
+			SELECT n.node_id AS hit_id, n.node_id, n.parent_id, n.title, 0 AS depth
+			FROM page_index_nodes n
+			WHERE n.doc_id = $1 AND n.node_id = ANY($2)
+			UNION ALL
+			SELECT a.hit_id, p.node_id, p.parent_id, p.title, a.depth + 1
+			FROM page_index_nodes p
+			JOIN ancestors a ON p.doc_id = $1 AND p.node_id = a.parent_id
+			WHERE a.depth < $3
+		)
+		SELECT hit_id, title FROM ancestors ORDER BY hit_id, depth DESC`
+
+	rows, err := r.db.Query(query, docID, pq.Array(nodeIDs), maxTreeDepth)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var hitID, title string
+		if err := rows.Scan(&hitID, &title); err != nil {
+			return nil, err
+		}
+		breadcrumbs[hitID] = append(breadcrumbs[hitID], title)
+	}
+	return breadcrumbs, rows.Err()
+}
+
+// ==================== 全文检索 ====================
+
+// defaultFullTextConfig 默认的文本搜索配置
+// english 不切分中文（连续的 CJK 字符整体作为一个词），中文文档需安装 zhparser / pg_jieba 等扩展并通过 SetFullTextConfig 指定
+const defaultFullTextConfig = "english"
+
+// textSearchConfigPattern 文本搜索配置名（会拼接进 SQL，只允许标识符）
+var textSearchConfigPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// SetFullTextConfig 设置全文检索的文本搜索配置（如 zhparser 的 chinese）
+// schema.sql 中 idx_nodes_fulltext 的表达式需使用同一配置重建才能命中索引
+func (r *DocumentRepository) SetFullTextConfig(config string) error {
+	if !textSearchConfigPattern.MatchString(config) {
+		return fmt.Errorf("invalid text search config %q", config)
+	}
+	r.fullTextConfig = config
+	return nil
+}
+
+// nodeSearchVector 节点的加权 tsvector：标题 A、摘要 B、正文 C
+// 需与 schema.sql 中 idx_nodes_fulltext 的表达式保持一致才能命中索引
+func nodeSearchVector(config string) string {
+	return `(setweight(to_tsvector('` + config + `', coalesce(title, '')), 'A') || ` +
+		`setweight(to_tsvector('` + config + `', coalesce(summary, '')), 'B') || ` +
+		`setweight(to_tsvector('` + config + `', coalesce(content, '')), 'C'))`
+}
+
+// ts_headline 以私有区字符标记命中词，转义原文后再替换为 <mark>，避免原文中的 HTML 原样输出
+const (
+	highlightStart = "\uE000"
+	highlightStop  = "\uE001"
+)
+
+// headlineOptions ts_headline 高亮选项
+const headlineOptions = "StartSel=" + highlightStart + ", StopSel=" + highlightStop + ", MaxWords=35, MinWords=15, MaxFragments=2, FragmentDelimiter=\" … \""
+
+// highlightReplacer 把命中标记替换为 <mark>
+var highlightReplacer = strings.NewReplacer(highlightStart, "<mark>", highlightStop, "</mark>")
+
+// highlightHTML 转义 ts_headline 的结果并把命中标记替换为 <mark>，返回可直接嵌入页面的 HTML
+// 原文中本身的标记字符在查询中已由 translate 移除
+func highlightHTML(headline string) string {
+	return highlightReplacer.Replace(html.EscapeString(headline))
+}
+
+// FullTextSearchNodes 跨文档全文检索节点，按 ts_rank_cd 排序并生成高亮片段
+// docIDs 为空时检索全部文档；perDoc > 0 时每个文档最多返回 perDoc 个节点
+// 返回的 TitleHighlight / Snippet 已转义，只包含 <mark> 标签
+func (r *DocumentRepository) FullTextSearchNodes(query string, docIDs []int64, perDoc, limit int) ([]*FullTextHit, error) {
+	config := r.fullTextConfig
+	vector := nodeSearchVector(config)
+	cols := "m." + strings.ReplaceAll(nodeColumns, ", ", ", m.")
+	sqlQuery := `
+		WITH q AS (
+			SELECT websearch_to_tsquery('` + config + `', $1) AS query
+		),
+		matched AS (
+			SELECT ` + nodeColumns + `,
+				ts_rank_cd(` + vector + `, q.query) AS rank
+			FROM page_index_nodes, q
+			WHERE ` + vector + ` @@ q.query
+				AND (COALESCE(cardinality($2::bigint[]), 0) = 0 OR doc_id = ANY($2))
+		),
+		ranked AS (
+			SELECT *, ROW_NUMBER() OVER (PARTITION BY doc_id ORDER BY rank DESC, id) AS doc_rank
+			FROM matched
+		)
+		SELECT ` + cols + `, m.rank, d.name AS document_name,
+			ts_headline('` + config + `', translate(m.title, $5, ''), q.query, 'HighlightAll=true, StartSel=` + highlightStart + `, StopSel=` + highlightStop + `') AS title_highlight,
+			ts_headline('` + config + `', translate(concat_ws(' ', m.summary, m.content), $5, ''), q.query, '` + headlineOptions + `') AS snippet
+		FROM (
+			SELECT * FROM ranked
+			WHERE $3 = 0 OR doc_rank <= $3
+			ORDER BY rank DESC, id
+			LIMIT $4
+		) m
+		JOIN documents d ON d.id = m.doc_id
+		CROSS JOIN q
+		ORDER BY m.rank DESC, m.id`
+
+	hits := []*FullTextHit{}
+	if err := r.db.Select(&hits, sqlQuery, query, pq.Array(docIDs), perDoc, limit, highlightStart+highlightStop); err != nil {
+		return nil, err
+	}
+	for _, hit := range hits {
+		hit.TitleHighlight = highlightHTML(hit.TitleHighlight)
+		hit.Snippet = highlightHTML(hit.Snippet)
+	}
+	return hits, nil
+}
+
+// ==================== 页面原文 ====================
+
+// ReplacePagesTx 替换文档的全部页面（先删后批量插入，需在事务中调用）
+func (r *DocumentRepository) ReplacePagesTx(tx *sqlx.Tx, docID int64, pages []PageText) error {
+	sql, args := xb.Of(&DocumentPage{}).
+		Eq("doc_id", docID).
+		Build().
+		SqlOfDelete()
+
+	if _, err := tx.Exec(tx.Rebind(sql), args...); err != nil {
+		return fmt.Errorf("delete pages failed: %w", err)
+	}
+
+	for start := 0; start < len(pages); start += insertBatchSize {
+		end := start + insertBatchSize
+		if end > len(pages) {
+			end = len(pages)
+		}
+
+		rows := make([][]interface{}, 0, end-start)
+		for _, page := range pages[start:end] {
+			rows = append(rows, []interface{}{docID, page.Page, page.Text})
+		}
+		sql, args := buildBatchInsert("document_pages", []string{"doc_id", "page_number", "text"}, rows)
+		if _, err := tx.Exec(sql, args...); err != nil {
+			return fmt.Errorf("insert pages [%d, %d) failed: %w", start, end, err)
+		}
+	}
+	return nil
+}
+
+// FindPage 查询单页原文
+func (r *DocumentRepository) FindPage(docID int64, page int) (*DocumentPage, error) {
+	sql, args, _ := xb.Of(&DocumentPage{}).
+		Eq("doc_id", docID).
+		Eq("page_number", page).
+		Build().
+		SqlOfSelect()
+
+	var p DocumentPage
+	if err := r.db.Get(&p, r.db.Rebind(sql), args...); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// FindPagesTx 查询文档的全部页面（按页码升序）
+func (r *DocumentRepository) FindPagesTx(q sqlx.Queryer, docID int64) ([]*DocumentPage, error) {
+	sql, args, _ := xb.Of(&DocumentPage{}).
+		Eq("doc_id", docID).
+		Sort("page_number", xb.ASC).
+		Build().
+		SqlOfSelect()
+
+	var pages []*DocumentPage
+	err := sqlx.Select(q, &pages, r.db.Rebind(sql), args...)
+	return pages, err
+}
+
+// FindNodeRangesTx 在事务内查询文档节点的页码范围与正文（组装 content 用）
+func (r *DocumentRepository) FindNodeRangesTx(q sqlx.Queryer, docID int64) ([]*PageIndexNode, error) {
+	var nodes []*PageIndexNode
+	err := sqlx.Select(q, &nodes,
+		"SELECT id, node_id, start_page, end_page, COALESCE(content, '') AS content FROM page_index_nodes WHERE doc_id = $1 ORDER BY id",
+		docID)
 	return nodes, err
 }
+
+// UpdateNodeContentTx 更新节点正文
+// xb 的 UpdateBuilder 会忽略空字符串，清空正文需要原生 SQL
+func (r *DocumentRepository) UpdateNodeContentTx(e sqlx.Execer, id int64, content string) error {
+	_, err := e.Exec("UPDATE page_index_nodes SET content = $1 WHERE id = $2", content, id)
+	return err
+}
+
+// ==================== 校验问题 ====================
+
+// CreateValidationIssuesTx 保存导入校验问题
+func (r *DocumentRepository) CreateValidationIssuesTx(e sqlx.Execer, docID int64, issues []*ValidationIssue) error {
+	for start := 0; start < len(issues); start += insertBatchSize {
+		end := start + insertBatchSize
+		if end > len(issues) {
+			end = len(issues)
+		}
+
+		rows := make([][]interface{}, 0, end-start)
+		for _, issue := range issues[start:end] {
+			rows = append(rows, []interface{}{docID, issue.Severity, issue.Code, issue.Path, issue.NodeID, issue.Message})
+		}
+		sql, args := buildBatchInsert("document_validation_issues",
+			[]string{"doc_id", "severity", "code", "path", "node_id", "message"}, rows)
+		if _, err := e.Exec(sql, args...); err != nil {
+			return fmt.Errorf("insert validation issues failed: %w", err)
+		}
+	}
+	return nil
+}
+
+// FindValidationIssues 查询文档保存的校验问题
+func (r *DocumentRepository) FindValidationIssues(docID int64) ([]*ValidationIssue, error) {
+	query := `
+		SELECT severity, code, path, COALESCE(node_id, '') AS node_id, message
+		FROM document_validation_issues
+		WHERE doc_id = $1
+		ORDER BY id`
+
+	issues := []*ValidationIssue{}
+	err := r.db.Select(&issues, query, docID)
+	return issues, err
+}
+
+// ==================== 向量 ====================
+
+// SemanticSearchNodes 按向量距离检索节点，可跨文档并按层级 / 页码过滤
+func (r *DocumentRepository) SemanticSearchNodes(query xb.Vector, docIDs []int64, level, page *int, limit int) ([]*SemanticHit, error) {
+	ids := make([]interface{}, 0, len(docIDs))
+	for _, id := range docIDs {
+		ids = append(ids, id)
+	}
+
+	sql, args := xb.Of(&PageIndexNode{}).
+		VectorSearch("embedding", query, limit).
+		NonNull("embedding").
+		In("doc_id", ids...).
+		Eq("level", level).
+		Lte("start_page", page).
+		Gte("end_page", page).
+		Build().
+		SqlOfVectorSearch()
+
+	hits := []*SemanticHit{}
+	err := r.db.Select(&hits, r.db.Rebind(sql), args...)
+	return hits, err
+}
+
+// FindNodesForEmbedding 按 id 顺序分页查询待生成向量的节点
+// docID 为 0 时查询全部文档；all 为 false 时只返回还没有向量的节点
+func (r *DocumentRepository) FindNodesForEmbedding(docID, afterID int64, all bool, limit int) ([]*PageIndexNode, error) {
+	builder := xb.Of(&PageIndexNode{}).
+		Eq("doc_id", docID).
+		Gt("id", afterID)
+	if !all {
+		builder.IsNull("embedding")
+	}
+
+	sql, args, _ := builder.
+		Sort("id", xb.ASC).
+		Limit(limit).
+		Build().
+		SqlOfSelect()
+
+	var nodes []*PageIndexNode
+	err := r.db.Select(&nodes, r.db.Rebind(sql), args...)
+	return nodes, err
+}
+
+// UpdateNodeEmbedding 更新节点向量
+func (r *DocumentRepository) UpdateNodeEmbedding(id int64, embedding xb.Vector) error {
+	sql, args := xb.Of(&PageIndexNode{}).
+		Update(func(ub *xb.UpdateBuilder) {
+			ub.Set("embedding", embedding)
+		}).
+		Eq("id", id).
+		Build().
+		SqlOfUpdate()
+
+	_, err := r.db.Exec(r.db.Rebind(sql), args...)
+	return err
+}
+
+// ==================== 文档目录与版本 ====================
+
+// documentInfoQuery 文档及节点 / 页面 / 版本计数
+const documentInfoQuery = `
+	SELECT d.*,
+		(SELECT COUNT(*) FROM page_index_nodes n WHERE n.doc_id = d.id) AS node_count,
+		(SELECT COUNT(*) FROM document_pages p WHERE p.doc_id = d.id) AS page_count,
+		(SELECT COUNT(*) FROM document_versions v WHERE v.doc_id = d.id) AS version_count
+	FROM documents d`
+
+// ListDocuments 查询文档目录（keyword 不为空时按名称模糊匹配），最新导入的在前
+func (r *DocumentRepository) ListDocuments(keyword string) ([]*DocumentInfo, error) {
+	query := documentInfoQuery
+	var args []interface{}
+	if keyword != "" {
+		query += " WHERE d.name ILIKE $1"
+		args = append(args, "%"+keyword+"%")
+	}
+	query += " ORDER BY d.id DESC"
+
+	docs := []*DocumentInfo{}
+	err := r.db.Select(&docs, query, args...)
+	return docs, err
+}
+
+// GetDocumentInfo 查询单个文档及计数
+func (r *DocumentRepository) GetDocumentInfo(docID int64) (*DocumentInfo, error) {
+	var doc DocumentInfo
+	if err := r.db.Get(&doc, documentInfoQuery+" WHERE d.id = $1", docID); err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// LockDocumentTx 查询并锁定文档行，串行化同一文档的重新导入 / 版本切换
+func (r *DocumentRepository) LockDocumentTx(tx *sqlx.Tx, docID int64) (*Document, error) {
+	var doc Document
+	if err := tx.Get(&doc, "SELECT * FROM documents WHERE id = $1 FOR UPDATE", docID); err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// DeleteDocumentTx 删除文档及其节点、页面、校验问题、版本和摘要任务，文档不存在时返回 sql.ErrNoRows
+func (r *DocumentRepository) DeleteDocumentTx(tx *sqlx.Tx, docID int64) error {
+	for _, table := range []string{"document_validation_issues", "document_pages", "document_versions", "summary_jobs", "page_index_nodes"} {
+		if _, err := tx.Exec("DELETE FROM "+table+" WHERE doc_id = $1", docID); err != nil {
+			return fmt.Errorf("delete from %s failed: %w", table, err)
+		}
+	}
+
+	result, err := tx.Exec("DELETE FROM documents WHERE id = $1", docID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// FindNodeStatesTx 查询文档节点的 node_id、标题、摘要与向量（切换版本前保留回填结果）
+func (r *DocumentRepository) FindNodeStatesTx(q sqlx.Queryer, docID int64) ([]*PageIndexNode, error) {
+	var nodes []*PageIndexNode
+	err := sqlx.Select(q, &nodes, "SELECT id, node_id, title, COALESCE(summary, '') AS summary, embedding FROM page_index_nodes WHERE doc_id = $1", docID)
+	return nodes, err
+}
+
+// DeleteNodesTx 删除文档的全部节点
+func (r *DocumentRepository) DeleteNodesTx(e sqlx.Execer, docID int64) error {
+	_, err := e.Exec("DELETE FROM page_index_nodes WHERE doc_id = $1", docID)
+	return err
+}
+
+// DeleteValidationIssuesTx 删除文档的校验问题
+func (r *DocumentRepository) DeleteValidationIssuesTx(e sqlx.Execer, docID int64) error {
+	_, err := e.Exec("DELETE FROM document_validation_issues WHERE doc_id = $1", docID)
+	return err
+}
+
+// CreateVersionTx 保存树快照，版本号为该文档已有最大版本 + 1（调用方需先锁定文档行）
+func (r *DocumentRepository) CreateVersionTx(q sqlx.Queryer, v *DocumentVersion) error {
+	query := `
+		INSERT INTO document_versions (doc_id, version, document_name, total_pages, node_count, structure)
+		SELECT $1, COALESCE(MAX(version), 0) + 1, $2, $3, $4, $5::jsonb
+		FROM document_versions WHERE doc_id = $1
+		RETURNING id, version`
+
+	// structure 以字符串传入：lib/pq 会把 []byte 当作 bytea 编码
+	return q.QueryRowx(query, v.DocID, v.DocumentName, v.TotalPages, v.NodeCount, string(v.Structure)).
+		Scan(&v.ID, &v.Version)
+}
+
+// FindVersions 查询文档的版本列表（不含快照内容）
+func (r *DocumentRepository) FindVersions(docID int64) ([]*DocumentVersion, error) {
+	query := `
+		SELECT id, doc_id, version, document_name, total_pages, node_count, created_at
+		FROM document_versions
+		WHERE doc_id = $1
+		ORDER BY version`
+
+	versions := []*DocumentVersion{}
+	err := r.db.Select(&versions, query, docID)
+	return versions, err
+}
+
+// GetVersion 查询指定版本（含快照内容）
+func (r *DocumentRepository) GetVersion(docID int64, version int) (*DocumentVersion, error) {
+	return r.GetVersionTx(r.db, docID, version)
+}
+
+// GetVersionTx 查询指定版本（可在事务中调用）
+func (r *DocumentRepository) GetVersionTx(q sqlx.Queryer, docID int64, version int) (*DocumentVersion, error) {
+	var v DocumentVersion
+	err := sqlx.Get(q, &v, "SELECT * FROM document_versions WHERE doc_id = $1 AND version = $2", docID, version)
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// UpdateVersionStructureTx 更新版本快照（回填的摘要写回快照）
+func (r *DocumentRepository) UpdateVersionStructureTx(e sqlx.Execer, id int64, structure []byte) error {
+	// structure 以字符串传入：lib/pq 会把 []byte 当作 bytea 编码
+	_, err := e.Exec("UPDATE document_versions SET structure = $1::jsonb WHERE id = $2", string(structure), id)
+	return err
+}
+
+// ActivateVersionTx 将文档的名称、总页数和当前版本更新为指定版本
+func (r *DocumentRepository) ActivateVersionTx(e sqlx.Execer, v *DocumentVersion) error {
+	_, err := e.Exec(
+		"UPDATE documents SET name = $1, total_pages = $2, active_version = $3 WHERE id = $4",
+		v.DocumentName, v.TotalPages, v.Version, v.DocID)
+	return err
+}
+
+// ==================== 摘要回填 ====================
+
+// FindDocIDsMissingSummary 查询存在空摘要节点的文档
+func (r *DocumentRepository) FindDocIDsMissingSummary() ([]int64, error) {
+	var ids []int64
+	err := r.db.Select(&ids, `
+		SELECT DISTINCT doc_id FROM page_index_nodes
+		WHERE COALESCE(summary, '') = ''
+		ORDER BY doc_id`)
+	return ids, err
+}
+
+// CountNodesMissingSummary 统计空摘要节点数（docID 为 0 时统计全部文档）
+func (r *DocumentRepository) CountNodesMissingSummary(docID int64) (int, error) {
+	var n int
+	err := r.db.Get(&n, `
+		SELECT COUNT(*) FROM page_index_nodes
+		WHERE COALESCE(summary, '') = '' AND ($1::bigint = 0 OR doc_id = $1)`, docID)
+	return n, err
+}
+
+// UpdateNodeSummary 更新节点摘要，并清空向量以便 embed-backfill 重新生成
+// 只在摘要仍为空时写入，避免覆盖并发写入的摘要
+func (r *DocumentRepository) UpdateNodeSummary(id int64, summary string) (bool, error) {
+	result, err := r.db.Exec(`
+		UPDATE page_index_nodes SET summary = $1, embedding = NULL
+		WHERE id = $2 AND COALESCE(summary, '') = ''`, summary, id)
+	if err != nil {
+		return false, err
+	}
+	n, _ := result.RowsAffected()
+	return n > 0, nil
+}
+
+// CreateSummaryJob 创建摘要回填任务
+func (r *DocumentRepository) CreateSummaryJob(job *SummaryJob) error {
+	return r.db.QueryRowx(`
+		INSERT INTO summary_jobs (doc_id, status, concurrency)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at, updated_at`, job.DocID, job.Status, job.Concurrency).
+		Scan(&job.ID, &job.CreatedAt, &job.UpdatedAt)
+}
+
+// GetSummaryJob 查询摘要回填任务
+func (r *DocumentRepository) GetSummaryJob(id int64) (*SummaryJob, error) {
+	sql, args, _ := xb.Of(&SummaryJob{}).
+		Eq("id", id).
+		Build().
+		SqlOfSelect()
+
+	var job SummaryJob
+	if err := r.db.Get(&job, r.db.Rebind(sql), args...); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// StartSummaryJobRun 标记任务开始运行：total 设为已完成数 + 本次待处理数，失败与跳过在本次运行中重新统计
+func (r *DocumentRepository) StartSummaryJobRun(id int64, pending int) error {
+	_, err := r.db.Exec(`
+		UPDATE summary_jobs
+		SET status = 'running', total = done + $1, failed = 0, skipped = 0, last_error = '',
+			finished_at = NULL, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $2`, pending, id)
+	return err
+}
+
+// AddSummaryJobProgress 累加任务进度
+func (r *DocumentRepository) AddSummaryJobProgress(id int64, done, failed, skipped int, lastError string) error {
+	_, err := r.db.Exec(`
+		UPDATE summary_jobs
+		SET done = done + $1, failed = failed + $2, skipped = skipped + $3,
+			last_error = CASE WHEN $4 = '' THEN last_error ELSE $4 END,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = $5`, done, failed, skipped, lastError, id)
+	return err
+}
+
+// FinishSummaryJob 标记任务结束
+func (r *DocumentRepository) FinishSummaryJob(id int64, status, lastError string) error {
+	_, err := r.db.Exec(`
+		UPDATE summary_jobs
+		SET status = $1, last_error = CASE WHEN $2 = '' THEN last_error ELSE $2 END,
+			finished_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $3`, status, lastError, id)
+	return err
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/fndome/xb"
@@ -17,6 +19,11 @@ func setupTestDB(t *testing.T) *sqlx.DB {
 
 	// 创建测试表
 	_, err = db.Exec(`
+		CREATE EXTENSION IF NOT EXISTS vector;
+		DROP TABLE IF EXISTS summary_jobs;
+		DROP TABLE IF EXISTS document_versions;
+		DROP TABLE IF EXISTS document_validation_issues;
+		DROP TABLE IF EXISTS document_pages;
 		DROP TABLE IF EXISTS page_index_nodes;
 		DROP TABLE IF EXISTS documents;
 		
@@ -24,6 +31,7 @@ func setupTestDB(t *testing.T) *sqlx.DB {
 			id BIGSERIAL PRIMARY KEY,
 			name VARCHAR(500),
 			total_pages INT,
+			active_version INT,
 			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 		);
 
@@ -38,8 +46,57 @@ func setupTestDB(t *testing.T) *sqlx.DB {
 			summary TEXT,
 			content TEXT,
 			level INT,
+			empty_nodes BOOLEAN DEFAULT FALSE,
+			embedding vector,
 			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 		);
+
+		CREATE TABLE document_pages (
+			id BIGSERIAL PRIMARY KEY,
+			doc_id BIGINT REFERENCES documents(id),
+			page_number INT,
+			text TEXT,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE (doc_id, page_number)
+		);
+
+		CREATE TABLE document_validation_issues (
+			id BIGSERIAL PRIMARY KEY,
+			doc_id BIGINT REFERENCES documents(id),
+			severity VARCHAR(10),
+			code VARCHAR(50),
+			path TEXT,
+			node_id VARCHAR(50),
+			message TEXT,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);
+
+		CREATE TABLE document_versions (
+			id BIGSERIAL PRIMARY KEY,
+			doc_id BIGINT REFERENCES documents(id),
+			version INT,
+			document_name VARCHAR(500),
+			total_pages INT,
+			node_count INT,
+			structure JSONB,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE (doc_id, version)
+		);
+
+		CREATE TABLE summary_jobs (
+			id BIGSERIAL PRIMARY KEY,
+			doc_id BIGINT REFERENCES documents(id),
+			status VARCHAR(20) NOT NULL DEFAULT 'pending',
+			concurrency INT NOT NULL DEFAULT 4,
+			total INT NOT NULL DEFAULT 0,
+			done INT NOT NULL DEFAULT 0,
+			failed INT NOT NULL DEFAULT 0,
+			skipped INT NOT NULL DEFAULT 0,
+			last_error TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			finished_at TIMESTAMP
+		);
 	`)
 	if err != nil {
 		t.Fatalf("Failed to create test tables: %v", err)
@@ -238,3 +295,119 @@ func TestAutoFiltering(t *testing.T) {
 	// 返回所有该文档的节点
 	t.Logf("Auto-filtering works: empty keyword returned %d results", len(results))
 }
+
+func TestFindAncestorsAndDescendants(t *testing.T) {
+	db := setupTestDB(t)
+	if db == nil {
+		return
+	}
+	defer db.Close()
+
+	repo := NewDocumentRepository(db)
+	result, err := NewPageIndexImporter(repo).Import(ImportRequest{
+		DocumentName: "Annual Report",
+		Structure:    sampleStructure(),
+	})
+	if err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	doc := result.Document
+
+	path, err := repo.FindAncestors(doc.ID, "0003")
+	if err != nil {
+		t.Fatalf("FindAncestors failed: %v", err)
+	}
+	if got := len(path); got != 3 || path[0].NodeID != "0000" || path[2].NodeID != "0003" {
+		t.Errorf("Expected path 0000 > 0001 > 0003, got %d nodes", got)
+	}
+
+	descendants, err := repo.FindDescendants(doc.ID, "0000", 0)
+	if err != nil {
+		t.Fatalf("FindDescendants failed: %v", err)
+	}
+	if len(descendants) != 4 {
+		t.Errorf("Expected 4 descendants, got %d", len(descendants))
+	}
+
+	children, err := repo.FindDescendants(doc.ID, "0000", 1)
+	if err != nil {
+		t.Fatalf("FindDescendants failed: %v", err)
+	}
+	if len(children) != 2 {
+		t.Errorf("Expected 2 descendants with max_depth=1, got %d", len(children))
+	}
+
+	siblings, err := repo.FindSiblings(doc.ID, "0002")
+	if err != nil {
+		t.Fatalf("FindSiblings failed: %v", err)
+	}
+	if len(siblings) != 1 || siblings[0].NodeID != "0003" {
+		t.Errorf("Expected sibling 0003, got %d nodes", len(siblings))
+	}
+
+	breadcrumbs, err := repo.FindBreadcrumbs(doc.ID, []string{"0002", "0004"})
+	if err != nil {
+		t.Fatalf("FindBreadcrumbs failed: %v", err)
+	}
+	if got := FormatBreadcrumb(breadcrumbs["0002"]); got != "Annual Report > Chapter 1 > Section 1.1" {
+		t.Errorf("Unexpected breadcrumb: %s", got)
+	}
+	if got := FormatBreadcrumb(breadcrumbs["0004"]); got != "Annual Report > Chapter 2" {
+		t.Errorf("Unexpected breadcrumb: %s", got)
+	}
+}
+
+func TestUploadPagesAssemblesContent(t *testing.T) {
+	db := setupTestDB(t)
+	if db == nil {
+		return
+	}
+	defer db.Close()
+
+	repo := NewDocumentRepository(db)
+	result, err := NewPageIndexImporter(repo).Import(ImportRequest{
+		DocumentName: "Annual Report",
+		TotalPages:   xb.Int(50),
+		Structure:    sampleStructure(),
+	})
+	if err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	doc := result.Document
+
+	pages := make([]PageText, 0, 50)
+	for i := 1; i <= 50; i++ {
+		pages = append(pages, PageText{Page: i, Text: fmt.Sprintf("page %d", i)})
+	}
+
+	resp, err := NewPageService(repo).UploadPages(doc.ID, pages)
+	if err != nil {
+		t.Fatalf("UploadPages failed: %v", err)
+	}
+	if resp.NodesAssembled != 5 {
+		t.Errorf("Expected 5 nodes assembled, got %d", resp.NodesAssembled)
+	}
+
+	node, err := repo.FindNodeByID(doc.ID, "0002")
+	if err != nil {
+		t.Fatalf("FindNodeByID failed: %v", err)
+	}
+	if !strings.HasPrefix(node.Content, "page 1\n\npage 2") || !strings.HasSuffix(node.Content, "page 10") {
+		t.Errorf("Unexpected content for 0002: %q", node.Content)
+	}
+
+	page, err := repo.FindPage(doc.ID, 25)
+	if err != nil || page.Text != "page 25" {
+		t.Errorf("FindPage: got %+v, err %v", page, err)
+	}
+
+	// 树搜索导航时不带正文，选定章节后按主键加载
+	nodes, err := repo.FindTreeNodes(doc.ID, true, false)
+	if err != nil || len(nodes) != 5 || nodes[2].Content != "" {
+		t.Fatalf("FindTreeNodes: got %d nodes, err %v", len(nodes), err)
+	}
+	contents, err := repo.FindNodeContents([]int64{nodes[2].ID})
+	if err != nil || contents[nodes[2].ID] != node.Content {
+		t.Errorf("FindNodeContents: got %v, err %v", contents, err)
+	}
+}
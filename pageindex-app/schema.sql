@@ -1,14 +1,19 @@
 -- PageIndex 应用数据库架构
 
+-- 启用 pgvector 扩展（节点语义检索）
+CREATE EXTENSION IF NOT EXISTS vector;
+
 -- 1. 文档表
 CREATE TABLE IF NOT EXISTS documents (
     id BIGSERIAL PRIMARY KEY,
     name VARCHAR(500) NOT NULL,
     total_pages INT,
+    active_version INT,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
 
 COMMENT ON TABLE documents IS 'PageIndex 处理的文档';
+COMMENT ON COLUMN documents.active_version IS '当前生效的树版本（document_versions.version）';
 
 -- 2. PageIndex 节点表（扁平化存储）
 CREATE TABLE IF NOT EXISTS page_index_nodes (
@@ -22,6 +27,8 @@ CREATE TABLE IF NOT EXISTS page_index_nodes (
     summary TEXT,
     content TEXT,
     level INT NOT NULL DEFAULT 0,
+    empty_nodes BOOLEAN NOT NULL DEFAULT FALSE,
+    embedding vector(1536),     -- 标题 + 摘要的向量（text-embedding-3-small，已归一化）
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
 
@@ -29,16 +36,95 @@ COMMENT ON TABLE page_index_nodes IS 'PageIndex 生成的文档层级节点（
 COMMENT ON COLUMN page_index_nodes.node_id IS 'PageIndex 节点 ID（如 "0006"）';
 COMMENT ON COLUMN page_index_nodes.parent_id IS '父节点 ID（根节点为空）';
 COMMENT ON COLUMN page_index_nodes.level IS '层级深度（根节点为 0）';
+COMMENT ON COLUMN page_index_nodes.empty_nodes IS '导入 JSON 中该叶子节点带有 "nodes": []（导出时保留该键）';
+COMMENT ON COLUMN page_index_nodes.embedding IS '标题 + 摘要的向量，由 embed-backfill 生成';
+
+-- 3. 页面原文表（按页存储，用于组装节点 content）
+CREATE TABLE IF NOT EXISTS document_pages (
+    id BIGSERIAL PRIMARY KEY,
+    doc_id BIGINT NOT NULL REFERENCES documents(id) ON DELETE CASCADE,
+    page_number INT NOT NULL,
+    text TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (doc_id, page_number)
+);
+
+COMMENT ON TABLE document_pages IS '文档每页的原始文本';
+COMMENT ON COLUMN document_pages.page_number IS '页码（从 1 开始，与 start_page / end_page 一致）';
+
+-- 4. 导入校验问题（lenient 模式下随文档保存）
+CREATE TABLE IF NOT EXISTS document_validation_issues (
+    id BIGSERIAL PRIMARY KEY,
+    doc_id BIGINT NOT NULL REFERENCES documents(id) ON DELETE CASCADE,
+    severity VARCHAR(10) NOT NULL,
+    code VARCHAR(50) NOT NULL,
+    path TEXT NOT NULL,
+    node_id VARCHAR(50),
+    message TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+COMMENT ON TABLE document_validation_issues IS 'PageIndex 树结构校验问题';
+COMMENT ON COLUMN document_validation_issues.path IS 'JSON 路径（如 structure.nodes[0].nodes[1]）';
+
+-- 5. 文档树版本（每次导入 / 重新导入保存完整快照，page_index_nodes 始终是当前版本）
+CREATE TABLE IF NOT EXISTS document_versions (
+    id BIGSERIAL PRIMARY KEY,
+    doc_id BIGINT NOT NULL REFERENCES documents(id) ON DELETE CASCADE,
+    version INT NOT NULL,
+    document_name VARCHAR(500) NOT NULL,
+    total_pages INT,
+    node_count INT NOT NULL DEFAULT 0,
+    structure JSONB NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (doc_id, version)
+);
+
+COMMENT ON TABLE document_versions IS '文档树的历史版本';
+COMMENT ON COLUMN document_versions.structure IS 'PageIndex JSON 的 structure 部分';
+
+-- 6. 摘要回填任务（进度持久化，可恢复）
+CREATE TABLE IF NOT EXISTS summary_jobs (
+    id BIGSERIAL PRIMARY KEY,
+    doc_id BIGINT REFERENCES documents(id) ON DELETE CASCADE,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    concurrency INT NOT NULL DEFAULT 4,
+    total INT NOT NULL DEFAULT 0,
+    done INT NOT NULL DEFAULT 0,
+    failed INT NOT NULL DEFAULT 0,
+    skipped INT NOT NULL DEFAULT 0,
+    last_error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    finished_at TIMESTAMP
+);
+
+COMMENT ON TABLE summary_jobs IS 'LLM 摘要回填任务';
+COMMENT ON COLUMN summary_jobs.doc_id IS '为空表示全部文档';
+
+-- 已有数据库升级（新增列）
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS active_version INT;
+ALTER TABLE page_index_nodes ADD COLUMN IF NOT EXISTS embedding vector(1536);
+ALTER TABLE page_index_nodes ADD COLUMN IF NOT EXISTS empty_nodes BOOLEAN NOT NULL DEFAULT FALSE;
 
--- 3. 索引
+-- 7. 索引
 CREATE INDEX IF NOT EXISTS idx_nodes_doc_id ON page_index_nodes (doc_id);
 CREATE INDEX IF NOT EXISTS idx_nodes_node_id ON page_index_nodes (doc_id, node_id);
 CREATE INDEX IF NOT EXISTS idx_nodes_parent_id ON page_index_nodes (doc_id, parent_id);
 CREATE INDEX IF NOT EXISTS idx_nodes_level ON page_index_nodes (doc_id, level);
 CREATE INDEX IF NOT EXISTS idx_nodes_page_range ON page_index_nodes (doc_id, start_page, end_page);
+CREATE INDEX IF NOT EXISTS idx_issues_doc_id ON document_validation_issues (doc_id);
 CREATE INDEX IF NOT EXISTS idx_nodes_title ON page_index_nodes USING gin (to_tsvector('english', title));
+-- 全文检索：表达式需与 repository.go 中的 nodeSearchVector 一致
+-- english 不切分中文；设置 FULLTEXT_CONFIG（如 zhparser 的 chinese）时需把下面的 'english' 换成同一配置后重建索引
+CREATE INDEX IF NOT EXISTS idx_nodes_fulltext ON page_index_nodes USING gin ((
+    setweight(to_tsvector('english', coalesce(title, '')), 'A') ||
+    setweight(to_tsvector('english', coalesce(summary, '')), 'B') ||
+    setweight(to_tsvector('english', coalesce(content, '')), 'C')
+));
+CREATE INDEX IF NOT EXISTS idx_nodes_embedding ON page_index_nodes USING hnsw (embedding vector_l2_ops);
 
--- 4. 示例查询
+-- 8. 示例查询
 -- 查询文档的顶层节点（章节）
 -- SELECT * FROM page_index_nodes WHERE doc_id = 1 AND level = 1 ORDER BY start_page;
 
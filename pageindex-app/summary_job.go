@@ -0,0 +1,307 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// 摘要任务状态
+const (
+	JobPending   = "pending"
+	JobRunning   = "running"
+	JobCompleted = "completed"
+	JobFailed    = "failed"
+)
+
+const defaultSummaryConcurrency = 4
+
+// ErrJobRunning 任务正在运行
+var ErrJobRunning = errors.New("job is already running")
+
+// SummaryBackfiller 为空摘要节点自底向上生成摘要
+//
+// 同一文档按层级从深到浅处理：父节点处理时子节点的摘要已经生成，
+// 同一层的节点互不依赖，并发调用 LLM（并发数受 concurrency 限制）。
+// 每个摘要生成后立即写库，任务中断后重新运行只会处理仍为空的节点。
+type SummaryBackfiller struct {
+	repo *DocumentRepository
+	llm  LLMService
+
+	mu      sync.Mutex
+	running map[int64]bool
+}
+
+func NewSummaryBackfiller(repo *DocumentRepository, llm LLMService) *SummaryBackfiller {
+	return &SummaryBackfiller{
+		repo:    repo,
+		llm:     llm,
+		running: make(map[int64]bool),
+	}
+}
+
+// Start 创建任务并在后台运行
+func (b *SummaryBackfiller) Start(req SummaryJobRequest) (*SummaryJob, error) {
+	job, err := b.Create(req)
+	if err != nil {
+		return nil, err
+	}
+
+	b.runAsync(job)
+	return job, nil
+}
+
+// Create 创建任务（不运行），指定的文档不存在时返回 sql.ErrNoRows
+func (b *SummaryBackfiller) Create(req SummaryJobRequest) (*SummaryJob, error) {
+	if req.DocID != nil {
+		if _, err := b.repo.GetDocument(*req.DocID); err != nil {
+			return nil, err
+		}
+	}
+
+	concurrency := req.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultSummaryConcurrency
+	}
+
+	job := &SummaryJob{
+		DocID:       req.DocID,
+		Status:      JobPending,
+		Concurrency: concurrency,
+	}
+	if err := b.repo.CreateSummaryJob(job); err != nil {
+		return nil, fmt.Errorf("create summary job failed: %w", err)
+	}
+	return job, nil
+}
+
+// Resume 在后台重新运行已有任务（中断、失败或有新的空摘要节点时）
+func (b *SummaryBackfiller) Resume(jobID int64) (*SummaryJob, error) {
+	job, err := b.repo.GetSummaryJob(jobID)
+	if err != nil {
+		return nil, err
+	}
+	if b.isRunning(job.ID) {
+		return nil, ErrJobRunning
+	}
+
+	b.runAsync(job)
+	return job, nil
+}
+
+func (b *SummaryBackfiller) runAsync(job *SummaryJob) {
+	go func() {
+		if err := b.Run(context.Background(), job); err != nil {
+			log.Printf("summary job %d failed: %v", job.ID, err)
+		}
+	}()
+}
+
+func (b *SummaryBackfiller) isRunning(jobID int64) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.running[jobID]
+}
+
+// Run 同步运行任务（CLI 与测试直接调用），返回导致任务失败的错误
+// 单个节点的 LLM 错误只计入 failed，不会中断任务
+func (b *SummaryBackfiller) Run(ctx context.Context, job *SummaryJob) error {
+	b.mu.Lock()
+	if b.running[job.ID] {
+		b.mu.Unlock()
+		return ErrJobRunning
+	}
+	b.running[job.ID] = true
+	b.mu.Unlock()
+	defer func() {
+		b.mu.Lock()
+		delete(b.running, job.ID)
+		b.mu.Unlock()
+	}()
+
+	err := b.run(ctx, job)
+	status, lastError := JobCompleted, ""
+	if err != nil {
+		status, lastError = JobFailed, err.Error()
+	}
+	if ferr := b.repo.FinishSummaryJob(job.ID, status, lastError); ferr != nil && err == nil {
+		err = ferr
+	}
+	job.Status = status
+	return err
+}
+
+func (b *SummaryBackfiller) run(ctx context.Context, job *SummaryJob) error {
+	var docID int64
+	if job.DocID != nil {
+		docID = *job.DocID
+	}
+
+	pending, err := b.repo.CountNodesMissingSummary(docID)
+	if err != nil {
+		return err
+	}
+	if err := b.repo.StartSummaryJobRun(job.ID, pending); err != nil {
+		return err
+	}
+
+	docIDs := []int64{docID}
+	if job.DocID == nil {
+		if docIDs, err = b.repo.FindDocIDsMissingSummary(); err != nil {
+			return err
+		}
+	}
+
+	for _, id := range docIDs {
+		nodes, err := b.repo.FindNodesByDoc(id)
+		if err != nil {
+			return err
+		}
+
+		err = SummarizeNodes(ctx, b.llm, nodes, job.Concurrency, func(node *PageIndexNode, summary string, genErr error) error {
+			switch {
+			case genErr != nil:
+				return b.repo.AddSummaryJobProgress(job.ID, 0, 1, 0,
+					fmt.Sprintf("doc %d node %s: %v", id, node.NodeID, genErr))
+			case summary == "":
+				return b.repo.AddSummaryJobProgress(job.ID, 0, 0, 1, "")
+			}
+			if _, err := b.repo.UpdateNodeSummary(node.ID, summary); err != nil {
+				return err
+			}
+			return b.repo.AddSummaryJobProgress(job.ID, 1, 0, 0, "")
+		})
+		if err != nil {
+			return fmt.Errorf("doc %d: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// SummarizeNodes 为 nodes 中摘要为空的节点自底向上生成摘要
+//
+// nodes 为同一文档的全部节点。生成的摘要会写回节点，供上层节点使用；
+// 每个节点处理完后调用 record：genErr 为 LLM 错误，summary 为空表示无可用材料而跳过。
+// record 返回错误时停止后续层级并返回该错误。
+func SummarizeNodes(ctx context.Context, llm LLMService, nodes []*PageIndexNode, concurrency int,
+	record func(node *PageIndexNode, summary string, genErr error) error) error {
+	if concurrency <= 0 {
+		concurrency = defaultSummaryConcurrency
+	}
+
+	children := make(map[string][]*PageIndexNode, len(nodes))
+	for _, node := range nodes {
+		children[node.ParentID] = append(children[node.ParentID], node)
+	}
+
+	for _, level := range pendingLevels(nodes) {
+		var (
+			wg        sync.WaitGroup
+			mu        sync.Mutex
+			recordErr error
+			sem       = make(chan struct{}, concurrency)
+		)
+		for _, node := range level {
+			if err := ctx.Err(); err != nil {
+				wg.Wait()
+				return err
+			}
+
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(node *PageIndexNode) {
+				defer wg.Done()
+				defer func() { <-sem }()
+
+				prompt := buildNodeSummaryPrompt(node, children[node.NodeID])
+				var (
+					summary string
+					genErr  error
+				)
+				if prompt != "" {
+					summary, genErr = llm.Generate(ctx, prompt)
+					summary = strings.TrimSpace(summary)
+					if genErr == nil && summary == "" {
+						genErr = fmt.Errorf("empty summary")
+					}
+				}
+
+				mu.Lock()
+				defer mu.Unlock()
+				if genErr == nil {
+					node.Summary = summary
+				}
+				if err := record(node, summary, genErr); err != nil && recordErr == nil {
+					recordErr = err
+				}
+			}(node)
+		}
+		wg.Wait()
+
+		if recordErr != nil {
+			return recordErr
+		}
+	}
+	return nil
+}
+
+// pendingLevels 将空摘要节点按层级从深到浅分组
+func pendingLevels(nodes []*PageIndexNode) [][]*PageIndexNode {
+	byLevel := make(map[int][]*PageIndexNode)
+	for _, node := range nodes {
+		if strings.TrimSpace(node.Summary) != "" {
+			continue
+		}
+		level := 0
+		if node.Level != nil {
+			level = *node.Level
+		}
+		byLevel[level] = append(byLevel[level], node)
+	}
+
+	levels := make([]int, 0, len(byLevel))
+	for level := range byLevel {
+		levels = append(levels, level)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(levels)))
+
+	result := make([][]*PageIndexNode, 0, len(levels))
+	for _, level := range levels {
+		result = append(result, byLevel[level])
+	}
+	return result
+}
+
+// buildNodeSummaryPrompt 用节点正文和子节点摘要构建提示词，两者都没有时返回空字符串
+func buildNodeSummaryPrompt(node *PageIndexNode, children []*PageIndexNode) string {
+	var childSummaries []string
+	for _, child := range children {
+		if child.Summary != "" {
+			childSummaries = append(childSummaries, fmt.Sprintf("- %s：%s", child.Title, child.Summary))
+		}
+	}
+	if strings.TrimSpace(node.Content) == "" && len(childSummaries) == 0 {
+		return ""
+	}
+	return buildSummaryPrompt(node.Title, node.Content, childSummaries)
+}
+
+// buildSummaryPrompt 章节摘要提示词
+func buildSummaryPrompt(title, content string, childSummaries []string) string {
+	var sb strings.Builder
+	sb.WriteString("请用一到两句话概括以下文档章节的内容，只返回摘要本身。\n\n")
+	sb.WriteString(fmt.Sprintf("章节标题：%s\n", title))
+	if content != "" {
+		sb.WriteString(fmt.Sprintf("\n正文：\n%s\n", truncateRunes(content, answerContentRunes)))
+	}
+	if len(childSummaries) > 0 {
+		sb.WriteString("\n子章节：\n")
+		sb.WriteString(strings.Join(childSummaries, "\n"))
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fndome/xb"
+)
+
+// summaryLLM 并发安全的假 LLM：返回 "summary of <标题>"，记录提示词与最大并发数
+type summaryLLM struct {
+	mu      sync.Mutex
+	prompts map[string]string
+	active  int
+	peak    int
+	fail    string // 标题包含该字符串时返回错误
+}
+
+func newSummaryLLM() *summaryLLM {
+	return &summaryLLM{prompts: make(map[string]string)}
+}
+
+func (l *summaryLLM) Generate(ctx context.Context, prompt string) (string, error) {
+	title := strings.TrimSpace(strings.SplitN(strings.SplitN(prompt, "章节标题：", 2)[1], "\n", 2)[0])
+
+	l.mu.Lock()
+	l.prompts[title] = prompt
+	l.active++
+	if l.active > l.peak {
+		l.peak = l.active
+	}
+	l.mu.Unlock()
+
+	time.Sleep(5 * time.Millisecond)
+
+	l.mu.Lock()
+	l.active--
+	l.mu.Unlock()
+
+	if l.fail != "" && strings.Contains(title, l.fail) {
+		return "", fmt.Errorf("llm unavailable")
+	}
+	return "summary of " + title, nil
+}
+
+func summaryTestNodes() []*PageIndexNode {
+	node := func(nodeID, parentID, title, content string, level int) *PageIndexNode {
+		return &PageIndexNode{NodeID: nodeID, ParentID: parentID, Title: title, Content: content, Level: xb.Int(level)}
+	}
+	return []*PageIndexNode{
+		node("0000", "", "Root", "", 0),
+		node("0001", "0000", "Chapter 1", "", 1),
+		node("0002", "0001", "Section 1.1", "text 1.1", 2),
+		node("0003", "0001", "Section 1.2", "text 1.2", 2),
+		node("0004", "0001", "Section 1.3", "text 1.3", 2),
+		node("0005", "0000", "Chapter 2", "", 1),
+	}
+}
+
+func TestPendingLevels(t *testing.T) {
+	nodes := summaryTestNodes()
+	nodes[3].Summary = "already done"
+
+	levels := pendingLevels(nodes)
+	if len(levels) != 3 {
+		t.Fatalf("Expected 3 levels, got %d", len(levels))
+	}
+	if len(levels[0]) != 2 || *levels[0][0].Level != 2 {
+		t.Errorf("Expected deepest level first without summarized nodes, got %+v", levels[0])
+	}
+	if *levels[2][0].Level != 0 {
+		t.Errorf("Expected root level last, got %d", *levels[2][0].Level)
+	}
+}
+
+func TestSummarizeNodesBottomUp(t *testing.T) {
+	llm := newSummaryLLM()
+	llm.fail = "1.3"
+	nodes := summaryTestNodes()
+
+	var mu sync.Mutex
+	done, failed, skipped := 0, 0, 0
+	err := SummarizeNodes(context.Background(), llm, nodes, 2, func(node *PageIndexNode, summary string, genErr error) error {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case genErr != nil:
+			failed++
+		case summary == "":
+			skipped++
+		default:
+			done++
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("SummarizeNodes failed: %v", err)
+	}
+
+	// 1.1、1.2、Chapter 1、Root 成功；1.3 失败；Chapter 2 没有正文和子摘要
+	if done != 4 || failed != 1 || skipped != 1 {
+		t.Errorf("Expected 4 done / 1 failed / 1 skipped, got %d / %d / %d", done, failed, skipped)
+	}
+	if llm.peak > 2 {
+		t.Errorf("Expected at most 2 concurrent calls, got %d", llm.peak)
+	}
+
+	chapter := llm.prompts["Chapter 1"]
+	if !strings.Contains(chapter, "Section 1.1：summary of Section 1.1") || strings.Contains(chapter, "Section 1.3") {
+		t.Errorf("Expected parent prompt to contain successful child summaries, got %q", chapter)
+	}
+	if !strings.Contains(llm.prompts["Root"], "summary of Chapter 1") {
+		t.Errorf("Expected root prompt to contain chapter summary, got %q", llm.prompts["Root"])
+	}
+	if nodes[4].Summary != "" || nodes[1].Summary != "summary of Chapter 1" {
+		t.Errorf("Unexpected node summaries: %q / %q", nodes[4].Summary, nodes[1].Summary)
+	}
+}
+
+func TestSummaryBackfillJob(t *testing.T) {
+	db := setupTestDB(t)
+	if db == nil {
+		return
+	}
+	defer db.Close()
+
+	repo := NewDocumentRepository(db)
+	structure := sampleStructure()
+	structure.Nodes[0].Nodes[0].Content = "text 1.1"
+	structure.Nodes[0].Nodes[1].Content = "text 1.2"
+	structure.Nodes[1].Content = "text 2"
+	structure.Nodes[1].Summary = "existing summary"
+	result, err := NewPageIndexImporter(repo).Import(ImportRequest{DocumentName: "Annual Report", TotalPages: xb.Int(50), Structure: structure})
+	if err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	docID := result.Document.ID
+
+	llm := newSummaryLLM()
+	llm.fail = "Chapter 1"
+	backfiller := NewSummaryBackfiller(repo, llm)
+	job, err := backfiller.Create(SummaryJobRequest{DocID: &docID, Concurrency: 2})
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if err := backfiller.Run(context.Background(), job); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	job, _ = repo.GetSummaryJob(job.ID)
+	if job.Status != JobCompleted || job.Total != 4 || job.Done != 3 || job.Failed != 1 || job.LastError == "" {
+		t.Errorf("Unexpected job after first run: %+v", job)
+	}
+	if node, _ := repo.FindNodeByID(docID, "0004"); node.Summary != "existing summary" {
+		t.Errorf("Expected existing summary to be kept, got %q", node.Summary)
+	}
+
+	// 恢复后只处理仍为空的节点（Chapter 1）
+	llm.fail = ""
+	if err := backfiller.Run(context.Background(), job); err != nil {
+		t.Fatalf("Resume failed: %v", err)
+	}
+	job, _ = repo.GetSummaryJob(job.ID)
+	if job.Status != JobCompleted || job.Total != 4 || job.Done != 4 || job.Failed != 0 {
+		t.Errorf("Unexpected job after resume: %+v", job)
+	}
+	if node, _ := repo.FindNodeByID(docID, "0001"); node.Summary != "summary of Chapter 1" {
+		t.Errorf("Expected chapter summary after resume, got %q", node.Summary)
+	}
+}
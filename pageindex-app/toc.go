@@ -0,0 +1,136 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"strings"
+)
+
+// 目录输出格式
+const (
+	TOCFormatMarkdown = "markdown"
+	TOCFormatHTML     = "html"
+	TOCFormatJSON     = "json"
+)
+
+// ErrInvalidTOCFormat 不支持的目录格式
+var ErrInvalidTOCFormat = errors.New("format must be markdown, html or json")
+
+// BuildTOC 由文档的树结构生成目录，根节点作为目录标题（depth 0）
+// 有起始页码的条目附带页面原文接口的链接
+func BuildTOC(docID int64, tree PageIndexJSON, withSummary bool) *TOCEntry {
+	var build func(node PageIndexJSON, depth int) *TOCEntry
+	build = func(node PageIndexJSON, depth int) *TOCEntry {
+		entry := &TOCEntry{
+			NodeID:    node.NodeID,
+			Title:     node.Title,
+			Depth:     depth,
+			StartPage: node.StartIndex,
+			EndPage:   node.EndIndex,
+		}
+		if node.StartIndex != nil {
+			entry.PageURL = pageURL(docID, *node.StartIndex)
+		}
+		if withSummary {
+			entry.Summary = strings.TrimSpace(node.Summary)
+		}
+		for _, child := range node.Nodes {
+			entry.Children = append(entry.Children, build(child, depth+1))
+		}
+		return entry
+	}
+	return build(tree, 0)
+}
+
+// RenderTOCMarkdown 渲染为 Markdown：根节点为一级标题，其下为缩进列表
+// 如 "- Chapter 1 ([p.1-20](/api/documents/1/pages/1))"，摘要作为列表项的续行
+func RenderTOCMarkdown(root *TOCEntry) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("# %s\n\n", root.Title))
+	if root.Summary != "" {
+		sb.WriteString(root.Summary + "\n\n")
+	}
+
+	var walk func(entries []*TOCEntry, indent string)
+	walk = func(entries []*TOCEntry, indent string) {
+		for _, entry := range entries {
+			sb.WriteString(fmt.Sprintf("%s- %s (%s)\n", indent, entry.Title, markdownPageLink(entry)))
+			if entry.Summary != "" {
+				sb.WriteString(fmt.Sprintf("%s  %s\n", indent, entry.Summary))
+			}
+			walk(entry.Children, indent+"  ")
+		}
+	}
+	walk(root.Children, "")
+	return sb.String()
+}
+
+// RenderTOCHTML 渲染为 HTML 片段：<nav class="toc"> 内嵌套 <ul>
+func RenderTOCHTML(root *TOCEntry) string {
+	var sb strings.Builder
+	sb.WriteString("<nav class=\"toc\">\n")
+	sb.WriteString(fmt.Sprintf("<h1>%s</h1>\n", html.EscapeString(root.Title)))
+	if root.Summary != "" {
+		sb.WriteString(fmt.Sprintf("<p class=\"toc-summary\">%s</p>\n", html.EscapeString(root.Summary)))
+	}
+
+	var walk func(entries []*TOCEntry, indent string)
+	walk = func(entries []*TOCEntry, indent string) {
+		if len(entries) == 0 {
+			return
+		}
+		sb.WriteString(indent + "<ul>\n")
+		for _, entry := range entries {
+			sb.WriteString(fmt.Sprintf("%s  <li><span class=\"toc-title\">%s</span> %s", indent,
+				html.EscapeString(entry.Title), htmlPageLink(entry)))
+			if entry.Summary != "" {
+				sb.WriteString(fmt.Sprintf("\n%s    <p class=\"toc-summary\">%s</p>", indent, html.EscapeString(entry.Summary)))
+			}
+			if len(entry.Children) > 0 {
+				sb.WriteString("\n")
+				walk(entry.Children, indent+"    ")
+				sb.WriteString(indent + "  ")
+			}
+			sb.WriteString("</li>\n")
+		}
+		sb.WriteString(indent + "</ul>\n")
+	}
+	walk(root.Children, "")
+
+	sb.WriteString("</nav>\n")
+	return sb.String()
+}
+
+// ParseTOCFormat 校验目录格式，空字符串取 markdown
+func ParseTOCFormat(format string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(format)) {
+	case "", TOCFormatMarkdown, "md":
+		return TOCFormatMarkdown, nil
+	case TOCFormatHTML:
+		return TOCFormatHTML, nil
+	case TOCFormatJSON:
+		return TOCFormatJSON, nil
+	}
+	return "", fmt.Errorf("%w: %q", ErrInvalidTOCFormat, format)
+}
+
+func pageURL(docID int64, page int) string {
+	return fmt.Sprintf("/api/documents/%d/pages/%d", docID, page)
+}
+
+func markdownPageLink(entry *TOCEntry) string {
+	pages := formatPages(entry.StartPage, entry.EndPage)
+	if entry.PageURL == "" {
+		return pages
+	}
+	return fmt.Sprintf("[%s](%s)", pages, entry.PageURL)
+}
+
+func htmlPageLink(entry *TOCEntry) string {
+	pages := formatPages(entry.StartPage, entry.EndPage)
+	if entry.PageURL == "" {
+		return fmt.Sprintf("<span class=\"toc-pages\">%s</span>", pages)
+	}
+	return fmt.Sprintf("<a class=\"toc-pages\" href=\"%s\">%s</a>", html.EscapeString(entry.PageURL), pages)
+}
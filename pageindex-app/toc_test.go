@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRenderTOCMarkdown(t *testing.T) {
+	tree := sampleStructure()
+	tree.Nodes[0].Summary = "Overview of the year"
+	tree.Nodes[1].StartIndex = nil
+	tree.Nodes[1].EndIndex = nil
+
+	got := RenderTOCMarkdown(BuildTOC(7, tree, true))
+	want := `# Annual Report
+
+- Chapter 1 ([p.1-20](/api/documents/7/pages/1))
+  Overview of the year
+  - Section 1.1 ([p.1-10](/api/documents/7/pages/1))
+  - Section 1.2 ([p.11-20](/api/documents/7/pages/11))
+- Chapter 2 (p.?)
+`
+	if got != want {
+		t.Errorf("Unexpected markdown:\n%s\nwant:\n%s", got, want)
+	}
+
+	if strings.Contains(RenderTOCMarkdown(BuildTOC(7, tree, false)), "Overview") {
+		t.Error("Expected summaries to be omitted without with_summary")
+	}
+}
+
+func TestRenderTOCHTML(t *testing.T) {
+	tree := sampleStructure()
+	tree.Nodes[1].Title = "Risks & <Controls>"
+
+	got := RenderTOCHTML(BuildTOC(7, tree, false))
+	if !strings.HasPrefix(got, "<nav class=\"toc\">\n<h1>Annual Report</h1>\n<ul>\n") {
+		t.Errorf("Unexpected header:\n%s", got)
+	}
+	if !strings.Contains(got, `<a class="toc-pages" href="/api/documents/7/pages/11">p.11-20</a>`) {
+		t.Errorf("Expected page link for Section 1.2:\n%s", got)
+	}
+	if !strings.Contains(got, "Risks &amp; &lt;Controls&gt;") {
+		t.Errorf("Expected escaped title:\n%s", got)
+	}
+	if strings.Count(got, "<ul>") != 2 || strings.Count(got, "</ul>") != 2 || strings.Count(got, "</li>") != 4 {
+		t.Errorf("Unexpected nesting:\n%s", got)
+	}
+}
+
+func TestParseTOCFormat(t *testing.T) {
+	for raw, want := range map[string]string{"": TOCFormatMarkdown, "md": TOCFormatMarkdown, "HTML": TOCFormatHTML, "json": TOCFormatJSON} {
+		if got, err := ParseTOCFormat(raw); err != nil || got != want {
+			t.Errorf("%q: expected %s, got %s, err %v", raw, want, got, err)
+		}
+	}
+	if _, err := ParseTOCFormat("pdf"); !errors.Is(err, ErrInvalidTOCFormat) {
+		t.Errorf("Expected ErrInvalidTOCFormat, got %v", err)
+	}
+}
+
+func TestTOCHandlerRejectsInvalidQuery(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/documents/:id/toc", GetDocumentTOCHandler(nil))
+
+	for _, url := range []string{
+		"/documents/abc/toc",
+		"/documents/1/toc?format=pdf",
+		"/documents/1/toc?depth=-1",
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, url, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", url, w.Code)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrNodeNotFound 节点不存在
+var ErrNodeNotFound = errors.New("node not found")
+
+// BuildTree 由扁平节点重建 PageIndex 嵌套结构
+//
+// nodes 需按先序遍历顺序排列（FindNodesByDoc 的返回顺序），兄弟节点顺序与导入时一致。
+// rootNodeID 为空时从根节点（parent_id 为空）开始；maxDepth 为根节点以下保留的层数，0 表示不限制。
+func BuildTree(nodes []*PageIndexNode, rootNodeID string, maxDepth int) (*PageIndexJSON, error) {
+	children := make(map[string][]*PageIndexNode, len(nodes))
+	var root *PageIndexNode
+	for _, node := range nodes {
+		children[node.ParentID] = append(children[node.ParentID], node)
+		if rootNodeID != "" && node.NodeID == rootNodeID {
+			root = node
+		}
+	}
+
+	if rootNodeID == "" {
+		roots := children[""]
+		if len(roots) == 0 {
+			return nil, ErrNodeNotFound
+		}
+		if len(roots) > 1 {
+			return nil, fmt.Errorf("document has %d root nodes, expected 1", len(roots))
+		}
+		root = roots[0]
+	}
+	if root == nil {
+		return nil, fmt.Errorf("%w: %s", ErrNodeNotFound, rootNodeID)
+	}
+
+	var build func(node *PageIndexNode, depth int) PageIndexJSON
+	build = func(node *PageIndexNode, depth int) PageIndexJSON {
+		out := PageIndexJSON{
+			Title:      node.Title,
+			NodeID:     node.NodeID,
+			StartIndex: node.StartPage,
+			EndIndex:   node.EndPage,
+			Summary:    node.Summary,
+			Content:    node.Content,
+		}
+		if node.EmptyNodes {
+			out.Nodes = []PageIndexJSON{}
+		}
+		if maxDepth > 0 && depth >= maxDepth {
+			return out
+		}
+		for _, child := range children[node.NodeID] {
+			out.Nodes = append(out.Nodes, build(child, depth+1))
+		}
+		return out
+	}
+
+	tree := build(root, 0)
+	return &tree, nil
+}
+
+// ExportTree 导出文档的树结构，格式与 POST /api/import 的请求体一致
+// req.WithContent 为 false 时不查询节点原文
+func (imp *PageIndexImporter) ExportTree(docID int64, req TreeRequest) (*ImportRequest, error) {
+	doc, err := imp.repo.GetDocument(docID)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes, err := imp.repo.FindTreeNodes(docID, true, req.WithContent)
+	if err != nil {
+		return nil, err
+	}
+
+	tree, err := BuildTree(nodes, req.NodeID, req.Depth)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ImportRequest{
+		DocumentName: doc.Name,
+		TotalPages:   doc.TotalPages,
+		Structure:    *tree,
+	}, nil
+}
+
+// OutlineTree 只由标题、节点 ID 与页码重建树结构（用于目录），withSummary 时附带摘要
+func (imp *PageIndexImporter) OutlineTree(docID int64, req TreeRequest, withSummary bool) (*PageIndexJSON, error) {
+	nodes, err := imp.repo.FindTreeNodes(docID, withSummary, false)
+	if err != nil {
+		return nil, err
+	}
+	return BuildTree(nodes, req.NodeID, req.Depth)
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+const (
+	defaultMaxSteps    = 4
+	tocSummaryRunes    = 200  // 目录中每个节点摘要的最大字数
+	answerContentRunes = 4000 // 生成答案时每个节点正文的最大字数
+)
+
+// TreeSearcher 基于推理的树搜索检索（无向量）
+//
+// 流程：
+// 1. 把当前层的目录（标题 + 摘要 + 页码）交给 LLM
+// 2. LLM 选择要展开的节点，进入下一层
+// 3. 重复直到 LLM 选定相关章节（或达到最大步数）
+// 4. 基于选定章节生成答案，附带节点与页码引用
+type TreeSearcher struct {
+	repo *DocumentRepository
+	llm  LLMService
+}
+
+func NewTreeSearcher(repo *DocumentRepository, llm LLMService) *TreeSearcher {
+	return &TreeSearcher{
+		repo: repo,
+		llm:  llm,
+	}
+}
+
+// Query 对文档执行推理检索
+func (s *TreeSearcher) Query(ctx context.Context, req QueryRequest) (*QueryResponse, error) {
+	if _, err := s.repo.GetDocument(*req.DocID); err != nil {
+		return nil, err
+	}
+
+	// 导航只需要标题、摘要与页码，正文在选定章节后再加载
+	nodes, err := s.repo.FindTreeNodes(*req.DocID, true, false)
+	if err != nil {
+		return nil, err
+	}
+
+	maxSteps := defaultMaxSteps
+	if req.MaxSteps != nil && *req.MaxSteps > 0 {
+		maxSteps = *req.MaxSteps
+	}
+
+	return s.Search(ctx, req.Question, nodes, maxSteps)
+}
+
+// Search 在给定节点树上执行推理检索
+func (s *TreeSearcher) Search(ctx context.Context, question string, nodes []*PageIndexNode, maxSteps int) (*QueryResponse, error) {
+	children := make(map[string][]*PageIndexNode, len(nodes))
+	for _, node := range nodes {
+		children[node.ParentID] = append(children[node.ParentID], node)
+	}
+
+	// 起始层：单一根节点时直接展示它的子节点（根节点通常是整本文档）
+	frontier := children[""]
+	if len(frontier) == 0 {
+		return nil, ErrNodeNotFound
+	}
+	if len(frontier) == 1 && len(children[frontier[0].NodeID]) > 0 {
+		frontier = children[frontier[0].NodeID]
+	}
+
+	var (
+		trace    []*SearchStep
+		selected []*PageIndexNode
+		path     []*PageIndexNode // 已展开的节点，作为下一轮的上下文
+	)
+
+	for step := 1; step <= maxSteps && len(frontier) > 0; step++ {
+		final := step == maxSteps
+
+		prompt := s.buildNavigationPrompt(question, frontier, path, children, final)
+		response, err := s.llm.Generate(ctx, prompt)
+		if err != nil {
+			return nil, fmt.Errorf("navigation step %d failed: %w", step, err)
+		}
+
+		decision, err := parseNavigationDecision(response)
+		if err != nil {
+			return nil, fmt.Errorf("navigation step %d: %w", step, err)
+		}
+
+		chosen := pickNodes(frontier, decision.NodeIDs)
+		if len(chosen) == 0 {
+			return nil, fmt.Errorf("navigation step %d: llm chose no node from the current table of contents", step)
+		}
+
+		trace = append(trace, &SearchStep{
+			Step:      step,
+			Action:    decision.Action,
+			NodeIDs:   nodeIDs(chosen),
+			Reasoning: decision.Reasoning,
+		})
+
+		if decision.Action != "expand" || final {
+			selected = append(selected, chosen...)
+			break
+		}
+
+		// 展开：有子节点的进入下一层，叶子节点直接视为选中
+		var next []*PageIndexNode
+		for _, node := range chosen {
+			if kids := children[node.NodeID]; len(kids) > 0 {
+				next = append(next, kids...)
+				path = append(path, node)
+			} else {
+				selected = append(selected, node)
+			}
+		}
+		frontier = next
+	}
+
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("tree search selected no section within %d steps", maxSteps)
+	}
+
+	if err := s.loadContent(selected); err != nil {
+		return nil, fmt.Errorf("load section content failed: %w", err)
+	}
+
+	answer, err := s.llm.Generate(ctx, s.buildAnswerPrompt(question, selected))
+	if err != nil {
+		return nil, fmt.Errorf("answer generation failed: %w", err)
+	}
+
+	citations := make([]*Citation, 0, len(selected))
+	for _, node := range selected {
+		citations = append(citations, &Citation{
+			NodeID:    node.NodeID,
+			Title:     node.Title,
+			StartPage: node.StartPage,
+			EndPage:   node.EndPage,
+		})
+	}
+
+	return &QueryResponse{
+		Answer:    answer,
+		Citations: citations,
+		Trace:     trace,
+	}, nil
+}
+
+// navigationDecision LLM 每一步的决策
+type navigationDecision struct {
+	Action    string   `json:"action"`
+	NodeIDs   []string `json:"node_ids"`
+	Reasoning string   `json:"reasoning"`
+}
+
+func parseNavigationDecision(response string) (*navigationDecision, error) {
+	var decision navigationDecision
+	if err := json.Unmarshal([]byte(extractJSON(response)), &decision); err != nil {
+		return nil, fmt.Errorf("parse llm decision: %w", err)
+	}
+	if decision.Action != "expand" && decision.Action != "select" {
+		return nil, fmt.Errorf("parse llm decision: unknown action %q", decision.Action)
+	}
+	return &decision, nil
+}
+
+// buildNavigationPrompt 构建目录导航提示词
+func (s *TreeSearcher) buildNavigationPrompt(
+	question string,
+	frontier []*PageIndexNode,
+	path []*PageIndexNode,
+	children map[string][]*PageIndexNode,
+	final bool,
+) string {
+	var sb strings.Builder
+
+	sb.WriteString("你是一个文档检索专家，需要像人类专家查阅报告一样，通过目录逐层定位与问题相关的章节。\n\n")
+	sb.WriteString(fmt.Sprintf("问题：%s\n\n", question))
+
+	if len(path) > 0 {
+		sb.WriteString("已展开的章节：\n")
+		for _, node := range path {
+			sb.WriteString(fmt.Sprintf("- [%s] %s\n", node.NodeID, node.Title))
+		}
+		sb.WriteString("\n")
+	}
+
+	sb.WriteString("当前目录：\n")
+	for _, node := range frontier {
+		sb.WriteString(fmt.Sprintf("- [%s] %s (%s)", node.NodeID, node.Title, formatPages(node.StartPage, node.EndPage)))
+		if len(children[node.NodeID]) > 0 {
+			sb.WriteString(fmt.Sprintf(" [%d 个子章节]", len(children[node.NodeID])))
+		}
+		sb.WriteString("\n")
+		if summary := truncateRunes(node.Summary, tocSummaryRunes); summary != "" {
+			sb.WriteString(fmt.Sprintf("  摘要：%s\n", summary))
+		}
+	}
+
+	sb.WriteString("\n请输出 JSON 格式的决策：\n\n")
+	sb.WriteString(`{
+  "action": "expand|select",
+  "node_ids": ["节点ID"],
+  "reasoning": "为什么选择这些节点"
+}
+`)
+	sb.WriteString("\n规则：\n")
+	sb.WriteString("1. expand: 相关内容在这些节点的子章节中，需要继续展开\n")
+	sb.WriteString("2. select: 这些节点本身就是回答问题所需的章节\n")
+	sb.WriteString("3. node_ids 只能从当前目录中选择，通常 1-3 个\n")
+	if final {
+		sb.WriteString("4. 这是最后一步，必须使用 select\n")
+	}
+	sb.WriteString("\n只返回 JSON，不要有其他文字。")
+
+	return sb.String()
+}
+
+// loadContent 为没有正文的选定节点加载 content（Query 查询节点时不带正文）
+func (s *TreeSearcher) loadContent(nodes []*PageIndexNode) error {
+	if s.repo == nil {
+		return nil
+	}
+
+	ids := make([]int64, 0, len(nodes))
+	for _, node := range nodes {
+		if node.Content == "" {
+			ids = append(ids, node.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	contents, err := s.repo.FindNodeContents(ids)
+	if err != nil {
+		return err
+	}
+	for _, node := range nodes {
+		if content, ok := contents[node.ID]; ok {
+			node.Content = content
+		}
+	}
+	return nil
+}
+
+// buildAnswerPrompt 构建答案生成提示词
+func (s *TreeSearcher) buildAnswerPrompt(question string, nodes []*PageIndexNode) string {
+	var sb strings.Builder
+
+	sb.WriteString("请根据以下文档章节回答问题。\n\n")
+	sb.WriteString("相关章节：\n")
+
+	for _, node := range nodes {
+		sb.WriteString(fmt.Sprintf("\n[%s] %s (%s)\n", node.NodeID, node.Title, formatPages(node.StartPage, node.EndPage)))
+		text := node.Content
+		if text == "" {
+			text = node.Summary
+		}
+		sb.WriteString(truncateRunes(text, answerContentRunes))
+		sb.WriteString("\n")
+	}
+
+	sb.WriteString(fmt.Sprintf("\n问题：%s\n\n", question))
+	sb.WriteString("请基于上述章节进行回答，并在引用处标注来源，格式如 [0006, p.21-23]。")
+	sb.WriteString("如果章节中没有相关信息，请明确说明。")
+
+	return sb.String()
+}
+
+// pickNodes 按 LLM 给出的顺序从候选节点中挑选，忽略不存在或重复的 ID
+func pickNodes(candidates []*PageIndexNode, ids []string) []*PageIndexNode {
+	byID := make(map[string]*PageIndexNode, len(candidates))
+	for _, node := range candidates {
+		byID[node.NodeID] = node
+	}
+
+	picked := make([]*PageIndexNode, 0, len(ids))
+	seen := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		if node, ok := byID[id]; ok && !seen[id] {
+			seen[id] = true
+			picked = append(picked, node)
+		}
+	}
+	return picked
+}
+
+func nodeIDs(nodes []*PageIndexNode) []string {
+	ids := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		ids = append(ids, node.NodeID)
+	}
+	return ids
+}
+
+// formatPages 格式化页码范围，如 "p.21-23"
+func formatPages(start, end *int) string {
+	switch {
+	case start == nil && end == nil:
+		return "p.?"
+	case start == nil:
+		return fmt.Sprintf("p.%d", *end)
+	case end == nil || *start == *end:
+		return fmt.Sprintf("p.%d", *start)
+	default:
+		return fmt.Sprintf("p.%d-%d", *start, *end)
+	}
+}
+
+// truncateRunes 按字符（而非字节）截断，避免截断中文
+func truncateRunes(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n]) + "..."
+}
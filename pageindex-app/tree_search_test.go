@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// scriptedLLM 按顺序返回预设响应的 LLM（记录收到的提示词）
+type scriptedLLM struct {
+	responses []string
+	prompts   []string
+}
+
+func (l *scriptedLLM) Generate(ctx context.Context, prompt string) (string, error) {
+	l.prompts = append(l.prompts, prompt)
+	if len(l.prompts) > len(l.responses) {
+		return "", fmt.Errorf("unexpected llm call %d", len(l.prompts))
+	}
+	return l.responses[len(l.prompts)-1], nil
+}
+
+func TestTreeSearchExpandThenSelect(t *testing.T) {
+	llm := &scriptedLLM{responses: []string{
+		"```json\n{\"action\": \"expand\", \"node_ids\": [\"0001\"], \"reasoning\": \"第一章讨论相关主题\"}\n```",
+		`{"action": "select", "node_ids": ["0003", "9999"], "reasoning": "1.2 节直接回答问题"}`,
+		"答案见 [0003, p.11-20]。",
+	}}
+	searcher := NewTreeSearcher(nil, llm)
+
+	resp, err := searcher.Search(context.Background(), "1.2 节讲了什么？", flattenTree(1, sampleStructure()), 4)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+
+	if resp.Answer != "答案见 [0003, p.11-20]。" {
+		t.Errorf("Unexpected answer: %s", resp.Answer)
+	}
+	if len(resp.Citations) != 1 || resp.Citations[0].NodeID != "0003" || *resp.Citations[0].StartPage != 11 {
+		t.Errorf("Expected citation of node 0003 from page 11, got %+v", resp.Citations)
+	}
+	if len(resp.Trace) != 2 || resp.Trace[0].Action != "expand" || resp.Trace[1].NodeIDs[0] != "0003" {
+		t.Errorf("Unexpected trace: %+v", resp.Trace)
+	}
+
+	// 第一轮只展示根节点的子章节，第二轮展示 0001 的子章节
+	if !strings.Contains(llm.prompts[0], "[0001] Chapter 1") || strings.Contains(llm.prompts[0], "[0002]") {
+		t.Errorf("First prompt should list top-level chapters only:\n%s", llm.prompts[0])
+	}
+	if !strings.Contains(llm.prompts[1], "[0002] Section 1.1") || !strings.Contains(llm.prompts[1], "已展开的章节") {
+		t.Errorf("Second prompt should list children of 0001:\n%s", llm.prompts[1])
+	}
+}
+
+func TestTreeSearchForcesSelectOnLastStep(t *testing.T) {
+	llm := &scriptedLLM{responses: []string{
+		`{"action": "expand", "node_ids": ["0001"]}`,
+		"answer",
+	}}
+	searcher := NewTreeSearcher(nil, llm)
+
+	resp, err := searcher.Search(context.Background(), "q", flattenTree(1, sampleStructure()), 1)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if !strings.Contains(llm.prompts[0], "必须使用 select") {
+		t.Error("Last step prompt should require select")
+	}
+	if len(resp.Citations) != 1 || resp.Citations[0].NodeID != "0001" {
+		t.Errorf("Expected 0001 to be selected on the last step, got %+v", resp.Citations)
+	}
+}
+
+func TestTreeSearchRejectsInvalidDecision(t *testing.T) {
+	nodes := flattenTree(1, sampleStructure())
+
+	cases := []string{
+		"not json",
+		`{"action": "jump", "node_ids": ["0001"]}`,
+		`{"action": "select", "node_ids": ["9999"]}`,
+	}
+	for _, response := range cases {
+		searcher := NewTreeSearcher(nil, &scriptedLLM{responses: []string{response}})
+		if _, err := searcher.Search(context.Background(), "q", nodes, 3); err == nil {
+			t.Errorf("Expected error for llm response %q", response)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestBuildTreeRoundTrip(t *testing.T) {
+	// 叶子节点 0002、0004 带有 "nodes": []，0003 没有 nodes 键，导出时需原样保留
+	fixture, err := os.ReadFile("testdata/structure.json")
+	if err != nil {
+		t.Fatalf("Read fixture failed: %v", err)
+	}
+	var original PageIndexJSON
+	if err := json.Unmarshal(fixture, &original); err != nil {
+		t.Fatalf("Unmarshal fixture failed: %v", err)
+	}
+
+	tree, err := BuildTree(flattenTree(1, original), "", 0)
+	if err != nil {
+		t.Fatalf("BuildTree failed: %v", err)
+	}
+
+	var want bytes.Buffer
+	if err := json.Compact(&want, fixture); err != nil {
+		t.Fatalf("Compact fixture failed: %v", err)
+	}
+	got, _ := json.Marshal(tree)
+	if string(got) != want.String() {
+		t.Errorf("Round trip mismatch:\nwant %s\ngot  %s", want.String(), got)
+	}
+}
+
+func TestBuildTreeSubtreeAndDepth(t *testing.T) {
+	nodes := flattenTree(1, sampleStructure())
+
+	subtree, err := BuildTree(nodes, "0001", 0)
+	if err != nil {
+		t.Fatalf("BuildTree failed: %v", err)
+	}
+	if subtree.NodeID != "0001" || len(subtree.Nodes) != 2 {
+		t.Errorf("Expected subtree 0001 with 2 children, got %s with %d", subtree.NodeID, len(subtree.Nodes))
+	}
+
+	shallow, err := BuildTree(nodes, "", 1)
+	if err != nil {
+		t.Fatalf("BuildTree failed: %v", err)
+	}
+	if len(shallow.Nodes) != 2 {
+		t.Fatalf("Expected 2 top-level chapters, got %d", len(shallow.Nodes))
+	}
+	for _, chapter := range shallow.Nodes {
+		if len(chapter.Nodes) != 0 {
+			t.Errorf("Depth 1 should not include grandchildren, %s has %d", chapter.NodeID, len(chapter.Nodes))
+		}
+	}
+
+	if _, err := BuildTree(nodes, "9999", 0); !errors.Is(err, ErrNodeNotFound) {
+		t.Errorf("Expected ErrNodeNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// 校验模式
+const (
+	ValidationStrict  = "strict"  // 存在任何 error 即拒绝导入
+	ValidationLenient = "lenient" // 仅结构性错误拒绝导入，其余问题随文档保存
+)
+
+// 问题级别
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// 问题代码
+const (
+	IssueEmptyNodeID        = "empty_node_id"
+	IssueDuplicateNodeID    = "duplicate_node_id"
+	IssueMissingPageRange   = "missing_page_range"
+	IssueInvalidRange       = "invalid_range"
+	IssuePageOutOfBounds    = "page_out_of_bounds"
+	IssueOutsideParent      = "outside_parent"
+	IssueOverlappingSibling = "overlapping_siblings"
+	IssueUnorderedSiblings  = "unordered_siblings"
+	IssueEmptyTitle         = "empty_title"
+)
+
+// fatalIssues 破坏树结构或无法入库的问题，任何模式下都拒绝导入
+var fatalIssues = map[string]bool{
+	IssueEmptyNodeID:      true,
+	IssueDuplicateNodeID:  true,
+	IssueMissingPageRange: true, // start_page / end_page 为 NOT NULL
+}
+
+// ValidationError 校验未通过
+type ValidationError struct {
+	Result *ValidationResult
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, 0, len(e.Result.Errors))
+	for _, issue := range e.Result.Errors {
+		msgs = append(msgs, issue.Path+": "+issue.Message)
+	}
+	return fmt.Sprintf("validation failed with %d error(s): %s", len(e.Result.Errors), strings.Join(msgs, "; "))
+}
+
+// ValidateTree 校验 PageIndex 树的结构
+//
+// Path 使用 JSON 路径定位节点，如 structure.nodes[0].nodes[1]，
+// 即使 node_id 为空或重复也能准确定位。
+func ValidateTree(root PageIndexJSON, totalPages *int) *ValidationResult {
+	v := &treeValidator{
+		result:     &ValidationResult{Errors: []*ValidationIssue{}, Warnings: []*ValidationIssue{}},
+		seen:       map[string]string{},
+		totalPages: totalPages,
+	}
+	v.walk(root, nil, "structure")
+	v.result.Valid = len(v.result.Errors) == 0
+	return v.result
+}
+
+// Rejects 判断在指定模式下是否拒绝导入
+func (r *ValidationResult) Rejects(mode string) bool {
+	if mode == ValidationStrict {
+		return len(r.Errors) > 0
+	}
+	for _, issue := range r.Errors {
+		if fatalIssues[issue.Code] {
+			return true
+		}
+	}
+	return false
+}
+
+// Issues 返回全部问题（errors 在前）
+func (r *ValidationResult) Issues() []*ValidationIssue {
+	issues := make([]*ValidationIssue, 0, len(r.Errors)+len(r.Warnings))
+	issues = append(issues, r.Errors...)
+	return append(issues, r.Warnings...)
+}
+
+type treeValidator struct {
+	result     *ValidationResult
+	seen       map[string]string // node_id -> 首次出现的路径
+	totalPages *int
+}
+
+func (v *treeValidator) add(severity, code string, node PageIndexJSON, path, format string, args ...interface{}) {
+	issue := &ValidationIssue{
+		Severity: severity,
+		Code:     code,
+		Path:     path,
+		NodeID:   node.NodeID,
+		Message:  fmt.Sprintf(format, args...),
+	}
+	if severity == SeverityError {
+		v.result.Errors = append(v.result.Errors, issue)
+	} else {
+		v.result.Warnings = append(v.result.Warnings, issue)
+	}
+}
+
+func (v *treeValidator) walk(node PageIndexJSON, parent *PageIndexJSON, path string) {
+	// 1. node_id
+	if strings.TrimSpace(node.NodeID) == "" {
+		v.add(SeverityError, IssueEmptyNodeID, node, path, "node_id is empty")
+	} else if first, ok := v.seen[node.NodeID]; ok {
+		v.add(SeverityError, IssueDuplicateNodeID, node, path, "node_id %q already used at %s", node.NodeID, first)
+	} else {
+		v.seen[node.NodeID] = path
+	}
+
+	if strings.TrimSpace(node.Title) == "" {
+		v.add(SeverityWarning, IssueEmptyTitle, node, path, "title is empty")
+	}
+
+	// 2. 页码范围
+	hasRange := node.StartIndex != nil && node.EndIndex != nil
+	if !hasRange {
+		v.add(SeverityError, IssueMissingPageRange, node, path, "start_index and end_index are required")
+	} else {
+		start, end := *node.StartIndex, *node.EndIndex
+		if start > end {
+			v.add(SeverityError, IssueInvalidRange, node, path, "start_index %d > end_index %d", start, end)
+		}
+		if start < 1 {
+			v.add(SeverityError, IssuePageOutOfBounds, node, path, "start_index %d is before page 1", start)
+		}
+		if v.totalPages != nil && end > *v.totalPages {
+			v.add(SeverityError, IssuePageOutOfBounds, node, path, "end_index %d exceeds total_pages %d", end, *v.totalPages)
+		}
+
+		if parent != nil && parent.StartIndex != nil && parent.EndIndex != nil &&
+			(start < *parent.StartIndex || end > *parent.EndIndex) {
+			v.add(SeverityError, IssueOutsideParent, node, path,
+				"pages %d-%d fall outside parent %q pages %d-%d",
+				start, end, parent.NodeID, *parent.StartIndex, *parent.EndIndex)
+		}
+	}
+
+	// 3. 兄弟节点：顺序与重叠（相邻章节共用边界页是常见情况，不算重叠）
+	for i := 1; i < len(node.Nodes); i++ {
+		prev, cur := node.Nodes[i-1], node.Nodes[i]
+		if prev.StartIndex == nil || prev.EndIndex == nil || cur.StartIndex == nil || cur.EndIndex == nil {
+			continue
+		}
+		curPath := fmt.Sprintf("%s.nodes[%d]", path, i)
+		if *cur.StartIndex < *prev.StartIndex {
+			v.add(SeverityWarning, IssueUnorderedSiblings, cur, curPath,
+				"starts at page %d, before previous sibling %q (page %d)", *cur.StartIndex, prev.NodeID, *prev.StartIndex)
+		} else if *cur.StartIndex < *prev.EndIndex {
+			v.add(SeverityWarning, IssueOverlappingSibling, cur, curPath,
+				"pages %d-%d overlap previous sibling %q pages %d-%d",
+				*cur.StartIndex, *cur.EndIndex, prev.NodeID, *prev.StartIndex, *prev.EndIndex)
+		}
+	}
+
+	for i, child := range node.Nodes {
+		v.walk(child, &node, fmt.Sprintf("%s.nodes[%d]", path, i))
+	}
+}
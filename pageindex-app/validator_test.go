@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/fndome/xb"
+)
+
+func issueCodes(issues []*ValidationIssue) map[string]*ValidationIssue {
+	codes := make(map[string]*ValidationIssue, len(issues))
+	for _, issue := range issues {
+		codes[issue.Code] = issue
+	}
+	return codes
+}
+
+func TestValidateTreeValid(t *testing.T) {
+	result := ValidateTree(sampleStructure(), xb.Int(50))
+	if !result.Valid || len(result.Errors) != 0 || len(result.Warnings) != 0 {
+		t.Errorf("Expected sample structure to be valid, got %+v", result)
+	}
+}
+
+func TestValidateTreeIssues(t *testing.T) {
+	tree := sampleStructure()
+	chapter1 := &tree.Nodes[0]
+	chapter1.Nodes[0].StartIndex = xb.Int(12) // 12 > 10: invalid range
+	chapter1.Nodes[1].EndIndex = xb.Int(25)   // 超出父节点 1-20
+	chapter1.Nodes = append(chapter1.Nodes, PageIndexJSON{
+		NodeID: "0002", Title: "", StartIndex: xb.Int(15), EndIndex: xb.Int(18), // 重复 ID、空标题、重叠
+	})
+	tree.Nodes[1].EndIndex = xb.Int(60) // 超出 total_pages，同时超出根节点 1-50
+
+	result := ValidateTree(tree, xb.Int(50))
+	if result.Valid {
+		t.Fatal("Expected invalid result")
+	}
+
+	errs := issueCodes(result.Errors)
+	for _, code := range []string{IssueInvalidRange, IssueOutsideParent, IssueDuplicateNodeID, IssuePageOutOfBounds} {
+		if errs[code] == nil {
+			t.Errorf("Expected error %s", code)
+		}
+	}
+	if dup := errs[IssueDuplicateNodeID]; dup != nil && dup.Path != "structure.nodes[0].nodes[2]" {
+		t.Errorf("Unexpected path for duplicate node: %s", dup.Path)
+	}
+
+	warnings := issueCodes(result.Warnings)
+	for _, code := range []string{IssueEmptyTitle, IssueOverlappingSibling} {
+		if warnings[code] == nil {
+			t.Errorf("Expected warning %s", code)
+		}
+	}
+
+	// 重复 node_id 是结构性错误，两种模式都拒绝
+	if !result.Rejects(ValidationStrict) || !result.Rejects(ValidationLenient) {
+		t.Error("Duplicate node_id should be rejected in both modes")
+	}
+}
+
+func TestValidationModes(t *testing.T) {
+	tree := sampleStructure()
+	tree.Nodes[1].EndIndex = xb.Int(60)
+
+	result := ValidateTree(tree, xb.Int(50))
+	if !result.Rejects(ValidationStrict) {
+		t.Error("Strict mode should reject page_out_of_bounds")
+	}
+	if result.Rejects(ValidationLenient) {
+		t.Error("Lenient mode should accept non-structural errors")
+	}
+	if len(result.Issues()) != len(result.Errors)+len(result.Warnings) {
+		t.Error("Issues should include errors and warnings")
+	}
+}
+
+func TestImportRejectsInvalidTree(t *testing.T) {
+	tree := sampleStructure()
+	tree.Nodes[1].NodeID = "0001"
+
+	// 校验失败时不会访问数据库
+	_, err := NewPageIndexImporter(nil).Import(ImportRequest{DocumentName: "dup", Structure: tree})
+
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("Expected ValidationError, got %v", err)
+	}
+	if len(verr.Result.Errors) != 1 || verr.Result.Errors[0].Code != IssueDuplicateNodeID {
+		t.Errorf("Unexpected validation errors: %+v", verr.Result.Errors)
+	}
+}
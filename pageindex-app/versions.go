@@ -0,0 +1,369 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ErrVersionNotFound 文档没有指定的版本
+var ErrVersionNotFound = errors.New("version not found")
+
+// Reimport 用新的 PageIndex 结果替换文档的树，并保存为新版本
+//
+// 旧版本的快照保留在 document_versions 中，可通过 ActivateVersion 切回。
+// 没有任何版本记录的旧文档会先把当前树保存为版本 1。
+func (imp *PageIndexImporter) Reimport(docID int64, req ImportRequest) (*ImportResult, error) {
+	validation := ValidateTree(req.Structure, req.TotalPages)
+	if validation.Rejects(req.Mode) {
+		return nil, &ValidationError{Result: validation}
+	}
+	issues := validation.Issues()
+
+	var doc *Document
+	err := imp.repo.WithTx(func(tx *sqlx.Tx) error {
+		var err error
+		if doc, err = imp.repo.LockDocumentTx(tx, docID); err != nil {
+			return err
+		}
+
+		if doc.ActiveVersion == nil {
+			if err := imp.snapshotCurrentTx(tx, doc); err != nil {
+				return fmt.Errorf("snapshot current tree failed: %w", err)
+			}
+		}
+
+		version, err := imp.createVersionTx(tx, docID, req)
+		if err != nil {
+			return err
+		}
+		return imp.applyVersionTx(tx, doc, version, req.Structure, issues)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &ImportResult{
+		Document: doc,
+		Issues:   issues,
+	}, nil
+}
+
+// ActivateVersion 将文档的当前树切换为指定版本
+// 快照在导入时已经校验过，切换时按 lenient 模式重新生成校验问题，不会拒绝
+func (imp *PageIndexImporter) ActivateVersion(docID int64, version int) (*ImportResult, error) {
+	var (
+		doc    *Document
+		issues []*ValidationIssue
+	)
+	err := imp.repo.WithTx(func(tx *sqlx.Tx) error {
+		var err error
+		if doc, err = imp.repo.LockDocumentTx(tx, docID); err != nil {
+			return err
+		}
+
+		v, err := imp.repo.GetVersionTx(tx, docID, version)
+		if err != nil {
+			return versionErr(err, version)
+		}
+		structure, err := decodeStructure(v)
+		if err != nil {
+			return err
+		}
+
+		issues = ValidateTree(structure, v.TotalPages).Issues()
+		return imp.applyVersionTx(tx, doc, v, structure, issues)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &ImportResult{
+		Document: doc,
+		Issues:   issues,
+	}, nil
+}
+
+// DiffVersions 比较两个版本的树
+// to 为 0 时取当前版本，from 为 0 时取 to 的上一个版本
+func (imp *PageIndexImporter) DiffVersions(docID int64, from, to int) (*TreeDiff, error) {
+	if to == 0 {
+		doc, err := imp.repo.GetDocument(docID)
+		if err != nil {
+			return nil, err
+		}
+		if doc.ActiveVersion == nil {
+			return nil, fmt.Errorf("%w: document %d has no versions", ErrVersionNotFound, docID)
+		}
+		to = *doc.ActiveVersion
+	}
+	if from == 0 {
+		from = to - 1
+	}
+
+	trees := make([]PageIndexJSON, 0, 2)
+	for _, version := range []int{from, to} {
+		v, err := imp.repo.GetVersion(docID, version)
+		if err != nil {
+			return nil, versionErr(err, version)
+		}
+		structure, err := decodeStructure(v)
+		if err != nil {
+			return nil, err
+		}
+		trees = append(trees, structure)
+	}
+
+	diff := DiffTrees(trees[0], trees[1])
+	diff.DocID = docID
+	diff.From = from
+	diff.To = to
+	return diff, nil
+}
+
+// DiffTrees 按 node_id 对齐比较两棵树：新增、删除与标题变化的节点
+//
+// PageIndex 的 node_id 按先序遍历编号，章节增删会导致后续节点整体错位，
+// 此时差异反映的是编号变化而不是内容变化。
+func DiffTrees(from, to PageIndexJSON) *TreeDiff {
+	oldNodes := flattenTree(0, from)
+	newNodes := flattenTree(0, to)
+
+	oldByID := make(map[string]*PageIndexNode, len(oldNodes))
+	for _, node := range oldNodes {
+		oldByID[node.NodeID] = node
+	}
+	newByID := make(map[string]*PageIndexNode, len(newNodes))
+	for _, node := range newNodes {
+		newByID[node.NodeID] = node
+	}
+
+	diff := &TreeDiff{
+		Added:    []*NodeChange{},
+		Removed:  []*NodeChange{},
+		Retitled: []*NodeChange{},
+	}
+	for _, node := range newNodes {
+		old, ok := oldByID[node.NodeID]
+		switch {
+		case !ok:
+			diff.Added = append(diff.Added, nodeChange(node))
+		case old.Title != node.Title:
+			change := nodeChange(node)
+			change.OldTitle = old.Title
+			diff.Retitled = append(diff.Retitled, change)
+		}
+	}
+	for _, node := range oldNodes {
+		if _, ok := newByID[node.NodeID]; !ok {
+			diff.Removed = append(diff.Removed, nodeChange(node))
+		}
+	}
+	return diff
+}
+
+func nodeChange(node *PageIndexNode) *NodeChange {
+	return &NodeChange{
+		NodeID:    node.NodeID,
+		Title:     node.Title,
+		StartPage: node.StartPage,
+		EndPage:   node.EndPage,
+	}
+}
+
+// createVersionTx 保存导入请求的树快照为新版本
+func (imp *PageIndexImporter) createVersionTx(tx *sqlx.Tx, docID int64, req ImportRequest) (*DocumentVersion, error) {
+	structure, err := json.Marshal(req.Structure)
+	if err != nil {
+		return nil, fmt.Errorf("marshal structure failed: %w", err)
+	}
+
+	nodeCount := countNodes(req.Structure)
+	v := &DocumentVersion{
+		DocID:        &docID,
+		DocumentName: req.DocumentName,
+		TotalPages:   req.TotalPages,
+		NodeCount:    &nodeCount,
+		Structure:    structure,
+	}
+	if err := imp.repo.CreateVersionTx(tx, v); err != nil {
+		return nil, fmt.Errorf("create version failed: %w", err)
+	}
+	return v, nil
+}
+
+// snapshotCurrentTx 把没有版本记录的文档的当前树保存为版本 1
+func (imp *PageIndexImporter) snapshotCurrentTx(tx *sqlx.Tx, doc *Document) error {
+	var nodes []*PageIndexNode
+	if err := tx.Select(&nodes, "SELECT "+nodeColumns+" FROM page_index_nodes WHERE doc_id = $1 ORDER BY id", doc.ID); err != nil {
+		return err
+	}
+	if len(nodes) == 0 {
+		return nil
+	}
+
+	tree, err := BuildTree(nodes, "", 0)
+	if err != nil {
+		return err
+	}
+	_, err = imp.createVersionTx(tx, doc.ID, ImportRequest{
+		DocumentName: doc.Name,
+		TotalPages:   doc.TotalPages,
+		Structure:    *tree,
+	})
+	return err
+}
+
+// applyVersionTx 用版本快照替换文档的节点与校验问题，并设为当前版本
+// 快照中没有 content 的节点用已上传的页面原文重新组装。
+// 删除旧节点前，回填的摘要先写回当前版本的快照，并沿用到新树中 node_id 与标题相同的节点（摘要也相同时沿用向量），
+// 其余节点的向量需重新回填。
+func (imp *PageIndexImporter) applyVersionTx(tx *sqlx.Tx, doc *Document, v *DocumentVersion, structure PageIndexJSON, issues []*ValidationIssue) error {
+	live, err := imp.repo.FindNodeStatesTx(tx, doc.ID)
+	if err != nil {
+		return err
+	}
+	if doc.ActiveVersion != nil {
+		if err := imp.saveSummariesTx(tx, doc.ID, *doc.ActiveVersion, live); err != nil {
+			return fmt.Errorf("save summaries to version %d failed: %w", *doc.ActiveVersion, err)
+		}
+	}
+
+	if err := imp.repo.DeleteNodesTx(tx, doc.ID); err != nil {
+		return fmt.Errorf("delete nodes failed: %w", err)
+	}
+
+	stored, err := imp.repo.FindPagesTx(tx, doc.ID)
+	if err != nil {
+		return err
+	}
+	pages := make(map[int]string, len(stored))
+	for _, p := range stored {
+		pages[*p.PageNumber] = p.Text
+	}
+
+	nodes := flattenTree(doc.ID, structure)
+	carryNodeStates(nodes, live)
+	for _, node := range nodes {
+		if node.Content == "" {
+			node.Content = AssembleContent(node, pages)
+		}
+	}
+	if err := imp.repo.CreateNodesTx(tx, nodes); err != nil {
+		return fmt.Errorf("create nodes failed: %w", err)
+	}
+
+	if err := imp.repo.DeleteValidationIssuesTx(tx, doc.ID); err != nil {
+		return fmt.Errorf("delete validation issues failed: %w", err)
+	}
+	if err := imp.repo.CreateValidationIssuesTx(tx, doc.ID, issues); err != nil {
+		return err
+	}
+
+	if err := imp.repo.ActivateVersionTx(tx, v); err != nil {
+		return fmt.Errorf("activate version failed: %w", err)
+	}
+	doc.Name = v.DocumentName
+	doc.TotalPages = v.TotalPages
+	doc.ActiveVersion = v.Version
+	return nil
+}
+
+// saveSummariesTx 把当前节点上回填的摘要写回版本快照中摘要为空的同一节点（node_id 与标题均相同）
+func (imp *PageIndexImporter) saveSummariesTx(tx *sqlx.Tx, docID int64, version int, live []*PageIndexNode) error {
+	v, err := imp.repo.GetVersionTx(tx, docID, version)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		return err
+	}
+	structure, err := decodeStructure(v)
+	if err != nil {
+		return err
+	}
+	if !fillSummaries(&structure, live) {
+		return nil
+	}
+
+	data, err := json.Marshal(structure)
+	if err != nil {
+		return fmt.Errorf("marshal structure failed: %w", err)
+	}
+	return imp.repo.UpdateVersionStructureTx(tx, v.ID, data)
+}
+
+// liveNodeKey 节点的 node_id 与标题，用于在版本之间对应同一节点
+func liveNodeKey(nodeID, title string) string {
+	return nodeID + "\x00" + title
+}
+
+func indexLiveNodes(live []*PageIndexNode) map[string]*PageIndexNode {
+	byKey := make(map[string]*PageIndexNode, len(live))
+	for _, node := range live {
+		byKey[liveNodeKey(node.NodeID, node.Title)] = node
+	}
+	return byKey
+}
+
+// fillSummaries 用 live 中同一节点的摘要填充树中的空摘要，返回是否有修改
+func fillSummaries(structure *PageIndexJSON, live []*PageIndexNode) bool {
+	byKey := indexLiveNodes(live)
+	changed := false
+	var walk func(node *PageIndexJSON)
+	walk = func(node *PageIndexJSON) {
+		if prev, ok := byKey[liveNodeKey(node.NodeID, node.Title)]; ok && node.Summary == "" && prev.Summary != "" {
+			node.Summary = prev.Summary
+			changed = true
+		}
+		for i := range node.Nodes {
+			walk(&node.Nodes[i])
+		}
+	}
+	walk(structure)
+	return changed
+}
+
+// carryNodeStates 新节点沿用 live 中同一节点回填的摘要；摘要相同时沿用向量（向量由标题 + 摘要生成）
+func carryNodeStates(nodes, live []*PageIndexNode) {
+	byKey := indexLiveNodes(live)
+	for _, node := range nodes {
+		prev, ok := byKey[liveNodeKey(node.NodeID, node.Title)]
+		if !ok {
+			continue
+		}
+		if node.Summary == "" {
+			node.Summary = prev.Summary
+		}
+		if node.Summary == prev.Summary {
+			node.Embedding = prev.Embedding
+		}
+	}
+}
+
+// versionErr 将版本查询的 sql.ErrNoRows 转为 ErrVersionNotFound，与文档不存在区分
+func versionErr(err error, version int) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w: %d", ErrVersionNotFound, version)
+	}
+	return err
+}
+
+func decodeStructure(v *DocumentVersion) (PageIndexJSON, error) {
+	var structure PageIndexJSON
+	if err := json.Unmarshal(v.Structure, &structure); err != nil {
+		return structure, fmt.Errorf("decode version %d structure failed: %w", *v.Version, err)
+	}
+	return structure, nil
+}
+
+func countNodes(node PageIndexJSON) int {
+	n := 1
+	for _, child := range node.Nodes {
+		n += countNodes(child)
+	}
+	return n
+}
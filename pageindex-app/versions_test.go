@@ -0,0 +1,175 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/fndome/xb"
+	"github.com/jmoiron/sqlx"
+)
+
+// revisedStructure 在 sampleStructure 基础上：0003 改名、0004 删除、新增 0005
+func revisedStructure() PageIndexJSON {
+	root := sampleStructure()
+	root.Nodes[0].Nodes[1].Title = "Section 1.2 (revised)"
+	root.Nodes = root.Nodes[:1]
+	root.Nodes = append(root.Nodes, PageIndexJSON{Title: "Appendix", NodeID: "0005", StartIndex: xb.Int(21), EndIndex: xb.Int(50)})
+	return root
+}
+
+func TestDiffTrees(t *testing.T) {
+	diff := DiffTrees(sampleStructure(), revisedStructure())
+
+	if len(diff.Added) != 1 || diff.Added[0].NodeID != "0005" {
+		t.Errorf("Expected 0005 added, got %+v", diff.Added)
+	}
+	if len(diff.Removed) != 1 || diff.Removed[0].NodeID != "0004" {
+		t.Errorf("Expected 0004 removed, got %+v", diff.Removed)
+	}
+	if len(diff.Retitled) != 1 || diff.Retitled[0].OldTitle != "Section 1.2" || diff.Retitled[0].Title != "Section 1.2 (revised)" {
+		t.Errorf("Expected 0003 retitled, got %+v", diff.Retitled)
+	}
+
+	same := DiffTrees(sampleStructure(), sampleStructure())
+	if len(same.Added)+len(same.Removed)+len(same.Retitled) != 0 {
+		t.Errorf("Expected no changes for identical trees, got %+v", same)
+	}
+}
+
+func TestCarryNodeStates(t *testing.T) {
+	live := []*PageIndexNode{
+		{NodeID: "0002", Title: "Section 1.1", Summary: "backfilled", Embedding: xb.Vector{1, 0}},
+		{NodeID: "0003", Title: "Section 1.2", Summary: "old title", Embedding: xb.Vector{0, 1}},
+	}
+
+	structure := revisedStructure()
+	if !fillSummaries(&structure, live) {
+		t.Fatal("Expected fillSummaries to report a change")
+	}
+	if got := structure.Nodes[0].Nodes[0].Summary; got != "backfilled" {
+		t.Errorf("Expected 0002 summary filled, got %q", got)
+	}
+	if got := structure.Nodes[0].Nodes[1].Summary; got != "" {
+		t.Errorf("Expected retitled 0003 to stay empty, got %q", got)
+	}
+	if fillSummaries(&structure, live) {
+		t.Error("Expected no change once summaries are filled")
+	}
+
+	nodes := flattenTree(1, revisedStructure())
+	nodes[2].Summary = "from snapshot"
+	carryNodeStates(nodes, live)
+	for _, node := range nodes {
+		switch node.NodeID {
+		case "0002":
+			if node.Summary != "from snapshot" || node.Embedding != nil {
+				t.Errorf("Expected snapshot summary kept without stale embedding, got %+v", node)
+			}
+		case "0003":
+			if node.Summary != "" || node.Embedding != nil {
+				t.Errorf("Expected retitled 0003 not carried, got %+v", node)
+			}
+		}
+	}
+
+	nodes = flattenTree(1, revisedStructure())
+	carryNodeStates(nodes, live)
+	if nodes[2].Summary != "backfilled" || len(nodes[2].Embedding) != 2 {
+		t.Errorf("Expected 0002 summary and embedding carried, got %+v", nodes[2])
+	}
+}
+
+func TestReimportAndActivateVersion(t *testing.T) {
+	db := setupTestDB(t)
+	if db == nil {
+		return
+	}
+	defer db.Close()
+
+	repo := NewDocumentRepository(db)
+	importer := NewPageIndexImporter(repo)
+
+	result, err := importer.Import(ImportRequest{DocumentName: "Annual Report", TotalPages: xb.Int(50), Structure: sampleStructure()})
+	if err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	docID := result.Document.ID
+	if v := result.Document.ActiveVersion; v == nil || *v != 1 {
+		t.Fatalf("Expected import to create version 1, got %v", v)
+	}
+
+	result, err = importer.Reimport(docID, ImportRequest{DocumentName: "Annual Report v2", TotalPages: xb.Int(50), Structure: revisedStructure()})
+	if err != nil {
+		t.Fatalf("Reimport failed: %v", err)
+	}
+	if *result.Document.ActiveVersion != 2 {
+		t.Errorf("Expected active version 2, got %d", *result.Document.ActiveVersion)
+	}
+	if _, err := repo.FindNodeByID(docID, "0004"); err == nil {
+		t.Error("Expected 0004 to be gone after reimport")
+	}
+
+	backfilled, err := repo.FindNodeByID(docID, "0002")
+	if err != nil {
+		t.Fatalf("FindNodeByID failed: %v", err)
+	}
+	if updated, err := repo.UpdateNodeSummary(backfilled.ID, "backfilled summary"); err != nil || !updated {
+		t.Fatalf("UpdateNodeSummary failed: %v, updated %v", err, updated)
+	}
+	if err := repo.UpdateNodeEmbedding(backfilled.ID, xb.Vector{0.6, 0.8}); err != nil {
+		t.Fatalf("UpdateNodeEmbedding failed: %v", err)
+	}
+
+	diff, err := importer.DiffVersions(docID, 0, 0)
+	if err != nil {
+		t.Fatalf("DiffVersions failed: %v", err)
+	}
+	if diff.From != 1 || diff.To != 2 || len(diff.Added) != 1 || len(diff.Removed) != 1 || len(diff.Retitled) != 1 {
+		t.Errorf("Unexpected diff: %+v", diff)
+	}
+
+	if _, err := importer.ActivateVersion(docID, 1); err != nil {
+		t.Fatalf("ActivateVersion failed: %v", err)
+	}
+	doc, _ := repo.GetDocument(docID)
+	if doc.Name != "Annual Report" || *doc.ActiveVersion != 1 {
+		t.Errorf("Expected version 1 restored, got %+v", doc)
+	}
+	if node, err := repo.FindNodeByID(docID, "0004"); err != nil || node.Title != "Chapter 2" {
+		t.Errorf("Expected 0004 restored, got %+v, err %v", node, err)
+	}
+
+	if node, err := repo.FindNodeByID(docID, "0002"); err != nil || node.Summary != "backfilled summary" || len(node.Embedding) != 2 {
+		t.Errorf("Expected backfilled state carried to version 1, got %+v, err %v", node, err)
+	}
+
+	if _, err := importer.ActivateVersion(docID, 2); err != nil {
+		t.Fatalf("ActivateVersion failed: %v", err)
+	}
+	if node, err := repo.FindNodeByID(docID, "0002"); err != nil || node.Summary != "backfilled summary" || len(node.Embedding) != 2 {
+		t.Errorf("Expected backfilled state to survive v2→v1→v2, got %+v, err %v", node, err)
+	}
+	if _, err := importer.ActivateVersion(docID, 1); err != nil {
+		t.Fatalf("ActivateVersion failed: %v", err)
+	}
+
+	if _, err := importer.ActivateVersion(docID, 9); !errors.Is(err, ErrVersionNotFound) {
+		t.Errorf("Expected ErrVersionNotFound, got %v", err)
+	}
+
+	docs, err := repo.ListDocuments("annual")
+	if err != nil || len(docs) != 1 || docs[0].NodeCount != 5 || docs[0].VersionCount != 2 {
+		t.Errorf("Unexpected catalog: %+v, err %v", docs, err)
+	}
+
+	if err := repo.WithTx(func(tx *sqlx.Tx) error { return repo.DeleteDocumentTx(tx, docID) }); err != nil {
+		t.Fatalf("DeleteDocumentTx failed: %v", err)
+	}
+	if _, err := repo.GetDocumentInfo(docID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected document to be deleted, got %v", err)
+	}
+	if err := repo.WithTx(func(tx *sqlx.Tx) error { return repo.DeleteDocumentTx(tx, docID) }); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected sql.ErrNoRows deleting a missing document, got %v", err)
+	}
+}
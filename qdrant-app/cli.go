@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+const usage = `用法:
+  qdrant-app                                   启动 HTTP 服务
+  qdrant-app snapshot create                   创建快照
+  qdrant-app snapshot list                     列出快照
+  qdrant-app snapshot download <name> <file>   下载快照到本地文件
+  qdrant-app snapshot restore <location|file>  从 URL / file:// 路径或本地文件恢复
+  qdrant-app migrate -to <collection> [选项]    复制点到另一个 collection
+  qdrant-app alias switch <alias>              将别名切换到 -collection
+
+通用选项（需放在位置参数之前）:
+  -qdrant      Qdrant 地址（默认 http://localhost:6333）
+  -collection  collection 名称（默认 documents）
+`
+
+// runCommand 执行运维子命令，输出写入 out
+func runCommand(args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing command\n%s", usage)
+	}
+
+	switch args[0] {
+	case "snapshot":
+		return runSnapshot(args[1:], out)
+	case "migrate":
+		return runMigrate(args[1:], out)
+	case "alias":
+		return runAlias(args[1:], out)
+	case "help", "-h", "--help":
+		fmt.Fprint(out, usage)
+		return nil
+	default:
+		return fmt.Errorf("unknown command %q\n%s", args[0], usage)
+	}
+}
+
+func commonFlags(name string) (*flag.FlagSet, *string, *string) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	baseURL := fs.String("qdrant", "http://localhost:6333", "Qdrant address")
+	collection := fs.String("collection", "documents", "collection name")
+	return fs, baseURL, collection
+}
+
+func runSnapshot(args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing snapshot subcommand (create/list/download/restore)")
+	}
+
+	fs, baseURL, collection := commonFlags("snapshot " + args[0])
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	client := NewQdrantClient(*baseURL, *collection)
+	rest := fs.Args()
+
+	switch args[0] {
+	case "create":
+		info, err := client.CreateSnapshot()
+		if err != nil {
+			return err
+		}
+		return printJSON(out, info)
+
+	case "list":
+		snapshots, err := client.ListSnapshots()
+		if err != nil {
+			return err
+		}
+		return printJSON(out, snapshots)
+
+	case "download":
+		if len(rest) != 2 {
+			return fmt.Errorf("usage: snapshot download <name> <file>")
+		}
+		f, err := os.Create(rest[1])
+		if err != nil {
+			return err
+		}
+		n, err := client.DownloadSnapshot(rest[0], f)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "downloaded %s (%d bytes) to %s\n", rest[0], n, rest[1])
+		return nil
+
+	case "restore":
+		if len(rest) != 1 {
+			return fmt.Errorf("usage: snapshot restore <location|file>")
+		}
+		// 本地存在的文件走上传，其余当作 Qdrant 可访问的 location
+		if _, err := os.Stat(rest[0]); err == nil {
+			if err := client.UploadSnapshot(rest[0]); err != nil {
+				return err
+			}
+		} else if err := client.RestoreSnapshot(rest[0]); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "restored %s from %s\n", *collection, rest[0])
+		return nil
+
+	default:
+		return fmt.Errorf("unknown snapshot subcommand %q", args[0])
+	}
+}
+
+func runMigrate(args []string, out io.Writer) error {
+	fs, baseURL, collection := commonFlags("migrate")
+	to := fs.String("to", "", "target collection (required)")
+	mapping := fs.String("map", "", "payload field mapping, e.g. title:name,obsolete:")
+	vectorSize := fs.Int("vector-size", 0, "target vector size (default: same as source)")
+	distance := fs.String("distance", "", "target distance: Cosine/Euclid/Dot (default: same as source)")
+	create := fs.Bool("create", true, "create target collection")
+	reembed := fs.Bool("reembed", false, "re-embed points with the OpenAI-compatible embedding API")
+	embedField := fs.String("embed-field", "content", "payload field used as embedding input")
+	model := fs.String("model", "text-embedding-3-small", "embedding model used with -reembed")
+	batch := fs.Int("batch", 256, "points per batch")
+	alias := fs.String("alias", "", "switch this alias to the target collection after migration")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *to == "" {
+		return fmt.Errorf("-to is required")
+	}
+	if *to == *collection {
+		return fmt.Errorf("source and target collection must differ")
+	}
+
+	fieldMapping, err := ParseFieldMapping(*mapping)
+	if err != nil {
+		return err
+	}
+
+	opts := MigrateOptions{
+		FieldMapping: fieldMapping,
+		EmbedField:   *embedField,
+		VectorSize:   *vectorSize,
+		Distance:     *distance,
+		CreateTarget: *create,
+		BatchSize:    *batch,
+		Progress: func(stats MigrateStats) {
+			fmt.Fprintf(os.Stderr, "migrate %s -> %s: %d points copied\n", *collection, *to, stats.Copied)
+		},
+	}
+	if *reembed {
+		opts.Embedder = NewOpenAIEmbedder(os.Getenv("OPENAI_API_KEY"), os.Getenv("OPENAI_BASE_URL"), *model, *vectorSize)
+	}
+
+	source := NewQdrantClient(*baseURL, *collection)
+	target := source.WithCollection(*to)
+
+	stats, err := NewMigrator(source, target).Migrate(opts)
+	if err != nil {
+		return err
+	}
+
+	if *alias != "" {
+		if err := target.SwitchAlias(*alias); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "alias %s -> %s\n", *alias, *to)
+	}
+	return printJSON(out, stats)
+}
+
+func runAlias(args []string, out io.Writer) error {
+	if len(args) == 0 || args[0] != "switch" {
+		return fmt.Errorf("usage: alias switch -collection <collection> <alias>")
+	}
+	fs, baseURL, collection := commonFlags("alias switch")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: alias switch -collection <collection> <alias>")
+	}
+
+	client := NewQdrantClient(*baseURL, *collection)
+	if err := client.SwitchAlias(fs.Arg(0)); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "alias %s -> %s\n", fs.Arg(0), *collection)
+	return nil
+}
+
+func printJSON(out io.Writer, v interface{}) error {
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
@@ -2,11 +2,20 @@ package main
 
 import (
 	"log"
+	"os"
 
 	"github.com/gin-gonic/gin"
 )
 
 func main() {
+	// 运维子命令：snapshot / migrate / alias
+	if len(os.Args) > 1 {
+		if err := runCommand(os.Args[1:], os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	// 初始化 Qdrant 客户端
 	qdrant := NewQdrantClient("http://localhost:6333", "documents")
 
@@ -26,4 +35,3 @@ func main() {
 		log.Fatal(err)
 	}
 }
-
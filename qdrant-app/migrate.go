@@ -0,0 +1,306 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Embedder 文本向量化接口（迁移时重新生成向量）
+type Embedder interface {
+	Embed(text string) ([]float32, error)
+}
+
+// Point Qdrant 点（ID 与向量保持原始 JSON，兼容整数/UUID ID 和命名向量）
+type Point struct {
+	ID      json.RawMessage        `json:"id"`
+	Vector  json.RawMessage        `json:"vector,omitempty"`
+	Payload map[string]interface{} `json:"payload,omitempty"`
+}
+
+// ScrollPoints 分页读取 collection 中的点
+// offset 为 nil 时从头开始；返回的 next 为 nil 表示已读完
+func (c *QdrantClient) ScrollPoints(offset json.RawMessage, limit int) (points []Point, next json.RawMessage, err error) {
+	body := map[string]interface{}{
+		"limit":        limit,
+		"with_payload": true,
+		"with_vector":  true,
+	}
+	if len(offset) > 0 {
+		body["offset"] = offset
+	}
+
+	var result struct {
+		Points         []Point         `json:"points"`
+		NextPageOffset json.RawMessage `json:"next_page_offset"`
+	}
+	path := fmt.Sprintf("/collections/%s/points/scroll", c.collection)
+	if err := c.doJSON(http.MethodPost, path, body, &result); err != nil {
+		return nil, nil, fmt.Errorf("scroll points: %w", err)
+	}
+
+	if string(result.NextPageOffset) == "null" {
+		result.NextPageOffset = nil
+	}
+	return result.Points, result.NextPageOffset, nil
+}
+
+// UpsertPoints 批量写入点
+func (c *QdrantClient) UpsertPoints(points []Point) error {
+	if len(points) == 0 {
+		return nil
+	}
+	body := map[string]interface{}{"points": points}
+	path := fmt.Sprintf("/collections/%s/points?wait=true", c.collection)
+	if err := c.doJSON(http.MethodPut, path, body, nil); err != nil {
+		return fmt.Errorf("upsert points: %w", err)
+	}
+	return nil
+}
+
+// MigrateOptions 迁移选项
+type MigrateOptions struct {
+	// FieldMapping payload 字段重命名：旧字段 -> 新字段，新字段为空表示删除
+	FieldMapping map[string]string
+
+	// Embedder 不为空时用 EmbedField 的文本重新生成向量（如更换 Embedding 模型）
+	Embedder   Embedder
+	EmbedField string // 默认 content（按重命名之后的字段名读取）
+
+	// VectorSize 目标 collection 的向量维度（0 表示沿用源 collection）
+	VectorSize int
+	Distance   string // 为空时沿用源 collection
+
+	// CreateTarget 目标 collection 不存在时自动创建
+	CreateTarget bool
+
+	BatchSize int // 每批读取/写入的点数，默认 256
+
+	// Progress 每批写入后以当前统计调用（可为 nil）
+	Progress func(stats MigrateStats)
+}
+
+// MigrateStats 迁移统计
+type MigrateStats struct {
+	Copied     int `json:"copied"`
+	Reembedded int `json:"reembedded"`
+	Batches    int `json:"batches"`
+}
+
+// Migrator 在两个 collection 之间复制点
+//
+// 典型的蓝绿切换流程：
+//
+//	documents_v1 (alias: documents)  --migrate-->  documents_v2
+//	SwitchAlias("documents") 指向 documents_v2，查询方无感知
+type Migrator struct {
+	source *QdrantClient
+	target *QdrantClient
+}
+
+func NewMigrator(source, target *QdrantClient) *Migrator {
+	return &Migrator{
+		source: source,
+		target: target,
+	}
+}
+
+// Migrate 执行迁移
+func (m *Migrator) Migrate(opts MigrateOptions) (*MigrateStats, error) {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 256
+	}
+	if opts.EmbedField == "" {
+		opts.EmbedField = "content"
+	}
+
+	vectorSize, distance := opts.VectorSize, opts.Distance
+	if opts.Embedder != nil && vectorSize == 0 {
+		return nil, fmt.Errorf("vector size is required when re-embedding")
+	}
+	if opts.Embedder == nil || (opts.CreateTarget && distance == "") {
+		params, err := m.source.VectorParams()
+		if err != nil {
+			return nil, err
+		}
+		if opts.Embedder == nil {
+			// 不重新生成向量时原样复制，目标维度必须与源一致，在创建目标 collection 之前检查
+			if vectorSize != 0 && vectorSize != params.Size {
+				return nil, fmt.Errorf("vector size %d differs from source %d, re-embedding is required to change it", vectorSize, params.Size)
+			}
+			vectorSize = params.Size
+		}
+		if distance == "" {
+			distance = params.Distance
+		}
+	}
+
+	if opts.CreateTarget {
+		if err := m.target.CreateCollection(vectorSize, distance); err != nil {
+			return nil, err
+		}
+	}
+
+	stats := &MigrateStats{}
+	var offset json.RawMessage
+	for {
+		points, next, err := m.source.ScrollPoints(offset, opts.BatchSize)
+		if err != nil {
+			return stats, err
+		}
+
+		out := make([]Point, 0, len(points))
+		for _, p := range points {
+			p.Payload = remapPayload(p.Payload, opts.FieldMapping)
+
+			if opts.Embedder != nil {
+				text, _ := p.Payload[opts.EmbedField].(string)
+				if text == "" {
+					return stats, fmt.Errorf("point %s: payload field %q is empty", string(p.ID), opts.EmbedField)
+				}
+				vec, err := opts.Embedder.Embed(text)
+				if err != nil {
+					return stats, fmt.Errorf("point %s: embed: %w", string(p.ID), err)
+				}
+				if len(vec) != vectorSize {
+					return stats, fmt.Errorf("point %s: embedding size %d, expected %d", string(p.ID), len(vec), vectorSize)
+				}
+				p.Vector, _ = json.Marshal(vec)
+				stats.Reembedded++
+			}
+
+			out = append(out, p)
+		}
+
+		if err := m.target.UpsertPoints(out); err != nil {
+			return stats, err
+		}
+		stats.Copied += len(out)
+		stats.Batches++
+		if opts.Progress != nil {
+			opts.Progress(*stats)
+		}
+
+		if next == nil {
+			return stats, nil
+		}
+		offset = next
+	}
+}
+
+// remapPayload 按映射重命名/删除 payload 字段，未出现在映射中的字段原样保留
+func remapPayload(payload map[string]interface{}, mapping map[string]string) map[string]interface{} {
+	if len(mapping) == 0 {
+		return payload
+	}
+
+	out := make(map[string]interface{}, len(payload))
+	for k, v := range payload {
+		newKey, ok := mapping[k]
+		if !ok {
+			out[k] = v
+			continue
+		}
+		if newKey != "" {
+			out[newKey] = v
+		}
+	}
+	return out
+}
+
+// ParseFieldMapping 解析 "old:new,drop:" 格式的字段映射
+func ParseFieldMapping(s string) (map[string]string, error) {
+	mapping := map[string]string{}
+	if strings.TrimSpace(s) == "" {
+		return mapping, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		parts := strings.SplitN(strings.TrimSpace(pair), ":", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid field mapping %q, expected old:new", pair)
+		}
+		mapping[parts[0]] = parts[1]
+	}
+	return mapping, nil
+}
+
+// OpenAIEmbedder OpenAI 兼容的 Embedding 客户端
+type OpenAIEmbedder struct {
+	apiKey     string
+	baseURL    string
+	model      string
+	dimensions int
+	httpClient *http.Client
+}
+
+// NewOpenAIEmbedder 创建 Embedding 客户端
+// dimensions > 0 时请求指定维度（text-embedding-3-* 支持）
+func NewOpenAIEmbedder(apiKey, baseURL, model string, dimensions int) *OpenAIEmbedder {
+	if baseURL == "" {
+		baseURL = "https://api.openai.com/v1"
+	}
+	if model == "" {
+		model = "text-embedding-3-small"
+	}
+	return &OpenAIEmbedder{
+		apiKey:     apiKey,
+		baseURL:    baseURL,
+		model:      model,
+		dimensions: dimensions,
+		httpClient: &http.Client{},
+	}
+}
+
+// Embed 生成 Embedding
+func (e *OpenAIEmbedder) Embed(text string) ([]float32, error) {
+	requestBody := map[string]interface{}{
+		"model": e.model,
+		"input": text,
+	}
+	if e.dimensions > 0 {
+		requestBody["dimensions"] = e.dimensions
+	}
+
+	data, err := json.Marshal(requestBody)
+	if err != nil {
+		return nil, fmt.Errorf("marshal request: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, e.baseURL+"/embeddings", bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+e.apiKey)
+
+	resp, err := e.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("embedding api error (status %d): %s", resp.StatusCode, string(body))
+	}
+
+	var result struct {
+		Data []struct {
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("unmarshal response: %w", err)
+	}
+	if len(result.Data) == 0 {
+		return nil, fmt.Errorf("no embeddings in response")
+	}
+	return result.Data[0].Embedding, nil
+}
@@ -0,0 +1,394 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeQdrant 内存版 Qdrant（只实现迁移用到的接口）
+type fakeQdrant struct {
+	mu       sync.Mutex
+	points   map[string][]Point // collection -> points
+	created  map[string]int     // collection -> vector size
+	distance map[string]string  // collection -> distance（未设置时为 Cosine）
+	aliases  map[string]string  // alias -> collection
+	pageSize int
+}
+
+func newFakeQdrant() *fakeQdrant {
+	return &fakeQdrant{
+		points:   map[string][]Point{},
+		created:  map[string]int{},
+		distance: map[string]string{},
+		aliases:  map[string]string{},
+	}
+}
+
+func (f *fakeQdrant) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	reply := func(result interface{}) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"result": result, "status": "ok"})
+	}
+
+	switch {
+	case r.URL.Path == "/aliases":
+		list := []AliasInfo{}
+		for a, c := range f.aliases {
+			list = append(list, AliasInfo{AliasName: a, CollectionName: c})
+		}
+		reply(map[string]interface{}{"aliases": list})
+
+	case r.URL.Path == "/collections/aliases":
+		var body struct {
+			Actions []map[string]map[string]string `json:"actions"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		for _, action := range body.Actions {
+			if del, ok := action["delete_alias"]; ok {
+				if _, exists := f.aliases[del["alias_name"]]; !exists {
+					http.Error(w, "alias not found", http.StatusNotFound)
+					return
+				}
+				delete(f.aliases, del["alias_name"])
+			}
+			if create, ok := action["create_alias"]; ok {
+				f.aliases[create["alias_name"]] = create["collection_name"]
+			}
+		}
+		reply(true)
+
+	case len(parts) == 2 && r.Method == http.MethodGet:
+		size, distance := f.created[parts[1]], f.distance[parts[1]]
+		if distance == "" {
+			distance = "Cosine"
+		}
+		reply(map[string]interface{}{
+			"config": map[string]interface{}{
+				"params": map[string]interface{}{
+					"vectors": map[string]interface{}{"size": size, "distance": distance},
+				},
+			},
+		})
+
+	case len(parts) == 2 && r.Method == http.MethodPut:
+		var body struct {
+			Vectors VectorParams `json:"vectors"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		f.created[parts[1]] = body.Vectors.Size
+		f.distance[parts[1]] = body.Vectors.Distance
+		reply(true)
+
+	case len(parts) == 4 && parts[3] == "scroll":
+		var body struct {
+			Limit  int             `json:"limit"`
+			Offset json.RawMessage `json:"offset"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		all := f.points[parts[1]]
+		start := 0
+		if len(body.Offset) > 0 {
+			json.Unmarshal(body.Offset, &start)
+		}
+		end := start + body.Limit
+		var next interface{}
+		if end < len(all) {
+			next = end
+		} else {
+			end = len(all)
+		}
+		reply(map[string]interface{}{"points": all[start:end], "next_page_offset": next})
+
+	case len(parts) == 3 && parts[2] == "points" && r.Method == http.MethodPut:
+		var body struct {
+			Points []Point `json:"points"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		f.points[parts[1]] = append(f.points[parts[1]], body.Points...)
+		reply(map[string]interface{}{"status": "completed"})
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+type fakeEmbedder struct {
+	size  int
+	calls []string
+}
+
+func (e *fakeEmbedder) Embed(text string) ([]float32, error) {
+	e.calls = append(e.calls, text)
+	vec := make([]float32, e.size)
+	vec[0] = float32(len(text))
+	return vec, nil
+}
+
+func seedPoints(n int) []Point {
+	points := make([]Point, 0, n)
+	for i := 1; i <= n; i++ {
+		id, _ := json.Marshal(i)
+		points = append(points, Point{
+			ID:     id,
+			Vector: json.RawMessage(`[0.1,0.2,0.3]`),
+			Payload: map[string]interface{}{
+				"title":    "doc",
+				"content":  strings.Repeat("x", i),
+				"obsolete": true,
+			},
+		})
+	}
+	return points
+}
+
+func TestMigrateCopiesAndRemapsPayload(t *testing.T) {
+	fake := newFakeQdrant()
+	fake.created["documents_v1"] = 3
+	fake.points["documents_v1"] = seedPoints(5)
+
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	source := NewQdrantClient(server.URL, "documents_v1")
+	target := source.WithCollection("documents_v2")
+
+	var progress []int
+	stats, err := NewMigrator(source, target).Migrate(MigrateOptions{
+		FieldMapping: map[string]string{"title": "name", "obsolete": ""},
+		CreateTarget: true,
+		BatchSize:    2,
+		Progress:     func(s MigrateStats) { progress = append(progress, s.Copied) },
+	})
+	if err != nil {
+		t.Fatalf("Migrate failed: %v", err)
+	}
+
+	if stats.Copied != 5 || stats.Batches != 3 {
+		t.Errorf("Expected 5 points in 3 batches, got %+v", stats)
+	}
+	if len(progress) != 3 || progress[0] != 2 || progress[2] != 5 {
+		t.Errorf("Expected progress after each batch, got %v", progress)
+	}
+	if fake.created["documents_v2"] != 3 {
+		t.Errorf("Expected target created with source vector size 3, got %d", fake.created["documents_v2"])
+	}
+
+	copied := fake.points["documents_v2"]
+	if len(copied) != 5 {
+		t.Fatalf("Expected 5 points in target, got %d", len(copied))
+	}
+	for _, p := range copied {
+		if _, ok := p.Payload["title"]; ok {
+			t.Error("title should be renamed to name")
+		}
+		if p.Payload["name"] != "doc" {
+			t.Errorf("Expected name=doc, got %v", p.Payload["name"])
+		}
+		if _, ok := p.Payload["obsolete"]; ok {
+			t.Error("obsolete should be dropped")
+		}
+		if string(p.Vector) != `[0.1,0.2,0.3]` {
+			t.Errorf("Vector should be copied as-is, got %s", p.Vector)
+		}
+	}
+}
+
+func TestMigrateReembedsWithNewVectorSize(t *testing.T) {
+	fake := newFakeQdrant()
+	fake.created["documents_v1"] = 3
+	fake.points["documents_v1"] = seedPoints(3)
+
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	source := NewQdrantClient(server.URL, "documents_v1")
+	target := source.WithCollection("documents_v2")
+	embedder := &fakeEmbedder{size: 8}
+
+	stats, err := NewMigrator(source, target).Migrate(MigrateOptions{
+		Embedder:     embedder,
+		VectorSize:   8,
+		CreateTarget: true,
+	})
+	if err != nil {
+		t.Fatalf("Migrate failed: %v", err)
+	}
+
+	if stats.Reembedded != 3 || len(embedder.calls) != 3 {
+		t.Errorf("Expected 3 re-embedded points, got stats=%+v calls=%d", stats, len(embedder.calls))
+	}
+	if fake.created["documents_v2"] != 8 {
+		t.Errorf("Expected target vector size 8, got %d", fake.created["documents_v2"])
+	}
+	for _, p := range fake.points["documents_v2"] {
+		var vec []float32
+		if err := json.Unmarshal(p.Vector, &vec); err != nil {
+			t.Fatalf("Invalid vector: %v", err)
+		}
+		if len(vec) != 8 {
+			t.Errorf("Expected vector size 8, got %d", len(vec))
+		}
+	}
+}
+
+func TestMigrateReembedRequiresVectorSize(t *testing.T) {
+	m := NewMigrator(NewQdrantClient("http://unused", "a"), NewQdrantClient("http://unused", "b"))
+	if _, err := m.Migrate(MigrateOptions{Embedder: &fakeEmbedder{size: 4}}); err == nil {
+		t.Error("Expected error when re-embedding without vector size")
+	}
+}
+
+func TestMigrateRejectsVectorSizeChangeWithoutReembed(t *testing.T) {
+	fake := newFakeQdrant()
+	fake.created["documents_v1"] = 3
+	fake.points["documents_v1"] = seedPoints(2)
+
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	source := NewQdrantClient(server.URL, "documents_v1")
+	_, err := NewMigrator(source, source.WithCollection("documents_v2")).Migrate(MigrateOptions{
+		VectorSize:   8,
+		CreateTarget: true,
+	})
+	if err == nil || !strings.Contains(err.Error(), "differs from source 3") {
+		t.Fatalf("Expected vector size mismatch error, got %v", err)
+	}
+	if _, ok := fake.created["documents_v2"]; ok {
+		t.Error("Target collection should not be created on vector size mismatch")
+	}
+}
+
+func TestMigrateKeepsSourceDistance(t *testing.T) {
+	fake := newFakeQdrant()
+	fake.created["documents_v1"] = 3
+	fake.distance["documents_v1"] = "Dot"
+	fake.points["documents_v1"] = seedPoints(2)
+
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	source := NewQdrantClient(server.URL, "documents_v1")
+	if _, err := NewMigrator(source, source.WithCollection("documents_v2")).Migrate(MigrateOptions{CreateTarget: true}); err != nil {
+		t.Fatalf("Migrate failed: %v", err)
+	}
+	if fake.distance["documents_v2"] != "Dot" {
+		t.Errorf("Expected target created with source distance Dot, got %q", fake.distance["documents_v2"])
+	}
+
+	if _, err := NewMigrator(source, source.WithCollection("documents_v3")).Migrate(MigrateOptions{Distance: "Euclid", CreateTarget: true}); err != nil {
+		t.Fatalf("Migrate failed: %v", err)
+	}
+	if fake.distance["documents_v3"] != "Euclid" {
+		t.Errorf("Expected explicit distance to override the source, got %q", fake.distance["documents_v3"])
+	}
+}
+
+func TestVectorParamsRejectsNamedVectors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"result": {"config": {"params": {"vectors": {"text": {"size": 4, "distance": "Cosine"}}}}}}`)
+	}))
+	defer server.Close()
+
+	if _, err := NewQdrantClient(server.URL, "documents").VectorParams(); err == nil || !strings.Contains(err.Error(), "single unnamed vector") {
+		t.Errorf("Expected an error for named vectors, got %v", err)
+	}
+}
+
+func TestSwitchAlias(t *testing.T) {
+	fake := newFakeQdrant()
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	client := NewQdrantClient(server.URL, "documents_v1")
+	if err := client.SwitchAlias("documents"); err != nil {
+		t.Fatalf("SwitchAlias (create) failed: %v", err)
+	}
+	if fake.aliases["documents"] != "documents_v1" {
+		t.Fatalf("Expected alias -> documents_v1, got %q", fake.aliases["documents"])
+	}
+
+	if err := client.WithCollection("documents_v2").SwitchAlias("documents"); err != nil {
+		t.Fatalf("SwitchAlias (switch) failed: %v", err)
+	}
+	if fake.aliases["documents"] != "documents_v2" {
+		t.Errorf("Expected alias -> documents_v2, got %q", fake.aliases["documents"])
+	}
+}
+
+func TestSnapshotCommands(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/collections/documents/snapshots":
+			w.Write([]byte(`{"result":{"name":"documents-1.snapshot","creation_time":"2024-01-01T00:00:00","size":42}}`))
+		case r.Method == http.MethodGet && r.URL.Path == "/collections/documents/snapshots":
+			w.Write([]byte(`{"result":[{"name":"documents-1.snapshot","size":42}]}`))
+		case r.Method == http.MethodGet && r.URL.Path == "/collections/documents/snapshots/documents-1.snapshot":
+			w.Write([]byte("SNAPSHOT-BYTES"))
+		case r.Method == http.MethodPut && r.URL.Path == "/collections/documents/snapshots/recover":
+			var body map[string]string
+			json.NewDecoder(r.Body).Decode(&body)
+			if body["location"] != "file:///snapshots/documents-1.snapshot" {
+				http.Error(w, "bad location", http.StatusBadRequest)
+				return
+			}
+			w.Write([]byte(`{"result":true}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	client := NewQdrantClient(server.URL, "documents")
+
+	info, err := client.CreateSnapshot()
+	if err != nil {
+		t.Fatalf("CreateSnapshot failed: %v", err)
+	}
+	if info.Name != "documents-1.snapshot" || info.Size != 42 {
+		t.Errorf("Unexpected snapshot info: %+v", info)
+	}
+
+	snapshots, err := client.ListSnapshots()
+	if err != nil || len(snapshots) != 1 {
+		t.Fatalf("ListSnapshots: got %v, err %v", snapshots, err)
+	}
+
+	var buf bytes.Buffer
+	if _, err := client.DownloadSnapshot("documents-1.snapshot", &buf); err != nil {
+		t.Fatalf("DownloadSnapshot failed: %v", err)
+	}
+	if buf.String() != "SNAPSHOT-BYTES" {
+		t.Errorf("Unexpected snapshot content: %q", buf.String())
+	}
+
+	if err := client.RestoreSnapshot("file:///snapshots/documents-1.snapshot"); err != nil {
+		t.Errorf("RestoreSnapshot failed: %v", err)
+	}
+	if _, err := client.DownloadSnapshot("missing.snapshot", &buf); err == nil {
+		t.Error("Expected error for missing snapshot")
+	}
+}
+
+func TestParseFieldMapping(t *testing.T) {
+	mapping, err := ParseFieldMapping("title:name, obsolete:")
+	if err != nil {
+		t.Fatalf("ParseFieldMapping failed: %v", err)
+	}
+	if mapping["title"] != "name" || mapping["obsolete"] != "" || len(mapping) != 2 {
+		t.Errorf("Unexpected mapping: %v", mapping)
+	}
+
+	if _, err := ParseFieldMapping("title"); err == nil {
+		t.Error("Expected error for mapping without colon")
+	}
+}
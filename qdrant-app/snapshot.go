@@ -0,0 +1,272 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+)
+
+// SnapshotInfo 快照信息
+type SnapshotInfo struct {
+	Name         string `json:"name"`
+	CreationTime string `json:"creation_time"`
+	Size         int64  `json:"size"`
+}
+
+// AliasInfo 别名信息
+type AliasInfo struct {
+	AliasName      string `json:"alias_name"`
+	CollectionName string `json:"collection_name"`
+}
+
+// CollectionName 当前客户端操作的 collection
+func (c *QdrantClient) CollectionName() string {
+	return c.collection
+}
+
+// WithCollection 返回指向另一个 collection 的客户端（共享 HTTP 连接）
+func (c *QdrantClient) WithCollection(collection string) *QdrantClient {
+	return &QdrantClient{
+		baseURL:    c.baseURL,
+		collection: collection,
+		httpClient: c.httpClient,
+	}
+}
+
+// CreateSnapshot 创建 collection 快照
+func (c *QdrantClient) CreateSnapshot() (*SnapshotInfo, error) {
+	var info SnapshotInfo
+	path := fmt.Sprintf("/collections/%s/snapshots?wait=true", c.collection)
+	if err := c.doJSON(http.MethodPost, path, nil, &info); err != nil {
+		return nil, fmt.Errorf("create snapshot: %w", err)
+	}
+	return &info, nil
+}
+
+// ListSnapshots 列出 collection 的所有快照
+func (c *QdrantClient) ListSnapshots() ([]SnapshotInfo, error) {
+	var snapshots []SnapshotInfo
+	path := fmt.Sprintf("/collections/%s/snapshots", c.collection)
+	if err := c.doJSON(http.MethodGet, path, nil, &snapshots); err != nil {
+		return nil, fmt.Errorf("list snapshots: %w", err)
+	}
+	return snapshots, nil
+}
+
+// DownloadSnapshot 下载快照文件并写入 w
+func (c *QdrantClient) DownloadSnapshot(name string, w io.Writer) (int64, error) {
+	u := fmt.Sprintf("%s/collections/%s/snapshots/%s", c.baseURL, c.collection, url.PathEscape(name))
+	resp, err := c.httpClient.Get(u)
+	if err != nil {
+		return 0, fmt.Errorf("download snapshot: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return 0, fmt.Errorf("download snapshot: qdrant error (status %d): %s", resp.StatusCode, string(body))
+	}
+
+	n, err := io.Copy(w, resp.Body)
+	if err != nil {
+		return n, fmt.Errorf("download snapshot: %w", err)
+	}
+	return n, nil
+}
+
+// RestoreSnapshot 从 URL 或 Qdrant 节点上的 file:// 路径恢复快照
+//
+// location 示例:
+//
+//	http://backup-host/documents-2024.snapshot
+//	file:///qdrant/snapshots/documents/documents-2024.snapshot
+func (c *QdrantClient) RestoreSnapshot(location string) error {
+	body := map[string]interface{}{
+		"location": location,
+		"priority": "snapshot", // 以快照数据为准
+	}
+	path := fmt.Sprintf("/collections/%s/snapshots/recover?wait=true", c.collection)
+	if err := c.doJSON(http.MethodPut, path, body, nil); err != nil {
+		return fmt.Errorf("restore snapshot: %w", err)
+	}
+	return nil
+}
+
+// UploadSnapshot 上传本地快照文件并恢复
+func (c *QdrantClient) UploadSnapshot(filePath string) error {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return fmt.Errorf("upload snapshot: %w", err)
+	}
+	defer f.Close()
+
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	part, err := mw.CreateFormFile("snapshot", filepath.Base(filePath))
+	if err != nil {
+		return fmt.Errorf("upload snapshot: %w", err)
+	}
+	if _, err := io.Copy(part, f); err != nil {
+		return fmt.Errorf("upload snapshot: %w", err)
+	}
+	if err := mw.Close(); err != nil {
+		return fmt.Errorf("upload snapshot: %w", err)
+	}
+
+	u := fmt.Sprintf("%s/collections/%s/snapshots/upload?wait=true&priority=snapshot", c.baseURL, c.collection)
+	resp, err := c.httpClient.Post(u, mw.FormDataContentType(), &buf)
+	if err != nil {
+		return fmt.Errorf("upload snapshot: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("upload snapshot: qdrant error (status %d): %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
+
+// VectorParams collection 的向量参数
+type VectorParams struct {
+	Size     int    `json:"size"`
+	Distance string `json:"distance"`
+}
+
+// VectorParams 读取 collection 的向量维度与距离（仅支持单一未命名向量）
+func (c *QdrantClient) VectorParams() (*VectorParams, error) {
+	var info struct {
+		Config struct {
+			Params struct {
+				Vectors json.RawMessage `json:"vectors"`
+			} `json:"params"`
+		} `json:"config"`
+	}
+	if err := c.doJSON(http.MethodGet, "/collections/"+c.collection, nil, &info); err != nil {
+		return nil, fmt.Errorf("get collection: %w", err)
+	}
+
+	// 命名向量的 vectors 是 名称 -> 参数 的对象，没有顶层 size
+	var params VectorParams
+	if err := json.Unmarshal(info.Config.Params.Vectors, &params); err != nil || params.Size == 0 {
+		return nil, fmt.Errorf("collection %s: only a single unnamed vector is supported, got vectors config %s", c.collection, string(info.Config.Params.Vectors))
+	}
+	return &params, nil
+}
+
+// CreateCollection 创建 collection
+// distance: Cosine / Euclid / Dot，为空时默认 Cosine
+func (c *QdrantClient) CreateCollection(vectorSize int, distance string) error {
+	if distance == "" {
+		distance = "Cosine"
+	}
+	body := map[string]interface{}{
+		"vectors": map[string]interface{}{
+			"size":     vectorSize,
+			"distance": distance,
+		},
+	}
+	if err := c.doJSON(http.MethodPut, "/collections/"+c.collection, body, nil); err != nil {
+		return fmt.Errorf("create collection: %w", err)
+	}
+	return nil
+}
+
+// ListAliases 列出指向当前 collection 的别名
+func (c *QdrantClient) ListAliases() ([]AliasInfo, error) {
+	var result struct {
+		Aliases []AliasInfo `json:"aliases"`
+	}
+	path := fmt.Sprintf("/collections/%s/aliases", c.collection)
+	if err := c.doJSON(http.MethodGet, path, nil, &result); err != nil {
+		return nil, fmt.Errorf("list aliases: %w", err)
+	}
+	return result.Aliases, nil
+}
+
+// SwitchAlias 将别名原子地切换到当前 collection（蓝绿切换）
+//
+// 删除旧别名与创建新别名在同一个请求中完成，查询方不会看到中间状态。
+func (c *QdrantClient) SwitchAlias(alias string) error {
+	var all struct {
+		Aliases []AliasInfo `json:"aliases"`
+	}
+	if err := c.doJSON(http.MethodGet, "/aliases", nil, &all); err != nil {
+		return fmt.Errorf("switch alias: %w", err)
+	}
+
+	actions := []map[string]interface{}{}
+	for _, a := range all.Aliases {
+		if a.AliasName == alias {
+			actions = append(actions, map[string]interface{}{
+				"delete_alias": map[string]string{"alias_name": alias},
+			})
+			break
+		}
+	}
+	actions = append(actions, map[string]interface{}{
+		"create_alias": map[string]string{"alias_name": alias, "collection_name": c.collection},
+	})
+
+	body := map[string]interface{}{"actions": actions}
+	if err := c.doJSON(http.MethodPost, "/collections/aliases", body, nil); err != nil {
+		return fmt.Errorf("switch alias: %w", err)
+	}
+	return nil
+}
+
+// doJSON 发送 JSON 请求并将响应中的 result 字段解析到 out（out 为 nil 时忽略）
+func (c *QdrantClient) doJSON(method, path string, body interface{}, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("marshal request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, c.baseURL+path, reader)
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("qdrant error (status %d): %s", resp.StatusCode, string(respBody))
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	var envelope struct {
+		Result json.RawMessage `json:"result"`
+	}
+	if err := json.Unmarshal(respBody, &envelope); err != nil {
+		return fmt.Errorf("unmarshal response: %w", err)
+	}
+	if err := json.Unmarshal(envelope.Result, out); err != nil {
+		return fmt.Errorf("unmarshal result: %w", err)
+	}
+	return nil
+}
@@ -4,7 +4,10 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"log"
 	"strings"
+	"sync"
+	"time"
 )
 
 // AgenticRAGService 第三代 Agentic RAG 服务
@@ -17,58 +20,110 @@ type AgenticRAGService struct {
 	baseRAG  *RAGService
 	planner  *QueryPlanner
 	executor *QueryExecutor
+	reranker Reranker // 可为 nil，此时 MMR 以与问题向量的相似度作为相关性
 }
 
-func NewAgenticRAGService(baseRAG *RAGService) *AgenticRAGService {
+func NewAgenticRAGService(baseRAG *RAGService, reranker Reranker) *AgenticRAGService {
 	return &AgenticRAGService{
 		baseRAG:  baseRAG,
 		planner:  NewQueryPlanner(baseRAG.llm),
-		executor: NewQueryExecutor(baseRAG),
+		executor: NewQueryExecutor(baseRAG, reranker),
+		reranker: reranker,
 	}
 }
 
 // Query 第三代 Agentic RAG 查询
 func (s *AgenticRAGService) Query(ctx context.Context, req RAGQueryRequest) (*RAGQueryResponse, error) {
+	return s.query(ctx, req, nil)
+}
+
+// QueryStream 流式 Agentic RAG 查询：依次推送 plan、hop（多跳模式）、sources、token 事件，返回完整响应
+func (s *AgenticRAGService) QueryStream(ctx context.Context, req RAGQueryRequest, emit StreamEmitter) (*RAGQueryResponse, error) {
+	return s.query(ctx, req, emit)
+}
+
+func (s *AgenticRAGService) query(ctx context.Context, req RAGQueryRequest, emit StreamEmitter) (*RAGQueryResponse, error) {
 	// === 阶段 1：问题分析与规划 ===
 	plan, err := s.planner.Plan(ctx, req.Question)
 	if err != nil {
 		return nil, fmt.Errorf("planning failed: %w", err)
 	}
+	if err := emit.Emit(EventPlan, plan); err != nil {
+		return nil, err
+	}
 
-	// 如果是简单问题，直接使用第一代 RAG
-	if plan.IsSimple {
-		return s.baseRAG.Query(ctx, req)
+	// 规划提取的关键词用于混合检索
+	if len(req.Keywords) == 0 {
+		req.Keywords = plan.Keywords
 	}
 
-	// === 阶段 2：多轮检索执行 ===
-	results, err := s.executor.Execute(ctx, plan, req)
+	// 如果是简单问题，直接使用第一代 RAG（多跳模式除外）
+	if plan.IsSimple && !req.Iterative {
+		return s.baseRAG.query(ctx, req, emit)
+	}
+
+	// === 阶段 2：多轮检索执行（多跳模式下迭代检索） ===
+	var results *ExecutionResults
+	var trace *MultiHopTrace
+	if req.Iterative {
+		results, trace, err = s.iterate(ctx, req, plan, emit)
+		if err == nil {
+			plan = plan.withQueries(trace.queries())
+		}
+	} else {
+		results, err = s.executor.Execute(ctx, plan, req)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("execution failed: %w", err)
 	}
 
-	// === 阶段 3：结果去重与重排 ===
-	uniqueChunks := s.dedup(results.AllChunks)
-	rerankedChunks := s.rerank(ctx, req.Question, uniqueChunks, s.getTopK(req))
+	// === 阶段 3：语义去重、重排与 MMR 多样性选择 ===
+	uniqueChunks := dedupChunks(results.AllChunks, req.dedupThreshold())
+	candidates, rerankErr := rerankChunks(ctx, s.reranker, req.Question, uniqueChunks, len(uniqueChunks))
+	if rerankErr != nil {
+		log.Printf("Rerank failed, falling back to retrieval order: %v", rerankErr)
+	}
+	selectedChunks := mmrSelect(s.questionVector(ctx, req.Question), candidates, s.getTopK(req), req.mmrLambda())
+
+	attachDocumentTitles(s.baseRAG.docs, selectedChunks)
+	if err := emit.Emit(EventSources, selectedChunks); err != nil {
+		return nil, err
+	}
 
 	// === 阶段 4：综合生成答案 ===
-	prompt := s.buildAgenticPrompt(req.Question, plan, results, rerankedChunks)
-	answer, err := s.baseRAG.llm.Generate(ctx, prompt)
+	prompt := s.buildAgenticPrompt(req.Question, plan, results, selectedChunks)
+	answer, err := generate(ctx, s.baseRAG.llm, prompt, emit)
 	if err != nil {
 		return nil, fmt.Errorf("generation failed: %w", err)
 	}
+	segments, citations := groundAnswer(ctx, s.baseRAG.llm, answer, selectedChunks, req.VerifyCitations)
+
+	metadata := map[string]interface{}{
+		"mode":            "agentic_rag_v3",
+		"is_simple":       plan.IsSimple,
+		"question_type":   plan.QuestionType,
+		"sub_queries":     plan.SubQueries,
+		"total_retrieved": len(uniqueChunks),
+		"deduplicated":    len(results.AllChunks) - len(uniqueChunks),
+		"mmr_lambda":      req.mmrLambda(),
+		"final_selected":  len(selectedChunks),
+		"rounds":          results.Rounds,
+		"round_details":   results.RoundResults,
+		"retrieval":       retrievalMode(req),
+		"citations":       citations,
+	}
+	rerankMetadata(metadata, s.reranker, rerankErr)
+	if trace != nil {
+		metadata["iterative"] = true
+		metadata["hops"] = len(trace.Hops)
+		metadata["trace"] = trace
+	}
 
 	return &RAGQueryResponse{
-		Answer:  answer,
-		Sources: rerankedChunks,
-		Metadata: map[string]interface{}{
-			"mode":            "agentic_rag_v3",
-			"is_simple":       plan.IsSimple,
-			"question_type":   plan.QuestionType,
-			"sub_queries":     plan.SubQueries,
-			"total_retrieved": len(uniqueChunks),
-			"final_selected":  len(rerankedChunks),
-			"rounds":          results.Rounds,
-		},
+		Answer:   answer,
+		Sources:  selectedChunks,
+		Segments: segments,
+		Metadata: metadata,
 	}, nil
 }
 
@@ -80,39 +135,14 @@ func (s *AgenticRAGService) getTopK(req RAGQueryRequest) int {
 	return 5
 }
 
-// dedup 去重（基于内容相似度）
-func (s *AgenticRAGService) dedup(chunks []*DocumentChunk) []*DocumentChunk {
-	if len(chunks) == 0 {
-		return chunks
-	}
-
-	// 简单去重：基于 ID
-	seen := make(map[int64]bool)
-	unique := make([]*DocumentChunk, 0)
-
-	for _, chunk := range chunks {
-		if !seen[chunk.ID] {
-			seen[chunk.ID] = true
-			unique = append(unique, chunk)
-		}
-	}
-
-	return unique
-}
-
-// rerank 重排序（基于相关性）
-func (s *AgenticRAGService) rerank(ctx context.Context, question string, chunks []*DocumentChunk, topK int) []*DocumentChunk {
-	// 简化版：保留前 topK 个
-	// 实际应用中应该使用：
-	// 1. LLM 重排（最准确但慢）
-	// 2. BGE-Reranker（平衡性能和准确性）
-	// 3. Cross-Encoder 模型
-
-	if len(chunks) <= topK {
-		return chunks
+// questionVector 原问题的向量，作为 MMR 的相关性依据；失败时返回 nil（按候选顺序计算相关性）
+func (s *AgenticRAGService) questionVector(ctx context.Context, question string) []float32 {
+	vector, err := s.baseRAG.embedder.Embed(ctx, question)
+	if err != nil {
+		log.Printf("Embed question for MMR failed, falling back to candidate order: %v", err)
+		return nil
 	}
-
-	return chunks[:topK]
+	return vector
 }
 
 // buildAgenticPrompt 构建 Agentic RAG 提示词
@@ -142,7 +172,7 @@ func (s *AgenticRAGService) buildAgenticPrompt(
 	// 展示检索到的文档
 	sb.WriteString("## 检索到的相关文档\n\n")
 	for i, chunk := range chunks {
-		sb.WriteString(fmt.Sprintf("### [文档 %d]\n", i+1))
+		sb.WriteString(fmt.Sprintf("### [%d]\n", i+1))
 		sb.WriteString(chunk.Content)
 		sb.WriteString("\n\n")
 	}
@@ -155,6 +185,7 @@ func (s *AgenticRAGService) buildAgenticPrompt(
 	sb.WriteString("2. 如果子问题的答案相关，请综合组织\n")
 	sb.WriteString("3. 如果文档中没有足够信息，请明确说明\n")
 	sb.WriteString("4. 回答应该自然流畅，不要生硬地罗列信息\n")
+	sb.WriteString("5. " + citationInstruction + "\n")
 
 	return sb.String()
 }
@@ -243,41 +274,112 @@ type QueryPlan struct {
 	Reasoning    string   `json:"reasoning"`
 }
 
+// withQueries 返回替换子问题后的计划副本（多跳模式下包含所有追问）
+func (p *QueryPlan) withQueries(queries []string) *QueryPlan {
+	copied := *p
+	copied.SubQueries = queries
+	return &copied
+}
+
 // ================== QueryExecutor ==================
 
 // QueryExecutor 查询执行器
+// 子问题并行检索（最多 concurrency 个同时进行），每轮的超时见 roundTimeoutFor
 type QueryExecutor struct {
-	baseRAG *RAGService
+	baseRAG      *RAGService
+	reranker     Reranker // 非 nil 时每轮过度召回，供后续重排
+	concurrency  int
+	roundTimeout time.Duration
 }
 
-func NewQueryExecutor(baseRAG *RAGService) *QueryExecutor {
-	return &QueryExecutor{baseRAG: baseRAG}
+const (
+	defaultRoundConcurrency = 4
+	defaultRoundTimeout     = 10 * time.Second // 单轮超时的上限
+	// roundDeadlineDivisor 请求带截止时间时，单轮最多使用剩余时间的 1/roundDeadlineDivisor，其余留给后续轮次、重排与生成
+	roundDeadlineDivisor = 2
+)
+
+func NewQueryExecutor(baseRAG *RAGService, reranker Reranker) *QueryExecutor {
+	return &QueryExecutor{
+		baseRAG:      baseRAG,
+		reranker:     reranker,
+		concurrency:  defaultRoundConcurrency,
+		roundTimeout: defaultRoundTimeout,
+	}
 }
 
 // Execute 执行多轮检索
+// 单轮失败或超时只记录在 RoundResults 中，全部失败时返回错误
 func (e *QueryExecutor) Execute(ctx context.Context, plan *QueryPlan, req RAGQueryRequest) (*ExecutionResults, error) {
+	n := len(plan.SubQueries)
+	chunks := make([][]*DocumentChunk, n)
+	errs := make([]error, n)
 	results := &ExecutionResults{
-		AllChunks: make([]*DocumentChunk, 0),
-		Rounds:    0,
+		AllChunks:    make([]*DocumentChunk, 0),
+		RoundResults: make([]RoundResult, n),
 	}
 
 	// 每个子问题执行一轮检索
-	for _, subQuery := range plan.SubQueries {
-		chunks, err := e.executeRound(ctx, subQuery, req)
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(e.concurrency, n); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				start := time.Now()
+				chunks[i], errs[i] = e.executeRound(ctx, plan.SubQueries[i], req)
+				results.RoundResults[i] = RoundResult{
+					Query:     plan.SubQueries[i],
+					LatencyMS: time.Since(start).Milliseconds(),
+					Hits:      len(chunks[i]),
+				}
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	// 按子问题顺序合并结果
+	var firstErr error
+	for i, err := range errs {
 		if err != nil {
-			// 单轮失败不影响整体
+			results.RoundResults[i].Error = err.Error()
+			if firstErr == nil {
+				firstErr = err
+			}
 			continue
 		}
-
-		results.AllChunks = append(results.AllChunks, chunks...)
+		results.AllChunks = append(results.AllChunks, chunks[i]...)
 		results.Rounds++
 	}
 
+	if n > 0 && results.Rounds == 0 {
+		return results, fmt.Errorf("all %d rounds failed: %w", n, firstErr)
+	}
 	return results, nil
 }
 
-// executeRound 执行单轮检索
+// roundTimeoutFor 单轮超时：ctx 带截止时间时取剩余时间的 1/roundDeadlineDivisor，不超过 roundTimeout
+func (e *QueryExecutor) roundTimeoutFor(ctx context.Context) time.Duration {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return e.roundTimeout
+	}
+	if timeout := time.Until(deadline) / roundDeadlineDivisor; timeout < e.roundTimeout {
+		return timeout
+	}
+	return e.roundTimeout
+}
+
+// executeRound 执行单轮检索，超过 roundTimeoutFor 给出的时间时中止
 func (e *QueryExecutor) executeRound(ctx context.Context, query string, req RAGQueryRequest) ([]*DocumentChunk, error) {
+	ctx, cancel := context.WithTimeout(ctx, e.roundTimeoutFor(ctx))
+	defer cancel()
+
 	// 1. 向量化子问题
 	queryVector, err := e.baseRAG.embedder.Embed(ctx, query)
 	if err != nil {
@@ -293,20 +395,22 @@ func (e *QueryExecutor) executeRound(ctx context.Context, query string, req RAGQ
 		}
 	}
 
-	chunks, err := e.baseRAG.repo.VectorSearch(
-		queryVector,
-		req.DocType,
-		req.Language,
-		roundTopK,
-	)
-
-	return chunks, err
+	return search(ctx, e.baseRAG.repo, queryVector, req, candidateK(e.reranker, roundTopK))
 }
 
 // ExecutionResults 执行结果
 type ExecutionResults struct {
-	AllChunks []*DocumentChunk
-	Rounds    int
+	AllChunks    []*DocumentChunk
+	Rounds       int           // 成功的轮数
+	RoundResults []RoundResult // 按子问题顺序
+}
+
+// RoundResult 单轮检索的结果
+type RoundResult struct {
+	Query     string `json:"query"`
+	LatencyMS int64  `json:"latency_ms"`
+	Hits      int    `json:"hits"`
+	Error     string `json:"error,omitempty"`
 }
 
 // ================== 辅助函数 ==================
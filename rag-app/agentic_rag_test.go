@@ -2,7 +2,11 @@ package main
 
 import (
 	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestAgenticRAG_SimpleQuestion(t *testing.T) {
@@ -11,8 +15,8 @@ func TestAgenticRAG_SimpleQuestion(t *testing.T) {
 	llm := &MockLLMService{}
 	repo := &MockChunkRepositoryImpl{}
 
-	ragService := NewRAGService(repo, embedder, llm)
-	agenticService := NewAgenticRAGService(ragService)
+	ragService := NewRAGService(repo, nil, embedder, llm, nil)
+	agenticService := NewAgenticRAGService(ragService, nil)
 
 	// 简单问题应该直接回退到第一代 RAG
 	req := RAGQueryRequest{
@@ -38,8 +42,8 @@ func TestAgenticRAG_ComplexQuestion(t *testing.T) {
 	llm := &MockLLMService{}
 	repo := &MockChunkRepositoryImpl{}
 
-	ragService := NewRAGService(repo, embedder, llm)
-	agenticService := NewAgenticRAGService(ragService)
+	ragService := NewRAGService(repo, nil, embedder, llm, nil)
+	agenticService := NewAgenticRAGService(ragService, nil)
 
 	// 复杂问题应该触发 Agentic RAG
 	req := RAGQueryRequest{
@@ -101,15 +105,16 @@ func TestQueryPlanner_ComplexQuestion(t *testing.T) {
 
 // MockChunkRepositoryImpl 用于测试
 type MockChunkRepositoryImpl struct {
+	docID int64 // 非 0 时返回的分块属于该文档
 }
 
 func (r *MockChunkRepositoryImpl) Create(chunk *DocumentChunk) error {
 	return nil
 }
 
-func (r *MockChunkRepositoryImpl) VectorSearch(queryVector []float32, docType, language string, limit int) ([]*DocumentChunk, error) {
+func (r *MockChunkRepositoryImpl) VectorSearch(ctx context.Context, queryVector []float32, docType, language string, limit int) ([]*DocumentChunk, error) {
 	// 返回模拟数据
-	return []*DocumentChunk{
+	chunks := []*DocumentChunk{
 		{
 			ID:      1,
 			Content: "Go 语言是 Google 开发的编程语言，以并发编程见长。",
@@ -122,10 +127,139 @@ func (r *MockChunkRepositoryImpl) VectorSearch(queryVector []float32, docType, l
 			ID:      3,
 			Content: "Channel 是 Go 语言中用于 Goroutine 之间通信的机制。",
 		},
-	}, nil
+	}
+	if r.docID != 0 {
+		for _, chunk := range chunks {
+			chunk.DocID = &r.docID
+		}
+	}
+	return chunks, nil
+}
+
+func (r *MockChunkRepositoryImpl) HybridSearch(ctx context.Context, queryVector []float32, keyword, docType, language string, limit int) ([]*DocumentChunk, error) {
+	return r.VectorSearch(ctx, queryVector, docType, language, limit)
+}
+
+// scriptedEmbedder 按子问题内容模拟各轮的表现："慢" 阻塞到超时，"错" 返回错误
+type scriptedEmbedder struct {
+	MockEmbeddingService
+	active  int32
+	maxSeen int32
+}
+
+func (e *scriptedEmbedder) Embed(ctx context.Context, text string) ([]float32, error) {
+	active := atomic.AddInt32(&e.active, 1)
+	defer atomic.AddInt32(&e.active, -1)
+	for {
+		seen := atomic.LoadInt32(&e.maxSeen)
+		if active <= seen || atomic.CompareAndSwapInt32(&e.maxSeen, seen, active) {
+			break
+		}
+	}
+
+	switch {
+	case strings.Contains(text, "慢"):
+		<-ctx.Done()
+		return nil, ctx.Err()
+	case strings.Contains(text, "错"):
+		return nil, errors.New("embedding api unavailable")
+	}
+	time.Sleep(10 * time.Millisecond)
+	return e.MockEmbeddingService.Embed(ctx, text)
+}
+
+func newScriptedExecutor(embedder EmbeddingService) *QueryExecutor {
+	executor := NewQueryExecutor(NewRAGService(&MockChunkRepositoryImpl{}, nil, embedder, &MockLLMService{}, nil), nil)
+	executor.concurrency = 2
+	executor.roundTimeout = 50 * time.Millisecond
+	return executor
+}
+
+func TestQueryExecutor_ParallelRoundsWithTimeout(t *testing.T) {
+	embedder := &scriptedEmbedder{}
+	executor := newScriptedExecutor(embedder)
+
+	plan := &QueryPlan{SubQueries: []string{"Go 并发", "慢查询", "出错的查询", "Rust 并发"}}
+	results, err := executor.Execute(context.Background(), plan, RAGQueryRequest{})
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+
+	if results.Rounds != 2 || len(results.AllChunks) != 6 {
+		t.Errorf("Expected 2 successful rounds with 6 chunks, got %d rounds, %d chunks", results.Rounds, len(results.AllChunks))
+	}
+	if embedder.maxSeen != 2 {
+		t.Errorf("Expected rounds to run 2 at a time, saw %d", embedder.maxSeen)
+	}
+
+	rounds := results.RoundResults
+	if len(rounds) != 4 || rounds[0].Query != "Go 并发" || rounds[0].Hits != 3 || rounds[0].Error != "" {
+		t.Fatalf("Unexpected round results: %+v", rounds)
+	}
+	if rounds[1].Hits != 0 || !strings.Contains(rounds[1].Error, "deadline exceeded") || rounds[1].LatencyMS < 50 {
+		t.Errorf("Expected slow round to time out after 50ms, got %+v", rounds[1])
+	}
+	if !strings.Contains(rounds[2].Error, "unavailable") {
+		t.Errorf("Expected failed round to record its error, got %+v", rounds[2])
+	}
 }
 
-func (r *MockChunkRepositoryImpl) HybridSearch(queryVector []float32, keyword, docType, language string, limit int) ([]*DocumentChunk, error) {
-	return r.VectorSearch(queryVector, docType, language, limit)
+func TestQueryExecutor_FailsOnlyWhenAllRoundsFail(t *testing.T) {
+	executor := newScriptedExecutor(&scriptedEmbedder{})
+
+	plan := &QueryPlan{SubQueries: []string{"慢查询", "出错的查询"}}
+	results, err := executor.Execute(context.Background(), plan, RAGQueryRequest{})
+	if err == nil || !strings.Contains(err.Error(), "all 2 rounds failed") {
+		t.Fatalf("Expected all rounds failed error, got %v", err)
+	}
+	if len(results.RoundResults) != 2 || results.RoundResults[1].Error == "" {
+		t.Errorf("Expected per-round errors to be recorded, got %+v", results.RoundResults)
+	}
+
+	// 请求的 ctx 取消时各轮随之结束
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := executor.Execute(ctx, &QueryPlan{SubQueries: []string{"慢查询"}}, RAGQueryRequest{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
+
+func TestQueryExecutor_RoundTimeoutFollowsDeadline(t *testing.T) {
+	executor := newScriptedExecutor(&scriptedEmbedder{})
+	executor.roundTimeout = time.Second
+
+	if got := executor.roundTimeoutFor(context.Background()); got != time.Second {
+		t.Errorf("Expected cap without deadline, got %v", got)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if got := executor.roundTimeoutFor(ctx); got != time.Second {
+		t.Errorf("Expected cap with distant deadline, got %v", got)
+	}
+
+	// 剩余 100ms 时每轮最多 50ms，慢查询不会耗尽整个请求的时间
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if got := executor.roundTimeoutFor(ctx); got > 50*time.Millisecond || got < 40*time.Millisecond {
+		t.Errorf("Expected about half of the remaining time, got %v", got)
+	}
+	// 慢查询超时后仍有剩余时间完成下一轮
+	results, _ := executor.Execute(ctx, &QueryPlan{SubQueries: []string{"慢查询", "Go 并发"}}, RAGQueryRequest{})
+	if results.Rounds != 1 || results.RoundResults[0].Error == "" || results.RoundResults[1].Error != "" {
+		t.Errorf("Expected slow round to time out and the next round to succeed, got %+v", results.RoundResults)
+	}
 }
 
+func TestAgenticRAG_RoundDetailsInMetadata(t *testing.T) {
+	ragService := NewRAGService(&MockChunkRepositoryImpl{}, nil, &MockEmbeddingService{}, &MockLLMService{}, nil)
+	agenticService := NewAgenticRAGService(ragService, nil)
+
+	resp, err := agenticService.Query(context.Background(), RAGQueryRequest{Question: "Go 和 Rust 在并发编程上有什么区别？"})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	rounds, ok := resp.Metadata["round_details"].([]RoundResult)
+	if !ok || len(rounds) != 3 || rounds[2].Query != "Go 和 Rust 并发编程的区别" || rounds[2].Hits != 3 {
+		t.Errorf("Expected round details for 3 sub-queries, got %+v", resp.Metadata["round_details"])
+	}
+}
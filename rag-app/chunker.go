@@ -0,0 +1,350 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// 分块策略
+const (
+	ChunkerRecursive = "recursive" // 按段落 → 行 → 句子 → 词 → 字符逐级切分（默认）
+	ChunkerMarkdown  = "markdown"  // 按 Markdown 标题切分章节，块前附标题路径
+	ChunkerSentence  = "sentence"  // 按句子（中英文标点）组合成块
+)
+
+// 分块长度单位
+const (
+	ChunkUnitRune  = "rune"  // 字符数（默认）
+	ChunkUnitToken = "token" // 估算的 token 数
+)
+
+const (
+	defaultChunkSize    = 500
+	defaultChunkOverlap = 50
+)
+
+// ErrInvalidChunkOptions 分块参数不合法
+var ErrInvalidChunkOptions = errors.New("invalid chunk options")
+
+// Chunker 文档分块策略
+type Chunker interface {
+	Split(content string) []string
+}
+
+// ChunkOptions 分块参数
+type ChunkOptions struct {
+	Strategy string // recursive | markdown | sentence
+	Unit     string // rune | token
+	Size     int    // 每块的最大长度
+	Overlap  int    // 相邻块的重叠长度
+}
+
+// WithDefaults 填充默认值：recursive、rune、500 / 50（只指定 chunk_size 时重叠为 0）
+func (o ChunkOptions) WithDefaults() ChunkOptions {
+	if o.Strategy == "" {
+		o.Strategy = ChunkerRecursive
+	}
+	if o.Unit == "" {
+		o.Unit = ChunkUnitRune
+	}
+	if o.Size == 0 {
+		o.Size = defaultChunkSize
+		if o.Overlap == 0 {
+			o.Overlap = defaultChunkOverlap
+		}
+	}
+	return o
+}
+
+// NewChunker 按参数创建分块器，零值取默认值
+func NewChunker(opts ChunkOptions) (Chunker, error) {
+	opts = opts.WithDefaults()
+	if opts.Size < 0 || opts.Overlap < 0 || opts.Overlap >= opts.Size {
+		return nil, fmt.Errorf("%w: chunk_size must be positive and chunk_overlap smaller than chunk_size", ErrInvalidChunkOptions)
+	}
+
+	var length LengthFunc
+	switch opts.Unit {
+	case ChunkUnitRune:
+		length = utf8.RuneCountInString
+	case ChunkUnitToken:
+		length = EstimateTokens
+	default:
+		return nil, fmt.Errorf("%w: unknown chunk_unit %q", ErrInvalidChunkOptions, opts.Unit)
+	}
+
+	recursive := &RecursiveChunker{Size: opts.Size, Overlap: opts.Overlap, Length: length}
+	switch opts.Strategy {
+	case ChunkerRecursive:
+		return recursive, nil
+	case ChunkerMarkdown:
+		return &MarkdownChunker{Body: recursive}, nil
+	case ChunkerSentence:
+		return &SentenceChunker{Size: opts.Size, Overlap: opts.Overlap, Length: length}, nil
+	}
+	return nil, fmt.Errorf("%w: unknown chunker %q", ErrInvalidChunkOptions, opts.Strategy)
+}
+
+// LengthFunc 计算文本长度
+type LengthFunc func(string) int
+
+// EstimateTokens 粗略估算 token 数：CJK 字符每个约 1 个 token，其余字符约 4 个 1 个 token
+func EstimateTokens(text string) int {
+	cjk, other := 0, 0
+	for _, r := range text {
+		if isCJK(r) {
+			cjk++
+		} else {
+			other++
+		}
+	}
+	return cjk + (other+3)/4
+}
+
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
+
+// ================== RecursiveChunker ==================
+
+// recursiveSeparators 从粗到细的切分点，切分后分隔符保留在前一段末尾
+var recursiveSeparators = []string{"\n\n", "\n", "。", "！", "？", "；", ". ", "! ", "? ", "; ", "，", ", ", " "}
+
+// RecursiveChunker 递归字符 / token 分块
+//
+// 文本超过 Size 时依次尝试段落、行、句子、短语、空格切分，仍过长则按字符硬切；
+// 切出的小段再贪心合并成不超过 Size 的块，相邻块保留不超过 Overlap 的末尾小段作为重叠。
+type RecursiveChunker struct {
+	Size    int
+	Overlap int
+	Length  LengthFunc
+}
+
+func (c *RecursiveChunker) Split(content string) []string {
+	return mergeSplits(c.atoms(content, recursiveSeparators), c.Size, c.Overlap, c.Length)
+}
+
+// atoms 将文本切成每段都不超过 Size 的小段，拼接后与原文一致
+func (c *RecursiveChunker) atoms(text string, separators []string) []string {
+	if c.Length(text) <= c.Size {
+		return []string{text}
+	}
+
+	for i, sep := range separators {
+		if !strings.Contains(text, sep) {
+			continue
+		}
+		var atoms []string
+		for _, part := range splitKeep(text, sep) {
+			atoms = append(atoms, c.atoms(part, separators[i+1:])...)
+		}
+		return atoms
+	}
+	return hardSplit(text, c.Size, c.Length)
+}
+
+// splitKeep 按 sep 切分，分隔符保留在前一段末尾
+func splitKeep(text, sep string) []string {
+	parts := strings.SplitAfter(text, sep)
+	if parts[len(parts)-1] == "" {
+		parts = parts[:len(parts)-1]
+	}
+	return parts
+}
+
+// hardSplit 按字符切成不超过 size 的小段
+func hardSplit(text string, size int, length LengthFunc) []string {
+	var (
+		parts []string
+		start int
+	)
+	for i, r := range text {
+		if i > start && length(text[start:i+utf8.RuneLen(r)]) > size {
+			parts = append(parts, text[start:i])
+			start = i
+		}
+	}
+	return append(parts, text[start:])
+}
+
+// mergeSplits 将小段贪心合并成不超过 size 的块，新块以上一块末尾不超过 overlap 的小段开头
+func mergeSplits(splits []string, size, overlap int, length LengthFunc) []string {
+	var (
+		chunks []string
+		window []string
+		total  int
+	)
+	for _, split := range splits {
+		n := length(split)
+		if total+n > size && len(window) > 0 {
+			chunks = appendChunk(chunks, strings.Join(window, ""))
+			for len(window) > 0 && (total > overlap || total+n > size) {
+				total -= length(window[0])
+				window = window[1:]
+			}
+		}
+		window = append(window, split)
+		total += n
+	}
+	if len(window) > 0 {
+		chunks = appendChunk(chunks, strings.Join(window, ""))
+	}
+	return chunks
+}
+
+func appendChunk(chunks []string, chunk string) []string {
+	if chunk = strings.TrimSpace(chunk); chunk != "" {
+		chunks = append(chunks, chunk)
+	}
+	return chunks
+}
+
+// ================== SentenceChunker ==================
+
+// SentenceChunker 按句子分块：中文按 。！？；，英文按 . ! ? 后跟空白切分句子，
+// 再将句子合并成不超过 Size 的块，重叠以整句为单位。超长句子按 RecursiveChunker 规则切分。
+type SentenceChunker struct {
+	Size    int
+	Overlap int
+	Length  LengthFunc
+}
+
+func (c *SentenceChunker) Split(content string) []string {
+	fallback := &RecursiveChunker{Size: c.Size, Length: c.Length}
+
+	var atoms []string
+	for _, sentence := range SplitSentences(content) {
+		atoms = append(atoms, fallback.atoms(sentence, recursiveSeparators[2:])...)
+	}
+	return mergeSplits(atoms, c.Size, c.Overlap, c.Length)
+}
+
+// SplitSentences 切分中英文句子，句末标点、右引号与其后的空白保留在句子末尾
+func SplitSentences(text string) []string {
+	runes := []rune(text)
+
+	var (
+		sentences []string
+		start     int
+	)
+	for i := 0; i < len(runes); i++ {
+		if !isSentenceEnd(runes, i) {
+			continue
+		}
+
+		end := i + 1
+		for end < len(runes) && strings.ContainsRune("”’」』\"')）", runes[end]) {
+			end++
+		}
+		for end < len(runes) && unicode.IsSpace(runes[end]) {
+			end++
+		}
+		sentences = append(sentences, string(runes[start:end]))
+		start = end
+		i = end - 1
+	}
+	if start < len(runes) {
+		sentences = append(sentences, string(runes[start:]))
+	}
+	return sentences
+}
+
+func isSentenceEnd(runes []rune, i int) bool {
+	switch runes[i] {
+	case '。', '！', '？', '；', '\n':
+		return true
+	case '.', '!', '?':
+		// 英文标点后需跟空白或位于末尾，避免切开 3.14、e.g 等
+		return i+1 == len(runes) || unicode.IsSpace(runes[i+1])
+	}
+	return false
+}
+
+// ================== MarkdownChunker ==================
+
+// MarkdownChunker 按 Markdown 标题切分章节（代码块内的 # 不视为标题）
+// 每个章节正文由 Body 分块，块前附标题路径（如 "安装 > Linux"），便于检索时保留上下文；
+// 只有标题没有正文的章节不单独成块。
+type MarkdownChunker struct {
+	Body *RecursiveChunker
+}
+
+func (c *MarkdownChunker) Split(content string) []string {
+	var (
+		chunks  []string
+		titles  []string // titles[i] 为 i+1 级标题
+		body    strings.Builder
+		inFence bool
+	)
+
+	flush := func() {
+		text := body.String()
+		body.Reset()
+		if strings.TrimSpace(text) == "" {
+			return
+		}
+
+		var path []string
+		for _, title := range titles {
+			if title != "" {
+				path = append(path, title)
+			}
+		}
+		if len(path) == 0 {
+			chunks = append(chunks, c.Body.Split(text)...)
+			return
+		}
+
+		prefix := strings.Join(path, " > ") + "\n\n"
+		body := *c.Body
+		body.Size = max(body.Size-body.Length(prefix), 1)
+		body.Overlap = min(body.Overlap, body.Size-1)
+		for _, chunk := range body.Split(text) {
+			chunks = append(chunks, prefix+chunk)
+		}
+	}
+
+	for _, line := range strings.SplitAfter(content, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			inFence = !inFence
+		}
+
+		level, title := 0, ""
+		if !inFence {
+			level, title = parseMarkdownHeading(trimmed)
+		}
+		if level == 0 {
+			body.WriteString(line)
+			continue
+		}
+
+		flush()
+		for len(titles) < level {
+			titles = append(titles, "")
+		}
+		titles = append(titles[:level-1], title)
+	}
+	flush()
+
+	return chunks
+}
+
+// parseMarkdownHeading 解析 ATX 标题（# 标题），不是标题时返回 0
+func parseMarkdownHeading(line string) (int, string) {
+	level := 0
+	for level < len(line) && line[level] == '#' {
+		level++
+	}
+	if level == 0 || level > 6 || (level < len(line) && line[level] != ' ' && line[level] != '\t') {
+		return 0, ""
+	}
+	title := strings.TrimSpace(strings.TrimRight(strings.TrimSpace(line[level:]), "#"))
+	if title == "" {
+		return 0, ""
+	}
+	return level, title
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestRecursiveChunkerKeepsShortParagraphs(t *testing.T) {
+	chunker, err := NewChunker(ChunkOptions{})
+	if err != nil {
+		t.Fatalf("NewChunker failed: %v", err)
+	}
+
+	content := "# 标题\n\n很短\n\n这是一个很长的段落，包含足够的文字，应该被保留。\n\n太短了"
+	chunks := chunker.Split(content)
+	if len(chunks) != 1 {
+		t.Fatalf("Expected short document to fit in one chunk, got %d", len(chunks))
+	}
+	for _, want := range []string{"# 标题", "很短", "太短了"} {
+		if !strings.Contains(chunks[0], want) {
+			t.Errorf("Expected chunk to keep %q, got %q", want, chunks[0])
+		}
+	}
+}
+
+func TestRecursiveChunkerSplitsLongParagraphWithOverlap(t *testing.T) {
+	chunker, _ := NewChunker(ChunkOptions{Size: 40, Overlap: 15})
+
+	// 一个没有空行的长段落：按句子切分并保留重叠
+	paragraph := strings.Repeat("Goroutine 是轻量级线程。", 10)
+	chunks := chunker.Split(paragraph)
+	if len(chunks) < 3 {
+		t.Fatalf("Expected long paragraph to be split, got %d chunks", len(chunks))
+	}
+	for i, chunk := range chunks {
+		if n := utf8.RuneCountInString(chunk); n > 40 {
+			t.Errorf("Chunk %d has %d runes, exceeds size 40", i, n)
+		}
+		if i > 0 && !strings.HasPrefix(chunk, "Goroutine") {
+			t.Errorf("Expected chunk %d to start at a sentence boundary, got %q", i, chunk)
+		}
+	}
+	if !strings.HasSuffix(chunks[0], chunks[1][:strings.Index(chunks[1], "。")+len("。")]) {
+		t.Errorf("Expected chunk 1 to overlap with the end of chunk 0:\n%q\n%q", chunks[0], chunks[1])
+	}
+}
+
+func TestRecursiveChunkerHardSplitsUnbrokenText(t *testing.T) {
+	chunker, _ := NewChunker(ChunkOptions{Size: 10})
+
+	chunks := chunker.Split(strings.Repeat("并", 25))
+	if len(chunks) != 3 || utf8.RuneCountInString(chunks[2]) != 5 {
+		t.Errorf("Expected 10/10/5 runes, got %v", chunks)
+	}
+}
+
+func TestTokenUnit(t *testing.T) {
+	if n := EstimateTokens("并发编程"); n != 4 {
+		t.Errorf("Expected 4 tokens for 4 CJK runes, got %d", n)
+	}
+	if n := EstimateTokens("concurrency"); n != 3 {
+		t.Errorf("Expected 3 tokens for 11 latin chars, got %d", n)
+	}
+
+	chunker, _ := NewChunker(ChunkOptions{Unit: ChunkUnitToken, Size: 20})
+	for i, chunk := range chunker.Split(strings.Repeat("Go channels are typed conduits. ", 20)) {
+		if n := EstimateTokens(chunk); n > 20 {
+			t.Errorf("Chunk %d has %d tokens, exceeds size 20", i, n)
+		}
+	}
+}
+
+func TestSplitSentences(t *testing.T) {
+	got := SplitSentences("Go 很快。Rust 很安全！真的吗？“是的。”Version 1.21 is out. Try it!")
+	want := []string{"Go 很快。", "Rust 很安全！", "真的吗？", "“是的。”", "Version 1.21 is out. ", "Try it!"}
+	if len(got) != len(want) {
+		t.Fatalf("Expected %d sentences, got %d: %q", len(want), len(got), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Sentence %d: expected %q, got %q", i, want[i], got[i])
+		}
+	}
+}
+
+func TestSentenceChunker(t *testing.T) {
+	chunker, _ := NewChunker(ChunkOptions{Strategy: ChunkerSentence, Size: 12, Overlap: 6})
+
+	chunks := chunker.Split("第一句话。第二句话。第三句话。")
+	want := []string{"第一句话。第二句话。", "第二句话。第三句话。"}
+	if len(chunks) != len(want) || chunks[0] != want[0] || chunks[1] != want[1] {
+		t.Errorf("Expected %q, got %q", want, chunks)
+	}
+}
+
+func TestMarkdownChunker(t *testing.T) {
+	chunker, _ := NewChunker(ChunkOptions{Strategy: ChunkerMarkdown})
+
+	content := `前言
+
+# 安装
+
+## Linux
+
+使用包管理器安装。
+
+` + "```bash\n# 不是标题\napt install go\n```" + `
+
+## macOS
+
+使用 Homebrew 安装。
+
+# 使用
+
+运行 go run。
+`
+	chunks := chunker.Split(content)
+	want := []string{
+		"前言",
+		"安装 > Linux\n\n使用包管理器安装。\n\n```bash\n# 不是标题\napt install go\n```",
+		"安装 > macOS\n\n使用 Homebrew 安装。",
+		"使用\n\n运行 go run。",
+	}
+	if len(chunks) != len(want) {
+		t.Fatalf("Expected %d chunks, got %d: %q", len(want), len(chunks), chunks)
+	}
+	for i := range want {
+		if chunks[i] != want[i] {
+			t.Errorf("Chunk %d: expected %q, got %q", i, want[i], chunks[i])
+		}
+	}
+}
+
+func TestNewChunkerRejectsInvalidOptions(t *testing.T) {
+	for _, opts := range []ChunkOptions{
+		{Strategy: "semantic"},
+		{Unit: "byte"},
+		{Size: 100, Overlap: 100},
+		{Size: -1},
+	} {
+		if _, err := NewChunker(opts); !errors.Is(err, ErrInvalidChunkOptions) {
+			t.Errorf("%+v: expected ErrInvalidChunkOptions, got %v", opts, err)
+		}
+	}
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// citationPattern 答案中的引用标记：[1]、[1, 2]、[1，2]
+var citationPattern = regexp.MustCompile(`\[(\d+(?:\s*[,，]\s*\d+)*)\]`)
+
+// AnswerSegment 答案中的一句话及其引用
+// Start / End 为该句在答案中的字符（rune）偏移，左闭右开，Text 含引用标记
+type AnswerSegment struct {
+	Text      string  `json:"text"`
+	Start     int     `json:"start"`
+	End       int     `json:"end"`
+	Citations []int   `json:"citations,omitempty"` // 引用编号（sources 中从 1 开始的序号）
+	ChunkIDs  []int64 `json:"chunk_ids,omitempty"` // 有效引用对应的分块 ID
+	// InvalidCitations 超出 sources 范围的引用编号
+	InvalidCitations []int `json:"invalid_citations,omitempty"`
+	// Supported 引用核验结果：开启 verify_citations 且有有效引用时由 LLM 判断该句是否被所引分块支持
+	Supported     *bool  `json:"supported,omitempty"`
+	SupportReason string `json:"support_reason,omitempty"`
+}
+
+// CitationReport 答案引用情况汇总（metadata.citations）
+type CitationReport struct {
+	Segments    int    `json:"segments"`
+	Cited       int    `json:"cited"`             // 带有效引用的句子数
+	Invalid     []int  `json:"invalid,omitempty"` // 出现过的无效引用编号
+	Verified    bool   `json:"verified"`          // 是否完成了 LLM 核验
+	Unsupported int    `json:"unsupported"`       // 核验未通过的句子数
+	VerifyError string `json:"verify_error,omitempty"`
+}
+
+// citationInstruction 生成提示词中要求逐句标注引用的说明
+const citationInstruction = "在引用了文档内容的句子末尾用 [n] 标注来源文档编号（如 [1] 或 [1][2]），只能引用上面列出的编号"
+
+// groundAnswer 把答案切分为句子并解析引用，verify 为 true 时再由 LLM 核验每个带引用的句子
+// 核验失败只记录在 report.VerifyError，不影响返回的引用
+func groundAnswer(ctx context.Context, llm LLMService, answer string, sources []*DocumentChunk, verify bool) ([]AnswerSegment, *CitationReport) {
+	segments := parseCitations(answer, sources)
+
+	report := &CitationReport{Segments: len(segments)}
+	invalid := make(map[int]bool)
+	for _, segment := range segments {
+		if len(segment.ChunkIDs) > 0 {
+			report.Cited++
+		}
+		for _, n := range segment.InvalidCitations {
+			if !invalid[n] {
+				invalid[n] = true
+				report.Invalid = append(report.Invalid, n)
+			}
+		}
+	}
+
+	if verify && report.Cited > 0 {
+		if err := verifyCitations(ctx, llm, segments, sources); err != nil {
+			log.Printf("Verify citations failed: %v", err)
+			report.VerifyError = err.Error()
+		} else {
+			report.Verified = true
+			for _, segment := range segments {
+				if segment.Supported != nil && !*segment.Supported {
+					report.Unsupported++
+				}
+			}
+		}
+	}
+
+	return segments, report
+}
+
+// parseCitations 按句切分答案，解析每句的 [n] 引用并映射到 sources 中的分块
+func parseCitations(answer string, sources []*DocumentChunk) []AnswerSegment {
+	runes := []rune(answer)
+	segments := make([]AnswerSegment, 0)
+	for _, span := range splitSentences(runes) {
+		segment := AnswerSegment{
+			Text:  string(runes[span[0]:span[1]]),
+			Start: span[0],
+			End:   span[1],
+		}
+
+		seen := make(map[int]bool)
+		for _, match := range citationPattern.FindAllStringSubmatch(segment.Text, -1) {
+			for _, field := range strings.FieldsFunc(match[1], func(r rune) bool { return r == ',' || r == '，' || unicode.IsSpace(r) }) {
+				n, err := strconv.Atoi(field)
+				if err != nil || seen[n] {
+					continue
+				}
+				seen[n] = true
+				segment.Citations = append(segment.Citations, n)
+				if n >= 1 && n <= len(sources) {
+					segment.ChunkIDs = append(segment.ChunkIDs, sources[n-1].ID)
+				} else {
+					segment.InvalidCitations = append(segment.InvalidCitations, n)
+				}
+			}
+		}
+		segments = append(segments, segment)
+	}
+	return segments
+}
+
+// splitSentences 按句末标点切分（规则同 SentenceChunker），返回去除首尾空白后的 rune 区间
+// 句末标点之后紧跟的引用标记归入前一句（如 "……。[1]"、"Go is fast.[1] Rust…"）
+func splitSentences(runes []rune) [][2]int {
+	var spans [][2]int
+	appendSpan := func(start, end int) {
+		for start < end && unicode.IsSpace(runes[start]) {
+			start++
+		}
+		for end > start && unicode.IsSpace(runes[end-1]) {
+			end--
+		}
+		if start < end {
+			spans = append(spans, [2]int{start, end})
+		}
+	}
+
+	start := 0
+	for i := 0; i < len(runes); i++ {
+		if !isCitedSentenceEnd(runes, i) {
+			continue
+		}
+
+		// 连续的句末标点（如 "？！"）与紧随的引用标记
+		end := i + 1
+		for end < len(runes) && runes[end] != '\n' && isCitedSentenceEnd(runes, end) {
+			end++
+		}
+		for n := citationLen(runes, end); n > 0; n = citationLen(runes, end) {
+			end += n
+		}
+
+		appendSpan(start, end)
+		start = end
+		i = end - 1
+	}
+	appendSpan(start, len(runes))
+	return spans
+}
+
+// isCitedSentenceEnd 在 isSentenceEnd 的基础上，把紧跟引用标记的英文句末标点（如 "fast.[1]"）也视为句末
+func isCitedSentenceEnd(runes []rune, i int) bool {
+	if isSentenceEnd(runes, i) {
+		return true
+	}
+	switch runes[i] {
+	case '.', '!', '?':
+		return citationLen(runes, i+1) > 0
+	}
+	return false
+}
+
+// citationLen 从 runes[i] 开始的引用标记的 rune 数，不是引用标记时返回 0
+func citationLen(runes []rune, i int) int {
+	if i >= len(runes) || runes[i] != '[' {
+		return 0
+	}
+	rest := string(runes[i:])
+	loc := citationPattern.FindStringIndex(rest)
+	if loc == nil || loc[0] != 0 {
+		return 0
+	}
+	return utf8.RuneCountInString(rest[:loc[1]])
+}
+
+// citationVerdict LLM 对单句引用的核验结果
+type citationVerdict struct {
+	Segment   int    `json:"segment"`
+	Supported bool   `json:"supported"`
+	Reason    string `json:"reason"`
+}
+
+// verifyCitations 一次 LLM 调用核验所有带有效引用的句子，结果写入 segments
+func verifyCitations(ctx context.Context, llm LLMService, segments []AnswerSegment, sources []*DocumentChunk) error {
+	var claims []int
+	for i := range segments {
+		if len(segments[i].ChunkIDs) > 0 {
+			claims = append(claims, i)
+		}
+	}
+
+	response, err := llm.Generate(ctx, buildCitationCheckPrompt(segments, claims, sources))
+	if err != nil {
+		return err
+	}
+
+	var result struct {
+		Results []citationVerdict `json:"results"`
+	}
+	if err := json.Unmarshal([]byte(extractJSON(response)), &result); err != nil {
+		return fmt.Errorf("parse verdicts: %w", err)
+	}
+
+	for _, verdict := range result.Results {
+		if verdict.Segment < 1 || verdict.Segment > len(claims) {
+			continue
+		}
+		segment := &segments[claims[verdict.Segment-1]]
+		supported := verdict.Supported
+		segment.Supported = &supported
+		segment.SupportReason = verdict.Reason
+	}
+	return nil
+}
+
+// buildCitationCheckPrompt 构建引用核验提示词：列出每个陈述及其引用的文档
+func buildCitationCheckPrompt(segments []AnswerSegment, claims []int, sources []*DocumentChunk) string {
+	var sb strings.Builder
+
+	sb.WriteString("你是一个事实核查专家，需要判断每个陈述是否被其引用的文档支持。\n\n")
+	sb.WriteString("文档：\n")
+	cited := make(map[int]bool)
+	for _, i := range claims {
+		for _, n := range segments[i].Citations {
+			if n >= 1 && n <= len(sources) && !cited[n] {
+				cited[n] = true
+				sb.WriteString(fmt.Sprintf("[%d] %s\n", n, sources[n-1].Content))
+			}
+		}
+	}
+
+	sb.WriteString("\n陈述：\n")
+	for i, segment := range claims {
+		text := strings.TrimSpace(citationPattern.ReplaceAllString(segments[segment].Text, ""))
+		refs := make([]string, 0, len(segments[segment].Citations))
+		for _, n := range segments[segment].Citations {
+			if n >= 1 && n <= len(sources) {
+				refs = append(refs, fmt.Sprintf("[%d]", n))
+			}
+		}
+		sb.WriteString(fmt.Sprintf("%d. %s（引用 %s）\n", i+1, text, strings.Join(refs, "")))
+	}
+
+	sb.WriteString(`
+请输出 JSON：
+
+{
+  "results": [
+    {"segment": 1, "supported": true, "reason": "简要说明"}
+  ]
+}
+
+规则：
+1. segment 为陈述编号，每个陈述输出一项
+2. supported: 陈述的内容能从其引用的文档中直接得出时设为 true，否则为 false
+
+只返回 JSON，不要有其他文字。`)
+
+	return sb.String()
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestParseCitations(t *testing.T) {
+	sources := []*DocumentChunk{{ID: 10}, {ID: 20}, {ID: 30}}
+	answer := "Go 由 Google 开发[1]。Goroutine 很轻量！[2][3]\nRust 强调内存安全 [1, 5]. 这句没有引用"
+
+	segments := parseCitations(answer, sources)
+	if len(segments) != 4 {
+		t.Fatalf("Expected 4 segments, got %+v", segments)
+	}
+
+	runes := []rune(answer)
+	for _, segment := range segments {
+		if string(runes[segment.Start:segment.End]) != segment.Text {
+			t.Errorf("Offsets [%d, %d) do not match text %q", segment.Start, segment.End, segment.Text)
+		}
+	}
+
+	if segments[0].Text != "Go 由 Google 开发[1]。" || segments[0].Start != 0 || len(segments[0].ChunkIDs) != 1 || segments[0].ChunkIDs[0] != 10 {
+		t.Errorf("Unexpected first segment: %+v", segments[0])
+	}
+	// 句末标点之后的引用归入前一句
+	if segments[1].Text != "Goroutine 很轻量！[2][3]" || len(segments[1].ChunkIDs) != 2 || segments[1].ChunkIDs[1] != 30 {
+		t.Errorf("Expected trailing markers to belong to the sentence, got %+v", segments[1])
+	}
+	if len(segments[2].Citations) != 2 || len(segments[2].ChunkIDs) != 1 || len(segments[2].InvalidCitations) != 1 || segments[2].InvalidCitations[0] != 5 {
+		t.Errorf("Expected [5] to be flagged invalid, got %+v", segments[2])
+	}
+	if segments[3].Text != "这句没有引用" || segments[3].Citations != nil {
+		t.Errorf("Unexpected uncited segment: %+v", segments[3])
+	}
+
+	_, report := groundAnswer(context.Background(), nil, answer, sources, false)
+	if report.Segments != 4 || report.Cited != 3 || len(report.Invalid) != 1 || report.Verified {
+		t.Errorf("Unexpected citation report: %+v", report)
+	}
+}
+
+func TestParseCitationsEnglish(t *testing.T) {
+	sources := []*DocumentChunk{{ID: 10}, {ID: 20}}
+	answer := "Go is fast.[1] Rust is safe.[2] Version 1.21 added min and max."
+
+	segments := parseCitations(answer, sources)
+	if len(segments) != 3 {
+		t.Fatalf("Expected 3 segments, got %+v", segments)
+	}
+	if segments[0].Text != "Go is fast.[1]" || len(segments[0].ChunkIDs) != 1 || segments[0].ChunkIDs[0] != 10 {
+		t.Errorf("Unexpected first segment: %+v", segments[0])
+	}
+	if segments[1].Text != "Rust is safe.[2]" || len(segments[1].ChunkIDs) != 1 || segments[1].ChunkIDs[0] != 20 {
+		t.Errorf("Unexpected second segment: %+v", segments[1])
+	}
+	// 数字中的 "." 不切分
+	if segments[2].Text != "Version 1.21 added min and max." || segments[2].Citations != nil {
+		t.Errorf("Unexpected uncited segment: %+v", segments[2])
+	}
+}
+
+func TestRAGService_VerifyCitations(t *testing.T) {
+	llm := &scriptedLLM{responses: []string{
+		"Channel 用于 Goroutine 通信[3]。Go 由微软开发[1]。",
+		"```json\n{\"results\": [{\"segment\": 1, \"supported\": true}, {\"segment\": 2, \"supported\": false, \"reason\": \"文档称 Go 由 Google 开发\"}]}\n```",
+	}}
+	service := NewRAGService(&MockChunkRepositoryImpl{}, nil, &MockEmbeddingService{}, llm, nil)
+
+	resp, err := service.Query(context.Background(), RAGQueryRequest{Question: "什么是 Channel？", VerifyCitations: true})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+
+	if !strings.Contains(llm.prompts[0], "[3]\nChannel") || !strings.Contains(llm.prompts[0], citationInstruction) {
+		t.Errorf("Expected numbered sources and citation instruction in prompt:\n%s", llm.prompts[0])
+	}
+	if !strings.Contains(llm.prompts[1], "2. Go 由微软开发。（引用 [1]）") {
+		t.Errorf("Expected claims to be listed in verification prompt:\n%s", llm.prompts[1])
+	}
+
+	segments := resp.Segments
+	if len(segments) != 2 || segments[0].ChunkIDs[0] != 3 || segments[0].Supported == nil || !*segments[0].Supported {
+		t.Fatalf("Unexpected segments: %+v", segments)
+	}
+	if segments[1].Supported == nil || *segments[1].Supported || segments[1].SupportReason == "" {
+		t.Errorf("Expected second segment to be unsupported, got %+v", segments[1])
+	}
+	report := resp.Metadata["citations"].(*CitationReport)
+	if !report.Verified || report.Cited != 2 || report.Unsupported != 1 {
+		t.Errorf("Unexpected citation report: %+v", report)
+	}
+
+	// 核验失败不影响答案与引用
+	llm.responses = []string{"Channel 用于通信[2]。", "不是 JSON"}
+	resp, err = service.Query(context.Background(), RAGQueryRequest{Question: "什么是 Channel？", VerifyCitations: true})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	report = resp.Metadata["citations"].(*CitationReport)
+	if report.Verified || report.VerifyError == "" || resp.Segments[0].ChunkIDs[0] != 2 || resp.Segments[0].Supported != nil {
+		t.Errorf("Expected verification failure to be reported only, got %+v %+v", report, resp.Segments)
+	}
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// 消息角色
+const (
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+)
+
+const (
+	defaultHistoryBudget = 2000 // 历史（摘要 + 未摘要的消息）的 token 预算，超出时把较早的消息并入摘要
+	recentMessages       = 4    // 摘要时保留原文的最近消息数（2 轮问答）
+	historySnippetRune   = 300  // 改写提示词中每条助手回答截取的长度
+	sessionTitleRune     = 50   // 以首个问题作为会话标题时截取的长度
+)
+
+// QueryFunc 执行一次 RAG 查询（RAGService 或 AgenticRAGService）
+type QueryFunc func(ctx context.Context, req RAGQueryRequest) (*RAGQueryResponse, error)
+
+// ConversationService 多轮对话：按会话历史把追问改写为独立问题，历史过长时压缩为摘要，并记录每轮问答
+type ConversationService struct {
+	sessions      SessionRepository
+	llm           LLMService
+	historyBudget int
+}
+
+func NewConversationService(sessions SessionRepository, llm LLMService) *ConversationService {
+	return &ConversationService{
+		sessions:      sessions,
+		llm:           llm,
+		historyBudget: defaultHistoryBudget,
+	}
+}
+
+// Create 创建会话
+func (s *ConversationService) Create(req CreateSessionRequest) (*Session, error) {
+	session := &Session{Title: strings.TrimSpace(req.Title)}
+	if err := s.sessions.CreateSession(session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// List 会话列表（不含消息）
+func (s *ConversationService) List() ([]*Session, error) {
+	return s.sessions.ListSessions()
+}
+
+// Get 会话详情，附带全部消息
+func (s *ConversationService) Get(id int64) (*Session, error) {
+	session, err := s.sessions.GetSession(id)
+	if err != nil {
+		return nil, err
+	}
+	if session.Messages, err = s.sessions.FindMessages(id, 0); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// Delete 删除会话及其消息
+func (s *ConversationService) Delete(id int64) error {
+	return s.sessions.DeleteSession(id)
+}
+
+// Query 在会话中查询：历史超出预算时先压缩为摘要，再结合历史把追问改写为独立问题交给 run 检索与生成，最后记录本轮问答
+// 摘要或改写失败时沿用原历史与原问题继续查询，错误记录在 metadata
+func (s *ConversationService) Query(ctx context.Context, req RAGQueryRequest, run QueryFunc) (*RAGQueryResponse, error) {
+	session, err := s.sessions.GetSession(*req.SessionID)
+	if err != nil {
+		return nil, err
+	}
+	history, err := s.sessions.FindMessages(session.ID, session.SummarizedUntil)
+	if err != nil {
+		return nil, fmt.Errorf("load history failed: %w", err)
+	}
+
+	// 1. 历史超出 token 预算时，把较早的消息并入摘要
+	summarized := false
+	var summaryErr error
+	if historyTokens(session.Summary, history) > s.historyBudget && len(history) > recentMessages {
+		if history, summaryErr = s.summarize(ctx, session, history); summaryErr != nil {
+			log.Printf("Summarize session %d failed, keeping full history: %v", session.ID, summaryErr)
+		} else {
+			summarized = true
+		}
+	}
+
+	// 2. 追问改写为独立问题
+	question := req.Question
+	standalone, rewriteErr := s.rewrite(ctx, session.Summary, history, question)
+	if rewriteErr != nil {
+		log.Printf("Rewrite question failed, using original question: %v", rewriteErr)
+		standalone = question
+	}
+
+	// 3. 检索与生成
+	req.Question = standalone
+	resp, err := run(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	// 4. 记录本轮问答
+	user := &SessionMessage{Role: RoleUser, Content: question}
+	if standalone != question {
+		user.Rewritten = standalone
+	}
+	assistant := &SessionMessage{Role: RoleAssistant, Content: resp.Answer}
+	if err := s.sessions.AppendMessages(session.ID, sessionTitle(question), user, assistant); err != nil {
+		return nil, fmt.Errorf("save messages failed: %w", err)
+	}
+
+	resp.Metadata["session_id"] = session.ID
+	resp.Metadata["standalone_question"] = standalone
+	resp.Metadata["history_summarized"] = summarized
+	if summaryErr != nil {
+		resp.Metadata["summary_error"] = summaryErr.Error()
+	}
+	if rewriteErr != nil {
+		resp.Metadata["rewrite_error"] = rewriteErr.Error()
+	}
+	return resp, nil
+}
+
+// summarize 把最近 recentMessages 条之前的消息与已有摘要合并为新摘要并保存，返回剩余的历史
+func (s *ConversationService) summarize(ctx context.Context, session *Session, history []*SessionMessage) ([]*SessionMessage, error) {
+	split := len(history) - recentMessages
+	folded := history[:split]
+
+	summary, err := s.llm.Generate(ctx, buildSummaryPrompt(session.Summary, folded))
+	if err != nil {
+		return history, err
+	}
+	summary = strings.TrimSpace(summary)
+	until := folded[len(folded)-1].ID
+	if err := s.sessions.UpdateSummary(session.ID, summary, until); err != nil {
+		return history, err
+	}
+
+	session.Summary = summary
+	session.SummarizedUntil = until
+	return history[split:], nil
+}
+
+// rewrite 结合摘要与历史把追问改写为独立问题；没有历史时原样返回
+func (s *ConversationService) rewrite(ctx context.Context, summary string, history []*SessionMessage, question string) (string, error) {
+	if summary == "" && len(history) == 0 {
+		return question, nil
+	}
+
+	response, err := s.llm.Generate(ctx, buildRewritePrompt(summary, history, question))
+	if err != nil {
+		return "", err
+	}
+	standalone := strings.TrimSpace(response)
+	if standalone == "" {
+		return "", fmt.Errorf("empty rewritten question")
+	}
+	return standalone, nil
+}
+
+// historyTokens 摘要与消息的估算 token 数
+func historyTokens(summary string, history []*SessionMessage) int {
+	tokens := EstimateTokens(summary)
+	for _, message := range history {
+		tokens += EstimateTokens(message.Content)
+	}
+	return tokens
+}
+
+// sessionTitle 以问题作为会话标题（会话已有标题时不覆盖）
+func sessionTitle(question string) string {
+	runes := []rune(strings.TrimSpace(question))
+	if len(runes) > sessionTitleRune {
+		return string(runes[:sessionTitleRune]) + "..."
+	}
+	return string(runes)
+}
+
+// writeHistory 写入对话记录：用户消息优先使用改写后的独立问题，助手回答截取前 snippet 个字符（0 表示不截取）
+func writeHistory(sb *strings.Builder, history []*SessionMessage, snippet int) {
+	for _, message := range history {
+		switch message.Role {
+		case RoleUser:
+			content := message.Content
+			if message.Rewritten != "" {
+				content = message.Rewritten
+			}
+			sb.WriteString(fmt.Sprintf("用户：%s\n", content))
+		default:
+			content := []rune(message.Content)
+			if snippet > 0 && len(content) > snippet {
+				content = append(content[:snippet], []rune("...")...)
+			}
+			sb.WriteString(fmt.Sprintf("助手：%s\n", string(content)))
+		}
+	}
+}
+
+// buildRewritePrompt 构建追问改写提示词
+func buildRewritePrompt(summary string, history []*SessionMessage, question string) string {
+	var sb strings.Builder
+
+	sb.WriteString("你是一个对话助手，需要结合对话历史把用户的追问改写为不依赖上下文的独立问题，用于文档检索。\n\n")
+	if summary != "" {
+		sb.WriteString(fmt.Sprintf("对话摘要：%s\n\n", summary))
+	}
+	if len(history) > 0 {
+		sb.WriteString("最近的对话：\n")
+		writeHistory(&sb, history, historySnippetRune)
+		sb.WriteString("\n")
+	}
+	sb.WriteString(fmt.Sprintf("追问：%s\n", question))
+
+	sb.WriteString(`
+规则：
+1. 补全追问中的指代（它、这个、上面提到的等）与省略的主语
+2. 追问本身已经完整时原样返回
+3. 只返回改写后的问题，不要有其他文字`)
+
+	return sb.String()
+}
+
+// buildSummaryPrompt 构建对话摘要提示词
+func buildSummaryPrompt(summary string, history []*SessionMessage) string {
+	var sb strings.Builder
+
+	sb.WriteString("你是一个对话摘要助手，需要把对话压缩为简洁的摘要，保留讨论的主题、关键实体与结论，供理解后续追问使用。\n\n")
+	if summary != "" {
+		sb.WriteString(fmt.Sprintf("已有摘要：%s\n\n", summary))
+	}
+	sb.WriteString("新增对话：\n")
+	writeHistory(&sb, history, 0)
+
+	sb.WriteString("\n只返回合并后的摘要，不要有其他文字。")
+
+	return sb.String()
+}
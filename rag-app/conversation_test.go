@@ -0,0 +1,380 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// memorySessionRepository 内存实现的 SessionRepository
+type memorySessionRepository struct {
+	mu        sync.Mutex
+	sessions  map[int64]*Session
+	messages  []*SessionMessage
+	nextID    int64
+	summaries int // UpdateSummary 调用次数
+}
+
+func newMemorySessionRepository() *memorySessionRepository {
+	return &memorySessionRepository{sessions: make(map[int64]*Session)}
+}
+
+func (r *memorySessionRepository) CreateSession(session *Session) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.nextID++
+	session.ID = r.nextID
+	session.CreatedAt = time.Now()
+	session.UpdatedAt = session.CreatedAt
+	copied := *session
+	r.sessions[session.ID] = &copied
+	return nil
+}
+
+func (r *memorySessionRepository) GetSession(id int64) (*Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	session, ok := r.sessions[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	copied := *session
+	for _, message := range r.messages {
+		if message.SessionID == id {
+			copied.MessageCount++
+		}
+	}
+	return &copied, nil
+}
+
+func (r *memorySessionRepository) ListSessions() ([]*Session, error) {
+	r.mu.Lock()
+	ids := make([]int64, 0, len(r.sessions))
+	for id := range r.sessions {
+		ids = append(ids, id)
+	}
+	r.mu.Unlock()
+
+	sort.Slice(ids, func(i, j int) bool { return ids[i] > ids[j] })
+	sessions := make([]*Session, 0, len(ids))
+	for _, id := range ids {
+		session, _ := r.GetSession(id)
+		sessions = append(sessions, session)
+	}
+	return sessions, nil
+}
+
+func (r *memorySessionRepository) DeleteSession(id int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.sessions[id]; !ok {
+		return sql.ErrNoRows
+	}
+	delete(r.sessions, id)
+	kept := r.messages[:0]
+	for _, message := range r.messages {
+		if message.SessionID != id {
+			kept = append(kept, message)
+		}
+	}
+	r.messages = kept
+	return nil
+}
+
+func (r *memorySessionRepository) FindMessages(sessionID, afterID int64) ([]*SessionMessage, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	messages := make([]*SessionMessage, 0)
+	for _, message := range r.messages {
+		if message.SessionID == sessionID && message.ID > afterID {
+			copied := *message
+			messages = append(messages, &copied)
+		}
+	}
+	return messages, nil
+}
+
+func (r *memorySessionRepository) AppendMessages(sessionID int64, title string, messages ...*SessionMessage) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	session, ok := r.sessions[sessionID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	for _, message := range messages {
+		r.nextID++
+		message.ID = r.nextID
+		message.SessionID = sessionID
+		copied := *message
+		r.messages = append(r.messages, &copied)
+	}
+	if session.Title == "" {
+		session.Title = title
+	}
+	session.UpdatedAt = time.Now()
+	return nil
+}
+
+func (r *memorySessionRepository) UpdateSummary(id int64, summary string, until int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.summaries++
+	r.sessions[id].Summary = summary
+	r.sessions[id].SummarizedUntil = until
+	return nil
+}
+
+// recordingQuery 记录实际执行的问题，返回固定答案
+type recordingQuery struct {
+	questions []string
+}
+
+func (q *recordingQuery) run(ctx context.Context, req RAGQueryRequest) (*RAGQueryResponse, error) {
+	q.questions = append(q.questions, req.Question)
+	return &RAGQueryResponse{
+		Answer:   "关于「" + req.Question + "」的回答",
+		Sources:  []*DocumentChunk{},
+		Metadata: map[string]interface{}{},
+	}, nil
+}
+
+func TestConversationRewritesFollowUps(t *testing.T) {
+	repo := newMemorySessionRepository()
+	llm := &scriptedLLM{responses: []string{"Go 的 Channel 有缓冲吗？"}}
+	conversations := NewConversationService(repo, llm)
+	session, _ := conversations.Create(CreateSessionRequest{})
+	query := &recordingQuery{}
+
+	// 首个问题没有历史，无需改写
+	resp, err := conversations.Query(context.Background(), RAGQueryRequest{Question: "Go 的 Channel 是什么？", SessionID: &session.ID}, query.run)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(llm.prompts) != 0 || resp.Metadata["session_id"] != session.ID {
+		t.Errorf("Expected no rewrite for first question, got prompts %v, metadata %+v", llm.prompts, resp.Metadata)
+	}
+
+	// 追问结合历史改写后再检索
+	resp, err = conversations.Query(context.Background(), RAGQueryRequest{Question: "它有缓冲吗？", SessionID: &session.ID}, query.run)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if query.questions[1] != "Go 的 Channel 有缓冲吗？" || resp.Metadata["standalone_question"] != "Go 的 Channel 有缓冲吗？" {
+		t.Errorf("Expected follow-up to be rewritten, got %v", query.questions)
+	}
+	if !strings.Contains(llm.prompts[0], "用户：Go 的 Channel 是什么？") || !strings.Contains(llm.prompts[0], "追问：它有缓冲吗？") {
+		t.Errorf("Expected history in rewrite prompt:\n%s", llm.prompts[0])
+	}
+
+	got, err := conversations.Get(session.ID)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if got.Title != "Go 的 Channel 是什么？" || len(got.Messages) != 4 {
+		t.Fatalf("Expected titled session with 4 messages, got %+v", got)
+	}
+	if got.Messages[2].Content != "它有缓冲吗？" || got.Messages[2].Rewritten != "Go 的 Channel 有缓冲吗？" || got.Messages[3].Role != RoleAssistant {
+		t.Errorf("Unexpected recorded messages: %+v %+v", got.Messages[2], got.Messages[3])
+	}
+
+	// 改写失败时沿用原问题
+	resp, err = conversations.Query(context.Background(), RAGQueryRequest{Question: "那 select 呢？", SessionID: &session.ID}, query.run)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if query.questions[2] != "那 select 呢？" || resp.Metadata["rewrite_error"] == nil {
+		t.Errorf("Expected fallback to original question, got %v, metadata %+v", query.questions, resp.Metadata)
+	}
+
+	missing := int64(999)
+	if _, err := conversations.Query(context.Background(), RAGQueryRequest{Question: "x", SessionID: &missing}, query.run); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected sql.ErrNoRows for missing session, got %v", err)
+	}
+}
+
+func TestConversationSummarizesLongHistory(t *testing.T) {
+	repo := newMemorySessionRepository()
+	llm := &scriptedLLM{responses: []string{"讨论了 Go 的 Goroutine 与 Channel。", "Go 的 select 如何使用？"}}
+	conversations := NewConversationService(repo, llm)
+	conversations.historyBudget = 20
+	session, _ := conversations.Create(CreateSessionRequest{Title: "Go 并发"})
+
+	turns := []string{"Goroutine 是什么？", "Goroutine 是轻量级线程。", "Channel 是什么？", "Channel 用于通信。", "有缓冲吗？", "可以有缓冲。"}
+	for i := 0; i < len(turns); i += 2 {
+		repo.AppendMessages(session.ID, "", &SessionMessage{Role: RoleUser, Content: turns[i]}, &SessionMessage{Role: RoleAssistant, Content: turns[i+1]})
+	}
+
+	resp, err := conversations.Query(context.Background(), RAGQueryRequest{Question: "select 呢？", SessionID: &session.ID}, (&recordingQuery{}).run)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if resp.Metadata["history_summarized"] != true {
+		t.Errorf("Expected history to be summarized, got %+v", resp.Metadata)
+	}
+
+	// 最早的一轮并入摘要，改写提示词只保留摘要与最近 4 条消息
+	if !strings.Contains(llm.prompts[0], "用户：Goroutine 是什么？") || strings.Contains(llm.prompts[0], "Channel 是什么") {
+		t.Errorf("Expected only the oldest turn to be summarized:\n%s", llm.prompts[0])
+	}
+	rewrite := llm.prompts[1]
+	if !strings.Contains(rewrite, "对话摘要：讨论了 Go 的 Goroutine 与 Channel。") || strings.Contains(rewrite, "Goroutine 是什么") || !strings.Contains(rewrite, "用户：Channel 是什么？") {
+		t.Errorf("Unexpected rewrite prompt:\n%s", rewrite)
+	}
+
+	got, _ := repo.GetSession(session.ID)
+	if got.Title != "Go 并发" || got.SummarizedUntil != 3 || got.MessageCount != 8 {
+		t.Errorf("Unexpected session after summary: %+v", got)
+	}
+
+	// 摘要后的历史回到预算内，不再重复摘要
+	conversations.historyBudget = 1000
+	llm.responses = []string{"Go 的 select 有默认分支吗？"}
+	if _, err := conversations.Query(context.Background(), RAGQueryRequest{Question: "有默认分支吗？", SessionID: &session.ID}, (&recordingQuery{}).run); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if repo.summaries != 1 {
+		t.Errorf("Expected a single summary, got %d", repo.summaries)
+	}
+}
+
+// MockLLMService（main.go 默认使用）对改写、摘要、充分性判断与引用核验提示词返回可用的结果
+func TestMockLLMServiceHandlesPipelinePrompts(t *testing.T) {
+	conversations := NewConversationService(newMemorySessionRepository(), &MockLLMService{})
+	conversations.historyBudget = 1
+	session, _ := conversations.Create(CreateSessionRequest{})
+	query := &recordingQuery{}
+	for _, question := range []string{"什么是 Channel？", "有缓冲吗？", "怎么关闭？", "关闭后还能读吗？"} {
+		resp, err := conversations.Query(context.Background(), RAGQueryRequest{Question: question, SessionID: &session.ID}, query.run)
+		if err != nil {
+			t.Fatalf("Query failed: %v", err)
+		}
+		if resp.Metadata["standalone_question"] != question || resp.Metadata["rewrite_error"] != nil || resp.Metadata["summary_error"] != nil {
+			t.Errorf("Expected follow-up to be echoed without errors, got %+v", resp.Metadata)
+		}
+	}
+	if stored, _ := conversations.Get(session.ID); !strings.Contains(stored.Summary, "什么是 Channel？") {
+		t.Errorf("Expected summary listing earlier questions, got %q", stored.Summary)
+	}
+
+	ragService := NewRAGService(&MockChunkRepositoryImpl{}, nil, &MockEmbeddingService{}, &MockLLMService{}, nil)
+	resp, err := NewAgenticRAGService(ragService, nil).Query(context.Background(), RAGQueryRequest{Question: "什么是 Channel？", Iterative: true, VerifyCitations: true})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if trace := resp.Metadata["trace"].(*MultiHopTrace); trace.StopReason != StopSufficient {
+		t.Errorf("Expected sufficiency judgement to parse, got stop reason %s", trace.StopReason)
+	}
+	if report := resp.Metadata["citations"].(*CitationReport); !report.Verified || report.Unsupported != 0 {
+		t.Errorf("Expected citation check to parse, got %+v", report)
+	}
+}
+
+func TestSessionHandlers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	conversations := NewConversationService(newMemorySessionRepository(), &MockLLMService{})
+	ragService := NewRAGService(&MockChunkRepositoryImpl{}, nil, &MockEmbeddingService{}, &MockLLMService{}, nil)
+
+	r := gin.New()
+	r.POST("/sessions", CreateSessionHandler(conversations))
+	r.GET("/sessions", ListSessionsHandler(conversations))
+	r.GET("/sessions/:id", GetSessionHandler(conversations))
+	r.DELETE("/sessions/:id", DeleteSessionHandler(conversations))
+	r.POST("/rag/query", RAGQueryHandler(ragService, NewAgenticRAGService(ragService, nil), conversations))
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w
+	}
+
+	w := do(http.MethodPost, "/sessions", "")
+	var session Session
+	if w.Code != http.StatusCreated || json.Unmarshal(w.Body.Bytes(), &session) != nil || session.ID == 0 {
+		t.Fatalf("Expected 201 with session, got %d: %s", w.Code, w.Body.String())
+	}
+
+	if w := do(http.MethodPost, "/rag/query", `{"question": "什么是 Channel？", "use_agentic": false, "session_id": 1}`); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"session_id":1`) {
+		t.Errorf("Expected session query to succeed, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do(http.MethodPost, "/rag/query", `{"question": "什么是 Channel？", "session_id": 42}`); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for unknown session, got %d", w.Code)
+	}
+
+	w = do(http.MethodGet, "/sessions", "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"total":1`) || !strings.Contains(w.Body.String(), `"message_count":2`) {
+		t.Errorf("Unexpected session list: %d %s", w.Code, w.Body.String())
+	}
+
+	w = do(http.MethodGet, "/sessions/1", "")
+	if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &session) != nil || len(session.Messages) != 2 || session.Title != "什么是 Channel？" {
+		t.Errorf("Unexpected session detail: %d %s", w.Code, w.Body.String())
+	}
+
+	if w := do(http.MethodDelete, "/sessions/1", ""); w.Code != http.StatusOK {
+		t.Errorf("Expected 200 on delete, got %d", w.Code)
+	}
+	if w := do(http.MethodGet, "/sessions/1", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 after delete, got %d", w.Code)
+	}
+	if w := do(http.MethodDelete, "/sessions/abc", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for invalid id, got %d", w.Code)
+	}
+}
+
+func TestSessionRepositoryLifecycle(t *testing.T) {
+	db := setupRAGTestDB(t)
+	if db == nil {
+		return
+	}
+	defer db.Close()
+
+	repo := NewSessionRepository(db)
+	session := &Session{}
+	if err := repo.CreateSession(session); err != nil {
+		t.Fatalf("CreateSession failed: %v", err)
+	}
+
+	user := &SessionMessage{Role: RoleUser, Content: "它有缓冲吗？", Rewritten: "Channel 有缓冲吗？"}
+	assistant := &SessionMessage{Role: RoleAssistant, Content: "可以有缓冲。"}
+	if err := repo.AppendMessages(session.ID, "它有缓冲吗？", user, assistant); err != nil {
+		t.Fatalf("AppendMessages failed: %v", err)
+	}
+	if err := repo.AppendMessages(session.ID, "第二个问题", &SessionMessage{Role: RoleUser, Content: "第二个问题"}); err != nil {
+		t.Fatalf("AppendMessages failed: %v", err)
+	}
+	if err := repo.UpdateSummary(session.ID, "讨论了 Channel。", assistant.ID); err != nil {
+		t.Fatalf("UpdateSummary failed: %v", err)
+	}
+
+	got, err := repo.GetSession(session.ID)
+	if err != nil || got.Title != "它有缓冲吗？" || got.MessageCount != 3 || got.SummarizedUntil != assistant.ID {
+		t.Fatalf("Unexpected session %+v, err %v", got, err)
+	}
+	messages, err := repo.FindMessages(session.ID, got.SummarizedUntil)
+	if err != nil || len(messages) != 1 || messages[0].Content != "第二个问题" {
+		t.Errorf("Expected only unsummarized messages, got %+v, err %v", messages, err)
+	}
+	if all, _ := repo.FindMessages(session.ID, 0); len(all) != 3 || all[0].Rewritten != "Channel 有缓冲吗？" {
+		t.Errorf("Unexpected messages: %+v", all)
+	}
+	if sessions, err := repo.ListSessions(); err != nil || len(sessions) != 1 {
+		t.Errorf("Unexpected session list %+v, err %v", sessions, err)
+	}
+
+	if err := repo.DeleteSession(session.ID); err != nil {
+		t.Fatalf("DeleteSession failed: %v", err)
+	}
+	if err := repo.DeleteSession(session.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected sql.ErrNoRows, got %v", err)
+	}
+}
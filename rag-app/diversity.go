@@ -0,0 +1,124 @@
+package main
+
+import "math"
+
+// defaultDedupThreshold 语义去重的默认余弦相似度阈值：不低于该值的分块视为近似重复
+const defaultDedupThreshold = 0.95
+
+// defaultMMRLambda MMR 的默认权衡系数：1 为纯相关性，0 为纯多样性
+const defaultMMRLambda = 0.7
+
+// cosineSimilarity 计算两个向量的余弦相似度，任一向量为空、维度不同或为零向量时 ok 为 false
+func cosineSimilarity(a, b []float32) (sim float64, ok bool) {
+	if len(a) == 0 || len(a) != len(b) {
+		return 0, false
+	}
+
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0, false
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB)), true
+}
+
+// dedupChunks 去重：先按分块 ID，再按向量的余弦相似度去除近似重复（相似度 >= threshold）
+// 保留先出现（排名更靠前）的分块；缺少向量的分块只按 ID 去重
+func dedupChunks(chunks []*DocumentChunk, threshold float64) []*DocumentChunk {
+	seen := make(map[int64]bool)
+	unique := make([]*DocumentChunk, 0, len(chunks))
+
+	for _, chunk := range chunks {
+		if seen[chunk.ID] {
+			continue
+		}
+		seen[chunk.ID] = true
+
+		duplicate := false
+		for _, kept := range unique {
+			if sim, ok := cosineSimilarity(chunk.Embedding, kept.Embedding); ok && sim >= threshold {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			unique = append(unique, chunk)
+		}
+	}
+
+	return unique
+}
+
+// mmrSelect 用 Maximal Marginal Relevance 从候选中选出 topK 个分块：
+// score = lambda × 相关性 − (1 − lambda) × 与已选分块的最大相似度
+// 相关性优先取 RerankScore，否则取与查询向量的余弦相似度，都缺失时按候选顺序递减；
+// 相关性归一化到 [0, 1] 后再与相似度比较
+func mmrSelect(queryVector []float32, chunks []*DocumentChunk, topK int, lambda float64) []*DocumentChunk {
+	if topK <= 0 || len(chunks) == 0 {
+		return []*DocumentChunk{}
+	}
+
+	relevance := mmrRelevance(queryVector, chunks)
+	selected := make([]*DocumentChunk, 0, min(topK, len(chunks)))
+	picked := make([]bool, len(chunks))
+
+	for len(selected) < topK && len(selected) < len(chunks) {
+		best := -1
+		bestScore := math.Inf(-1)
+		for i, chunk := range chunks {
+			if picked[i] {
+				continue
+			}
+
+			redundancy := 0.0
+			for _, s := range selected {
+				if sim, ok := cosineSimilarity(chunk.Embedding, s.Embedding); ok && sim > redundancy {
+					redundancy = sim
+				}
+			}
+
+			score := lambda*relevance[i] - (1-lambda)*redundancy
+			if score > bestScore {
+				best = i
+				bestScore = score
+			}
+		}
+		picked[best] = true
+		selected = append(selected, chunks[best])
+	}
+
+	return selected
+}
+
+// mmrRelevance 计算候选的相关性并做 min-max 归一化（全部相同时均为 1）
+func mmrRelevance(queryVector []float32, chunks []*DocumentChunk) []float64 {
+	relevance := make([]float64, len(chunks))
+	for i, chunk := range chunks {
+		switch sim, ok := cosineSimilarity(queryVector, chunk.Embedding); {
+		case chunk.RerankScore != nil:
+			relevance[i] = *chunk.RerankScore
+		case ok:
+			relevance[i] = sim
+		default:
+			relevance[i] = 1 - float64(i)/float64(len(chunks))
+		}
+	}
+
+	lo, hi := relevance[0], relevance[0]
+	for _, r := range relevance {
+		lo = math.Min(lo, r)
+		hi = math.Max(hi, r)
+	}
+	for i := range relevance {
+		if hi > lo {
+			relevance[i] = (relevance[i] - lo) / (hi - lo)
+		} else {
+			relevance[i] = 1
+		}
+	}
+	return relevance
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+// vectorEmbedder 对任意文本返回固定向量
+type vectorEmbedder struct {
+	MockEmbeddingService
+	vector []float32
+}
+
+func (e *vectorEmbedder) Embed(ctx context.Context, text string) ([]float32, error) {
+	return e.vector, nil
+}
+
+// embeddedRepository 每轮检索都返回带向量的分块：1 与 2 近似重复，3 与问题相关，4 与问题无关但内容独立
+type embeddedRepository struct {
+	MockChunkRepositoryImpl
+}
+
+func (r *embeddedRepository) VectorSearch(ctx context.Context, queryVector []float32, docType, language string, limit int) ([]*DocumentChunk, error) {
+	return []*DocumentChunk{
+		{ID: 1, Content: "Goroutine 由 Go 运行时调度。", Embedding: []float32{1, 0, 0}},
+		{ID: 2, Content: "Goroutine 由 Go 的运行时调度。", Embedding: []float32{0.999, 0.04, 0}},
+		{ID: 3, Content: "Go 调度器采用 GMP 模型。", Embedding: []float32{0.8, 0.6, 0}},
+		{ID: 4, Content: "Rust 通过所有权保证内存安全。", Embedding: []float32{0, 0, 1}},
+	}, nil
+}
+
+func (r *embeddedRepository) HybridSearch(ctx context.Context, queryVector []float32, keyword, docType, language string, limit int) ([]*DocumentChunk, error) {
+	return r.VectorSearch(ctx, queryVector, docType, language, limit)
+}
+
+func chunkIDs(chunks []*DocumentChunk) []int64 {
+	ids := make([]int64, len(chunks))
+	for i, chunk := range chunks {
+		ids[i] = chunk.ID
+	}
+	return ids
+}
+
+func TestDedupChunks(t *testing.T) {
+	chunks, _ := (&embeddedRepository{}).VectorSearch(context.Background(), nil, "", "", 4)
+	chunks = append(chunks, &DocumentChunk{ID: 3}, &DocumentChunk{ID: 5}, &DocumentChunk{ID: 6})
+
+	// 1 与 2 的相似度约 0.999；缺少向量的 5、6 只按 ID 去重
+	if got := chunkIDs(dedupChunks(chunks, 0.95)); len(got) != 5 || got[1] != 3 {
+		t.Errorf("Expected near-duplicate 2 and repeated 3 to be removed, got %v", got)
+	}
+	if got := chunkIDs(dedupChunks(chunks, 1)); len(got) != 6 {
+		t.Errorf("Expected threshold 1 to keep near-duplicates, got %v", got)
+	}
+}
+
+func TestMMRSelect(t *testing.T) {
+	chunks, _ := (&embeddedRepository{}).VectorSearch(context.Background(), nil, "", "", 4)
+	chunks = dedupChunks(chunks, defaultDedupThreshold)
+	query := []float32{1, 0, 0}
+
+	tests := []struct {
+		lambda float64
+		want   []int64
+	}{
+		{1, []int64{1, 3}},   // 纯相关性
+		{0.3, []int64{1, 4}}, // 注重多样性：3 与 1 相似度 0.8，让位于无关但独立的 4
+	}
+	for _, tt := range tests {
+		got := chunkIDs(mmrSelect(query, chunks, 2, tt.lambda))
+		if len(got) != 2 || got[0] != tt.want[0] || got[1] != tt.want[1] {
+			t.Errorf("lambda=%v: expected %v, got %v", tt.lambda, tt.want, got)
+		}
+	}
+
+	// Rerank 分数优先于向量相关性；缺少向量时保持候选顺序
+	for i, score := range []float64{0.1, 0.2, 0.9} {
+		score := score
+		chunks[i].RerankScore = &score
+	}
+	if got := chunkIDs(mmrSelect(query, chunks, 1, 1)); got[0] != 4 {
+		t.Errorf("Expected rerank score to drive relevance, got %v", got)
+	}
+	plain := []*DocumentChunk{{ID: 7}, {ID: 8}, {ID: 9}}
+	if got := chunkIDs(mmrSelect(nil, plain, 5, defaultMMRLambda)); len(got) != 3 || got[0] != 7 || got[2] != 9 {
+		t.Errorf("Expected candidate order without vectors, got %v", got)
+	}
+}
+
+func TestAgenticRAG_SemanticDedupAndMMR(t *testing.T) {
+	embedder := &vectorEmbedder{vector: []float32{1, 0, 0}}
+	ragService := NewRAGService(&embeddedRepository{}, nil, embedder, &MockLLMService{}, nil)
+	agenticService := NewAgenticRAGService(ragService, nil)
+
+	topK := 2
+	lambda := 0.3
+	resp, err := agenticService.Query(context.Background(), RAGQueryRequest{
+		Question:  "Go 和 Rust 在并发编程上有什么区别？",
+		TopK:      &topK,
+		MMRLambda: &lambda,
+	})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+
+	if got := chunkIDs(resp.Sources); len(got) != 2 || got[0] != 1 || got[1] != 4 {
+		t.Errorf("Expected MMR to select [1 4], got %v", got)
+	}
+	// 3 轮共召回 12 个分块：9 个重复 ID，1 个近似重复
+	if resp.Metadata["total_retrieved"] != 3 || resp.Metadata["deduplicated"] != 9 || resp.Metadata["mmr_lambda"] != 0.3 {
+		t.Errorf("Unexpected dedup metadata: %+v", resp.Metadata)
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+)
+
+// DocumentService 文档生命周期：分块、向量化、重建索引
+type DocumentService struct {
+	docs     DocumentRepository
+	embedder EmbeddingService
+}
+
+func NewDocumentService(docs DocumentRepository, embedder EmbeddingService) *DocumentService {
+	return &DocumentService{
+		docs:     docs,
+		embedder: embedder,
+	}
+}
+
+// Reindex 用新的分块参数（未指定的沿用当前参数）和当前的嵌入服务重建文档的分块
+// 全部分块向量化成功后才替换旧分块，失败时旧索引保持不变
+func (s *DocumentService) Reindex(ctx context.Context, id int64, req ReindexRequest) (*Document, error) {
+	doc, err := s.docs.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := doc.ChunkOptions()
+	override := req.ChunkOptions()
+	if override.Strategy != "" {
+		opts.Strategy = override.Strategy
+	}
+	if override.Unit != "" {
+		opts.Unit = override.Unit
+	}
+	if override.Size != 0 {
+		opts.Size = override.Size
+		opts.Overlap = override.Overlap
+	} else if override.Overlap != 0 {
+		opts.Overlap = override.Overlap
+	}
+
+	chunks, err := s.buildChunks(ctx, doc, opts.WithDefaults())
+	if err != nil {
+		return nil, err
+	}
+	if err := s.docs.ReplaceChunks(doc, chunks); err != nil {
+		return nil, fmt.Errorf("replace chunks failed: %w", err)
+	}
+	return doc, nil
+}
+
+// buildChunks 分块并向量化，同时把分块参数与嵌入模型记录到 doc
+func (s *DocumentService) buildChunks(ctx context.Context, doc *Document, opts ChunkOptions) ([]*DocumentChunk, error) {
+	contents, err := splitDocument(doc, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	embeddings, err := embedTexts(ctx, s.embedder, contents)
+	if err != nil {
+		return nil, fmt.Errorf("embedding chunks failed: %w", err)
+	}
+
+	chunks := make([]*DocumentChunk, 0, len(contents))
+	for i, content := range contents {
+		chunks = append(chunks, newChunk(doc, i, content, embeddings[i]))
+	}
+
+	doc.EmbeddingModel = embeddingModelName(s.embedder)
+	return chunks, nil
+}
+
+// splitDocument 按分块参数切分文档原文，并把参数记录到 doc
+func splitDocument(doc *Document, opts ChunkOptions) ([]string, error) {
+	chunker, err := NewChunker(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	doc.Chunker = opts.Strategy
+	doc.ChunkUnit = opts.Unit
+	doc.ChunkSize = opts.Size
+	doc.ChunkOverlap = opts.Overlap
+	return chunker.Split(doc.Content), nil
+}
+
+// newChunk 构建文档的第 index 个分块，metadata 记录文档标题
+func newChunk(doc *Document, index int, content string, embedding []float32) *DocumentChunk {
+	metadata, _ := json.Marshal(map[string]string{"title": doc.Title})
+	docID := doc.ID
+	return &DocumentChunk{
+		DocID:     &docID,
+		ChunkID:   &index,
+		Content:   content,
+		Embedding: embedding,
+		DocType:   doc.DocType,
+		Language:  doc.Language,
+		Metadata:  string(metadata),
+	}
+}
+
+// attachDocumentTitles 为检索结果填充所属文档的标题，查询失败只记录日志
+func attachDocumentTitles(docs DocumentRepository, chunks []*DocumentChunk) {
+	if docs == nil {
+		return
+	}
+
+	seen := make(map[int64]bool)
+	ids := make([]int64, 0)
+	for _, chunk := range chunks {
+		if chunk.DocID != nil && !seen[*chunk.DocID] {
+			seen[*chunk.DocID] = true
+			ids = append(ids, *chunk.DocID)
+		}
+	}
+	if len(ids) == 0 {
+		return
+	}
+
+	titles, err := docs.FindTitles(ids)
+	if err != nil {
+		log.Printf("Find document titles failed: %v", err)
+		return
+	}
+	for _, chunk := range chunks {
+		if chunk.DocID != nil {
+			chunk.DocTitle = titles[*chunk.DocID]
+		}
+	}
+}
+
+// embeddingModelName 嵌入模型名称：实现了 EmbeddingModel() 时取其返回值，否则取实现类型
+func embeddingModelName(embedder EmbeddingService) string {
+	if named, ok := embedder.(interface{ EmbeddingModel() string }); ok {
+		return named.EmbeddingModel()
+	}
+	return fmt.Sprintf("%T", embedder)
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// memoryDocumentRepository 内存文档仓库（用于测试）
+type memoryDocumentRepository struct {
+	docs   map[int64]*Document
+	chunks map[int64][]*DocumentChunk
+	nextID int64
+}
+
+func newMemoryDocumentRepository() *memoryDocumentRepository {
+	return &memoryDocumentRepository{
+		docs:   make(map[int64]*Document),
+		chunks: make(map[int64][]*DocumentChunk),
+	}
+}
+
+func (r *memoryDocumentRepository) CreateWithChunks(doc *Document, chunks []*DocumentChunk) error {
+	r.nextID++
+	doc.ID = r.nextID
+	r.docs[doc.ID] = doc
+	return r.ReplaceChunks(doc, chunks)
+}
+
+func (r *memoryDocumentRepository) Get(id int64) (*Document, error) {
+	doc, ok := r.docs[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	copied := *doc
+	return &copied, nil
+}
+
+func (r *memoryDocumentRepository) List(docType, keyword string) ([]*Document, error) {
+	docs := make([]*Document, 0)
+	for _, doc := range r.docs {
+		if (docType == "" || doc.DocType == docType) && strings.Contains(doc.Title, keyword) {
+			docs = append(docs, doc)
+		}
+	}
+	return docs, nil
+}
+
+func (r *memoryDocumentRepository) Delete(id int64) error {
+	if _, ok := r.docs[id]; !ok {
+		return sql.ErrNoRows
+	}
+	delete(r.docs, id)
+	delete(r.chunks, id)
+	return nil
+}
+
+func (r *memoryDocumentRepository) ReplaceChunks(doc *Document, chunks []*DocumentChunk) error {
+	for _, chunk := range chunks {
+		chunk.DocID = &doc.ID
+	}
+	doc.ChunkCount = len(chunks)
+	r.chunks[doc.ID] = chunks
+	copied := *doc
+	r.docs[doc.ID] = &copied
+	return nil
+}
+
+func (r *memoryDocumentRepository) UpdateChunkCount(id int64) error {
+	if doc, ok := r.docs[id]; ok {
+		doc.ChunkCount = len(r.chunks[id])
+	}
+	return nil
+}
+
+// Create 同时充当分块仓库，供导入任务写入分块
+func (r *memoryDocumentRepository) Create(chunk *DocumentChunk) error {
+	r.chunks[*chunk.DocID] = append(r.chunks[*chunk.DocID], chunk)
+	return nil
+}
+
+func (r *memoryDocumentRepository) VectorSearch(ctx context.Context, queryVector []float32, docType, language string, limit int) ([]*DocumentChunk, error) {
+	return nil, nil
+}
+
+func (r *memoryDocumentRepository) HybridSearch(ctx context.Context, queryVector []float32, keyword, docType, language string, limit int) ([]*DocumentChunk, error) {
+	return nil, nil
+}
+
+func (r *memoryDocumentRepository) FindTitles(ids []int64) (map[int64]string, error) {
+	titles := make(map[int64]string)
+	for _, id := range ids {
+		if doc, ok := r.docs[id]; ok {
+			titles[id] = doc.Title
+		}
+	}
+	return titles, nil
+}
+
+// failingEmbedder 第 n 次调用起返回错误
+type failingEmbedder struct {
+	MockEmbeddingService
+	calls  int
+	failAt int
+}
+
+func (e *failingEmbedder) Embed(ctx context.Context, text string) ([]float32, error) {
+	e.calls++
+	if e.calls >= e.failAt {
+		return nil, errors.New("embedding api unavailable")
+	}
+	return e.MockEmbeddingService.Embed(ctx, text)
+}
+
+const lifecycleContent = "# 并发\n\nGoroutine 是轻量级线程。\n\n# 通信\n\nChannel 用于 Goroutine 之间通信。"
+
+// ingestDocument 通过导入任务创建文档并同步处理
+func ingestDocument(t *testing.T, docs *memoryDocumentRepository, embedder EmbeddingService, req CreateDocRequest) *Document {
+	t.Helper()
+	ingestion := NewIngestionService(docs, newMemoryJobRepository(docs), embedder)
+	doc, job, err := ingestion.Submit(req)
+	if err != nil {
+		t.Fatalf("Submit failed: %v", err)
+	}
+	if err := ingestion.Process(context.Background(), job.ID); err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+	stored, _ := docs.Get(doc.ID)
+	return stored
+}
+
+func TestDocumentServiceReindex(t *testing.T) {
+	docs := newMemoryDocumentRepository()
+	service := NewDocumentService(docs, &MockEmbeddingService{})
+
+	doc := ingestDocument(t, docs, &MockEmbeddingService{}, CreateDocRequest{Title: `Go "并发"`, Content: lifecycleContent, DocType: "article"})
+	if doc.Chunker != ChunkerRecursive || doc.ChunkSize != defaultChunkSize || doc.EmbeddingModel != "mock-768" || doc.ChunkCount != 1 {
+		t.Errorf("Expected resolved defaults to be recorded, got %+v", doc)
+	}
+	chunks := docs.chunks[doc.ID]
+	if len(chunks) != 1 || *chunks[0].DocID != doc.ID || chunks[0].Metadata != `{"title":"Go \"并发\""}` {
+		t.Fatalf("Unexpected chunks: %+v", chunks)
+	}
+
+	doc, err := service.Reindex(context.Background(), doc.ID, ReindexRequest{ChunkParams{Chunker: ChunkerMarkdown}})
+	if err != nil {
+		t.Fatalf("Reindex failed: %v", err)
+	}
+	if doc.Chunker != ChunkerMarkdown || doc.ChunkSize != defaultChunkSize || doc.ChunkCount != 2 {
+		t.Errorf("Expected markdown reindex keeping chunk size, got %+v", doc)
+	}
+	if got := docs.chunks[doc.ID][1].Content; !strings.HasPrefix(got, "通信\n\n") {
+		t.Errorf("Expected heading path prefix, got %q", got)
+	}
+}
+
+func TestDocumentServiceReindexKeepsIndexOnEmbeddingFailure(t *testing.T) {
+	docs := newMemoryDocumentRepository()
+	embedder := &failingEmbedder{failAt: 2}
+	service := NewDocumentService(docs, embedder)
+
+	doc := ingestDocument(t, docs, embedder, CreateDocRequest{Title: "Go", Content: lifecycleContent})
+
+	if _, err := service.Reindex(context.Background(), doc.ID, ReindexRequest{ChunkParams{Chunker: ChunkerMarkdown}}); err == nil {
+		t.Fatal("Expected reindex to fail")
+	}
+	if stored, _ := docs.Get(doc.ID); stored.Chunker != ChunkerRecursive || len(docs.chunks[doc.ID]) != 1 {
+		t.Errorf("Expected old index to be kept, got %+v with %d chunks", stored, len(docs.chunks[doc.ID]))
+	}
+
+	if _, err := service.Reindex(context.Background(), 99, ReindexRequest{}); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected sql.ErrNoRows for missing document, got %v", err)
+	}
+}
+
+func TestRAGQuerySourcesCarryDocumentTitle(t *testing.T) {
+	docs := newMemoryDocumentRepository()
+	docs.docs[7] = &Document{ID: 7, Title: "Go 并发编程"}
+	repo := &MockChunkRepositoryImpl{docID: 7}
+
+	service := NewRAGService(repo, docs, &MockEmbeddingService{}, &MockLLMService{}, nil)
+	resp, err := service.Query(context.Background(), RAGQueryRequest{Question: "什么是 Channel？"})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	for _, source := range resp.Sources {
+		if source.DocID == nil || *source.DocID != 7 || source.DocTitle != "Go 并发编程" {
+			t.Errorf("Expected source to carry document 7 title, got %+v", source)
+		}
+	}
+}
+
+func TestDocumentHandlers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	docs := newMemoryDocumentRepository()
+	service := NewDocumentService(docs, &MockEmbeddingService{})
+	ingestion := NewIngestionService(docs, newMemoryJobRepository(docs), &MockEmbeddingService{})
+
+	r := gin.New()
+	r.POST("/documents", CreateDocumentHandler(ingestion))
+	r.GET("/documents/:id", GetDocumentHandler(docs))
+	r.DELETE("/documents/:id", DeleteDocumentHandler(docs))
+	r.POST("/documents/:id/reindex", ReindexDocumentHandler(service))
+
+	for _, tc := range []struct {
+		method, url, body string
+		code              int
+	}{
+		{http.MethodPost, "/documents", `{"title": "Go", "content": "Goroutine 是轻量级线程。"}`, http.StatusAccepted},
+		{http.MethodPost, "/documents", `{"title": "Go", "content": "x", "chunker": "semantic"}`, http.StatusBadRequest},
+		{http.MethodGet, "/documents/1", "", http.StatusOK},
+		{http.MethodGet, "/documents/abc", "", http.StatusBadRequest},
+		{http.MethodPost, "/documents/1/reindex", "", http.StatusOK},
+		{http.MethodPost, "/documents/1/reindex", `{"chunk_size": 10, "chunk_overlap": 20}`, http.StatusBadRequest},
+		{http.MethodDelete, "/documents/1", "", http.StatusOK},
+		{http.MethodDelete, "/documents/1", "", http.StatusNotFound},
+		{http.MethodPost, "/documents/1/reindex", "", http.StatusNotFound},
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(tc.method, tc.url, strings.NewReader(tc.body)))
+		if w.Code != tc.code {
+			t.Errorf("%s %s: expected %d, got %d: %s", tc.method, tc.url, tc.code, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestDocumentRepositoryLifecycle(t *testing.T) {
+	db := setupRAGTestDB(t)
+	if db == nil {
+		return
+	}
+	defer db.Close()
+
+	docs := NewDocumentRepository(db)
+	service := NewDocumentService(docs, &MockEmbeddingService{})
+	ingestion := NewIngestionService(docs, NewJobRepository(db), &MockEmbeddingService{})
+
+	doc, job, err := ingestion.Submit(CreateDocRequest{Title: "Go 并发", Content: lifecycleContent, DocType: "article"})
+	if err != nil {
+		t.Fatalf("Submit failed: %v", err)
+	}
+	if err := ingestion.Process(context.Background(), job.ID); err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+	if _, err := service.Reindex(context.Background(), doc.ID, ReindexRequest{ChunkParams{Chunker: ChunkerMarkdown}}); err != nil {
+		t.Fatalf("Reindex failed: %v", err)
+	}
+
+	list, err := docs.List("article", "并发")
+	if err != nil || len(list) != 1 || list[0].ChunkCount != 2 || list[0].Content != "" {
+		t.Errorf("Unexpected list: %+v, err %v", list, err)
+	}
+	if titles, err := docs.FindTitles([]int64{doc.ID}); err != nil || titles[doc.ID] != "Go 并发" {
+		t.Errorf("Unexpected titles %v, err %v", titles, err)
+	}
+
+	if err := docs.Delete(doc.ID); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	var remaining int
+	db.Get(&remaining, "SELECT COUNT(*) FROM document_chunks WHERE doc_id = $1", doc.ID)
+	if remaining != 0 {
+		t.Errorf("Expected chunks to be deleted, %d remaining", remaining)
+	}
+	if err := docs.Delete(doc.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected sql.ErrNoRows deleting twice, got %v", err)
+	}
+}
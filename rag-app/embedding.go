@@ -0,0 +1,311 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// BatchEmbedError 批量向量化中部分文本失败
+// Errs 与输入文本一一对应，成功的为 nil
+type BatchEmbedError struct {
+	Errs []error
+}
+
+func (e *BatchEmbedError) Error() string {
+	failed := 0
+	var first error
+	for _, err := range e.Errs {
+		if err != nil {
+			failed++
+			if first == nil {
+				first = err
+			}
+		}
+	}
+	return fmt.Sprintf("%d of %d texts failed: %v", failed, len(e.Errs), first)
+}
+
+// ItemErrors 与输入文本一一对应的错误
+func (e *BatchEmbedError) ItemErrors() []error {
+	return e.Errs
+}
+
+// itemErrors 按文本给出错误的批量错误，如 *BatchEmbedError 与 llm.BatchEmbedError
+type itemErrors interface {
+	ItemErrors() []error
+}
+
+// batchItemErr 第 i 个文本的错误；err 不是按文本区分的批量错误时所有文本共享该错误
+func batchItemErr(err error, i int) error {
+	var batchErr itemErrors
+	if errors.As(err, &batchErr) {
+		return batchErr.ItemErrors()[i]
+	}
+	return err
+}
+
+// embedTexts 批量向量化：实现了 BatchEmbeddingService 时走批量接口，否则逐个调用 Embed
+func embedTexts(ctx context.Context, embedder EmbeddingService, texts []string) ([][]float32, error) {
+	if batch, ok := embedder.(BatchEmbeddingService); ok {
+		return batch.EmbedBatch(ctx, texts)
+	}
+
+	vectors := make([][]float32, len(texts))
+	errs := make([]error, len(texts))
+	failed := false
+	for i, text := range texts {
+		if err := ctx.Err(); err != nil {
+			errs[i], failed = err, true
+			continue
+		}
+		if vectors[i], errs[i] = embedder.Embed(ctx, text); errs[i] != nil {
+			failed = true
+		}
+	}
+	if failed {
+		return vectors, &BatchEmbedError{Errs: errs}
+	}
+	return vectors, nil
+}
+
+// ConcurrentEmbedder 为没有原生批量接口的嵌入服务提供批量向量化：
+// workers 个并发请求，并按 ratePerSecond 限速（0 表示不限速）
+type ConcurrentEmbedder struct {
+	EmbeddingService
+	workers int
+	limiter *rateLimiter
+}
+
+func NewConcurrentEmbedder(embedder EmbeddingService, workers int, ratePerSecond float64) *ConcurrentEmbedder {
+	if workers <= 0 {
+		workers = 1
+	}
+	return &ConcurrentEmbedder{
+		EmbeddingService: embedder,
+		workers:          workers,
+		limiter:          newRateLimiter(ratePerSecond),
+	}
+}
+
+// EmbeddingModel 沿用被包装服务的模型名称
+func (e *ConcurrentEmbedder) EmbeddingModel() string {
+	return embeddingModelName(e.EmbeddingService)
+}
+
+func (e *ConcurrentEmbedder) Embed(ctx context.Context, text string) ([]float32, error) {
+	if err := e.limiter.Wait(ctx); err != nil {
+		return nil, err
+	}
+	return e.EmbeddingService.Embed(ctx, text)
+}
+
+func (e *ConcurrentEmbedder) EmbedBatch(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	errs := make([]error, len(texts))
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(e.workers, len(texts)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				vectors[i], errs[i] = e.Embed(ctx, texts[i])
+			}
+		}()
+	}
+	for i := range texts {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return vectors, &BatchEmbedError{Errs: errs}
+		}
+	}
+	return vectors, nil
+}
+
+// rateLimiter 按固定间隔放行请求
+type rateLimiter struct {
+	interval time.Duration
+	mu       sync.Mutex
+	next     time.Time
+}
+
+func newRateLimiter(ratePerSecond float64) *rateLimiter {
+	if ratePerSecond <= 0 {
+		return &rateLimiter{}
+	}
+	return &rateLimiter{interval: time.Duration(float64(time.Second) / ratePerSecond)}
+}
+
+// Wait 等待下一个可用时间片，ctx 结束时返回其错误
+func (l *rateLimiter) Wait(ctx context.Context) error {
+	if l.interval == 0 {
+		return ctx.Err()
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	wait := l.next.Sub(now)
+	l.next = l.next.Add(l.interval)
+	l.mu.Unlock()
+
+	if wait == 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// EmbeddingCache 向量缓存，key 由模型名称与文本内容哈希组成
+type EmbeddingCache interface {
+	Get(key string) ([]float32, bool)
+	Set(key string, vector []float32)
+}
+
+// CachedEmbedder 按文本内容缓存向量，重复导入未修改的内容不再调用嵌入服务
+type CachedEmbedder struct {
+	next  EmbeddingService
+	cache EmbeddingCache
+	model string
+}
+
+func NewCachedEmbedder(next EmbeddingService, cache EmbeddingCache) *CachedEmbedder {
+	return &CachedEmbedder{next: next, cache: cache, model: embeddingModelName(next)}
+}
+
+func (e *CachedEmbedder) EmbeddingModel() string {
+	return e.model
+}
+
+func (e *CachedEmbedder) Embed(ctx context.Context, text string) ([]float32, error) {
+	vectors, err := e.EmbedBatch(ctx, []string{text})
+	if err != nil {
+		return nil, batchItemErr(err, 0)
+	}
+	return vectors[0], nil
+}
+
+// EmbedBatch 只向嵌入服务发送未命中缓存的文本（相同文本只发送一次）
+func (e *CachedEmbedder) EmbedBatch(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	keys := make([]string, len(texts))
+	missing := make(map[string][]int)
+	var missTexts []string
+	for i, text := range texts {
+		keys[i] = e.cacheKey(text)
+		if vector, ok := e.cache.Get(keys[i]); ok {
+			vectors[i] = vector
+			continue
+		}
+		if _, ok := missing[keys[i]]; !ok {
+			missTexts = append(missTexts, text)
+		}
+		missing[keys[i]] = append(missing[keys[i]], i)
+	}
+	if len(missTexts) == 0 {
+		return vectors, nil
+	}
+
+	embedded, err := embedTexts(ctx, e.next, missTexts)
+	if err != nil {
+		var batchErr itemErrors
+		if !errors.As(err, &batchErr) {
+			return nil, err
+		}
+	}
+
+	errs := make([]error, len(texts))
+	for j, text := range missTexts {
+		key := e.cacheKey(text)
+		itemErr := batchItemErr(err, j)
+		if itemErr == nil {
+			e.cache.Set(key, embedded[j])
+		}
+		for _, i := range missing[key] {
+			vectors[i], errs[i] = embedded[j], itemErr
+		}
+	}
+	if err != nil {
+		return vectors, &BatchEmbedError{Errs: errs}
+	}
+	return vectors, nil
+}
+
+func (e *CachedEmbedder) cacheKey(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return e.model + ":" + hex.EncodeToString(sum[:])
+}
+
+// MemoryEmbeddingCache 进程内 LRU 向量缓存（重启后清空，多实例之间不共享）
+type MemoryEmbeddingCache struct {
+	capacity int
+	mu       sync.Mutex
+	entries  map[string]*list.Element
+	order    *list.List
+}
+
+type cacheEntry struct {
+	key    string
+	vector []float32
+}
+
+func NewMemoryEmbeddingCache(capacity int) *MemoryEmbeddingCache {
+	return &MemoryEmbeddingCache{
+		capacity: capacity,
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+func (c *MemoryEmbeddingCache) Get(key string) ([]float32, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	return elem.Value.(*cacheEntry).vector, true
+}
+
+func (c *MemoryEmbeddingCache) Set(key string, vector []float32) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[key]; ok {
+		elem.Value.(*cacheEntry).vector = vector
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&cacheEntry{key: key, vector: vector})
+	if c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+func (c *MemoryEmbeddingCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
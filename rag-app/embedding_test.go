@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"rag-app/integrations/llm"
+)
+
+// countingEmbedder 记录调用次数与最大并发，内容含 "fail" 时返回错误
+type countingEmbedder struct {
+	MockEmbeddingService
+	calls   int32
+	active  int32
+	maxSeen int32
+	mu      sync.Mutex
+	texts   []string
+}
+
+func (e *countingEmbedder) Embed(ctx context.Context, text string) ([]float32, error) {
+	atomic.AddInt32(&e.calls, 1)
+	active := atomic.AddInt32(&e.active, 1)
+	defer atomic.AddInt32(&e.active, -1)
+	for {
+		seen := atomic.LoadInt32(&e.maxSeen)
+		if active <= seen || atomic.CompareAndSwapInt32(&e.maxSeen, seen, active) {
+			break
+		}
+	}
+	time.Sleep(time.Millisecond)
+
+	e.mu.Lock()
+	e.texts = append(e.texts, text)
+	e.mu.Unlock()
+	if strings.Contains(text, "fail") {
+		return nil, errors.New("embedding api unavailable")
+	}
+	return []float32{float32(len(text))}, nil
+}
+
+func TestConcurrentEmbedderBatch(t *testing.T) {
+	inner := &countingEmbedder{}
+	embedder := NewConcurrentEmbedder(inner, 3, 0)
+
+	texts := []string{"a", "bb", "fail", "dddd", "eeeee", "ffffff"}
+	vectors, err := embedder.EmbedBatch(context.Background(), texts)
+
+	var batchErr *BatchEmbedError
+	if !errors.As(err, &batchErr) {
+		t.Fatalf("Expected *BatchEmbedError, got %v", err)
+	}
+	for i, text := range texts {
+		if i == 2 {
+			if batchErr.Errs[i] == nil || vectors[i] != nil {
+				t.Errorf("Expected text %d to fail", i)
+			}
+			continue
+		}
+		if batchErr.Errs[i] != nil || vectors[i][0] != float32(len(text)) {
+			t.Errorf("Expected vector of text %d in input order, got %v (err %v)", i, vectors[i], batchErr.Errs[i])
+		}
+	}
+	if inner.maxSeen > 3 || inner.maxSeen < 2 {
+		t.Errorf("Expected up to 3 concurrent calls, saw %d", inner.maxSeen)
+	}
+	if embedder.EmbeddingModel() != "mock-768" {
+		t.Errorf("Expected wrapped model name, got %q", embedder.EmbeddingModel())
+	}
+}
+
+func TestBatchItemErr(t *testing.T) {
+	tooLong := llm.ErrEmbeddingInputTooLong
+	err := &llm.BatchEmbedError{Errs: []error{nil, tooLong}}
+	if batchItemErr(err, 0) != nil || batchItemErr(err, 1) != tooLong {
+		t.Errorf("Expected per-item errors from llm.BatchEmbedError, got %v", err)
+	}
+
+	plain := errors.New("boom")
+	if batchItemErr(plain, 0) != plain || batchItemErr(plain, 1) != plain {
+		t.Error("Expected a plain error to apply to every item")
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	limiter := newRateLimiter(100)
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		if err := limiter.Wait(context.Background()); err != nil {
+			t.Fatalf("Wait failed: %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 35*time.Millisecond {
+		t.Errorf("Expected 5 requests at 100/s to take ~40ms, took %v", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	limiter = newRateLimiter(0.001)
+	limiter.Wait(context.Background())
+	if err := limiter.Wait(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
+
+func TestCachedEmbedder(t *testing.T) {
+	inner := &countingEmbedder{}
+	cache := NewMemoryEmbeddingCache(10)
+	embedder := NewCachedEmbedder(inner, cache)
+
+	vectors, err := embedder.EmbedBatch(context.Background(), []string{"Go", "Rust", "Go"})
+	if err != nil {
+		t.Fatalf("EmbedBatch failed: %v", err)
+	}
+	if inner.calls != 2 || vectors[2][0] != 2 {
+		t.Errorf("Expected duplicate text to be embedded once, got %d calls", inner.calls)
+	}
+
+	if _, err := embedder.Embed(context.Background(), "Rust"); err != nil || inner.calls != 2 {
+		t.Errorf("Expected cache hit, got %d calls (err %v)", inner.calls, err)
+	}
+
+	vectors, err = embedder.EmbedBatch(context.Background(), []string{"Go", "fail"})
+	var batchErr *BatchEmbedError
+	if !errors.As(err, &batchErr) || batchErr.Errs[0] != nil || batchErr.Errs[1] == nil || vectors[0] == nil {
+		t.Errorf("Expected partial failure keeping cached vector, got %v (err %v)", vectors, err)
+	}
+	if _, err := embedder.Embed(context.Background(), "fail"); err == nil || inner.calls != 4 {
+		t.Errorf("Expected failures not to be cached, got %d calls (err %v)", inner.calls, err)
+	}
+
+	// 模型名称是缓存 key 的一部分
+	other := NewCachedEmbedder(struct{ EmbeddingService }{inner}, cache)
+	if other.cacheKey("Go") == embedder.cacheKey("Go") {
+		t.Error("Expected cache key to include model name")
+	}
+}
+
+func TestMemoryEmbeddingCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	cache := NewMemoryEmbeddingCache(2)
+	cache.Set("a", []float32{1})
+	cache.Set("b", []float32{2})
+	cache.Get("a")
+	cache.Set("c", []float32{3})
+
+	if _, ok := cache.Get("b"); ok {
+		t.Error("Expected b to be evicted")
+	}
+	if _, ok := cache.Get("a"); !ok || cache.Len() != 2 {
+		t.Errorf("Expected a and c to remain, len %d", cache.Len())
+	}
+}
+
+func TestReingestUnchangedContentHitsCache(t *testing.T) {
+	docs := newMemoryDocumentRepository()
+	inner := &countingEmbedder{}
+	embedder := NewCachedEmbedder(NewConcurrentEmbedder(inner, 2, 0), NewMemoryEmbeddingCache(100))
+
+	ingestDocument(t, docs, embedder, ingestionRequest)
+	calls := inner.calls
+	doc := ingestDocument(t, docs, embedder, ingestionRequest)
+
+	if inner.calls != calls || doc.ChunkCount != 2 || doc.EmbeddingModel != "mock-768" {
+		t.Errorf("Expected re-ingestion to be served from cache, calls %d -> %d, doc %+v", calls, inner.calls, doc)
+	}
+}
@@ -1,15 +1,17 @@
 package main
 
 import (
-	"log"
+	"context"
+	"database/sql"
+	"errors"
 	"net/http"
-	"strings"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 )
 
-// CreateDocumentHandler 创建文档
-func CreateDocumentHandler(service *RAGService) gin.HandlerFunc {
+// CreateDocumentHandler 上传文档：同步分块并创建导入任务，向量化在后台进行
+func CreateDocumentHandler(ingestion *IngestionService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var req CreateDocRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
@@ -17,40 +19,202 @@ func CreateDocumentHandler(service *RAGService) gin.HandlerFunc {
 			return
 		}
 
-		// 分块处理
-		chunks := splitDocument(req.Content)
-
-		// 向量化每个分块
-		for i, chunkContent := range chunks {
-			embedding, err := service.embedder.Embed(c.Request.Context(), chunkContent)
-			if err != nil {
-				log.Printf("Embedding failed: %v", err)
-				continue
+		doc, job, err := ingestion.Submit(req)
+		if err != nil {
+			if errors.Is(err, ErrInvalidChunkOptions) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
 			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusAccepted, gin.H{
+			"message":  "Document accepted",
+			"document": doc,
+			"job":      job,
+		})
+	}
+}
+
+// ListDocumentsHandler 文档列表（doc_type 过滤，keyword 按标题模糊匹配）
+func ListDocumentsHandler(docs DocumentRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		results, err := docs.List(c.Query("doc_type"), c.Query("keyword"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"documents": results,
+			"total":     len(results),
+		})
+	}
+}
+
+// GetDocumentHandler 文档详情（含原文与分块参数）
+func GetDocumentHandler(docs DocumentRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := parseDocumentID(c)
+		if !ok {
+			return
+		}
+
+		doc, err := docs.Get(id)
+		if err != nil {
+			respondDocumentError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, doc)
+	}
+}
+
+// DeleteDocumentHandler 删除文档及其全部分块
+func DeleteDocumentHandler(docs DocumentRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := parseDocumentID(c)
+		if !ok {
+			return
+		}
+
+		if err := docs.Delete(id); err != nil {
+			respondDocumentError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Document deleted"})
+	}
+}
 
-			chunk := &DocumentChunk{
-				ChunkID:   &i,
-				Content:   chunkContent,
-				Embedding: embedding,
-				DocType:   req.DocType,
-				Language:  req.Language,
-				Metadata:  `{"title": "` + req.Title + `"}`,
+// ReindexDocumentHandler 用新的分块参数或嵌入模型重建文档的分块
+func ReindexDocumentHandler(service *DocumentService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := parseDocumentID(c)
+		if !ok {
+			return
+		}
+
+		var req ReindexRequest
+		if c.Request.ContentLength != 0 {
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
 			}
+		}
 
-			if err := service.repo.Create(chunk); err != nil {
-				log.Printf("Create chunk failed: %v", err)
+		doc, err := service.Reindex(c.Request.Context(), id, req)
+		if err != nil {
+			if errors.Is(err, ErrInvalidChunkOptions) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
 			}
+			respondDocumentError(c, err)
+			return
 		}
 
 		c.JSON(http.StatusOK, gin.H{
-			"message": "Document created",
-			"chunks":  len(chunks),
+			"message":  "Document reindexed",
+			"document": doc,
+			"chunks":   doc.ChunkCount,
 		})
 	}
 }
 
-// RAGQueryHandler RAG 查询处理器
-func RAGQueryHandler(service *RAGService, agenticService *AgenticRAGService) gin.HandlerFunc {
+// parseDocumentID 解析路径中的文档 ID，非法时返回 400
+func parseDocumentID(c *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid document id"})
+		return 0, false
+	}
+	return id, true
+}
+
+// respondDocumentError 文档不存在返回 404，其余返回 500
+func respondDocumentError(c *gin.Context, err error) {
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "document not found"})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
+
+// GetJobHandler 查询导入任务进度（含失败分块的错误）
+func GetJobHandler(ingestion *IngestionService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := parseJobID(c)
+		if !ok {
+			return
+		}
+
+		job, err := ingestion.Job(id)
+		if err != nil {
+			respondJobError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, job)
+	}
+}
+
+// RetryJobHandler 重试失败的分块
+func RetryJobHandler(ingestion *IngestionService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := parseJobID(c)
+		if !ok {
+			return
+		}
+
+		job, err := ingestion.Retry(id)
+		if err != nil {
+			respondJobError(c, err)
+			return
+		}
+		c.JSON(http.StatusAccepted, job)
+	}
+}
+
+// CancelJobHandler 取消排队或运行中的导入任务
+func CancelJobHandler(ingestion *IngestionService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := parseJobID(c)
+		if !ok {
+			return
+		}
+
+		job, err := ingestion.Cancel(id)
+		if err != nil {
+			respondJobError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, job)
+	}
+}
+
+func parseJobID(c *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid job id"})
+		return 0, false
+	}
+	return id, true
+}
+
+// respondJobError 任务不存在返回 404，状态不允许该操作返回 409，其余返回 500
+func respondJobError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{"error": "job not found"})
+	case errors.Is(err, ErrJobFinished), errors.Is(err, ErrJobNotRetryable):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// RAGQueryHandler RAG 查询处理器，指定 session_id 时在会话中查询（追问改写 + 记录问答）
+func RAGQueryHandler(service *RAGService, agenticService *AgenticRAGService, conversations *ConversationService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var req RAGQueryRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
@@ -64,18 +228,26 @@ func RAGQueryHandler(service *RAGService, agenticService *AgenticRAGService) gin
 			useAgentic = *req.UseAgentic
 		}
 
-		var resp *RAGQueryResponse
-		var err error
+		if c.Query("stream") == "true" {
+			streamRAGQuery(c, req, useAgentic, service, agenticService, conversations)
+			return
+		}
 
-		if useAgentic {
-			// 第三代 Agentic RAG
-			resp, err = agenticService.Query(c.Request.Context(), req)
-		} else {
+		run := func(ctx context.Context, req RAGQueryRequest) (*RAGQueryResponse, error) {
+			if useAgentic {
+				// 第三代 Agentic RAG
+				return agenticService.Query(ctx, req)
+			}
 			// 第一代 RAG
-			resp, err = service.Query(c.Request.Context(), req)
+			return service.Query(ctx, req)
 		}
 
+		resp, err := querySession(c.Request.Context(), req, conversations, run)
 		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+				return
+			}
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
@@ -84,6 +256,137 @@ func RAGQueryHandler(service *RAGService, agenticService *AgenticRAGService) gin
 	}
 }
 
+// streamRAGQuery 以 Server-Sent Events 推送查询过程：plan → sources → token... → done
+// 查询失败时推送 error 事件；客户端断开后请求 context 取消，LLM 生成随之中止
+func streamRAGQuery(c *gin.Context, req RAGQueryRequest, useAgentic bool, service *RAGService, agenticService *AgenticRAGService, conversations *ConversationService) {
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+
+	ctx := c.Request.Context()
+	emit := func(event string, data interface{}) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		c.SSEvent(event, data)
+		c.Writer.Flush()
+		return nil
+	}
+
+	run := func(ctx context.Context, req RAGQueryRequest) (*RAGQueryResponse, error) {
+		if useAgentic {
+			return agenticService.QueryStream(ctx, req, emit)
+		}
+		return service.QueryStream(ctx, req, emit)
+	}
+
+	resp, err := querySession(ctx, req, conversations, run)
+	if err != nil {
+		if ctx.Err() == nil {
+			emit(EventError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	emit(EventDone, DoneEvent{Answer: resp.Answer, Segments: resp.Segments, Metadata: resp.Metadata})
+}
+
+// querySession 指定 session_id 时在会话中查询，否则直接查询
+func querySession(ctx context.Context, req RAGQueryRequest, conversations *ConversationService, run QueryFunc) (*RAGQueryResponse, error) {
+	if req.SessionID == nil {
+		return run(ctx, req)
+	}
+	return conversations.Query(ctx, req, run)
+}
+
+// CreateSessionHandler 创建对话会话
+func CreateSessionHandler(conversations *ConversationService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req CreateSessionRequest
+		if c.Request.ContentLength != 0 {
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		session, err := conversations.Create(req)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusCreated, session)
+	}
+}
+
+// ListSessionsHandler 会话列表（按最近更新排序，不含消息）
+func ListSessionsHandler(conversations *ConversationService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		sessions, err := conversations.List()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"sessions": sessions,
+			"total":    len(sessions),
+		})
+	}
+}
+
+// GetSessionHandler 会话详情（含摘要与全部消息）
+func GetSessionHandler(conversations *ConversationService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := parseSessionID(c)
+		if !ok {
+			return
+		}
+
+		session, err := conversations.Get(id)
+		if err != nil {
+			respondSessionError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, session)
+	}
+}
+
+// DeleteSessionHandler 删除会话及其消息
+func DeleteSessionHandler(conversations *ConversationService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := parseSessionID(c)
+		if !ok {
+			return
+		}
+
+		if err := conversations.Delete(id); err != nil {
+			respondSessionError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Session deleted"})
+	}
+}
+
+func parseSessionID(c *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid session id"})
+		return 0, false
+	}
+	return id, true
+}
+
+// respondSessionError 会话不存在返回 404，其余返回 500
+func respondSessionError(c *gin.Context, err error) {
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
+
 // REFRAGQueryHandler REFRAG 查询处理器
 func REFRAGQueryHandler(service *REFRAGService) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -102,19 +405,3 @@ func REFRAGQueryHandler(service *REFRAGService) gin.HandlerFunc {
 		c.JSON(http.StatusOK, resp)
 	}
 }
-
-// splitDocument 简单的文档分块（实际应用中应使用更复杂的分块策略）
-func splitDocument(content string) []string {
-	// 按段落分块
-	paragraphs := strings.Split(content, "\n\n")
-
-	chunks := make([]string, 0)
-	for _, p := range paragraphs {
-		p = strings.TrimSpace(p)
-		if len(p) > 50 { // 只保留有足够内容的段落
-			chunks = append(chunks, p)
-		}
-	}
-
-	return chunks
-}
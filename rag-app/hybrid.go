@@ -0,0 +1,94 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// rrfK RRF 融合的平滑常数：score = Σ 1 / (rrfK + rank)
+const rrfK = 60
+
+// hybridOverFetch 混合检索中每一路召回 limit 的倍数，融合后再截断
+const hybridOverFetch = 3
+
+// SearchTokens 全文检索分词：CJK 连续字符切为二元组（单字保留原样），其余按字母数字切词并转小写
+// 写入时存入 search_tokens 列，查询时以相同规则切分关键词，使 PostgreSQL 的 simple 分词器可以匹配中文
+func SearchTokens(text string) []string {
+	var tokens []string
+	var word []rune
+	var cjk []rune
+
+	flushWord := func() {
+		if len(word) > 0 {
+			tokens = append(tokens, strings.ToLower(string(word)))
+			word = word[:0]
+		}
+	}
+	flushCJK := func() {
+		switch len(cjk) {
+		case 0:
+		case 1:
+			tokens = append(tokens, string(cjk))
+		default:
+			for i := 0; i+1 < len(cjk); i++ {
+				tokens = append(tokens, string(cjk[i:i+2]))
+			}
+		}
+		cjk = cjk[:0]
+	}
+
+	for _, r := range text {
+		switch {
+		case isCJK(r):
+			flushWord()
+			cjk = append(cjk, r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			flushCJK()
+			word = append(word, r)
+		default:
+			flushWord()
+			flushCJK()
+		}
+	}
+	flushWord()
+	flushCJK()
+	return tokens
+}
+
+// keywordQuery 把关键词转换为 to_tsquery 表达式（任一词项命中即可，命中越多排名越高）
+// 词项只含字母、数字与 CJK 字符，无需转义
+func keywordQuery(keyword string) string {
+	seen := make(map[string]bool)
+	var terms []string
+	for _, token := range SearchTokens(keyword) {
+		if !seen[token] {
+			seen[token] = true
+			terms = append(terms, token)
+		}
+	}
+	return strings.Join(terms, " | ")
+}
+
+// fuseRRF 用 Reciprocal Rank Fusion 合并多路检索结果（按分块 ID 合并），分数记录在 RRFScore
+// 同分时保持首次出现的顺序（先列出的检索路优先）
+func fuseRRF(lists ...[]*DocumentChunk) []*DocumentChunk {
+	scores := make(map[int64]float64)
+	fused := make([]*DocumentChunk, 0)
+	for _, list := range lists {
+		for rank, chunk := range list {
+			if _, ok := scores[chunk.ID]; !ok {
+				fused = append(fused, chunk)
+			}
+			scores[chunk.ID] += 1 / float64(rrfK+rank+1)
+		}
+	}
+
+	for _, chunk := range fused {
+		chunk.RRFScore = scores[chunk.ID]
+	}
+	sort.SliceStable(fused, func(i, j int) bool {
+		return fused[i].RRFScore > fused[j].RRFScore
+	})
+	return fused
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestSearchTokens(t *testing.T) {
+	for _, tc := range []struct {
+		text string
+		want []string
+	}{
+		{"Go 并发编程", []string{"go", "并发", "发编", "编程"}},
+		{"Goroutine和Channel", []string{"goroutine", "和", "channel"}},
+		{"HTTP/2 协议，v1.21", []string{"http", "2", "协议", "v1", "21"}},
+		{"。，！", nil},
+	} {
+		if got := SearchTokens(tc.text); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("SearchTokens(%q) = %q, want %q", tc.text, got, tc.want)
+		}
+	}
+}
+
+func TestKeywordQuery(t *testing.T) {
+	if got := keywordQuery("并发 Go 并发 go's"); got != "并发 | go | s" {
+		t.Errorf("Unexpected tsquery %q", got)
+	}
+	if got := keywordQuery("？！"); got != "" {
+		t.Errorf("Expected empty tsquery for punctuation, got %q", got)
+	}
+}
+
+func TestFuseRRF(t *testing.T) {
+	chunk := func(id int64) *DocumentChunk { return &DocumentChunk{ID: id} }
+	vector := []*DocumentChunk{chunk(1), chunk(2), chunk(3)}
+	keyword := []*DocumentChunk{chunk(3), chunk(4), chunk(2)}
+
+	fused := fuseRRF(vector, keyword)
+	ids := make([]int64, len(fused))
+	for i, c := range fused {
+		ids[i] = c.ID
+	}
+	// 3: 1/63 + 1/61，2: 1/62 + 1/63，1: 1/61，4: 1/62
+	if want := []int64{3, 2, 1, 4}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("Expected fused order %v, got %v", want, ids)
+	}
+	if want := 1.0/63 + 1.0/61; fused[0].RRFScore != want {
+		t.Errorf("Expected RRF score %f, got %f", want, fused[0].RRFScore)
+	}
+}
+
+func TestRAGServiceUsesHybridSearchWithKeywords(t *testing.T) {
+	repo := &limitRecordingRepository{}
+	service := NewRAGService(repo, nil, &MockEmbeddingService{}, &MockLLMService{}, nil)
+
+	resp, err := service.Query(context.Background(), RAGQueryRequest{Question: "什么是 Channel？"})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(repo.keywords) != 0 || resp.Metadata["retrieval"] != "vector" {
+		t.Errorf("Expected vector search without keywords, got %v", repo.keywords)
+	}
+
+	resp, err = service.Query(context.Background(), RAGQueryRequest{Question: "什么是 Channel？", Keywords: []string{"Channel", "通信"}})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if !reflect.DeepEqual(repo.keywords, []string{"Channel 通信"}) || resp.Metadata["retrieval"] != "hybrid" {
+		t.Errorf("Expected hybrid search with joined keywords, got %v", repo.keywords)
+	}
+}
+
+func TestAgenticRAGFeedsPlanKeywords(t *testing.T) {
+	repo := &limitRecordingRepository{}
+	agentic := NewAgenticRAGService(NewRAGService(repo, nil, &MockEmbeddingService{}, &MockLLMService{}, nil), nil)
+
+	resp, err := agentic.Query(context.Background(), RAGQueryRequest{Question: "Go 和 Rust 在并发编程上有什么区别？"})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	// MockLLMService 的规划提取了 Go、Rust、并发、区别，每个子问题一轮混合检索
+	if len(repo.keywords) != 3 || repo.keywords[0] != "Go Rust 并发 区别" || resp.Metadata["retrieval"] != "hybrid" {
+		t.Errorf("Expected each round to use plan keywords, got %v", repo.keywords)
+	}
+}
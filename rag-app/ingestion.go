@@ -0,0 +1,333 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+)
+
+// 导入任务状态
+const (
+	JobPending   = "pending"
+	JobRunning   = "running"
+	JobCompleted = "completed" // 全部分块成功
+	JobPartial   = "partial"   // 部分分块失败，可重试
+	JobFailed    = "failed"    // 任务无法继续（如文档已删除），可重试
+	JobCanceled  = "canceled"
+)
+
+// 分块状态
+const (
+	ItemPending = "pending"
+	ItemDone    = "done"
+	ItemFailed  = "failed"
+)
+
+const (
+	ingestionQueueSize = 100
+	ingestionBatchSize = 32 // 每批向量化的分块数
+)
+
+var (
+	// ErrJobFinished 任务已结束，不能取消
+	ErrJobFinished = errors.New("job already finished")
+	// ErrJobNotRetryable 任务仍在排队或运行，或已全部成功
+	ErrJobNotRetryable = errors.New("job is not retryable")
+)
+
+func isJobFinished(status string) bool {
+	switch status {
+	case JobCompleted, JobPartial, JobFailed, JobCanceled:
+		return true
+	}
+	return false
+}
+
+// IngestionService 异步导入文档
+//
+// 上传时只做分块并创建任务，向量化与写入分块由进程内的 worker 池完成。
+// 每个分块的状态单独记录：单个分块失败不影响其他分块，失败的分块可重试；
+// 运行中的任务可取消，已写入的分块保留。
+type IngestionService struct {
+	docs     DocumentRepository
+	jobs     JobRepository
+	embedder EmbeddingService
+	queue    chan int64
+
+	mu   sync.Mutex
+	runs map[int64]*ingestionRun // 运行中的任务
+}
+
+// ingestionRun 任务的一次运行，Retry 后同一任务可能有新的运行在旧运行退出前注册
+type ingestionRun struct {
+	cancel context.CancelFunc
+}
+
+func NewIngestionService(docs DocumentRepository, jobs JobRepository, embedder EmbeddingService) *IngestionService {
+	return &IngestionService{
+		docs:     docs,
+		jobs:     jobs,
+		embedder: embedder,
+		queue:    make(chan int64, ingestionQueueSize),
+		runs:     make(map[int64]*ingestionRun),
+	}
+}
+
+// Start 启动 workers 个 worker，ctx 结束时退出
+// 上次进程退出时仍在排队或运行的任务会重新排队
+func (s *IngestionService) Start(ctx context.Context, workers int) error {
+	for i := 0; i < workers; i++ {
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case jobID := <-s.queue:
+					if err := s.Process(ctx, jobID); err != nil {
+						log.Printf("Ingestion job %d failed: %v", jobID, err)
+					}
+				}
+			}
+		}()
+	}
+
+	ids, err := s.jobs.FindJobIDsByStatus(JobPending, JobRunning)
+	if err != nil {
+		return fmt.Errorf("find unfinished jobs failed: %w", err)
+	}
+	for _, id := range ids {
+		if _, err := s.jobs.TransitionJob(id, JobPending, "", JobRunning); err != nil {
+			return err
+		}
+		s.enqueue(id)
+	}
+	return nil
+}
+
+// Submit 创建文档并分块，创建导入任务后立即返回
+func (s *IngestionService) Submit(req CreateDocRequest) (*Document, *IngestionJob, error) {
+	doc := &Document{
+		Title:          req.Title,
+		Content:        req.Content,
+		DocType:        req.DocType,
+		Language:       req.Language,
+		EmbeddingModel: embeddingModelName(s.embedder),
+	}
+	contents, err := splitDocument(doc, req.ChunkOptions().WithDefaults())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := s.docs.CreateWithChunks(doc, nil); err != nil {
+		return nil, nil, fmt.Errorf("create document failed: %w", err)
+	}
+
+	items := make([]*IngestionJobItem, len(contents))
+	for i, content := range contents {
+		items[i] = &IngestionJobItem{ChunkIndex: i, Content: content, Status: ItemPending}
+	}
+	job := &IngestionJob{DocID: doc.ID, Status: JobPending}
+	if err := s.jobs.CreateJob(job, items); err != nil {
+		return nil, nil, fmt.Errorf("create ingestion job failed: %w", err)
+	}
+
+	s.enqueue(job.ID)
+	return doc, job, nil
+}
+
+// Job 查询任务进度，附带失败分块的错误
+func (s *IngestionService) Job(id int64) (*IngestionJob, error) {
+	job, err := s.jobs.GetJob(id)
+	if err != nil {
+		return nil, err
+	}
+	if job.Failed > 0 {
+		if job.Errors, err = s.jobs.FindItems(id, ItemFailed); err != nil {
+			return nil, err
+		}
+	}
+	return job, nil
+}
+
+// Retry 重新处理失败的分块（以及取消时未处理的分块）
+func (s *IngestionService) Retry(id int64) (*IngestionJob, error) {
+	job, err := s.jobs.GetJob(id)
+	if err != nil {
+		return nil, err
+	}
+
+	// 已取消但仍在处理当前分块的运行退出前不能重试，否则新旧运行会同时处理剩余分块
+	s.mu.Lock()
+	_, running := s.runs[id]
+	s.mu.Unlock()
+	if running {
+		return nil, fmt.Errorf("%w: job is still stopping", ErrJobNotRetryable)
+	}
+
+	ok, err := s.jobs.TransitionJob(id, JobPending, "", JobPartial, JobFailed, JobCanceled)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w: status is %s", ErrJobNotRetryable, job.Status)
+	}
+	if _, err := s.jobs.ResetFailedItems(id); err != nil {
+		return nil, err
+	}
+
+	s.enqueue(id)
+	return s.Job(id)
+}
+
+// Cancel 取消排队或运行中的任务；运行中的任务在当前分块处理完后停止
+func (s *IngestionService) Cancel(id int64) (*IngestionJob, error) {
+	job, err := s.jobs.GetJob(id)
+	if err != nil {
+		return nil, err
+	}
+
+	ok, err := s.jobs.TransitionJob(id, JobCanceled, "", JobPending, JobRunning)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w: status is %s", ErrJobFinished, job.Status)
+	}
+
+	s.mu.Lock()
+	if run, ok := s.runs[id]; ok {
+		run.cancel()
+	}
+	s.mu.Unlock()
+
+	return s.Job(id)
+}
+
+// Process 同步处理任务中待处理的分块（worker 与测试调用）
+// 任务不在排队状态（已取消或已被其他 worker 处理）时直接返回
+// 先注册本次运行再切换为 running，保证切换之后到达的 Cancel 一定能取消本次运行
+func (s *IngestionService) Process(ctx context.Context, jobID int64) error {
+	ctx, cancel := context.WithCancel(ctx)
+	run := &ingestionRun{cancel: cancel}
+	s.mu.Lock()
+	if _, running := s.runs[jobID]; running {
+		// 本进程中已有运行在处理该任务
+		s.mu.Unlock()
+		cancel()
+		return nil
+	}
+	s.runs[jobID] = run
+	s.mu.Unlock()
+	defer func() {
+		// 只注销本次运行，不能删除重试后新运行的注册
+		s.mu.Lock()
+		if s.runs[jobID] == run {
+			delete(s.runs, jobID)
+		}
+		s.mu.Unlock()
+		cancel()
+	}()
+
+	ok, err := s.jobs.TransitionJob(jobID, JobRunning, "", JobPending)
+	if err != nil || !ok {
+		return err
+	}
+
+	runErr := s.process(ctx, jobID)
+
+	switch {
+	case ctx.Err() != nil:
+		// 被取消时状态已是 canceled；进程退出时放回队列，下次启动继续
+		_, err = s.jobs.TransitionJob(jobID, JobPending, "", JobRunning)
+		return err
+	case runErr != nil:
+		if _, err := s.jobs.TransitionJob(jobID, JobFailed, runErr.Error(), JobRunning); err != nil {
+			return err
+		}
+		return runErr
+	}
+
+	job, err := s.jobs.GetJob(jobID)
+	if err != nil {
+		return err
+	}
+	status, lastError := JobCompleted, ""
+	if job.Failed > 0 {
+		status, lastError = JobPartial, fmt.Sprintf("%d chunks failed", job.Failed)
+	}
+	_, err = s.jobs.TransitionJob(jobID, status, lastError, JobRunning)
+	return err
+}
+
+func (s *IngestionService) process(ctx context.Context, jobID int64) error {
+	job, err := s.jobs.GetJob(jobID)
+	if err != nil {
+		return err
+	}
+	doc, err := s.docs.Get(job.DocID)
+	if err != nil {
+		return fmt.Errorf("get document %d failed: %w", job.DocID, err)
+	}
+
+	items, err := s.jobs.FindItems(jobID, ItemPending)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := s.docs.UpdateChunkCount(doc.ID); err != nil {
+			log.Printf("Update chunk count of document %d failed: %v", doc.ID, err)
+		}
+	}()
+
+	for start := 0; start < len(items); start += ingestionBatchSize {
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err := s.processBatch(ctx, doc, items[start:min(start+ingestionBatchSize, len(items))]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// processBatch 批量向量化一批分块并逐个写入，每个分块单独记录成功或失败
+// 分块写入与标记完成在同一事务中，进程中途退出后重新处理不会写入重复的分块
+func (s *IngestionService) processBatch(ctx context.Context, doc *Document, items []*IngestionJobItem) error {
+	texts := make([]string, len(items))
+	for i, item := range items {
+		texts[i] = item.Content
+	}
+	embeddings, batchErr := embedTexts(ctx, s.embedder, texts)
+
+	for i, item := range items {
+		item.Attempts++
+		err := batchItemErr(batchErr, i)
+		if err == nil {
+			item.Status, item.Error = ItemDone, ""
+			if err = s.jobs.CompleteItem(item, newChunk(doc, item.ChunkIndex, item.Content, embeddings[i])); err == nil {
+				continue
+			}
+		}
+		if ctx.Err() != nil {
+			// 取消导致的失败不计入，分块保持待处理
+			continue
+		}
+
+		item.Status, item.Error = ItemFailed, err.Error()
+		if err := s.jobs.UpdateItem(item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// enqueue 任务排队，队列已满时在后台等待
+func (s *IngestionService) enqueue(jobID int64) {
+	select {
+	case s.queue <- jobID:
+	default:
+		go func() { s.queue <- jobID }()
+	}
+}
@@ -0,0 +1,392 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// memoryJobRepository 内存导入任务仓库（用于测试），完成的分块写入 chunks
+type memoryJobRepository struct {
+	chunks ChunkRepository
+	mu     sync.Mutex
+	jobs   map[int64]*IngestionJob
+	items  map[int64][]*IngestionJobItem
+	nextID int64
+}
+
+func newMemoryJobRepository(chunks ChunkRepository) *memoryJobRepository {
+	return &memoryJobRepository{
+		chunks: chunks,
+		jobs:   make(map[int64]*IngestionJob),
+		items:  make(map[int64][]*IngestionJobItem),
+	}
+}
+
+func (r *memoryJobRepository) CreateJob(job *IngestionJob, items []*IngestionJobItem) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.nextID++
+	job.ID = r.nextID
+	job.Total, job.Pending = len(items), len(items)
+	for i, item := range items {
+		item.ID = int64(i + 1)
+		item.JobID = job.ID
+	}
+	copied := *job
+	r.jobs[job.ID] = &copied
+	r.items[job.ID] = items
+	return nil
+}
+
+func (r *memoryJobRepository) GetJob(id int64) (*IngestionJob, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	job, ok := r.jobs[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	copied := *job
+	copied.Total, copied.Done, copied.Failed, copied.Pending = len(r.items[id]), 0, 0, 0
+	for _, item := range r.items[id] {
+		switch item.Status {
+		case ItemDone:
+			copied.Done++
+		case ItemFailed:
+			copied.Failed++
+		case ItemPending:
+			copied.Pending++
+		}
+	}
+	return &copied, nil
+}
+
+func (r *memoryJobRepository) FindItems(jobID int64, status string) ([]*IngestionJobItem, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	items := make([]*IngestionJobItem, 0)
+	for _, item := range r.items[jobID] {
+		if status == "" || item.Status == status {
+			copied := *item
+			items = append(items, &copied)
+		}
+	}
+	return items, nil
+}
+
+func (r *memoryJobRepository) UpdateItem(item *IngestionJobItem) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, stored := range r.items[item.JobID] {
+		if stored.ID == item.ID {
+			*stored = *item
+		}
+	}
+	return nil
+}
+
+func (r *memoryJobRepository) CompleteItem(item *IngestionJobItem, chunk *DocumentChunk) error {
+	if err := r.chunks.Create(chunk); err != nil {
+		return err
+	}
+	return r.UpdateItem(item)
+}
+
+func (r *memoryJobRepository) ResetFailedItems(jobID int64) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := 0
+	for _, item := range r.items[jobID] {
+		if item.Status == ItemFailed {
+			item.Status, item.Error = ItemPending, ""
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (r *memoryJobRepository) TransitionJob(id int64, status, lastError string, from ...string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	job, ok := r.jobs[id]
+	if !ok {
+		return false, nil
+	}
+	for _, f := range from {
+		if job.Status == f {
+			job.Status, job.LastError = status, lastError
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *memoryJobRepository) FindJobIDsByStatus(statuses ...string) ([]int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ids := make([]int64, 0)
+	for id := int64(1); id <= r.nextID; id++ {
+		for _, status := range statuses {
+			if r.jobs[id].Status == status {
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids, nil
+}
+
+// cancelingEmbedder 第一次调用时取消任务并立即重试，模拟运行中被取消
+type cancelingEmbedder struct {
+	MockEmbeddingService
+	ingestion *IngestionService
+	jobID     int64
+	retryErr  error // 运行退出前重试的结果
+}
+
+func (e *cancelingEmbedder) Embed(ctx context.Context, text string) ([]float32, error) {
+	if e.jobID != 0 {
+		e.ingestion.Cancel(e.jobID)
+		_, e.retryErr = e.ingestion.Retry(e.jobID)
+		e.jobID = 0
+	}
+	return e.MockEmbeddingService.Embed(ctx, text)
+}
+
+var ingestionRequest = CreateDocRequest{
+	Title:   "Go 并发",
+	Content: lifecycleContent,
+	ChunkParams: ChunkParams{
+		Chunker: ChunkerMarkdown,
+	},
+}
+
+func TestIngestionPartialFailureAndRetry(t *testing.T) {
+	docs := newMemoryDocumentRepository()
+	jobs := newMemoryJobRepository(docs)
+	embedder := &failingEmbedder{failAt: 2}
+	ingestion := NewIngestionService(docs, jobs, embedder)
+
+	doc, job, err := ingestion.Submit(ingestionRequest)
+	if err != nil {
+		t.Fatalf("Submit failed: %v", err)
+	}
+	if job.Status != JobPending || job.Total != 2 || doc.Chunker != ChunkerMarkdown || doc.EmbeddingModel != "mock-768" {
+		t.Fatalf("Unexpected submit result: %+v %+v", job, doc)
+	}
+
+	if err := ingestion.Process(context.Background(), job.ID); err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+	job, _ = ingestion.Job(job.ID)
+	if job.Status != JobPartial || job.Done != 1 || job.Failed != 1 || len(job.Errors) != 1 {
+		t.Fatalf("Expected partial job with one failed chunk, got %+v", job)
+	}
+	if item := job.Errors[0]; item.ChunkIndex != 1 || item.Attempts != 1 || !strings.Contains(item.Error, "unavailable") {
+		t.Errorf("Unexpected failed item: %+v", item)
+	}
+	if stored, _ := docs.Get(doc.ID); stored.ChunkCount != 1 {
+		t.Errorf("Expected chunk count 1 after partial ingestion, got %d", stored.ChunkCount)
+	}
+
+	if _, err := ingestion.Retry(job.ID); err != nil {
+		t.Fatalf("Retry failed: %v", err)
+	}
+	embedder.failAt = 100
+	if err := ingestion.Process(context.Background(), job.ID); err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+	job, _ = ingestion.Job(job.ID)
+	if job.Status != JobCompleted || job.Done != 2 || len(job.Errors) != 0 {
+		t.Errorf("Expected completed job after retry, got %+v", job)
+	}
+	chunks := docs.chunks[doc.ID]
+	if len(chunks) != 2 || *chunks[1].ChunkID != 1 || !strings.HasPrefix(chunks[1].Content, "通信\n\n") {
+		t.Errorf("Unexpected chunks: %+v", chunks)
+	}
+
+	if _, err := ingestion.Retry(job.ID); !errors.Is(err, ErrJobNotRetryable) {
+		t.Errorf("Expected ErrJobNotRetryable for completed job, got %v", err)
+	}
+	if _, err := ingestion.Cancel(job.ID); !errors.Is(err, ErrJobFinished) {
+		t.Errorf("Expected ErrJobFinished for completed job, got %v", err)
+	}
+}
+
+func TestIngestionCancel(t *testing.T) {
+	docs := newMemoryDocumentRepository()
+	embedder := &cancelingEmbedder{}
+	ingestion := NewIngestionService(docs, newMemoryJobRepository(docs), embedder)
+
+	doc, job, err := ingestion.Submit(ingestionRequest)
+	if err != nil {
+		t.Fatalf("Submit failed: %v", err)
+	}
+	embedder.ingestion, embedder.jobID = ingestion, job.ID
+
+	if err := ingestion.Process(context.Background(), job.ID); err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+	job, _ = ingestion.Job(job.ID)
+	if job.Status != JobCanceled || job.Done != 1 || job.Pending != 1 {
+		t.Fatalf("Expected canceled job keeping the written chunk, got %+v", job)
+	}
+	if !errors.Is(embedder.retryErr, ErrJobNotRetryable) {
+		t.Errorf("Expected retry to be refused while the canceled run is stopping, got %v", embedder.retryErr)
+	}
+
+	// 已取消的任务不再处理，重试后继续处理剩余分块
+	if _, err := ingestion.Retry(job.ID); err != nil {
+		t.Fatalf("Retry failed: %v", err)
+	}
+	if err := ingestion.Process(context.Background(), job.ID); err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+	job, _ = ingestion.Job(job.ID)
+	if job.Status != JobCompleted || len(docs.chunks[doc.ID]) != 2 {
+		t.Errorf("Expected completed job after retry, got %+v", job)
+	}
+}
+
+// cancelOnStartJobRepository 任务切换为 running 后立即取消，模拟 Cancel 紧跟在状态切换之后到达
+type cancelOnStartJobRepository struct {
+	*memoryJobRepository
+	ingestion *IngestionService
+}
+
+func (r *cancelOnStartJobRepository) TransitionJob(id int64, status, lastError string, from ...string) (bool, error) {
+	ok, err := r.memoryJobRepository.TransitionJob(id, status, lastError, from...)
+	if ok && status == JobRunning {
+		r.ingestion.Cancel(id)
+	}
+	return ok, err
+}
+
+func TestIngestionCancelRightAfterStart(t *testing.T) {
+	docs := newMemoryDocumentRepository()
+	jobs := &cancelOnStartJobRepository{memoryJobRepository: newMemoryJobRepository(docs)}
+	ingestion := NewIngestionService(docs, jobs, &MockEmbeddingService{})
+	jobs.ingestion = ingestion
+
+	doc, job, err := ingestion.Submit(ingestionRequest)
+	if err != nil {
+		t.Fatalf("Submit failed: %v", err)
+	}
+	if err := ingestion.Process(context.Background(), job.ID); err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+	job, _ = ingestion.Job(job.ID)
+	if job.Status != JobCanceled || job.Done != 0 || len(docs.chunks[doc.ID]) != 0 {
+		t.Errorf("Expected the run to stop before writing chunks, got %+v", job)
+	}
+}
+
+func TestIngestionResumesUnfinishedJobs(t *testing.T) {
+	docs := newMemoryDocumentRepository()
+	jobs := newMemoryJobRepository(docs)
+	ingestion := NewIngestionService(docs, jobs, &MockEmbeddingService{})
+
+	doc, job, err := ingestion.Submit(ingestionRequest)
+	if err != nil {
+		t.Fatalf("Submit failed: %v", err)
+	}
+	// 模拟上次进程在运行中退出
+	<-ingestion.queue
+	jobs.TransitionJob(job.ID, JobRunning, "", JobPending)
+
+	if err := ingestion.Start(context.Background(), 0); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	if got := <-ingestion.queue; got != job.ID {
+		t.Fatalf("Expected job %d to be re-enqueued, got %d", job.ID, got)
+	}
+	if err := ingestion.Process(context.Background(), job.ID); err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+	if job, _ := ingestion.Job(job.ID); job.Status != JobCompleted || len(docs.chunks[doc.ID]) != 2 {
+		t.Errorf("Expected resumed job to complete, got %+v", job)
+	}
+}
+
+func TestJobHandlers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	docs := newMemoryDocumentRepository()
+	ingestion := NewIngestionService(docs, newMemoryJobRepository(docs), &failingEmbedder{failAt: 2})
+
+	_, job, err := ingestion.Submit(ingestionRequest)
+	if err != nil {
+		t.Fatalf("Submit failed: %v", err)
+	}
+
+	r := gin.New()
+	r.GET("/jobs/:id", GetJobHandler(ingestion))
+	r.POST("/jobs/:id/retry", RetryJobHandler(ingestion))
+	r.POST("/jobs/:id/cancel", CancelJobHandler(ingestion))
+
+	request := func(method, url string, code int) string {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, url, nil))
+		if w.Code != code {
+			t.Errorf("%s %s: expected %d, got %d: %s", method, url, code, w.Code, w.Body.String())
+		}
+		return w.Body.String()
+	}
+
+	request(http.MethodPost, "/jobs/1/retry", http.StatusConflict)
+	request(http.MethodGet, "/jobs/abc", http.StatusBadRequest)
+	request(http.MethodGet, "/jobs/99", http.StatusNotFound)
+
+	ingestion.Process(context.Background(), job.ID)
+	if body := request(http.MethodGet, "/jobs/1", http.StatusOK); !strings.Contains(body, `"status":"partial"`) || !strings.Contains(body, `"chunk_index":1`) {
+		t.Errorf("Expected partial job with failed chunk, got %s", body)
+	}
+	request(http.MethodPost, "/jobs/1/cancel", http.StatusConflict)
+	request(http.MethodPost, "/jobs/1/retry", http.StatusAccepted)
+	request(http.MethodPost, "/jobs/1/cancel", http.StatusOK)
+}
+
+func TestJobRepositoryLifecycle(t *testing.T) {
+	db := setupRAGTestDB(t)
+	if db == nil {
+		return
+	}
+	defer db.Close()
+
+	docs := NewDocumentRepository(db)
+	jobs := NewJobRepository(db)
+	ingestion := NewIngestionService(docs, jobs, &failingEmbedder{failAt: 2})
+
+	doc, job, err := ingestion.Submit(ingestionRequest)
+	if err != nil {
+		t.Fatalf("Submit failed: %v", err)
+	}
+	if err := ingestion.Process(context.Background(), job.ID); err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+
+	job, err = ingestion.Job(job.ID)
+	if err != nil || job.Status != JobPartial || job.Done != 1 || len(job.Errors) != 1 || job.FinishedAt == nil {
+		t.Fatalf("Unexpected job %+v, err %v", job, err)
+	}
+	if stored, _ := docs.Get(doc.ID); stored.ChunkCount != 1 {
+		t.Errorf("Expected chunk count 1, got %d", stored.ChunkCount)
+	}
+
+	job, err = ingestion.Retry(job.ID)
+	if err != nil || job.Status != JobPending || job.Pending != 1 || job.FinishedAt != nil {
+		t.Errorf("Unexpected retried job %+v, err %v", job, err)
+	}
+
+	if err := docs.Delete(doc.ID); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, err := jobs.GetJob(job.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected job to be deleted with document, got %v", err)
+	}
+}
@@ -1,12 +1,15 @@
 package llm
 
 import (
+	"bufio"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"strings"
+	"unicode/utf8"
 )
 
 // OpenAIClient OpenAI LLM 客户端
@@ -114,12 +117,221 @@ func (c *OpenAIClient) GenerateWithOptions(ctx context.Context, prompt string, o
 	return result.Choices[0].Message.Content, nil
 }
 
+// GenerateStream 流式生成文本（stream: true）
+// 每收到一段增量调用 onDelta，返回完整文本；onDelta 返回错误时停止读取并返回该错误
+func (c *OpenAIClient) GenerateStream(ctx context.Context, prompt string, onDelta func(delta string) error) (string, error) {
+	// 构建请求体
+	requestBody := map[string]interface{}{
+		"model": c.model,
+		"messages": []map[string]string{
+			{"role": "user", "content": prompt},
+		},
+		"stream": true,
+	}
+
+	jsonData, err := json.Marshal(requestBody)
+	if err != nil {
+		return "", fmt.Errorf("marshal request: %w", err)
+	}
+
+	// 创建 HTTP 请求
+	req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/chat/completions", strings.NewReader(string(jsonData)))
+	if err != nil {
+		return "", fmt.Errorf("create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	req.Header.Set("Accept", "text/event-stream")
+
+	// 发送请求
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("openai api error (status %d): %s", resp.StatusCode, string(body))
+	}
+
+	// 逐行读取 SSE：data: {...}，以 data: [DONE] 结束
+	var answer strings.Builder
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "[DONE]" {
+			break
+		}
+
+		var chunk struct {
+			Choices []struct {
+				Delta struct {
+					Content string `json:"content"`
+				} `json:"delta"`
+			} `json:"choices"`
+		}
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return answer.String(), fmt.Errorf("unmarshal stream chunk: %w", err)
+		}
+		if len(chunk.Choices) == 0 || chunk.Choices[0].Delta.Content == "" {
+			continue
+		}
+
+		delta := chunk.Choices[0].Delta.Content
+		answer.WriteString(delta)
+		if err := onDelta(delta); err != nil {
+			return answer.String(), err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return answer.String(), fmt.Errorf("read stream: %w", err)
+	}
+
+	return answer.String(), nil
+}
+
+// EmbeddingModel Embed 使用的模型名称
+func (c *OpenAIClient) EmbeddingModel() string {
+	return "text-embedding-3-small"
+}
+
+// Embedding 接口单次请求的上限
+const (
+	maxEmbeddingInputs     = 2048   // 单次请求最多的输入条数
+	maxEmbeddingTokens     = 300000 // 单次请求所有输入的 token 总数上限
+	maxEmbeddingInputToken = 8192   // 单条输入的 token 上限
+)
+
+// ErrEmbeddingInputTooLong 单条输入超过 Embedding 模型的 token 上限
+var ErrEmbeddingInputTooLong = errors.New("embedding input exceeds token limit")
+
+// BatchEmbedError 批量生成 Embedding 时部分输入失败
+// Errs 与输入一一对应，成功的为 nil
+type BatchEmbedError struct {
+	Errs []error
+}
+
+func (e *BatchEmbedError) Error() string {
+	failed := 0
+	var first error
+	for _, err := range e.Errs {
+		if err != nil {
+			failed++
+			if first == nil {
+				first = err
+			}
+		}
+	}
+	return fmt.Sprintf("%d of %d texts failed: %v", failed, len(e.Errs), first)
+}
+
+// Unwrap 返回各输入的错误，便于 errors.Is(err, ErrEmbeddingInputTooLong)
+func (e *BatchEmbedError) Unwrap() []error {
+	return e.Errs
+}
+
+// ItemErrors 与输入一一对应的错误
+func (e *BatchEmbedError) ItemErrors() []error {
+	return e.Errs
+}
+
 // Embed 生成 Embedding（使用 OpenAI text-embedding-3-small）
 func (c *OpenAIClient) Embed(ctx context.Context, text string) ([]float32, error) {
+	embeddings, err := c.EmbedBatch(ctx, []string{text})
+	if err != nil {
+		var batchErr *BatchEmbedError
+		if errors.As(err, &batchErr) {
+			return nil, batchErr.Errs[0]
+		}
+		return nil, err
+	}
+	return embeddings[0], nil
+}
+
+// EmbedBatch 批量生成 Embedding，按接口的条数与 token 上限拆分为多次请求
+// 返回的向量与 texts 一一对应；超过单条 token 上限的输入不发送，其余输入照常生成，
+// 此时返回 *BatchEmbedError，超长输入对应 ErrEmbeddingInputTooLong
+func (c *OpenAIClient) EmbedBatch(ctx context.Context, texts []string) ([][]float32, error) {
+	batches, errs := splitEmbeddingBatches(texts)
+
+	embeddings := make([][]float32, len(texts))
+	for _, batch := range batches {
+		inputs := make([]string, len(batch))
+		for j, i := range batch {
+			inputs[j] = texts[i]
+		}
+		result, err := c.embedInputs(ctx, inputs)
+		if err != nil {
+			return nil, err
+		}
+		for j, i := range batch {
+			embeddings[i] = result[j]
+		}
+	}
+	if errs != nil {
+		return embeddings, &BatchEmbedError{Errs: errs}
+	}
+	return embeddings, nil
+}
+
+// splitEmbeddingBatches 按条数与 token 上限把输入下标切分为多批，token 数由 estimateEmbeddingTokens 估算
+// 超过单条上限的输入不放入任何一批，在 errs 的对应位置记录 ErrEmbeddingInputTooLong；没有超长输入时 errs 为 nil
+func splitEmbeddingBatches(texts []string) (batches [][]int, errs []error) {
+	var batch []int
+	tokens := 0
+	for i, text := range texts {
+		n := estimateEmbeddingTokens(text)
+		if n > maxEmbeddingInputToken {
+			if errs == nil {
+				errs = make([]error, len(texts))
+			}
+			errs[i] = fmt.Errorf("%w: input %d has about %d tokens (limit %d)", ErrEmbeddingInputTooLong, i, n, maxEmbeddingInputToken)
+			continue
+		}
+		if len(batch) > 0 && (len(batch) >= maxEmbeddingInputs || tokens+n > maxEmbeddingTokens) {
+			batches = append(batches, batch)
+			batch, tokens = nil, 0
+		}
+		batch = append(batch, i)
+		tokens += n
+	}
+	if len(batch) > 0 {
+		batches = append(batches, batch)
+	}
+	return batches, errs
+}
+
+// estimateEmbeddingTokens 偏保守地估算 cl100k_base 编码的 token 数
+// ASCII 按每 3 个字符 1 个 token（英文实际约 4 个）；常用 CJK 字符多为 1~2 个 token，按 2 个计；
+// emoji 与扩展区汉字等 4 字节字符可能拆成多个字节级 token，按 UTF-8 字节数计
+func estimateEmbeddingTokens(text string) int {
+	ascii, tokens := 0, 0
+	for _, r := range text {
+		switch size := utf8.RuneLen(r); {
+		case size == 1:
+			ascii++
+		case size == 4:
+			tokens += 4
+		default:
+			tokens += 2
+		}
+	}
+	return tokens + (ascii+2)/3
+}
+
+// embedInputs 以数组形式一次请求多条输入
+func (c *OpenAIClient) embedInputs(ctx context.Context, inputs []string) ([][]float32, error) {
 	// 构建请求体
 	requestBody := map[string]interface{}{
-		"model": "text-embedding-3-small", // 推荐模型
-		"input": text,
+		"model": c.EmbeddingModel(), // 推荐模型
+		"input": inputs,
 	}
 
 	jsonData, err := json.Marshal(requestBody)
@@ -153,9 +365,10 @@ func (c *OpenAIClient) Embed(ctx context.Context, text string) ([]float32, error
 		return nil, fmt.Errorf("openai api error (status %d): %s", resp.StatusCode, string(body))
 	}
 
-	// 解析响应
+	// 解析响应（data 按 index 对应输入顺序）
 	var result struct {
 		Data []struct {
+			Index     int       `json:"index"`
 			Embedding []float32 `json:"embedding"`
 		} `json:"data"`
 	}
@@ -164,11 +377,18 @@ func (c *OpenAIClient) Embed(ctx context.Context, text string) ([]float32, error
 		return nil, fmt.Errorf("unmarshal response: %w", err)
 	}
 
-	if len(result.Data) == 0 {
-		return nil, fmt.Errorf("no embeddings in response")
+	if len(result.Data) != len(inputs) {
+		return nil, fmt.Errorf("expected %d embeddings in response, got %d", len(inputs), len(result.Data))
 	}
 
-	return result.Data[0].Embedding, nil
+	embeddings := make([][]float32, len(inputs))
+	for _, item := range result.Data {
+		if item.Index < 0 || item.Index >= len(inputs) {
+			return nil, fmt.Errorf("embedding index %d out of range", item.Index)
+		}
+		embeddings[item.Index] = item.Embedding
+	}
+	return embeddings, nil
 }
 
 // DescribeImage 描述图片（使用 GPT-4V）
@@ -0,0 +1,147 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestOpenAIClientGenerateStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body["stream"] != true {
+			t.Errorf("Expected stream: true, got %v (err %v)", body, err)
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"role\":\"assistant\"}}]}\n\n")
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"Go 的\"}}]}\n\n")
+		fmt.Fprint(w, ": keep-alive\n\n")
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"并发模型\"}}]}\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	client := NewOpenAIClient(OpenAIConfig{APIKey: "test", BaseURL: server.URL})
+
+	var deltas []string
+	answer, err := client.GenerateStream(context.Background(), "prompt", func(delta string) error {
+		deltas = append(deltas, delta)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("GenerateStream failed: %v", err)
+	}
+	if answer != "Go 的并发模型" || len(deltas) != 2 {
+		t.Errorf("Unexpected answer %q, deltas %v", answer, deltas)
+	}
+}
+
+func TestOpenAIClientGenerateStreamError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error": "rate limited"}`, http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	client := NewOpenAIClient(OpenAIConfig{APIKey: "test", BaseURL: server.URL})
+	if _, err := client.GenerateStream(context.Background(), "prompt", func(string) error { return nil }); err == nil {
+		t.Error("Expected error for non-200 response")
+	}
+}
+
+func TestOpenAIClientEmbedBatch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Input []string `json:"input"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || len(body.Input) != 2 {
+			t.Errorf("Expected array input with 2 texts, got %v (err %v)", body.Input, err)
+		}
+		// 乱序返回，客户端按 index 还原
+		fmt.Fprint(w, `{"data": [{"index": 1, "embedding": [0.2]}, {"index": 0, "embedding": [0.1]}]}`)
+	}))
+	defer server.Close()
+
+	client := NewOpenAIClient(OpenAIConfig{APIKey: "test", BaseURL: server.URL})
+	embeddings, err := client.EmbedBatch(context.Background(), []string{"Go", "Rust"})
+	if err != nil {
+		t.Fatalf("EmbedBatch failed: %v", err)
+	}
+	if len(embeddings) != 2 || embeddings[0][0] != 0.1 || embeddings[1][0] != 0.2 {
+		t.Errorf("Unexpected embeddings %v", embeddings)
+	}
+}
+
+func TestOpenAIClientEmbedBatchSkipsOversizeInput(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Input []string `json:"input"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || len(body.Input) != 2 || body.Input[1] != "Rust" {
+			t.Errorf("Expected only the 2 valid inputs to be sent, got %d inputs (err %v)", len(body.Input), err)
+		}
+		fmt.Fprint(w, `{"data": [{"index": 0, "embedding": [0.1]}, {"index": 1, "embedding": [0.2]}]}`)
+	}))
+	defer server.Close()
+
+	client := NewOpenAIClient(OpenAIConfig{APIKey: "test", BaseURL: server.URL})
+	embeddings, err := client.EmbedBatch(context.Background(), []string{"Go", strings.Repeat("并", 4100), "Rust"})
+
+	var batchErr *BatchEmbedError
+	if !errors.As(err, &batchErr) || !errors.Is(err, ErrEmbeddingInputTooLong) {
+		t.Fatalf("Expected *BatchEmbedError wrapping ErrEmbeddingInputTooLong, got %v", err)
+	}
+	if batchErr.Errs[0] != nil || batchErr.Errs[1] == nil || batchErr.Errs[2] != nil {
+		t.Errorf("Expected only input 1 to fail, got %v", batchErr.Errs)
+	}
+	if embeddings[0][0] != 0.1 || embeddings[1] != nil || embeddings[2][0] != 0.2 {
+		t.Errorf("Unexpected embeddings %v", embeddings)
+	}
+}
+
+func TestSplitEmbeddingBatches(t *testing.T) {
+	texts := make([]string, maxEmbeddingInputs+1)
+	if batches, errs := splitEmbeddingBatches(texts); errs != nil || len(batches) != 2 || len(batches[1]) != 1 {
+		t.Errorf("Expected split by input count, got %d batches (errs %v)", len(batches), errs)
+	}
+
+	// 每条约 8000 token，300000 token 的预算每批最多 37 条
+	texts = make([]string, 40)
+	for i := range texts {
+		texts[i] = strings.Repeat("并", 4000)
+	}
+	if batches, errs := splitEmbeddingBatches(texts); errs != nil || len(batches) != 2 || len(batches[0]) != 37 {
+		t.Errorf("Expected split by token budget, got %d batches (errs %v)", len(batches), errs)
+	}
+
+	batches, errs := splitEmbeddingBatches([]string{"Go", strings.Repeat("并", 4100), "Rust"})
+	if len(batches) != 1 || len(batches[0]) != 2 || batches[0][1] != 2 {
+		t.Errorf("Expected oversize input left out of batches, got %v", batches)
+	}
+	if len(errs) != 3 || errs[0] != nil || !errors.Is(errs[1], ErrEmbeddingInputTooLong) || errs[2] != nil {
+		t.Errorf("Expected ErrEmbeddingInputTooLong for input 1 only, got %v", errs)
+	}
+}
+
+func TestEstimateEmbeddingTokens(t *testing.T) {
+	cases := []struct {
+		text string
+		want int
+	}{
+		{"", 0},
+		{"hello world", 4},
+		{"并发", 4},
+		{"🚀", 4},
+		{"Go 并发🚀", 1 + 4 + 4},
+	}
+	for _, c := range cases {
+		if got := estimateEmbeddingTokens(c.text); got != c.want {
+			t.Errorf("estimateEmbeddingTokens(%q) = %d, want %d", c.text, got, c.want)
+		}
+	}
+}
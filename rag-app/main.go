@@ -1,11 +1,15 @@
 package main
 
 import (
+	"context"
 	"log"
+	"os"
 
 	"github.com/gin-gonic/gin"
 	"github.com/jmoiron/sqlx"
 	_ "github.com/lib/pq"
+
+	"rag-app/integrations/rerank"
 )
 
 func main() {
@@ -18,15 +22,35 @@ func main() {
 
 	// 创建服务
 	repo := NewChunkRepository(db)
-	embedder := &MockEmbeddingService{}
+	docs := NewDocumentRepository(db)
+	// 嵌入：无原生批量接口时用 worker 池并发请求（限速 20 次/秒），向量按内容哈希缓存
+	embedder := NewCachedEmbedder(NewConcurrentEmbedder(&MockEmbeddingService{}, 4, 20), NewMemoryEmbeddingCache(10000))
 	llm := &MockLLMService{}
-	ragService := NewRAGService(repo, embedder, llm)
+
+	// 可选：设置 BGE_RERANK_URL 启用 BGE-Reranker 重排（Cohere 见 integrations/rerank）
+	var reranker Reranker
+	if url := os.Getenv("BGE_RERANK_URL"); url != "" {
+		reranker = rerank.NewBGERerankClient(rerank.BGEConfig{BaseURL: url})
+	}
+
+	ragService := NewRAGService(repo, docs, embedder, llm, reranker)
+	docService := NewDocumentService(docs, embedder)
+
+	// 异步导入：上传后由后台 worker 向量化分块
+	jobs := NewJobRepository(db)
+	ingestion := NewIngestionService(docs, jobs, embedder)
+	if err := ingestion.Start(context.Background(), 4); err != nil {
+		log.Fatal(err)
+	}
 
 	// ⭐ 创建第三代 Agentic RAG 服务
-	agenticService := NewAgenticRAGService(ragService)
+	agenticService := NewAgenticRAGService(ragService, reranker)
+
+	// 多轮对话：会话与消息存储在 PostgreSQL
+	conversations := NewConversationService(NewSessionRepository(db), llm)
 
 	// ⭐ 创建 REFRAG 风格 RAG 服务
-	refragService := NewREFRAGService(repo, embedder, llm)
+	refragService := NewREFRAGService(repo, embedder, llm, reranker)
 
 	// 创建 HTTP 服务
 	r := gin.Default()
@@ -34,16 +58,39 @@ func main() {
 	// 注册路由
 	api := r.Group("/api")
 	{
-		api.POST("/documents", CreateDocumentHandler(ragService))
-		api.POST("/rag/query", RAGQueryHandler(ragService, agenticService))
+		api.POST("/documents", CreateDocumentHandler(ingestion))
+		api.GET("/documents", ListDocumentsHandler(docs))
+		api.GET("/documents/:id", GetDocumentHandler(docs))
+		api.DELETE("/documents/:id", DeleteDocumentHandler(docs))
+		api.POST("/documents/:id/reindex", ReindexDocumentHandler(docService))
+		api.GET("/jobs/:id", GetJobHandler(ingestion))
+		api.POST("/jobs/:id/retry", RetryJobHandler(ingestion))
+		api.POST("/jobs/:id/cancel", CancelJobHandler(ingestion))
+		api.POST("/sessions", CreateSessionHandler(conversations))
+		api.GET("/sessions", ListSessionsHandler(conversations))
+		api.GET("/sessions/:id", GetSessionHandler(conversations))
+		api.DELETE("/sessions/:id", DeleteSessionHandler(conversations))
+		api.POST("/rag/query", RAGQueryHandler(ragService, agenticService, conversations))
 		api.POST("/rag/refrag", REFRAGQueryHandler(refragService)) // ⭐ REFRAG 查询
 	}
 
 	// 启动服务
 	log.Println("RAG Server (v3 Agentic + REFRAG) starting on :8080")
 	log.Println("Endpoints:")
-	log.Println("  POST /api/documents - 上传文档")
-	log.Println("  POST /api/rag/query - RAG 查询（默认使用第三代 Agentic RAG）")
+	log.Println("  POST /api/documents - 上传文档（异步导入，返回任务）")
+	log.Println("  GET  /api/documents - 文档列表（doc_type、keyword 过滤）")
+	log.Println("  GET  /api/documents/:id - 文档详情")
+	log.Println("  DELETE /api/documents/:id - 删除文档及其分块")
+	log.Println("  POST /api/documents/:id/reindex - 用新的分块参数 / 嵌入模型重建分块")
+	log.Println("  GET  /api/jobs/:id - 导入任务进度")
+	log.Println("  POST /api/jobs/:id/retry - 重试失败的分块")
+	log.Println("  POST /api/jobs/:id/cancel - 取消导入任务")
+	log.Println("  POST /api/sessions - 创建对话会话")
+	log.Println("  GET  /api/sessions - 会话列表")
+	log.Println("  GET  /api/sessions/:id - 会话详情（摘要与消息）")
+	log.Println("  DELETE /api/sessions/:id - 删除会话")
+	log.Println("  POST /api/rag/query - RAG 查询（默认使用第三代 Agentic RAG，session_id 开启多轮对话）")
+	log.Println("  POST /api/rag/query?stream=true - 流式 RAG 查询（Server-Sent Events）")
 	log.Println("  POST /api/rag/refrag - REFRAG 风格查询（压缩 + 智能选择）")
 	
 	if err := r.Run(":8080"); err != nil {
@@ -16,19 +16,159 @@ type DocumentChunk struct {
 	DocType   string    `json:"doc_type" db:"doc_type"`
 	Language  string    `json:"language" db:"language"`
 	Metadata  string    `json:"metadata" db:"metadata"` // JSONB
-	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	// SearchTokens 全文检索分词结果（空格分隔），见 SearchTokens
+	SearchTokens string    `json:"-" db:"search_tokens"`
+	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+	// 检索结果附带的字段
+	Distance    float64 `json:"distance,omitempty" db:"distance"`
+	KeywordRank float64 `json:"keyword_rank,omitempty" db:"keyword_rank"` // 全文检索的 ts_rank_cd
+	RRFScore    float64 `json:"rrf_score,omitempty" db:"-"`               // 混合检索的融合分数
+	DocTitle    string  `json:"doc_title,omitempty" db:"-"`
+	// RerankScore Reranker 给出的相关性分数（未经重排时为空）
+	RerankScore *float64 `json:"rerank_score,omitempty" db:"-"`
 }
 
 func (*DocumentChunk) TableName() string {
 	return "document_chunks"
 }
 
+// Document 文档（分块的来源），保存原文与分块参数以便重建索引
+type Document struct {
+	ID             int64     `json:"id" db:"id"`
+	Title          string    `json:"title" db:"title"`
+	Content        string    `json:"content,omitempty" db:"content"` // 列表接口不返回原文
+	DocType        string    `json:"doc_type" db:"doc_type"`
+	Language       string    `json:"language" db:"language"`
+	Chunker        string    `json:"chunker" db:"chunker"`
+	ChunkUnit      string    `json:"chunk_unit" db:"chunk_unit"`
+	ChunkSize      int       `json:"chunk_size" db:"chunk_size"`
+	ChunkOverlap   int       `json:"chunk_overlap" db:"chunk_overlap"`
+	EmbeddingModel string    `json:"embedding_model" db:"embedding_model"`
+	ChunkCount     int       `json:"chunk_count" db:"chunk_count"`
+	CreatedAt      time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at" db:"updated_at"`
+}
+
+func (*Document) TableName() string {
+	return "documents"
+}
+
+// ChunkOptions 文档当前的分块参数
+func (d *Document) ChunkOptions() ChunkOptions {
+	return ChunkOptions{
+		Strategy: d.Chunker,
+		Unit:     d.ChunkUnit,
+		Size:     d.ChunkSize,
+		Overlap:  d.ChunkOverlap,
+	}
+}
+
+// ChunkParams 请求中的分块参数
+type ChunkParams struct {
+	// 分块策略：recursive（默认）| markdown | sentence
+	Chunker      string `json:"chunker"`
+	ChunkUnit    string `json:"chunk_unit"`    // rune（默认）| token
+	ChunkSize    int    `json:"chunk_size"`    // 默认 500
+	ChunkOverlap int    `json:"chunk_overlap"` // 默认 50（指定 chunk_size 时默认 0）
+}
+
+func (p ChunkParams) ChunkOptions() ChunkOptions {
+	return ChunkOptions{
+		Strategy: p.Chunker,
+		Unit:     p.ChunkUnit,
+		Size:     p.ChunkSize,
+		Overlap:  p.ChunkOverlap,
+	}
+}
+
 // CreateDocRequest 创建文档请求
 type CreateDocRequest struct {
 	Title    string `json:"title" binding:"required"`
 	Content  string `json:"content" binding:"required"`
 	DocType  string `json:"doc_type"`
 	Language string `json:"language"`
+	ChunkParams
+}
+
+// ReindexRequest 重建索引请求：未指定的分块参数沿用文档当前的参数
+type ReindexRequest struct {
+	ChunkParams
+}
+
+// IngestionJob 文档导入任务：后台向量化并写入文档的分块
+type IngestionJob struct {
+	ID         int64      `json:"id" db:"id"`
+	DocID      int64      `json:"doc_id" db:"doc_id"`
+	Status     string     `json:"status" db:"status"`
+	LastError  string     `json:"last_error,omitempty" db:"last_error"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at" db:"updated_at"`
+	FinishedAt *time.Time `json:"finished_at" db:"finished_at"`
+	// 由分块状态统计
+	Total   int `json:"total" db:"total"`
+	Done    int `json:"done" db:"done"`
+	Failed  int `json:"failed" db:"failed"`
+	Pending int `json:"pending" db:"pending"`
+	// 失败分块的错误（查询任务时填充）
+	Errors []*IngestionJobItem `json:"errors,omitempty" db:"-"`
+}
+
+func (*IngestionJob) TableName() string {
+	return "ingestion_jobs"
+}
+
+// IngestionJobItem 导入任务中的一个分块
+type IngestionJobItem struct {
+	ID         int64     `json:"-" db:"id"`
+	JobID      int64     `json:"-" db:"job_id"`
+	ChunkIndex int       `json:"chunk_index" db:"chunk_index"`
+	Content    string    `json:"-" db:"content"`
+	Status     string    `json:"status" db:"status"`
+	Error      string    `json:"error,omitempty" db:"error"`
+	Attempts   int       `json:"attempts" db:"attempts"`
+	UpdatedAt  time.Time `json:"updated_at" db:"updated_at"`
+}
+
+func (*IngestionJobItem) TableName() string {
+	return "ingestion_job_items"
+}
+
+// Session 多轮对话会话
+type Session struct {
+	ID    int64  `json:"id" db:"id"`
+	Title string `json:"title" db:"title"` // 未指定时取首个问题
+	// Summary 早期对话的摘要（历史超出 token 预算时生成），SummarizedUntil 为已并入摘要的最后一条消息 ID
+	Summary         string    `json:"summary,omitempty" db:"summary"`
+	SummarizedUntil int64     `json:"-" db:"summarized_until"`
+	MessageCount    int       `json:"message_count" db:"message_count"`
+	CreatedAt       time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at" db:"updated_at"`
+	// 查询会话详情时填充
+	Messages []*SessionMessage `json:"messages,omitempty" db:"-"`
+}
+
+func (*Session) TableName() string {
+	return "sessions"
+}
+
+// SessionMessage 会话中的一条消息
+type SessionMessage struct {
+	ID        int64  `json:"id" db:"id"`
+	SessionID int64  `json:"-" db:"session_id"`
+	Role      string `json:"role" db:"role"` // user | assistant
+	Content   string `json:"content" db:"content"`
+	// Rewritten 用户追问改写后的独立问题（未改写时为空）
+	Rewritten string    `json:"rewritten,omitempty" db:"rewritten"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+func (*SessionMessage) TableName() string {
+	return "session_messages"
+}
+
+// CreateSessionRequest 创建会话请求
+type CreateSessionRequest struct {
+	Title string `json:"title" binding:"max=200"` // 未指定时取首个问题
 }
 
 // RAGQueryRequest RAG 查询请求
@@ -37,13 +177,45 @@ type RAGQueryRequest struct {
 	DocType  string `json:"doc_type"`
 	Language string `json:"language"`
 	TopK     *int   `json:"top_k"`
+	// Keywords 关键词，非空时使用混合检索（向量 + 全文检索，RRF 融合）；Agentic RAG 未指定时使用规划提取的关键词
+	Keywords []string `json:"keywords"`
 	// UseAgentic 是否使用第三代 Agentic RAG（默认 true）
 	UseAgentic *bool `json:"use_agentic"`
+	// SessionID 多轮对话会话：追问先结合历史改写为独立问题再检索，问答记录写入会话
+	SessionID *int64 `json:"session_id"`
+	// Iterative 多跳检索（Agentic RAG）：每跳检索后由 LLM 判断证据是否充分，不足时追问继续检索
+	Iterative   bool `json:"iterative"`
+	MaxHops     int  `json:"max_hops"`     // 最大跳数（默认 3）
+	TokenBudget int  `json:"token_budget"` // 充分性判断的 token 预算（默认 8000）
+	// DedupThreshold 语义去重阈值（Agentic RAG）：向量余弦相似度不低于该值的分块视为近似重复（默认 0.95）
+	DedupThreshold *float64 `json:"dedup_threshold" binding:"omitempty,min=0,max=1"`
+	// MMRLambda MMR 选择最终 topK 时的权衡系数（Agentic RAG）：1 为纯相关性，越小越注重多样性（默认 0.7）
+	MMRLambda *float64 `json:"mmr_lambda" binding:"omitempty,min=0,max=1"`
+	// VerifyCitations 由 LLM 核验答案中每个带引用的句子是否被所引分块支持（额外一次 LLM 调用）
+	VerifyCitations bool `json:"verify_citations"`
+}
+
+// dedupThreshold 语义去重阈值，未指定时取默认值
+func (r RAGQueryRequest) dedupThreshold() float64 {
+	if r.DedupThreshold != nil {
+		return *r.DedupThreshold
+	}
+	return defaultDedupThreshold
+}
+
+// mmrLambda MMR 权衡系数，未指定时取默认值
+func (r RAGQueryRequest) mmrLambda() float64 {
+	if r.MMRLambda != nil {
+		return *r.MMRLambda
+	}
+	return defaultMMRLambda
 }
 
 // RAGQueryResponse RAG 查询响应
 type RAGQueryResponse struct {
-	Answer   string                 `json:"answer"`
-	Sources  []*DocumentChunk       `json:"sources"`
+	Answer  string           `json:"answer"`
+	Sources []*DocumentChunk `json:"sources"`
+	// Segments 按句切分的答案，[n] 引用映射到 Sources 中的分块
+	Segments []AnswerSegment        `json:"segments,omitempty"`
 	Metadata map[string]interface{} `json:"metadata"`
 }
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// 多跳检索的默认参数
+const (
+	defaultMaxHops      = 3
+	defaultTokenBudget  = 8000 // 充分性判断的 LLM 调用 token 预算（估算）
+	maxFollowUpsPerHop  = 3
+	evidenceSnippetRune = 200 // 判断提示词中每条证据截取的长度
+)
+
+// 多跳检索的结束原因
+const (
+	StopSufficient  = "sufficient"    // LLM 判断证据充分
+	StopMaxHops     = "max_hops"      // 达到最大跳数
+	StopTokenBudget = "token_budget"  // 下一次判断会超出 token 预算
+	StopNoFollowUps = "no_follow_ups" // LLM 判断不充分，但没有提出新的追问
+	StopJudgeFailed = "judge_failed"  // 判断调用失败或无法解析
+	StopHopFailed   = "hop_failed"    // 追问的检索全部失败
+)
+
+// HopTrace 一跳的推理轨迹
+type HopTrace struct {
+	Hop        int           `json:"hop"`
+	Queries    []string      `json:"queries"`
+	Rounds     []RoundResult `json:"rounds"`
+	NewChunks  int           `json:"new_chunks"` // 本跳新增的证据数
+	Sufficient bool          `json:"sufficient"`
+	Reasoning  string        `json:"reasoning,omitempty"`
+	FollowUps  []string      `json:"follow_ups,omitempty"`
+	Tokens     int           `json:"tokens"` // 本跳判断消耗的 token（估算）
+	Error      string        `json:"error,omitempty"`
+}
+
+// MultiHopTrace 多跳检索的完整轨迹
+type MultiHopTrace struct {
+	Hops       []*HopTrace `json:"hops"`
+	StopReason string      `json:"stop_reason"`
+	TokensUsed int         `json:"tokens_used"`
+	MaxHops    int         `json:"max_hops"`
+	Budget     int         `json:"token_budget"`
+}
+
+// queries 按检索顺序返回所有跳的查询
+func (t *MultiHopTrace) queries() []string {
+	var queries []string
+	for _, hop := range t.Hops {
+		queries = append(queries, hop.Queries...)
+	}
+	return queries
+}
+
+// sufficiencyJudgement LLM 对证据充分性的判断
+type sufficiencyJudgement struct {
+	Sufficient      bool     `json:"sufficient"`
+	Reasoning       string   `json:"reasoning"`
+	FollowUpQueries []string `json:"follow_up_queries"`
+}
+
+// iterate 多跳检索：每跳检索后由 LLM 判断证据是否充分，不足时按其提出的追问继续检索
+// 返回所有跳的检索结果（合并后的 AllChunks 按发现顺序去重）与推理轨迹；仅第一跳全部失败时返回错误
+func (s *AgenticRAGService) iterate(ctx context.Context, req RAGQueryRequest, plan *QueryPlan, emit StreamEmitter) (*ExecutionResults, *MultiHopTrace, error) {
+	trace := &MultiHopTrace{MaxHops: req.MaxHops, Budget: req.TokenBudget}
+	if trace.MaxHops <= 0 {
+		trace.MaxHops = defaultMaxHops
+	}
+	if trace.Budget <= 0 {
+		trace.Budget = defaultTokenBudget
+	}
+
+	results := &ExecutionResults{AllChunks: make([]*DocumentChunk, 0)}
+	seen := make(map[int64]bool)
+	asked := make(map[string]bool)
+	var askedOrder []string
+
+	queries := plan.SubQueries
+	if len(queries) == 0 {
+		queries = []string{req.Question}
+	}
+
+	for hop := 1; ; hop++ {
+		// 上一跳已完成，推送其轨迹
+		if hop > 1 {
+			if err := emit.Emit(EventHop, trace.Hops[hop-2]); err != nil {
+				return nil, nil, err
+			}
+		}
+		for _, q := range queries {
+			asked[q] = true
+			askedOrder = append(askedOrder, q)
+		}
+		step := &HopTrace{Hop: hop, Queries: queries}
+		trace.Hops = append(trace.Hops, step)
+
+		// 1. 检索本跳的查询
+		hopResults, err := s.executor.Execute(ctx, &QueryPlan{SubQueries: queries}, req)
+		if hopResults != nil {
+			step.Rounds = hopResults.RoundResults
+			results.RoundResults = append(results.RoundResults, hopResults.RoundResults...)
+		}
+		if err != nil {
+			if hop == 1 {
+				return nil, nil, err
+			}
+			step.Error = err.Error()
+			trace.StopReason = StopHopFailed
+			break
+		}
+		results.Rounds += hopResults.Rounds
+		for _, chunk := range hopResults.AllChunks {
+			if !seen[chunk.ID] {
+				seen[chunk.ID] = true
+				results.AllChunks = append(results.AllChunks, chunk)
+				step.NewChunks++
+			}
+		}
+
+		if hop >= trace.MaxHops {
+			trace.StopReason = StopMaxHops
+			break
+		}
+
+		// 2. 判断证据是否充分（超出预算时不再判断）
+		prompt := buildSufficiencyPrompt(req.Question, askedOrder, results.AllChunks)
+		cost := EstimateTokens(prompt)
+		if trace.TokensUsed+cost > trace.Budget {
+			trace.StopReason = StopTokenBudget
+			break
+		}
+
+		response, err := s.baseRAG.llm.Generate(ctx, prompt)
+		step.Tokens = cost + EstimateTokens(response)
+		trace.TokensUsed += step.Tokens
+		if err != nil {
+			step.Error = err.Error()
+			trace.StopReason = StopJudgeFailed
+			break
+		}
+
+		var judgement sufficiencyJudgement
+		if err := json.Unmarshal([]byte(extractJSON(response)), &judgement); err != nil {
+			step.Error = fmt.Sprintf("parse judgement: %v", err)
+			trace.StopReason = StopJudgeFailed
+			break
+		}
+		step.Sufficient = judgement.Sufficient
+		step.Reasoning = judgement.Reasoning
+		if judgement.Sufficient {
+			trace.StopReason = StopSufficient
+			break
+		}
+
+		// 3. 只追问未检索过的查询
+		queries = nil
+		for _, q := range judgement.FollowUpQueries {
+			q = strings.TrimSpace(q)
+			if q != "" && !asked[q] && len(queries) < maxFollowUpsPerHop {
+				queries = append(queries, q)
+			}
+		}
+		step.FollowUps = queries
+		if len(queries) == 0 {
+			trace.StopReason = StopNoFollowUps
+			break
+		}
+	}
+
+	if err := emit.Emit(EventHop, trace.Hops[len(trace.Hops)-1]); err != nil {
+		return nil, nil, err
+	}
+	return results, trace, nil
+}
+
+// buildSufficiencyPrompt 构建证据充分性判断的提示词
+func buildSufficiencyPrompt(question string, asked []string, chunks []*DocumentChunk) string {
+	var sb strings.Builder
+
+	sb.WriteString("你是一个检索评估专家，需要判断已检索到的证据是否足以回答用户问题。\n\n")
+	sb.WriteString(fmt.Sprintf("用户问题：%s\n\n", question))
+
+	sb.WriteString("已检索过的查询：\n")
+	for _, q := range asked {
+		sb.WriteString(fmt.Sprintf("- %s\n", q))
+	}
+
+	sb.WriteString("\n已找到的证据：\n")
+	if len(chunks) == 0 {
+		sb.WriteString("（无）\n")
+	}
+	for i, chunk := range chunks {
+		content := []rune(chunk.Content)
+		if len(content) > evidenceSnippetRune {
+			content = append(content[:evidenceSnippetRune], []rune("...")...)
+		}
+		sb.WriteString(fmt.Sprintf("[%d] %s\n", i+1, string(content)))
+	}
+
+	sb.WriteString(`
+请输出 JSON：
+
+{
+  "sufficient": false,
+  "reasoning": "还缺少哪些信息",
+  "follow_up_queries": ["追问1", "追问2"]
+}
+
+规则：
+1. sufficient: 证据能完整回答问题时设为 true
+2. follow_up_queries: 证据不足时，根据已找到的内容提出 1-3 个新的检索查询（不要重复已检索过的查询）
+
+只返回 JSON，不要有其他文字。`)
+
+	return sb.String()
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// scriptedLLM 按顺序返回预设的响应，并记录收到的提示词
+type scriptedLLM struct {
+	mu        sync.Mutex
+	responses []string
+	prompts   []string
+}
+
+func (l *scriptedLLM) Generate(ctx context.Context, prompt string) (string, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.prompts = append(l.prompts, prompt)
+	if len(l.responses) == 0 {
+		return "", errors.New("script exhausted")
+	}
+	response := l.responses[0]
+	l.responses = l.responses[1:]
+	return response, nil
+}
+
+// corpusEmbedder 把查询映射为语料中的编号，corpusRepository 按编号返回分块
+type corpusEmbedder struct {
+	MockEmbeddingService
+	ids map[string]float32
+}
+
+func (e *corpusEmbedder) Embed(ctx context.Context, text string) ([]float32, error) {
+	return []float32{e.ids[text]}, nil
+}
+
+type corpusRepository struct {
+	MockChunkRepositoryImpl
+	chunks map[float32][]*DocumentChunk
+}
+
+func (r *corpusRepository) VectorSearch(ctx context.Context, queryVector []float32, docType, language string, limit int) ([]*DocumentChunk, error) {
+	return r.chunks[queryVector[0]], nil
+}
+
+const multiHopQuestion = "Go 的调度器是谁设计的？他还参与了哪些项目？"
+
+func newMultiHopService(llm LLMService) *AgenticRAGService {
+	embedder := &corpusEmbedder{ids: map[string]float32{
+		"Go 调度器的设计者":          1,
+		"Dmitry Vyukov 参与的项目": 2,
+		"ThreadSanitizer 简介":  3,
+	}}
+	repo := &corpusRepository{chunks: map[float32][]*DocumentChunk{
+		1: {{ID: 1, Content: "Go 的 work-stealing 调度器由 Dmitry Vyukov 设计。"}},
+		2: {{ID: 1, Content: "Go 的 work-stealing 调度器由 Dmitry Vyukov 设计。"}, {ID: 2, Content: "Dmitry Vyukov 还参与了 ThreadSanitizer。"}},
+		3: {{ID: 3, Content: "ThreadSanitizer 是数据竞争检测工具。"}},
+	}}
+	return NewAgenticRAGService(NewRAGService(repo, nil, embedder, llm, nil), nil)
+}
+
+const multiHopPlan = `{"is_simple": false, "question_type": "reasoning", "sub_queries": ["Go 调度器的设计者"]}`
+
+func TestMultiHopStopsWhenSufficient(t *testing.T) {
+	llm := &scriptedLLM{responses: []string{
+		multiHopPlan,
+		"```json\n" + `{"sufficient": false, "reasoning": "还不知道他参与的项目", "follow_up_queries": ["Dmitry Vyukov 参与的项目", "Go 调度器的设计者"]}` + "\n```",
+		`{"sufficient": true, "reasoning": "已找到设计者和项目"}`,
+		"Dmitry Vyukov 设计了 Go 调度器，还参与了 ThreadSanitizer。",
+	}}
+	service := newMultiHopService(llm)
+
+	resp, err := service.Query(context.Background(), RAGQueryRequest{Question: multiHopQuestion, Iterative: true})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+
+	trace := resp.Metadata["trace"].(*MultiHopTrace)
+	if trace.StopReason != StopSufficient || len(trace.Hops) != 2 || resp.Metadata["hops"] != 2 {
+		t.Fatalf("Expected 2 hops stopping on sufficient evidence, got %+v", trace)
+	}
+	first, second := trace.Hops[0], trace.Hops[1]
+	if first.Sufficient || len(first.FollowUps) != 1 || first.FollowUps[0] != "Dmitry Vyukov 参与的项目" || first.Tokens == 0 {
+		t.Errorf("Expected repeated follow-up to be dropped, got %+v", first)
+	}
+	if second.NewChunks != 1 || !second.Sufficient || second.Rounds[0].Hits != 2 {
+		t.Errorf("Expected second hop to add 1 new chunk, got %+v", second)
+	}
+	if len(resp.Sources) != 2 || !strings.Contains(resp.Answer, "ThreadSanitizer") {
+		t.Errorf("Expected answer from both hops' evidence, got %q with %d sources", resp.Answer, len(resp.Sources))
+	}
+
+	// 第二次判断的提示词包含第一跳找到的证据与已检索过的查询
+	judge := llm.prompts[2]
+	if !strings.Contains(judge, "Dmitry Vyukov 设计") || !strings.Contains(judge, "- Go 调度器的设计者\n- Dmitry Vyukov 参与的项目") {
+		t.Errorf("Unexpected judge prompt:\n%s", judge)
+	}
+	// 生成答案的提示词列出所有跳的查询
+	if !strings.Contains(llm.prompts[3], "2. Dmitry Vyukov 参与的项目") {
+		t.Errorf("Expected follow-up queries in answer prompt:\n%s", llm.prompts[3])
+	}
+}
+
+func TestMultiHopStopsAtMaxHops(t *testing.T) {
+	llm := &scriptedLLM{responses: []string{
+		multiHopPlan,
+		`{"sufficient": false, "follow_up_queries": ["Dmitry Vyukov 参与的项目"]}`,
+		"答案",
+	}}
+	service := newMultiHopService(llm)
+
+	resp, err := service.Query(context.Background(), RAGQueryRequest{Question: multiHopQuestion, Iterative: true, MaxHops: 2})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	trace := resp.Metadata["trace"].(*MultiHopTrace)
+	if trace.StopReason != StopMaxHops || len(trace.Hops) != 2 || len(llm.prompts) != 3 {
+		t.Errorf("Expected to stop after 2 hops without judging the last, got %+v (%d LLM calls)", trace, len(llm.prompts))
+	}
+}
+
+func TestMultiHopStopsAtTokenBudget(t *testing.T) {
+	llm := &scriptedLLM{responses: []string{
+		multiHopPlan,
+		`{"sufficient": false, "follow_up_queries": ["Dmitry Vyukov 参与的项目"]}`,
+		"答案",
+	}}
+	service := newMultiHopService(llm)
+
+	// 预算只够一次判断
+	budget := EstimateTokens(buildSufficiencyPrompt(multiHopQuestion, []string{"Go 调度器的设计者"}, []*DocumentChunk{{Content: "Go 的 work-stealing 调度器由 Dmitry Vyukov 设计。"}})) + 50
+	resp, err := service.Query(context.Background(), RAGQueryRequest{Question: multiHopQuestion, Iterative: true, TokenBudget: budget})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	trace := resp.Metadata["trace"].(*MultiHopTrace)
+	if trace.StopReason != StopTokenBudget || len(trace.Hops) != 2 || trace.TokensUsed > budget {
+		t.Errorf("Expected to stop on token budget after 2 hops, got %+v", trace)
+	}
+}
+
+func TestMultiHopStopReasons(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		judgment string
+		reason   string
+	}{
+		{"no follow-ups", `{"sufficient": false, "follow_up_queries": ["Go 调度器的设计者"]}`, StopNoFollowUps},
+		{"unparseable", "我觉得还不够", StopJudgeFailed},
+	} {
+		llm := &scriptedLLM{responses: []string{multiHopPlan, tc.judgment, "答案"}}
+		resp, err := newMultiHopService(llm).Query(context.Background(), RAGQueryRequest{Question: multiHopQuestion, Iterative: true})
+		if err != nil {
+			t.Fatalf("%s: Query failed: %v", tc.name, err)
+		}
+		if trace := resp.Metadata["trace"].(*MultiHopTrace); trace.StopReason != tc.reason || len(trace.Hops) != 1 {
+			t.Errorf("%s: expected stop reason %s after 1 hop, got %+v", tc.name, tc.reason, trace)
+		}
+	}
+}
+
+func TestMultiHopStreamsHops(t *testing.T) {
+	llm := &scriptedLLM{responses: []string{
+		multiHopPlan,
+		`{"sufficient": false, "follow_up_queries": ["ThreadSanitizer 简介"]}`,
+		`{"sufficient": true}`,
+		"答案",
+	}}
+	service := newMultiHopService(llm)
+
+	var hops []int
+	_, err := service.QueryStream(context.Background(), RAGQueryRequest{Question: multiHopQuestion, Iterative: true}, func(event string, data interface{}) error {
+		if event == EventHop {
+			hops = append(hops, data.(*HopTrace).Hop)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("QueryStream failed: %v", err)
+	}
+	if len(hops) != 2 || hops[0] != 1 || hops[1] != 2 {
+		t.Errorf("Expected one hop event per hop, got %v", hops)
+	}
+}
@@ -3,26 +3,40 @@ package main
 import (
 	"context"
 	"fmt"
+	"log"
 	"strings"
 )
 
 // RAGService RAG 服务
 type RAGService struct {
 	repo     ChunkRepository
+	docs     DocumentRepository // 可为 nil，此时检索结果不附带文档标题
 	embedder EmbeddingService
 	llm      LLMService
+	reranker Reranker // 可为 nil，此时按向量距离取前 topK 个
 }
 
-func NewRAGService(repo ChunkRepository, embedder EmbeddingService, llm LLMService) *RAGService {
+func NewRAGService(repo ChunkRepository, docs DocumentRepository, embedder EmbeddingService, llm LLMService, reranker Reranker) *RAGService {
 	return &RAGService{
 		repo:     repo,
+		docs:     docs,
 		embedder: embedder,
 		llm:      llm,
+		reranker: reranker,
 	}
 }
 
 // Query RAG 查询
 func (s *RAGService) Query(ctx context.Context, req RAGQueryRequest) (*RAGQueryResponse, error) {
+	return s.query(ctx, req, nil)
+}
+
+// QueryStream 流式 RAG 查询：依次推送 sources、token 事件，返回完整响应
+func (s *RAGService) QueryStream(ctx context.Context, req RAGQueryRequest, emit StreamEmitter) (*RAGQueryResponse, error) {
+	return s.query(ctx, req, emit)
+}
+
+func (s *RAGService) query(ctx context.Context, req RAGQueryRequest, emit StreamEmitter) (*RAGQueryResponse, error) {
 	// 1. 将问题转换为向量
 	queryVector, err := s.embedder.Embed(ctx, req.Question)
 	if err != nil {
@@ -35,38 +49,82 @@ func (s *RAGService) Query(ctx context.Context, req RAGQueryRequest) (*RAGQueryR
 		topK = *req.TopK
 	}
 
-	chunks, err := s.repo.VectorSearch(queryVector, req.DocType, req.Language, topK)
+	chunks, err := search(ctx, s.repo, queryVector, req, candidateK(s.reranker, topK))
 	if err != nil {
 		return nil, fmt.Errorf("search failed: %w", err)
 	}
+	candidates := len(chunks)
+
+	// 3. 重排（失败时按向量距离截断）
+	chunks, rerankErr := rerankChunks(ctx, s.reranker, req.Question, chunks, topK)
+	if rerankErr != nil {
+		log.Printf("Rerank failed, falling back to vector order: %v", rerankErr)
+	}
 
 	if len(chunks) == 0 {
-		return &RAGQueryResponse{
+		resp := &RAGQueryResponse{
 			Answer:   "抱歉，没有找到相关文档。",
 			Sources:  []*DocumentChunk{},
 			Metadata: map[string]interface{}{"chunks_found": 0},
-		}, nil
+		}
+		if err := emit.Emit(EventSources, resp.Sources); err != nil {
+			return nil, err
+		}
+		if err := emit.Emit(EventToken, TokenEvent{Delta: resp.Answer}); err != nil {
+			return nil, err
+		}
+		return resp, nil
+	}
+
+	attachDocumentTitles(s.docs, chunks)
+	if err := emit.Emit(EventSources, chunks); err != nil {
+		return nil, err
 	}
 
-	// 3. 构建 LLM 提示词
+	// 4. 构建 LLM 提示词
 	prompt := s.buildPrompt(req.Question, chunks)
 
-	// 4. 调用 LLM 生成答案
-	answer, err := s.llm.Generate(ctx, prompt)
+	// 5. 调用 LLM 生成答案
+	answer, err := generate(ctx, s.llm, prompt, emit)
 	if err != nil {
 		return nil, fmt.Errorf("llm generation failed: %w", err)
 	}
 
+	// 6. 解析引用（可选核验）
+	segments, citations := groundAnswer(ctx, s.llm, answer, chunks, req.VerifyCitations)
+
+	metadata := map[string]interface{}{
+		"chunks_found": len(chunks),
+		"candidates":   candidates,
+		"top_k":        topK,
+		"retrieval":    retrievalMode(req),
+		"citations":    citations,
+	}
+	rerankMetadata(metadata, s.reranker, rerankErr)
+
 	return &RAGQueryResponse{
-		Answer:  answer,
-		Sources: chunks,
-		Metadata: map[string]interface{}{
-			"chunks_found": len(chunks),
-			"top_k":        topK,
-		},
+		Answer:   answer,
+		Sources:  chunks,
+		Segments: segments,
+		Metadata: metadata,
 	}, nil
 }
 
+// search 有关键词时混合检索，否则向量检索
+func search(ctx context.Context, repo ChunkRepository, queryVector []float32, req RAGQueryRequest, limit int) ([]*DocumentChunk, error) {
+	if len(req.Keywords) > 0 {
+		return repo.HybridSearch(ctx, queryVector, strings.Join(req.Keywords, " "), req.DocType, req.Language, limit)
+	}
+	return repo.VectorSearch(ctx, queryVector, req.DocType, req.Language, limit)
+}
+
+func retrievalMode(req RAGQueryRequest) string {
+	if len(req.Keywords) > 0 {
+		return "hybrid"
+	}
+	return "vector"
+}
+
 // buildPrompt 构建 LLM 提示词
 func (s *RAGService) buildPrompt(question string, chunks []*DocumentChunk) string {
 	var sb strings.Builder
@@ -75,13 +133,14 @@ func (s *RAGService) buildPrompt(question string, chunks []*DocumentChunk) strin
 	sb.WriteString("相关文档：\n")
 
 	for i, chunk := range chunks {
-		sb.WriteString(fmt.Sprintf("\n[文档 %d]\n", i+1))
+		sb.WriteString(fmt.Sprintf("\n[%d]\n", i+1))
 		sb.WriteString(chunk.Content)
 		sb.WriteString("\n")
 	}
 
 	sb.WriteString(fmt.Sprintf("\n问题：%s\n\n", question))
-	sb.WriteString("请基于上述文档内容进行回答。如果文档中没有相关信息，请明确说明。")
+	sb.WriteString("请基于上述文档内容进行回答。如果文档中没有相关信息，请明确说明。\n")
+	sb.WriteString(citationInstruction + "。")
 
 	return sb.String()
 }
@@ -96,6 +155,20 @@ type LLMService interface {
 	Generate(ctx context.Context, prompt string) (string, error)
 }
 
+// StreamingLLMService 支持流式输出的 LLM 服务
+// GenerateStream 每收到一段增量调用 onDelta，返回完整文本；onDelta 返回错误时中止生成
+type StreamingLLMService interface {
+	LLMService
+	GenerateStream(ctx context.Context, prompt string, onDelta func(delta string) error) (string, error)
+}
+
+// BatchEmbeddingService 支持批量向量化的嵌入服务
+// 返回的向量与 texts 一一对应；部分文本失败时返回 *BatchEmbedError，成功的向量照常返回
+type BatchEmbeddingService interface {
+	EmbeddingService
+	EmbedBatch(ctx context.Context, texts []string) ([][]float32, error)
+}
+
 // MockEmbeddingService 模拟嵌入服务（用于演示）
 type MockEmbeddingService struct{}
 
@@ -109,6 +182,10 @@ func (s *MockEmbeddingService) Embed(ctx context.Context, text string) ([]float3
 	return vec, nil
 }
 
+func (s *MockEmbeddingService) EmbeddingModel() string {
+	return "mock-768"
+}
+
 // MockLLMService 模拟 LLM 服务（用于演示）
 type MockLLMService struct{}
 
@@ -142,6 +219,68 @@ func (s *MockLLMService) Generate(ctx context.Context, prompt string) (string, e
   "reasoning": "这是一个简单的事实性问题，可以直接回答"
 }`, nil
 	}
-	
-	return "这是基于检索文档生成的答案...", nil
+
+	// 追问改写：原样返回追问
+	if strings.Contains(prompt, "把用户的追问改写为不依赖上下文的独立问题") {
+		if question, ok := promptLine(prompt, "追问："); ok {
+			return question, nil
+		}
+	}
+
+	// 对话摘要：列出用户问过的问题
+	if strings.Contains(prompt, "你是一个对话摘要助手") {
+		var questions []string
+		if summary, ok := promptLine(prompt, "已有摘要："); ok {
+			questions = append(questions, strings.TrimPrefix(summary, "用户询问了："))
+		}
+		for _, line := range strings.Split(prompt, "\n") {
+			if strings.HasPrefix(line, "用户：") {
+				questions = append(questions, strings.TrimPrefix(line, "用户："))
+			}
+		}
+		return "用户询问了：" + strings.Join(questions, "；"), nil
+	}
+
+	// 多跳检索的充分性判断：证据总是充分
+	if strings.Contains(prompt, "判断已检索到的证据是否足以回答用户问题") {
+		return `{"sufficient": true, "reasoning": "已检索到相关证据", "follow_up_queries": []}`, nil
+	}
+
+	// 引用核验：每个陈述都被支持
+	if strings.Contains(prompt, "判断每个陈述是否被其引用的文档支持") {
+		var results []string
+		for i := 1; strings.Contains(prompt, fmt.Sprintf("\n%d. ", i)); i++ {
+			results = append(results, fmt.Sprintf(`{"segment": %d, "supported": true}`, i))
+		}
+		return `{"results": [` + strings.Join(results, ", ") + `]}`, nil
+	}
+
+	return "这是基于检索文档生成的答案[1]。", nil
+}
+
+// promptLine 提示词中以 prefix 开头的第一行去掉前缀后的内容
+func promptLine(prompt, prefix string) (string, bool) {
+	for _, line := range strings.Split(prompt, "\n") {
+		if strings.HasPrefix(line, prefix) {
+			return strings.TrimSpace(strings.TrimPrefix(line, prefix)), true
+		}
+	}
+	return "", false
+}
+
+// GenerateStream 模拟流式输出：将完整答案按几个字符一段推送
+func (s *MockLLMService) GenerateStream(ctx context.Context, prompt string, onDelta func(delta string) error) (string, error) {
+	answer, err := s.Generate(ctx, prompt)
+	if err != nil {
+		return "", err
+	}
+
+	runes := []rune(answer)
+	for start := 0; start < len(runes); start += 4 {
+		end := min(start+4, len(runes))
+		if err := onDelta(string(runes[start:end])); err != nil {
+			return "", err
+		}
+	}
+	return answer, nil
 }
@@ -5,52 +5,6 @@ import (
 	"testing"
 )
 
-func TestSplitDocument(t *testing.T) {
-	tests := []struct {
-		name     string
-		content  string
-		minChunks int
-	}{
-		{
-			name: "simple paragraphs",
-			content: `段落1：这是第一段内容，包含足够的文字。
-
-段落2：这是第二段内容，也包含足够的文字。
-
-段落3：这是第三段内容，继续包含足够的文字。`,
-			minChunks: 3,
-		},
-		{
-			name: "with short paragraphs",
-			content: `很短
-
-这是一个很长的段落，包含足够的文字，应该被保留。
-
-太短了`,
-			minChunks: 1,
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			chunks := splitDocument(tt.content)
-			
-			if len(chunks) < tt.minChunks {
-				t.Errorf("Expected at least %d chunks, got %d", tt.minChunks, len(chunks))
-			}
-
-			// 验证每个分块都有足够的内容
-			for i, chunk := range chunks {
-				if len(chunk) < 50 {
-					t.Errorf("Chunk %d too short: %d chars", i, len(chunk))
-				}
-			}
-
-			t.Logf("Split into %d chunks", len(chunks))
-		})
-	}
-}
-
 func TestRAGServiceQuery(t *testing.T) {
 	// 使用 Mock 服务测试 RAG 流程
 	embedder := &MockEmbeddingService{}
@@ -87,7 +41,7 @@ func TestRAGServiceQuery(t *testing.T) {
 func TestBuildPrompt(t *testing.T) {
 	embedder := &MockEmbeddingService{}
 	llm := &MockLLMService{}
-	service := NewRAGService(nil, embedder, llm)
+	service := NewRAGService(nil, nil, embedder, llm, nil)
 
 	chunks := []*DocumentChunk{
 		{
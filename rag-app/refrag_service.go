@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"fmt"
+	"log"
 	"sort"
 	"strings"
 )
@@ -14,13 +15,15 @@ type REFRAGService struct {
 	repo     ChunkRepository
 	embedder EmbeddingService
 	llm      LLMService
+	reranker Reranker // 可为 nil，此时使用启发式评分
 }
 
-func NewREFRAGService(repo ChunkRepository, embedder EmbeddingService, llm LLMService) *REFRAGService {
+func NewREFRAGService(repo ChunkRepository, embedder EmbeddingService, llm LLMService, reranker Reranker) *REFRAGService {
 	return &REFRAGService{
 		repo:     repo,
 		embedder: embedder,
 		llm:      llm,
+		reranker: reranker,
 	}
 }
 
@@ -77,7 +80,7 @@ func (s *REFRAGService) Query(ctx context.Context, req REFRAGQueryRequest) (*REF
 	}
 
 	// 3. 过度获取大量 chunks（传统 RAG 只取 Top-K，这里取更多）
-	chunks, err := s.repo.VectorSearch(queryVector, req.DocType, req.Language, overFetchK)
+	chunks, err := s.repo.VectorSearch(ctx, queryVector, req.DocType, req.Language, overFetchK)
 	if err != nil {
 		return nil, fmt.Errorf("search failed: %w", err)
 	}
@@ -94,25 +97,39 @@ func (s *REFRAGService) Query(ctx context.Context, req REFRAGQueryRequest) (*REF
 		}, nil
 	}
 
-	// 4. 压缩所有 chunks（生成块向量）
+	chunksFound := len(chunks)
+
+	// 4. 重排全部候选（失败时回退到启发式评分）
+	chunks, rerankErr := rerankChunks(ctx, s.reranker, req.Question, chunks, len(chunks))
+	if rerankErr != nil {
+		log.Printf("Rerank failed, falling back to heuristic scoring: %v", rerankErr)
+	}
+
+	// 5. 压缩所有 chunks（生成块向量）
 	compressedChunks := s.compressChunks(chunks, queryVector, compressionRatio)
 
-	// 5. 使用策略网络评分（这里简化实现，使用向量相似度 + 关键词匹配）
-	s.scoreChunks(compressedChunks, req.Question)
+	// 6. 评分：有 Reranker 分数时直接使用，否则使用策略网络评分（这里简化实现，使用向量相似度 + 关键词匹配）
+	if s.reranker != nil && rerankErr == nil {
+		for _, chunk := range compressedChunks {
+			chunk.Score = *chunk.OriginalChunk.RerankScore
+		}
+	} else {
+		s.scoreChunks(compressedChunks, req.Question)
+	}
 
-	// 6. 选择 Top-K 最相关的 chunks 进行解压
+	// 7. 选择 Top-K 最相关的 chunks 进行解压
 	expandedChunks, remainingCompressed := s.selectAndExpand(compressedChunks, expandK)
 
-	// 7. 构建混合提示词（完整文本 + 压缩向量）
+	// 8. 构建混合提示词（完整文本 + 压缩向量）
 	prompt := s.buildHybridPrompt(req.Question, expandedChunks, remainingCompressed)
 
-	// 8. 调用 LLM 生成答案
+	// 9. 调用 LLM 生成答案
 	answer, err := s.llm.Generate(ctx, prompt)
 	if err != nil {
 		return nil, fmt.Errorf("llm generation failed: %w", err)
 	}
 
-	// 9. 计算统计信息
+	// 10. 计算统计信息
 	totalTokens := 0
 	compressedTokens := 0
 	for _, chunk := range expandedChunks {
@@ -122,21 +139,24 @@ func (s *REFRAGService) Query(ctx context.Context, req REFRAGQueryRequest) (*REF
 		compressedTokens += chunk.CompressedTokenCount
 	}
 
+	metadata := map[string]interface{}{
+		"chunks_found":      chunksFound,
+		"expanded_count":    len(expandedChunks),
+		"compressed_count":  len(remainingCompressed),
+		"over_fetch_k":      overFetchK,
+		"expand_k":          expandK,
+		"compression_ratio": compressionRatio,
+		"total_tokens":      totalTokens,
+		"compressed_tokens": compressedTokens,
+		"token_reduction":   fmt.Sprintf("%.1f%%", float64(compressedTokens)/float64(totalTokens+compressedTokens)*100),
+	}
+	rerankMetadata(metadata, s.reranker, rerankErr)
+
 	return &REFRAGQueryResponse{
 		Answer:           answer,
 		ExpandedChunks:   expandedChunks,
 		CompressedChunks: remainingCompressed,
-		Metadata: map[string]interface{}{
-			"chunks_found":      len(chunks),
-			"expanded_count":    len(expandedChunks),
-			"compressed_count":  len(remainingCompressed),
-			"over_fetch_k":      overFetchK,
-			"expand_k":          expandK,
-			"compression_ratio": compressionRatio,
-			"total_tokens":      totalTokens,
-			"compressed_tokens": compressedTokens,
-			"token_reduction":   fmt.Sprintf("%.1f%%", float64(compressedTokens)/float64(totalTokens+compressedTokens)*100),
-		},
+		Metadata:         metadata,
 	}, nil
 }
 
@@ -36,7 +36,7 @@ func TestREFRAGService_Query(t *testing.T) {
 	embedder := &MockEmbeddingService{}
 	llm := &MockLLMService{}
 
-	service := NewREFRAGService(repo, embedder, llm)
+	service := NewREFRAGService(repo, embedder, llm, nil)
 
 	// 测试查询
 	req := REFRAGQueryRequest{
@@ -175,7 +175,7 @@ func (m *MockChunkRepository) Create(chunk *DocumentChunk) error {
 	return nil
 }
 
-func (m *MockChunkRepository) VectorSearch(queryVector []float32, docType, language string, limit int) ([]*DocumentChunk, error) {
+func (m *MockChunkRepository) VectorSearch(ctx context.Context, queryVector []float32, docType, language string, limit int) ([]*DocumentChunk, error) {
 	result := make([]*DocumentChunk, 0, limit)
 	for i, chunk := range m.chunks {
 		if i >= limit {
@@ -190,7 +190,7 @@ func (m *MockChunkRepository) VectorSearch(queryVector []float32, docType, langu
 	return result, nil
 }
 
-func (m *MockChunkRepository) HybridSearch(queryVector []float32, keyword, docType, language string, limit int) ([]*DocumentChunk, error) {
-	return m.VectorSearch(queryVector, docType, language, limit)
+func (m *MockChunkRepository) HybridSearch(ctx context.Context, queryVector []float32, keyword, docType, language string, limit int) ([]*DocumentChunk, error) {
+	return m.VectorSearch(ctx, queryVector, docType, language, limit)
 }
 
@@ -1,15 +1,21 @@
 package main
 
 import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
 	"github.com/fndome/xb"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 )
 
 // ChunkRepository 文档分块仓库接口
 type ChunkRepository interface {
 	Create(chunk *DocumentChunk) error
-	VectorSearch(queryVector []float32, docType, language string, limit int) ([]*DocumentChunk, error)
-	HybridSearch(queryVector []float32, keyword, docType, language string, limit int) ([]*DocumentChunk, error)
+	VectorSearch(ctx context.Context, queryVector []float32, docType, language string, limit int) ([]*DocumentChunk, error)
+	HybridSearch(ctx context.Context, queryVector []float32, keyword, docType, language string, limit int) ([]*DocumentChunk, error)
 }
 
 // ChunkRepositoryImpl 文档分块仓库实现
@@ -23,6 +29,11 @@ func NewChunkRepository(db *sqlx.DB) ChunkRepository {
 
 // Create 创建文档分块
 func (r *ChunkRepositoryImpl) Create(chunk *DocumentChunk) error {
+	return insertChunk(r.db, chunk)
+}
+
+// insertChunk 写入文档分块（db 或事务）
+func insertChunk(db sqlx.Ext, chunk *DocumentChunk) error {
 	sql, args := xb.Of(&DocumentChunk{}).
 		Insert(func(ib *xb.InsertBuilder) {
 			ib.Set("doc_id", chunk.DocID).
@@ -31,17 +42,18 @@ func (r *ChunkRepositoryImpl) Create(chunk *DocumentChunk) error {
 				Set("embedding", chunk.Embedding).
 				Set("doc_type", chunk.DocType).
 				Set("language", chunk.Language).
-				Set("metadata", chunk.Metadata)
+				Set("metadata", chunk.Metadata).
+				Set("search_tokens", strings.Join(SearchTokens(chunk.Content), " "))
 		}).
 		Build().
 		SqlOfInsert()
 
-	_, err := r.db.Exec(sql, args...)
+	_, err := db.Exec(db.Rebind(sql), args...)
 	return err
 }
 
 // VectorSearch 向量搜索
-func (r *ChunkRepositoryImpl) VectorSearch(queryVector []float32, docType, language string, limit int) ([]*DocumentChunk, error) {
+func (r *ChunkRepositoryImpl) VectorSearch(ctx context.Context, queryVector []float32, docType, language string, limit int) ([]*DocumentChunk, error) {
 	sql, args := xb.Of(&DocumentChunk{}).
 		VectorSearch("embedding", queryVector, limit).
 		Eq("doc_type", docType).
@@ -50,7 +62,7 @@ func (r *ChunkRepositoryImpl) VectorSearch(queryVector []float32, docType, langu
 		SqlOfVectorSearch()
 
 	var chunks []*DocumentChunk
-	err := r.db.Select(&chunks, sql, args...)
+	err := r.db.SelectContext(ctx, &chunks, r.db.Rebind(sql), args...)
 	if err != nil {
 		return nil, err
 	}
@@ -58,29 +70,492 @@ func (r *ChunkRepositoryImpl) VectorSearch(queryVector []float32, docType, langu
 }
 
 // HybridSearch 混合搜索（关键词 + 向量）
-func (r *ChunkRepositoryImpl) HybridSearch(queryVector []float32, keyword, docType, language string, limit int) ([]*DocumentChunk, error) {
-	// 先做向量检索（over-fetch）
-	vectorLimit := limit * 3
+// 向量检索与全文检索各召回 limit × hybridOverFetch 个，用 RRF 融合后取前 limit 个；keyword 无有效词项时退化为向量检索
+func (r *ChunkRepositoryImpl) HybridSearch(ctx context.Context, queryVector []float32, keyword, docType, language string, limit int) ([]*DocumentChunk, error) {
+	query := keywordQuery(keyword)
+	if query == "" {
+		return r.VectorSearch(ctx, queryVector, docType, language, limit)
+	}
 
-	sql, args := xb.Of(&DocumentChunk{}).
-		VectorSearch("embedding", queryVector, vectorLimit).
-		Like("content", keyword).
+	vectorChunks, err := r.VectorSearch(ctx, queryVector, docType, language, limit*hybridOverFetch)
+	if err != nil {
+		return nil, err
+	}
+	keywordChunks, err := r.keywordSearch(ctx, query, docType, language, limit*hybridOverFetch)
+	if err != nil {
+		return nil, err
+	}
+
+	return truncateChunks(fuseRRF(vectorChunks, keywordChunks), limit), nil
+}
+
+// keywordSearch 全文检索（按 ts_rank_cd 排序）
+func (r *ChunkRepositoryImpl) keywordSearch(ctx context.Context, query, docType, language string, limit int) ([]*DocumentChunk, error) {
+	chunks := make([]*DocumentChunk, 0)
+	err := r.db.SelectContext(ctx, &chunks, `
+		SELECT c.*, ts_rank_cd(to_tsvector('simple', c.search_tokens), q) AS keyword_rank
+		FROM document_chunks c, to_tsquery('simple', $1) q
+		WHERE to_tsvector('simple', c.search_tokens) @@ q
+		  AND ($2 = '' OR c.doc_type = $2)
+		  AND ($3 = '' OR c.language = $3)
+		ORDER BY keyword_rank DESC, c.id
+		LIMIT $4`,
+		query, docType, language, limit,
+	)
+	return chunks, err
+}
+
+// DocumentRepository 文档仓库接口
+type DocumentRepository interface {
+	// CreateWithChunks 在同一事务中创建文档及其分块
+	CreateWithChunks(doc *Document, chunks []*DocumentChunk) error
+	Get(id int64) (*Document, error)
+	// List 文档列表（不含原文），keyword 按标题模糊匹配
+	List(docType, keyword string) ([]*Document, error)
+	// Delete 删除文档及其分块，文档不存在时返回 sql.ErrNoRows
+	Delete(id int64) error
+	// ReplaceChunks 在同一事务中用新分块替换文档的全部分块，并更新文档的分块参数
+	ReplaceChunks(doc *Document, chunks []*DocumentChunk) error
+	// FindTitles 批量查询文档标题
+	FindTitles(ids []int64) (map[int64]string, error)
+	// UpdateChunkCount 按已写入的分块重新统计 chunk_count
+	UpdateChunkCount(id int64) error
+}
+
+// DocumentRepositoryImpl 文档仓库实现
+type DocumentRepositoryImpl struct {
+	db *sqlx.DB
+}
+
+func NewDocumentRepository(db *sqlx.DB) DocumentRepository {
+	return &DocumentRepositoryImpl{db: db}
+}
+
+// documentListColumns 列表查询的列（不含 content）
+var documentListColumns = []string{
+	"id", "title", "doc_type", "language", "chunker", "chunk_unit", "chunk_size", "chunk_overlap",
+	"embedding_model", "chunk_count", "created_at", "updated_at",
+}
+
+func (r *DocumentRepositoryImpl) CreateWithChunks(doc *Document, chunks []*DocumentChunk) error {
+	return r.withTx(func(tx *sqlx.Tx) error {
+		doc.ChunkCount = len(chunks)
+		err := tx.QueryRowx(`
+			INSERT INTO documents (title, content, doc_type, language, chunker, chunk_unit, chunk_size, chunk_overlap, embedding_model, chunk_count)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+			RETURNING id, created_at, updated_at`,
+			doc.Title, doc.Content, doc.DocType, doc.Language, doc.Chunker, doc.ChunkUnit,
+			doc.ChunkSize, doc.ChunkOverlap, doc.EmbeddingModel, doc.ChunkCount,
+		).Scan(&doc.ID, &doc.CreatedAt, &doc.UpdatedAt)
+		if err != nil {
+			return err
+		}
+
+		return insertChunksTx(tx, doc.ID, chunks)
+	})
+}
+
+func (r *DocumentRepositoryImpl) Get(id int64) (*Document, error) {
+	sql, args, _ := xb.Of(&Document{}).
+		Eq("id", id).
+		Build().
+		SqlOfSelect()
+
+	var doc Document
+	if err := r.db.Get(&doc, r.db.Rebind(sql), args...); err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+func (r *DocumentRepositoryImpl) List(docType, keyword string) ([]*Document, error) {
+	sql, args, _ := xb.Of(&Document{}).
+		Select(documentListColumns...).
 		Eq("doc_type", docType).
-		Eq("language", language).
+		Like("title", keyword).
+		Sort("id", xb.DESC).
 		Build().
-		SqlOfVectorSearch()
+		SqlOfSelect()
 
-	var chunks []*DocumentChunk
-	err := r.db.Select(&chunks, sql, args...)
+	docs := make([]*Document, 0)
+	if err := r.db.Select(&docs, r.db.Rebind(sql), args...); err != nil {
+		return nil, err
+	}
+	return docs, nil
+}
+
+func (r *DocumentRepositoryImpl) Delete(id int64) error {
+	return r.withTx(func(tx *sqlx.Tx) error {
+		for _, stmt := range []string{
+			"DELETE FROM document_chunks WHERE doc_id = $1",
+			"DELETE FROM ingestion_job_items WHERE job_id IN (SELECT id FROM ingestion_jobs WHERE doc_id = $1)",
+			"DELETE FROM ingestion_jobs WHERE doc_id = $1",
+		} {
+			if _, err := tx.Exec(stmt, id); err != nil {
+				return err
+			}
+		}
+
+		result, err := tx.Exec("DELETE FROM documents WHERE id = $1", id)
+		if err != nil {
+			return err
+		}
+		if n, err := result.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return sql.ErrNoRows
+		}
+		return nil
+	})
+}
+
+func (r *DocumentRepositoryImpl) ReplaceChunks(doc *Document, chunks []*DocumentChunk) error {
+	return r.withTx(func(tx *sqlx.Tx) error {
+		if _, err := tx.Exec("DELETE FROM document_chunks WHERE doc_id = $1", doc.ID); err != nil {
+			return err
+		}
+		if err := insertChunksTx(tx, doc.ID, chunks); err != nil {
+			return err
+		}
+
+		doc.ChunkCount = len(chunks)
+		doc.UpdatedAt = time.Now()
+		_, err := tx.Exec(`
+			UPDATE documents
+			SET chunker = $2, chunk_unit = $3, chunk_size = $4, chunk_overlap = $5,
+			    embedding_model = $6, chunk_count = $7, updated_at = $8
+			WHERE id = $1`,
+			doc.ID, doc.Chunker, doc.ChunkUnit, doc.ChunkSize, doc.ChunkOverlap,
+			doc.EmbeddingModel, doc.ChunkCount, doc.UpdatedAt,
+		)
+		return err
+	})
+}
+
+func (r *DocumentRepositoryImpl) FindTitles(ids []int64) (map[int64]string, error) {
+	titles := make(map[int64]string, len(ids))
+	if len(ids) == 0 {
+		return titles, nil
+	}
+
+	vs := make([]interface{}, len(ids))
+	for i, id := range ids {
+		vs[i] = id
+	}
+	sql, args, _ := xb.Of(&Document{}).
+		Select("id", "title").
+		In("id", vs...).
+		Build().
+		SqlOfSelect()
+
+	var docs []*Document
+	if err := r.db.Select(&docs, r.db.Rebind(sql), args...); err != nil {
+		return nil, err
+	}
+	for _, doc := range docs {
+		titles[doc.ID] = doc.Title
+	}
+	return titles, nil
+}
+
+func (r *DocumentRepositoryImpl) UpdateChunkCount(id int64) error {
+	_, err := r.db.Exec(`
+		UPDATE documents
+		SET chunk_count = (SELECT COUNT(*) FROM document_chunks WHERE doc_id = $1), updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1`, id)
+	return err
+}
+
+func (r *DocumentRepositoryImpl) withTx(fn func(tx *sqlx.Tx) error) error {
+	return withTx(r.db, fn)
+}
+
+func withTx(db *sqlx.DB, fn func(tx *sqlx.Tx) error) error {
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func insertChunksTx(tx *sqlx.Tx, docID int64, chunks []*DocumentChunk) error {
+	for _, chunk := range chunks {
+		chunk.DocID = &docID
+		if err := insertChunk(tx, chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// JobRepository 导入任务仓库接口
+type JobRepository interface {
+	// CreateJob 在同一事务中创建任务及其分块
+	CreateJob(job *IngestionJob, items []*IngestionJobItem) error
+	// GetJob 查询任务，附带按分块状态统计的 total / done / failed / pending
+	GetJob(id int64) (*IngestionJob, error)
+	// FindItems 按状态查询任务的分块（status 为空时返回全部），按 chunk_index 排序
+	FindItems(jobID int64, status string) ([]*IngestionJobItem, error)
+	UpdateItem(item *IngestionJobItem) error
+	// CompleteItem 在同一事务中写入分块并更新导入分块的状态
+	CompleteItem(item *IngestionJobItem, chunk *DocumentChunk) error
+	// ResetFailedItems 将失败的分块重置为待处理，返回重置数量
+	ResetFailedItems(jobID int64) (int, error)
+	// TransitionJob 仅当任务当前状态属于 from 时更新状态，返回是否更新
+	TransitionJob(id int64, status, lastError string, from ...string) (bool, error)
+	// FindJobIDsByStatus 查询指定状态的任务 ID（进程重启后恢复）
+	FindJobIDsByStatus(statuses ...string) ([]int64, error)
+}
+
+// JobRepositoryImpl 导入任务仓库实现
+type JobRepositoryImpl struct {
+	db *sqlx.DB
+}
+
+func NewJobRepository(db *sqlx.DB) JobRepository {
+	return &JobRepositoryImpl{db: db}
+}
+
+func (r *JobRepositoryImpl) CreateJob(job *IngestionJob, items []*IngestionJobItem) error {
+	return withTx(r.db, func(tx *sqlx.Tx) error {
+		err := tx.QueryRowx(`
+			INSERT INTO ingestion_jobs (doc_id, status) VALUES ($1, $2)
+			RETURNING id, created_at, updated_at`,
+			job.DocID, job.Status,
+		).Scan(&job.ID, &job.CreatedAt, &job.UpdatedAt)
+		if err != nil {
+			return err
+		}
+
+		for _, item := range items {
+			item.JobID = job.ID
+			if _, err := tx.Exec(`
+				INSERT INTO ingestion_job_items (job_id, chunk_index, content, status) VALUES ($1, $2, $3, $4)`,
+				item.JobID, item.ChunkIndex, item.Content, item.Status,
+			); err != nil {
+				return err
+			}
+		}
+		job.Total = len(items)
+		job.Pending = len(items)
+		return nil
+	})
+}
+
+func (r *JobRepositoryImpl) GetJob(id int64) (*IngestionJob, error) {
+	var job IngestionJob
+	err := r.db.Get(&job, `
+		SELECT j.id, j.doc_id, j.status, j.last_error, j.created_at, j.updated_at, j.finished_at,
+		       COUNT(i.id) AS total,
+		       COUNT(i.id) FILTER (WHERE i.status = $2) AS done,
+		       COUNT(i.id) FILTER (WHERE i.status = $3) AS failed,
+		       COUNT(i.id) FILTER (WHERE i.status = $4) AS pending
+		FROM ingestion_jobs j
+		LEFT JOIN ingestion_job_items i ON i.job_id = j.id
+		WHERE j.id = $1
+		GROUP BY j.id`,
+		id, ItemDone, ItemFailed, ItemPending,
+	)
 	if err != nil {
 		return nil, err
 	}
+	return &job, nil
+}
+
+func (r *JobRepositoryImpl) FindItems(jobID int64, status string) ([]*IngestionJobItem, error) {
+	sql, args, _ := xb.Of(&IngestionJobItem{}).
+		Eq("job_id", jobID).
+		Eq("status", status).
+		Sort("chunk_index", xb.ASC).
+		Build().
+		SqlOfSelect()
+
+	items := make([]*IngestionJobItem, 0)
+	if err := r.db.Select(&items, r.db.Rebind(sql), args...); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func (r *JobRepositoryImpl) UpdateItem(item *IngestionJobItem) error {
+	return updateItem(r.db, item)
+}
 
-	// 在应用层做重排序（BM25 + Vector Score）
-	// 这里简化处理，实际应用中可以使用更复杂的重排序算法
-	if len(chunks) > limit {
-		chunks = chunks[:limit]
+func (r *JobRepositoryImpl) CompleteItem(item *IngestionJobItem, chunk *DocumentChunk) error {
+	return withTx(r.db, func(tx *sqlx.Tx) error {
+		if err := insertChunk(tx, chunk); err != nil {
+			return err
+		}
+		return updateItem(tx, item)
+	})
+}
+
+func updateItem(db sqlx.Execer, item *IngestionJobItem) error {
+	_, err := db.Exec(`
+		UPDATE ingestion_job_items SET status = $2, error = $3, attempts = $4, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1`,
+		item.ID, item.Status, item.Error, item.Attempts,
+	)
+	return err
+}
+
+func (r *JobRepositoryImpl) ResetFailedItems(jobID int64) (int, error) {
+	result, err := r.db.Exec(`
+		UPDATE ingestion_job_items SET status = $2, error = '', updated_at = CURRENT_TIMESTAMP
+		WHERE job_id = $1 AND status = $3`,
+		jobID, ItemPending, ItemFailed,
+	)
+	if err != nil {
+		return 0, err
 	}
+	n, err := result.RowsAffected()
+	return int(n), err
+}
 
-	return chunks, nil
+func (r *JobRepositoryImpl) TransitionJob(id int64, status, lastError string, from ...string) (bool, error) {
+	result, err := r.db.Exec(`
+		UPDATE ingestion_jobs
+		SET status = $2, last_error = $3, updated_at = CURRENT_TIMESTAMP,
+		    finished_at = CASE WHEN $4 THEN CURRENT_TIMESTAMP END
+		WHERE id = $1 AND status = ANY($5)`,
+		id, status, lastError, isJobFinished(status), pq.Array(from),
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+func (r *JobRepositoryImpl) FindJobIDsByStatus(statuses ...string) ([]int64, error) {
+	ids := make([]int64, 0)
+	err := r.db.Select(&ids, "SELECT id FROM ingestion_jobs WHERE status = ANY($1) ORDER BY id", pq.Array(statuses))
+	return ids, err
+}
+
+// SessionRepository 对话会话仓库接口
+type SessionRepository interface {
+	CreateSession(session *Session) error
+	// GetSession 查询会话（不含消息），附带消息数
+	GetSession(id int64) (*Session, error)
+	// ListSessions 会话列表（不含消息），按最近更新排序
+	ListSessions() ([]*Session, error)
+	// DeleteSession 删除会话及其消息，会话不存在时返回 sql.ErrNoRows
+	DeleteSession(id int64) error
+	// FindMessages 查询 ID 大于 afterID 的消息（afterID 为 0 时返回全部），按 ID 排序
+	FindMessages(sessionID, afterID int64) ([]*SessionMessage, error)
+	// AppendMessages 在同一事务中追加消息并更新会话时间，title 非空且会话尚无标题时一并写入
+	AppendMessages(sessionID int64, title string, messages ...*SessionMessage) error
+	// UpdateSummary 更新会话摘要及已并入摘要的最后一条消息 ID
+	UpdateSummary(id int64, summary string, until int64) error
+}
+
+// SessionRepositoryImpl 对话会话仓库实现
+type SessionRepositoryImpl struct {
+	db *sqlx.DB
+}
+
+func NewSessionRepository(db *sqlx.DB) SessionRepository {
+	return &SessionRepositoryImpl{db: db}
+}
+
+// sessionColumns 会话字段及消息数
+const sessionColumns = `
+	SELECT s.id, s.title, s.summary, s.summarized_until, s.created_at, s.updated_at,
+	       (SELECT COUNT(*) FROM session_messages m WHERE m.session_id = s.id) AS message_count
+	FROM sessions s`
+
+func (r *SessionRepositoryImpl) CreateSession(session *Session) error {
+	return r.db.QueryRowx(`
+		INSERT INTO sessions (title) VALUES ($1)
+		RETURNING id, created_at, updated_at`,
+		session.Title,
+	).Scan(&session.ID, &session.CreatedAt, &session.UpdatedAt)
+}
+
+func (r *SessionRepositoryImpl) GetSession(id int64) (*Session, error) {
+	var session Session
+	if err := r.db.Get(&session, sessionColumns+" WHERE s.id = $1", id); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (r *SessionRepositoryImpl) ListSessions() ([]*Session, error) {
+	sessions := make([]*Session, 0)
+	if err := r.db.Select(&sessions, sessionColumns+" ORDER BY s.updated_at DESC, s.id DESC"); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+func (r *SessionRepositoryImpl) DeleteSession(id int64) error {
+	return withTx(r.db, func(tx *sqlx.Tx) error {
+		if _, err := tx.Exec("DELETE FROM session_messages WHERE session_id = $1", id); err != nil {
+			return err
+		}
+
+		result, err := tx.Exec("DELETE FROM sessions WHERE id = $1", id)
+		if err != nil {
+			return err
+		}
+		if n, err := result.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return sql.ErrNoRows
+		}
+		return nil
+	})
+}
+
+func (r *SessionRepositoryImpl) FindMessages(sessionID, afterID int64) ([]*SessionMessage, error) {
+	sql, args, _ := xb.Of(&SessionMessage{}).
+		Eq("session_id", sessionID).
+		Gt("id", afterID).
+		Sort("id", xb.ASC).
+		Build().
+		SqlOfSelect()
+
+	messages := make([]*SessionMessage, 0)
+	if err := r.db.Select(&messages, r.db.Rebind(sql), args...); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+func (r *SessionRepositoryImpl) AppendMessages(sessionID int64, title string, messages ...*SessionMessage) error {
+	return withTx(r.db, func(tx *sqlx.Tx) error {
+		for _, message := range messages {
+			message.SessionID = sessionID
+			err := tx.QueryRowx(`
+				INSERT INTO session_messages (session_id, role, content, rewritten) VALUES ($1, $2, $3, $4)
+				RETURNING id, created_at`,
+				message.SessionID, message.Role, message.Content, message.Rewritten,
+			).Scan(&message.ID, &message.CreatedAt)
+			if err != nil {
+				return err
+			}
+		}
+
+		_, err := tx.Exec(`
+			UPDATE sessions
+			SET title = CASE WHEN title = '' THEN $2 ELSE title END, updated_at = CURRENT_TIMESTAMP
+			WHERE id = $1`,
+			sessionID, title,
+		)
+		return err
+	})
+}
+
+func (r *SessionRepositoryImpl) UpdateSummary(id int64, summary string, until int64) error {
+	_, err := r.db.Exec(`
+		UPDATE sessions SET summary = $2, summarized_until = $3, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1`,
+		id, summary, until,
+	)
+	return err
 }
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"context"
+	"strings"
 	"testing"
 
 	"github.com/fndome/xb"
@@ -20,19 +22,76 @@ func setupRAGTestDB(t *testing.T) *sqlx.DB {
 
 	_, err = db.Exec(`
 		CREATE EXTENSION IF NOT EXISTS vector;
+		DROP TABLE IF EXISTS session_messages;
+		DROP TABLE IF EXISTS sessions;
+		DROP TABLE IF EXISTS ingestion_job_items;
+		DROP TABLE IF EXISTS ingestion_jobs;
 		DROP TABLE IF EXISTS document_chunks;
+		DROP TABLE IF EXISTS documents;
+		CREATE TABLE documents (
+			id BIGSERIAL PRIMARY KEY,
+			title VARCHAR(500) NOT NULL,
+			content TEXT NOT NULL,
+			doc_type VARCHAR(50),
+			language VARCHAR(10),
+			chunker VARCHAR(20),
+			chunk_unit VARCHAR(10),
+			chunk_size INT,
+			chunk_overlap INT,
+			embedding_model VARCHAR(100),
+			chunk_count INT DEFAULT 0,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);
 		CREATE TABLE document_chunks (
 			id BIGSERIAL PRIMARY KEY,
-			doc_id BIGINT,
+			doc_id BIGINT REFERENCES documents(id) ON DELETE CASCADE,
 			chunk_id INT,
 			content TEXT,
 			embedding vector(768),
 			doc_type VARCHAR(50),
 			language VARCHAR(10),
 			metadata JSONB,
+			search_tokens TEXT NOT NULL DEFAULT '',
 			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 		);
 		CREATE INDEX ON document_chunks USING ivfflat (embedding vector_cosine_ops);
+		CREATE INDEX ON document_chunks USING gin (to_tsvector('simple', search_tokens));
+		CREATE TABLE ingestion_jobs (
+			id BIGSERIAL PRIMARY KEY,
+			doc_id BIGINT REFERENCES documents(id) ON DELETE CASCADE,
+			status VARCHAR(20) NOT NULL,
+			last_error TEXT DEFAULT '',
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			finished_at TIMESTAMP
+		);
+		CREATE TABLE ingestion_job_items (
+			id BIGSERIAL PRIMARY KEY,
+			job_id BIGINT REFERENCES ingestion_jobs(id) ON DELETE CASCADE,
+			chunk_index INT NOT NULL,
+			content TEXT NOT NULL,
+			status VARCHAR(20) NOT NULL,
+			error TEXT DEFAULT '',
+			attempts INT DEFAULT 0,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE TABLE sessions (
+			id BIGSERIAL PRIMARY KEY,
+			title VARCHAR(200) NOT NULL DEFAULT '',
+			summary TEXT NOT NULL DEFAULT '',
+			summarized_until BIGINT NOT NULL DEFAULT 0,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE TABLE session_messages (
+			id BIGSERIAL PRIMARY KEY,
+			session_id BIGINT REFERENCES sessions(id) ON DELETE CASCADE,
+			role VARCHAR(20) NOT NULL,
+			content TEXT NOT NULL,
+			rewritten TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);
 	`)
 	if err != nil {
 		t.Fatalf("Failed to create test table: %v", err)
@@ -96,7 +155,7 @@ func TestVectorSearchWithFiltering(t *testing.T) {
 
 	// 测试向量搜索 + 过滤
 	queryVector := make([]float32, 768)
-	results, err := repo.VectorSearch(queryVector, "article", "zh", 10)
+	results, err := repo.VectorSearch(context.Background(), queryVector, "article", "zh", 10)
 	if err != nil {
 		t.Fatalf("VectorSearch failed: %v", err)
 	}
@@ -130,7 +189,7 @@ func TestHybridSearchAutoFiltering(t *testing.T) {
 	var emptyDocType string
 	var emptyLanguage string
 
-	results, err := repo.HybridSearch(queryVector, emptyKeyword, emptyDocType, emptyLanguage, 10)
+	results, err := repo.HybridSearch(context.Background(), queryVector, emptyKeyword, emptyDocType, emptyLanguage, 10)
 	if err != nil {
 		t.Fatalf("HybridSearch failed: %v", err)
 	}
@@ -138,3 +197,42 @@ func TestHybridSearchAutoFiltering(t *testing.T) {
 	// 应该成功执行，空字符串被自动过滤
 	t.Logf("HybridSearch with auto-filtering: found %d results", len(results))
 }
+
+func TestHybridSearchKeywordFusion(t *testing.T) {
+	db := setupRAGTestDB(t)
+	if db == nil {
+		return
+	}
+	defer db.Close()
+
+	repo := NewChunkRepository(db)
+	for i, content := range []string{
+		"Goroutine 是 Go 语言的轻量级线程。",
+		"Channel 用于 Goroutine 之间通信。",
+		"Rust 通过所有权保证内存安全。",
+	} {
+		embedding := make([]float32, 768)
+		embedding[i] = 1
+		if err := repo.Create(&DocumentChunk{Content: content, Embedding: embedding, DocType: "article", Metadata: "{}"}); err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+	}
+
+	// 查询向量最接近 Rust 分块，关键词命中 Channel 分块
+	queryVector := make([]float32, 768)
+	queryVector[2] = 1
+	results, err := repo.HybridSearch(context.Background(), queryVector, "通信 channel", "article", "", 2)
+	if err != nil {
+		t.Fatalf("HybridSearch failed: %v", err)
+	}
+	if len(results) != 2 || results[0].RRFScore == 0 {
+		t.Fatalf("Expected 2 fused results, got %+v", results)
+	}
+	found := false
+	for _, chunk := range results {
+		found = found || strings.Contains(chunk.Content, "Channel")
+	}
+	if !found {
+		t.Errorf("Expected keyword match to be fused into results, got %+v", results)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"sort"
+
+	"rag-app/integrations/rerank"
+)
+
+// rerankOverFetch 启用 Reranker 时召回 topK 的倍数作为候选
+const rerankOverFetch = 4
+
+// Reranker 重排序服务
+// integrations/rerank 的 CohereRerankClient、BGERerankClient 均实现该接口
+type Reranker interface {
+	Rerank(ctx context.Context, query string, documents []string, topK int) ([]rerank.RerankResult, error)
+}
+
+// candidateK 召回的候选数量：启用 Reranker 时过度召回
+func candidateK(reranker Reranker, topK int) int {
+	if reranker == nil {
+		return topK
+	}
+	return topK * rerankOverFetch
+}
+
+// rerankChunks 用 Reranker 对候选重排并保留前 topK 个，分数记录在 RerankScore
+// reranker 为 nil 时按原顺序截断；重排失败时同样按原顺序截断，并返回错误供调用方记录
+func rerankChunks(ctx context.Context, reranker Reranker, query string, chunks []*DocumentChunk, topK int) ([]*DocumentChunk, error) {
+	if reranker == nil || len(chunks) == 0 {
+		return truncateChunks(chunks, topK), nil
+	}
+
+	documents := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		documents[i] = chunk.Content
+	}
+	results, err := reranker.Rerank(ctx, query, documents, topK)
+	if err != nil {
+		return truncateChunks(chunks, topK), err
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].RelevanceScore > results[j].RelevanceScore
+	})
+	reranked := make([]*DocumentChunk, 0, topK)
+	seen := make(map[int]bool)
+	for _, result := range results {
+		if result.Index < 0 || result.Index >= len(chunks) || seen[result.Index] {
+			continue
+		}
+		seen[result.Index] = true
+		score := result.RelevanceScore
+		chunk := chunks[result.Index]
+		chunk.RerankScore = &score
+		reranked = append(reranked, chunk)
+	}
+	return truncateChunks(reranked, topK), nil
+}
+
+func truncateChunks(chunks []*DocumentChunk, topK int) []*DocumentChunk {
+	if len(chunks) <= topK {
+		return chunks
+	}
+	return chunks[:topK]
+}
+
+// rerankMetadata 记录是否经过重排，失败时附带错误
+func rerankMetadata(metadata map[string]interface{}, reranker Reranker, err error) {
+	metadata["reranked"] = reranker != nil && err == nil
+	if err != nil {
+		metadata["rerank_error"] = err.Error()
+	}
+}
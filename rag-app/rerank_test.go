@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"rag-app/integrations/rerank"
+)
+
+// newRerankServer 进程内的 BGE 格式 Rerank 服务：含 Channel 的文档得分最高
+// status 非 200 时模拟服务故障
+func newRerankServer(t *testing.T, status int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if status != http.StatusOK {
+			http.Error(w, "model overloaded", status)
+			return
+		}
+
+		var req struct {
+			Query     string   `json:"query"`
+			Documents []string `json:"documents"`
+			TopK      int      `json:"top_k"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("Invalid rerank request: %v", err)
+		}
+
+		type result struct {
+			Index int     `json:"index"`
+			Score float64 `json:"score"`
+		}
+		results := make([]result, 0, len(req.Documents))
+		for i, doc := range req.Documents {
+			score := 0.1 * float64(i)
+			if strings.Contains(doc, "Channel") {
+				score = 0.9
+			}
+			results = append(results, result{Index: i, Score: score})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"results": results})
+	}))
+}
+
+// limitRecordingRepository 记录每次检索的 limit 与混合检索的关键词
+type limitRecordingRepository struct {
+	MockChunkRepositoryImpl
+	mu       sync.Mutex
+	limits   []int
+	keywords []string // HybridSearch 收到的关键词
+}
+
+func (r *limitRecordingRepository) VectorSearch(ctx context.Context, queryVector []float32, docType, language string, limit int) ([]*DocumentChunk, error) {
+	r.mu.Lock()
+	r.limits = append(r.limits, limit)
+	r.mu.Unlock()
+	return r.MockChunkRepositoryImpl.VectorSearch(ctx, queryVector, docType, language, limit)
+}
+
+func (r *limitRecordingRepository) HybridSearch(ctx context.Context, queryVector []float32, keyword, docType, language string, limit int) ([]*DocumentChunk, error) {
+	r.mu.Lock()
+	r.keywords = append(r.keywords, keyword)
+	r.mu.Unlock()
+	return r.VectorSearch(ctx, queryVector, docType, language, limit)
+}
+
+func TestRAGServiceRerank(t *testing.T) {
+	server := newRerankServer(t, http.StatusOK)
+	defer server.Close()
+
+	repo := &limitRecordingRepository{}
+	reranker := rerank.NewBGERerankClient(rerank.BGEConfig{BaseURL: server.URL})
+	service := NewRAGService(repo, nil, &MockEmbeddingService{}, &MockLLMService{}, reranker)
+
+	topK := 2
+	resp, err := service.Query(context.Background(), RAGQueryRequest{Question: "什么是 Channel？", TopK: &topK})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(repo.limits) != 1 || repo.limits[0] != topK*rerankOverFetch {
+		t.Errorf("Expected over-fetch of %d candidates, got %v", topK*rerankOverFetch, repo.limits)
+	}
+	if len(resp.Sources) != 2 || resp.Sources[0].ID != 3 || resp.Sources[1].ID != 2 {
+		t.Fatalf("Expected sources reordered by rerank score, got %+v", resp.Sources)
+	}
+	if score := resp.Sources[0].RerankScore; score == nil || *score != 0.9 {
+		t.Errorf("Expected rerank score 0.9 on top source, got %v", score)
+	}
+	if resp.Metadata["reranked"] != true || resp.Metadata["candidates"] != 3 {
+		t.Errorf("Unexpected metadata %v", resp.Metadata)
+	}
+}
+
+func TestRerankFallsBackOnFailure(t *testing.T) {
+	server := newRerankServer(t, http.StatusServiceUnavailable)
+	defer server.Close()
+
+	reranker := rerank.NewBGERerankClient(rerank.BGEConfig{BaseURL: server.URL})
+	ragService := NewRAGService(&MockChunkRepositoryImpl{}, nil, &MockEmbeddingService{}, &MockLLMService{}, reranker)
+
+	topK := 2
+	resp, err := ragService.Query(context.Background(), RAGQueryRequest{Question: "什么是 Channel？", TopK: &topK})
+	if err != nil {
+		t.Fatalf("Expected query to succeed without reranker, got %v", err)
+	}
+	if len(resp.Sources) != 2 || resp.Sources[0].ID != 1 || resp.Sources[0].RerankScore != nil {
+		t.Errorf("Expected vector order fallback, got %+v", resp.Sources)
+	}
+	if resp.Metadata["reranked"] != false || !strings.Contains(resp.Metadata["rerank_error"].(string), "503") {
+		t.Errorf("Expected rerank error in metadata, got %v", resp.Metadata)
+	}
+
+	agentic := NewAgenticRAGService(ragService, reranker)
+	resp, err = agentic.Query(context.Background(), RAGQueryRequest{Question: "Go 和 Rust 在并发编程上有什么区别？", TopK: &topK})
+	if err != nil {
+		t.Fatalf("Expected agentic query to succeed without reranker, got %v", err)
+	}
+	if len(resp.Sources) != 2 || resp.Metadata["rerank_error"] == nil {
+		t.Errorf("Expected truncated sources with rerank error, got %d sources, metadata %v", len(resp.Sources), resp.Metadata)
+	}
+
+	refrag := NewREFRAGService(&MockChunkRepositoryImpl{}, &MockEmbeddingService{}, &MockLLMService{}, reranker)
+	refragResp, err := refrag.Query(context.Background(), REFRAGQueryRequest{Question: "什么是 Channel？", ExpandK: 1})
+	if err != nil {
+		t.Fatalf("Expected REFRAG query to succeed without reranker, got %v", err)
+	}
+	if len(refragResp.ExpandedChunks) != 1 || refragResp.Metadata["reranked"] != false {
+		t.Errorf("Expected heuristic scoring fallback, got %+v", refragResp.Metadata)
+	}
+}
+
+func TestAgenticRAGRerank(t *testing.T) {
+	server := newRerankServer(t, http.StatusOK)
+	defer server.Close()
+
+	repo := &limitRecordingRepository{}
+	reranker := rerank.NewBGERerankClient(rerank.BGEConfig{BaseURL: server.URL})
+	ragService := NewRAGService(repo, nil, &MockEmbeddingService{}, &MockLLMService{}, nil)
+	agentic := NewAgenticRAGService(ragService, reranker)
+
+	topK := 1
+	resp, err := agentic.Query(context.Background(), RAGQueryRequest{Question: "Go 和 Rust 在并发编程上有什么区别？", TopK: &topK})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	for _, limit := range repo.limits {
+		if limit != 3*rerankOverFetch {
+			t.Errorf("Expected each round to over-fetch %d candidates, got %v", 3*rerankOverFetch, repo.limits)
+			break
+		}
+	}
+	if len(resp.Sources) != 1 || resp.Sources[0].ID != 3 || resp.Metadata["reranked"] != true {
+		t.Errorf("Expected Channel chunk ranked first, got %+v, metadata %v", resp.Sources, resp.Metadata)
+	}
+}
+
+func TestREFRAGRerankScores(t *testing.T) {
+	server := newRerankServer(t, http.StatusOK)
+	defer server.Close()
+
+	reranker := rerank.NewBGERerankClient(rerank.BGEConfig{BaseURL: server.URL})
+	service := NewREFRAGService(&MockChunkRepositoryImpl{}, &MockEmbeddingService{}, &MockLLMService{}, reranker)
+
+	resp, err := service.Query(context.Background(), REFRAGQueryRequest{Question: "什么是 Channel？", ExpandK: 1})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	expanded := resp.ExpandedChunks
+	if len(expanded) != 1 || expanded[0].OriginalChunk.ID != 3 || expanded[0].Score != 0.9 {
+		t.Errorf("Expected Channel chunk expanded with rerank score, got %+v", expanded)
+	}
+	if len(resp.CompressedChunks) != 2 || resp.Metadata["reranked"] != true {
+		t.Errorf("Unexpected compressed chunks or metadata: %d, %v", len(resp.CompressedChunks), resp.Metadata)
+	}
+}
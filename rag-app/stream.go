@@ -0,0 +1,60 @@
+package main
+
+import "context"
+
+// SSE 事件类型
+const (
+	EventPlan    = "plan"    // 查询计划（Agentic RAG）
+	EventHop     = "hop"     // 多跳检索每一跳的轨迹
+	EventSources = "sources" // 检索到的文档分块
+	EventToken   = "token"   // 答案增量
+	EventDone    = "done"    // 最终 metadata
+	EventError   = "error"   // 查询失败
+)
+
+// StreamEmitter 流式查询的事件回调，返回错误时中止查询（如客户端断开）
+// nil 表示非流式查询，Emit 不做任何事
+type StreamEmitter func(event string, data interface{}) error
+
+// Emit 推送事件
+func (e StreamEmitter) Emit(event string, data interface{}) error {
+	if e == nil {
+		return nil
+	}
+	return e(event, data)
+}
+
+// TokenEvent 答案增量
+type TokenEvent struct {
+	Delta string `json:"delta"`
+}
+
+// DoneEvent 流式查询结束
+type DoneEvent struct {
+	Answer   string                 `json:"answer"`
+	Segments []AnswerSegment        `json:"segments,omitempty"`
+	Metadata map[string]interface{} `json:"metadata"`
+}
+
+// generate 调用 LLM 生成答案
+// 流式查询时优先使用 StreamingLLMService 逐段推送 token；LLM 不支持流式时把完整答案作为一个 token 推送
+func generate(ctx context.Context, llm LLMService, prompt string, emit StreamEmitter) (string, error) {
+	if emit == nil {
+		return llm.Generate(ctx, prompt)
+	}
+
+	if streaming, ok := llm.(StreamingLLMService); ok {
+		return streaming.GenerateStream(ctx, prompt, func(delta string) error {
+			return emit.Emit(EventToken, TokenEvent{Delta: delta})
+		})
+	}
+
+	answer, err := llm.Generate(ctx, prompt)
+	if err != nil {
+		return "", err
+	}
+	if err := emit.Emit(EventToken, TokenEvent{Delta: answer}); err != nil {
+		return "", err
+	}
+	return answer, nil
+}
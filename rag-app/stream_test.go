@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// sseEvent 解析后的 SSE 事件
+type sseEvent struct {
+	Event string
+	Data  string
+}
+
+func parseSSE(body string) []sseEvent {
+	var events []sseEvent
+	for _, block := range strings.Split(body, "\n\n") {
+		var ev sseEvent
+		for _, line := range strings.Split(block, "\n") {
+			switch {
+			case strings.HasPrefix(line, "event:"):
+				ev.Event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+			case strings.HasPrefix(line, "data:"):
+				ev.Data += strings.TrimPrefix(line, "data:")
+			}
+		}
+		if ev.Event != "" {
+			events = append(events, ev)
+		}
+	}
+	return events
+}
+
+func streamQuery(t *testing.T, body string) []sseEvent {
+	gin.SetMode(gin.TestMode)
+	ragService := NewRAGService(&MockChunkRepositoryImpl{}, nil, &MockEmbeddingService{}, &MockLLMService{}, nil)
+	r := gin.New()
+	r.POST("/rag/query", RAGQueryHandler(ragService, NewAgenticRAGService(ragService, nil), nil))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/rag/query?stream=true", strings.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/event-stream") {
+		t.Errorf("Expected text/event-stream, got %q", ct)
+	}
+	return parseSSE(w.Body.String())
+}
+
+func TestRAGQueryHandlerStreamAgentic(t *testing.T) {
+	events := streamQuery(t, `{"question": "Go 和 Rust 在并发编程上有什么区别？"}`)
+
+	if len(events) < 4 {
+		t.Fatalf("Expected plan, sources, tokens and done, got %+v", events)
+	}
+	if events[0].Event != EventPlan || events[1].Event != EventSources || events[len(events)-1].Event != EventDone {
+		t.Errorf("Unexpected event order: %+v", events)
+	}
+
+	var answer strings.Builder
+	for _, ev := range events[2 : len(events)-1] {
+		if ev.Event != EventToken {
+			t.Fatalf("Expected token event, got %s", ev.Event)
+		}
+		var token TokenEvent
+		if err := json.Unmarshal([]byte(ev.Data), &token); err != nil {
+			t.Fatalf("Invalid token data %q: %v", ev.Data, err)
+		}
+		answer.WriteString(token.Delta)
+	}
+
+	var done DoneEvent
+	if err := json.Unmarshal([]byte(events[len(events)-1].Data), &done); err != nil {
+		t.Fatalf("Invalid done data: %v", err)
+	}
+	if answer.String() != done.Answer || done.Answer == "" {
+		t.Errorf("Expected tokens to add up to the answer, got %q vs %q", answer.String(), done.Answer)
+	}
+	if done.Metadata["mode"] != "agentic_rag_v3" {
+		t.Errorf("Expected agentic metadata, got %+v", done.Metadata)
+	}
+}
+
+func TestRAGQueryHandlerStreamSimple(t *testing.T) {
+	events := streamQuery(t, `{"question": "什么是 Channel？", "use_agentic": false}`)
+
+	if len(events) < 3 || events[0].Event != EventSources || events[len(events)-1].Event != EventDone {
+		t.Errorf("Unexpected events for first-generation RAG: %+v", events)
+	}
+}
+
+// plainLLM 不支持流式的 LLM
+type plainLLM struct{ answer string }
+
+func (l *plainLLM) Generate(ctx context.Context, prompt string) (string, error) {
+	return l.answer, nil
+}
+
+func TestGenerateFallsBackWithoutStreaming(t *testing.T) {
+	var events []string
+	emit := func(event string, data interface{}) error {
+		events = append(events, event+":"+data.(TokenEvent).Delta)
+		return nil
+	}
+
+	answer, err := generate(context.Background(), &plainLLM{answer: "完整答案"}, "prompt", emit)
+	if err != nil || answer != "完整答案" {
+		t.Fatalf("Unexpected answer %q, err %v", answer, err)
+	}
+	if len(events) != 1 || events[0] != "token:完整答案" {
+		t.Errorf("Expected a single token event, got %v", events)
+	}
+
+	stop := errors.New("client gone")
+	_, err = generate(context.Background(), &MockLLMService{}, "prompt", func(string, interface{}) error { return stop })
+	if !errors.Is(err, stop) {
+		t.Errorf("Expected emitter error to abort generation, got %v", err)
+	}
+}